@@ -0,0 +1,234 @@
+// Package api mounts the route tables of the services. Every version of the
+// API is a Routes table served under /api/<version>, the layout from before
+// /api/v1 stays available at the root with deprecation headers until its
+// sunset. A new version starts as a copy of the previous table with the
+// routes whose shape changes replaced:
+//
+//	v1 := rute(...)
+//	a.Version("v1", v1, nil)
+//	a.Version("v2", v1.With(api.Route{Method: http.MethodGet, Path: "/pegawai/:id", Handler: h.GetPegawaiV2}), nil)
+//
+// Handlers shared by several versions can ask for the one being served with
+// Version(ctx).
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"uas/openapi"
+)
+
+// Prefix is where the versions are mounted.
+const Prefix = "/api"
+
+// HeaderVersion names the version that served a response, empty for the
+// unversioned root routes.
+const HeaderVersion = "API-Version"
+
+const versionKey = "api_version"
+
+// Route is one entry of a route table.
+type Route struct {
+	Method     string
+	Path       string
+	Handler    echo.HandlerFunc
+	Middleware []echo.MiddlewareFunc
+	Doc        openapi.Operation
+	// Successor is the path of the route replacing this one in the version
+	// named by the Deprecation, when it is not Path itself.
+	Successor string
+}
+
+type Routes []Route
+
+// With returns a copy of rs where every route in replace takes the place of
+// the route with the same method and path, or is added when there is none.
+func (rs Routes) With(replace ...Route) Routes {
+	out := append(Routes{}, rs...)
+	for _, r := range replace {
+		i := out.index(r.Method, r.Path)
+		if i < 0 {
+			out = append(out, r)
+			continue
+		}
+		out[i] = r
+	}
+	return out
+}
+
+// Without returns a copy of rs without the route method path.
+func (rs Routes) Without(method, path string) Routes {
+	out := append(Routes{}, rs...)
+	if i := out.index(method, path); i >= 0 {
+		out = append(out[:i], out[i+1:]...)
+	}
+	return out
+}
+
+// GuardWrites returns a copy of rs where every route but GET runs
+// middleware first and is documented as needing a login with one of peran.
+func (rs Routes) GuardWrites(peran []string, middleware ...echo.MiddlewareFunc) Routes {
+	out := append(Routes{}, rs...)
+	for i, r := range out {
+		if r.Method == http.MethodGet {
+			continue
+		}
+		out[i].Middleware = append(append([]echo.MiddlewareFunc{}, middleware...), r.Middleware...)
+		out[i].Doc.Auth, out[i].Doc.Peran = true, peran
+	}
+	return out
+}
+
+func (rs Routes) index(method, path string) int {
+	for i, r := range rs {
+		if r.Method == method && r.Path == path {
+			return i
+		}
+	}
+	return -1
+}
+
+// Deprecation announces that routes go away. Since and Sunset are sent as
+// the Deprecation (RFC 9745) and Sunset (RFC 8594) headers, Successor names
+// the version that replaces them in a Link header.
+type Deprecation struct {
+	Since     time.Time
+	Sunset    time.Time
+	Successor string
+}
+
+// RootDeprecation is the schedule of the unversioned root routes, the ones
+// the services served before /api/v1.
+var RootDeprecation = Deprecation{
+	Since:     time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC),
+	Sunset:    time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC),
+	Successor: "v1",
+}
+
+// API mounts route tables on an Echo instance and documents them in spec.
+type API struct {
+	e    *echo.Echo
+	spec *openapi.Spec
+}
+
+func New(e *echo.Echo, spec *openapi.Spec) *API {
+	return &API{e: e, spec: spec}
+}
+
+// Version serves routes under /api/<name>, dep is nil for a current version.
+func (a *API) Version(name string, routes Routes, dep *Deprecation) {
+	a.mount(Prefix+"/"+name, name, routes, dep, "")
+}
+
+// Unversioned serves routes at the root, the layout from before /api/v1,
+// deprecated by dep.
+func (a *API) Unversioned(routes Routes, dep Deprecation) {
+	a.mount("", "", routes, &dep, "Unversioned (deprecated)")
+}
+
+// Root serves routes at the root without a version, for the operational
+// routes like /healthz that are not part of the API itself.
+func (a *API) Root(routes Routes) {
+	a.mount("", "", routes, nil, "")
+}
+
+func (a *API) mount(prefix, version string, routes Routes, dep *Deprecation, tag string) {
+	for _, r := range routes {
+		middleware := []echo.MiddlewareFunc{versi(version)}
+		if dep != nil {
+			middleware = append(middleware, deprecated(*dep, r))
+		}
+		middleware = append(middleware, r.Middleware...)
+		a.e.Add(r.Method, prefix+r.Path, r.Handler, middleware...)
+
+		if a.spec == nil {
+			continue
+		}
+		doc := r.Doc
+		doc.Deprecated = dep != nil
+		if tag != "" {
+			doc.Tag = tag
+		}
+		if dep != nil {
+			note := "Deprecated, use " + successor(*dep, r) + " instead."
+			if !dep.Sunset.IsZero() {
+				note = fmt.Sprintf("Deprecated, removed after %s. Use %s instead.", dep.Sunset.Format("2006-01-02"), successor(*dep, r))
+			}
+			doc.Description = strings.TrimSpace(note + "\n\n" + doc.Description)
+		}
+		a.spec.Add(r.Method, prefix+r.Path, doc)
+	}
+}
+
+// Version returns the version that serves ctx, empty for the root routes.
+func Version(ctx echo.Context) string {
+	v, _ := ctx.Get(versionKey).(string)
+	return v
+}
+
+func versi(version string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			ctx.Set(versionKey, version)
+			if version != "" {
+				ctx.Response().Header().Set(HeaderVersion, version)
+			}
+			return next(ctx)
+		}
+	}
+}
+
+// successor is the path pattern of the route replacing r.
+func successor(dep Deprecation, r Route) string {
+	path := r.Successor
+	if path == "" {
+		path = r.Path
+	}
+	if dep.Successor != "" {
+		path = Prefix + "/" + dep.Successor + path
+	}
+	return path
+}
+
+func deprecated(dep Deprecation, r Route) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			h := ctx.Response().Header()
+			if dep.Since.IsZero() {
+				h.Set("Deprecation", "true")
+			} else {
+				h.Set("Deprecation", fmt.Sprintf("@%d", dep.Since.Unix()))
+			}
+			if !dep.Sunset.IsZero() {
+				h.Set("Sunset", dep.Sunset.UTC().Format(http.TimeFormat))
+			}
+			if dep.Successor != "" {
+				h.Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, isi(ctx, successor(dep, r))))
+			}
+			return next(ctx)
+		}
+	}
+}
+
+// isi fills the :params of path from the request, the ones it does not
+// have are left as {name}.
+func isi(ctx echo.Context, path string) string {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		name, ok := strings.CutPrefix(seg, ":")
+		if !ok {
+			continue
+		}
+		if v := ctx.Param(name); v != "" {
+			segments[i] = v
+		} else {
+			segments[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
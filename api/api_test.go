@@ -0,0 +1,157 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"uas/api"
+	"uas/apperror"
+	"uas/openapi"
+	"uas/testutil"
+)
+
+func versi(ctx echo.Context) error {
+	return ctx.String(http.StatusOK, api.Version(ctx))
+}
+
+func TestRoutes(t *testing.T) {
+	rs := api.Routes{
+		{Method: http.MethodGet, Path: "/a"},
+		{Method: http.MethodPut, Path: "/a"},
+	}
+	ganti := rs.With(api.Route{Method: http.MethodPut, Path: "/a", Successor: "/a/:id"}, api.Route{Method: http.MethodGet, Path: "/b"})
+	if len(ganti) != 3 || ganti[1].Successor != "/a/:id" || ganti[2].Path != "/b" {
+		t.Errorf("With gave %+v", ganti)
+	}
+	if rs[1].Successor != "" {
+		t.Error("With changed the table it copied")
+	}
+	tanpa := rs.Without(http.MethodGet, "/a")
+	if len(tanpa) != 1 || tanpa[0].Method != http.MethodPut || len(rs) != 2 {
+		t.Errorf("Without gave %+v, left %+v", tanpa, rs)
+	}
+	dijaga := rs.GuardWrites([]string{"admin"}, func(next echo.HandlerFunc) echo.HandlerFunc { return next })
+	if len(dijaga[0].Middleware) != 0 || dijaga[0].Doc.Auth || len(dijaga[1].Middleware) != 1 || !dijaga[1].Doc.Auth || dijaga[1].Doc.Peran[0] != "admin" {
+		t.Errorf("GuardWrites gave %+v", dijaga)
+	}
+	if rs[1].Doc.Auth || len(rs[1].Middleware) != 0 {
+		t.Error("GuardWrites changed the table it copied")
+	}
+}
+
+func TestAPI(t *testing.T) {
+	routes := api.Routes{
+		{Method: http.MethodGet, Path: "/pegawai/:id", Handler: versi, Doc: openapi.Operation{Summary: "Get", Tag: "Pegawai"}},
+		{Method: http.MethodPut, Path: "/pegawai", Handler: versi, Successor: "/pegawai/:id", Doc: openapi.Operation{Summary: "Update", Tag: "Pegawai"}},
+	}
+	dep := api.Deprecation{
+		Since:     time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC),
+		Sunset:    time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC),
+		Successor: "v1",
+	}
+	e := echo.New()
+	spec := openapi.New("Test", "1.0.0", "")
+	a := api.New(e, spec)
+	a.Version("v1", routes, nil)
+	a.Unversioned(routes, dep)
+	srv := testutil.NewServer(t, e)
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		version string
+		link    string
+	}{
+		{name: "versioned", method: http.MethodGet, path: "/api/v1/pegawai/7", version: "v1"},
+		{name: "root", method: http.MethodGet, path: "/pegawai/7", link: `</api/v1/pegawai/7>; rel="successor-version"`},
+		{name: "root with successor", method: http.MethodPut, path: "/pegawai", link: `</api/v1/pegawai/{id}>; rel="successor-version"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Do(tt.method, tt.path, nil).Expect(http.StatusOK)
+			if string(res.Body) != tt.version || res.Header.Get(api.HeaderVersion) != tt.version {
+				t.Errorf("served by %q, %s %q", res.Body, api.HeaderVersion, res.Header.Get(api.HeaderVersion))
+			}
+			if got := res.Header.Get("Link"); got != tt.link {
+				t.Errorf("Link = %q, want %q", got, tt.link)
+			}
+			deprecation, sunset := "", ""
+			if tt.link != "" {
+				deprecation, sunset = "@1792368000", "Fri, 30 Apr 2027 00:00:00 GMT"
+			}
+			if got := res.Header.Get("Deprecation"); got != deprecation {
+				t.Errorf("Deprecation = %q, want %q", got, deprecation)
+			}
+			if got := res.Header.Get("Sunset"); got != sunset {
+				t.Errorf("Sunset = %q, want %q", got, sunset)
+			}
+		})
+	}
+
+	doc := spec.Document()
+	if op := doc.Paths["/api/v1/pegawai/{id}"]["get"]; op == nil || op.Deprecated {
+		t.Errorf("GET /api/v1/pegawai/{id} is documented as %+v", op)
+	}
+	if op := doc.Paths["/pegawai"]["put"]; op == nil || !op.Deprecated || op.Tags[0] != "Unversioned (deprecated)" {
+		t.Errorf("PUT /pegawai is documented as %+v", op)
+	}
+	if missing := openapi.Drift(doc, e.Routes()); len(missing) != 0 {
+		t.Errorf("undocumented routes %v", missing)
+	}
+}
+
+type orang struct {
+	ID   int64  `json:"id"`
+	Nama string `json:"nama"`
+	Nik  string `json:"nik"`
+}
+
+func TestShape(t *testing.T) {
+	shape := api.Shape{
+		Model: orang{},
+		Masks: map[string]func(string) string{"nik": func(string) string { return "***" }},
+		Reveal: func(ctx echo.Context, obj map[string]interface{}) bool {
+			return ctx.Request().Header.Get("X-Pemilik") == fmt.Sprint(obj["id"])
+		},
+	}
+	daftar := []orang{{ID: 1, Nama: "Budi", Nik: "3273010101900001"}, {ID: 2, Nama: "Siti", Nik: "3273014502920002"}}
+	tests := []struct {
+		name    string
+		query   string
+		pemilik string
+		data    interface{}
+		want    string
+		code    int
+	}{
+		{name: "masked", data: daftar, want: `[{"id":1,"nama":"Budi","nik":"***"},{"id":2,"nama":"Siti","nik":"***"}]`},
+		{name: "revealed for its owner", pemilik: "2", data: daftar, want: `[{"id":1,"nama":"Budi","nik":"***"},{"id":2,"nama":"Siti","nik":"3273014502920002"}]`},
+		{name: "fields", query: "?fields=id,nik", data: daftar[0], want: `{"id":1,"nik":"***"}`},
+		{name: "empty fields is every field", query: "?fields=", data: daftar[0], want: `{"id":1,"nama":"Budi","nik":"***"}`},
+		{name: "unknown field", query: "?fields=gaji", data: daftar, code: http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/"+tt.query, nil)
+			req.Header.Set("X-Pemilik", tt.pemilik)
+			ctx := echo.New().NewContext(req, httptest.NewRecorder())
+			got, err := shape.Apply(ctx, tt.data, api.Fields(ctx))
+			if tt.code != 0 {
+				if apperror.From(err).Status != tt.code {
+					t.Errorf("error %v, want status %d", err, tt.code)
+				}
+				return
+			}
+			b, _ := json.Marshal(got)
+			if err != nil || string(b) != tt.want {
+				t.Errorf("got %s, %v, want %s", b, err, tt.want)
+			}
+		})
+	}
+}
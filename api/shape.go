@@ -0,0 +1,121 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"uas/apperror"
+)
+
+// Shape decides what a response shows of a resource: fields the caller may
+// not see in full are masked, and ?fields=nama,unit leaves only the listed
+// ones.
+type Shape struct {
+	// Model is a value of the resource type, its JSON members are the
+	// fields ?fields= may name.
+	Model interface{}
+	// Masks replace the value of a field, by JSON name, unless Reveal
+	// allows the caller to see it.
+	Masks map[string]func(string) string
+	// Reveal reports whether the caller of ctx sees obj unmasked. Without
+	// Reveal everything is masked.
+	Reveal func(ctx echo.Context, obj map[string]interface{}) bool
+}
+
+// Fields returns the members ?fields= asks for, nil when it is not given.
+func Fields(ctx echo.Context) []string {
+	q := ctx.QueryParam("fields")
+	if strings.TrimSpace(q) == "" {
+		return nil
+	}
+	var fields []string
+	for _, f := range strings.Split(q, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// Apply returns v, an object or a list of them, as the caller of ctx may
+// see it with only fields, all when fields is nil. An unknown field is a
+// validation error.
+func (s Shape) Apply(ctx echo.Context, v interface{}, fields []string) (interface{}, error) {
+	if err := s.valid(fields); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	// ids stay numbers instead of float64
+	dec.UseNumber()
+	var data interface{}
+	if err := dec.Decode(&data); err != nil {
+		return nil, err
+	}
+	switch d := data.(type) {
+	case map[string]interface{}:
+		return s.object(ctx, d, fields), nil
+	case []interface{}:
+		for i, item := range d {
+			if obj, ok := item.(map[string]interface{}); ok {
+				d[i] = s.object(ctx, obj, fields)
+			}
+		}
+		return d, nil
+	default:
+		return data, nil
+	}
+}
+
+func (s Shape) object(ctx echo.Context, obj map[string]interface{}, fields []string) map[string]interface{} {
+	if s.Reveal == nil || !s.Reveal(ctx, obj) {
+		for f, mask := range s.Masks {
+			if nilai, ok := obj[f].(string); ok && nilai != "" {
+				obj[f] = mask(nilai)
+			}
+		}
+	}
+	if fields == nil {
+		return obj
+	}
+	out := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		if nilai, ok := obj[f]; ok {
+			out[f] = nilai
+		}
+	}
+	return out
+}
+
+func (s Shape) valid(fields []string) error {
+	if fields == nil || s.Model == nil {
+		return nil
+	}
+	b, err := json.Marshal(s.Model)
+	if err != nil {
+		return err
+	}
+	var model map[string]json.RawMessage
+	if err := json.Unmarshal(b, &model); err != nil {
+		return err
+	}
+	for _, f := range fields {
+		if _, ok := model[f]; !ok {
+			names := make([]string, 0, len(model))
+			for n := range model {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return apperror.Validation(fmt.Sprintf("Invalid field %s in fields, expected some of %s", f, strings.Join(names, ", ")))
+		}
+	}
+	return nil
+}
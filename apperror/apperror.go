@@ -0,0 +1,127 @@
+// Package apperror is the error model shared by every service. Handlers
+// return an *Error and the central HTTPErrorHandler renders it as an RFC 7807
+// application/problem+json response.
+package apperror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Stable error codes, clients may switch on these.
+const (
+	CodeBadRequest       = "bad_request"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeValidation       = "validation_failed"
+	CodeInternal         = "internal_error"
+	CodeUnavailable      = "service_unavailable"
+)
+
+// Error is an error with an HTTP status and a stable code. Detail is shown to
+// the client, Err is the cause and is only logged.
+type Error struct {
+	Status int
+	Code   string
+	Detail string
+	// Data is sent as the "data" member, e.g. the record that conflicts.
+	Data interface{}
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Detail, e.Err)
+	}
+	return e.Code + ": " + e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithData attaches data to the problem response.
+func (e *Error) WithData(data interface{}) *Error {
+	e.Data = data
+	return e
+}
+
+func New(status int, code, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+// BadRequest is for a body or parameter that cannot be parsed at all.
+func BadRequest(detail string) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, detail)
+}
+
+// Validation is for well-formed input that breaks a business rule.
+func Validation(detail string) *Error {
+	return New(http.StatusUnprocessableEntity, CodeValidation, detail)
+}
+
+func Unauthorized(detail string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, detail)
+}
+
+func Forbidden(detail string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, detail)
+}
+
+func NotFound(detail string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, detail)
+}
+
+func Conflict(detail string) *Error {
+	return New(http.StatusConflict, CodeConflict, detail)
+}
+
+// Internal hides err from the client behind detail.
+func Internal(detail string, err error) *Error {
+	e := New(http.StatusInternalServerError, CodeInternal, detail)
+	e.Err = err
+	return e
+}
+
+// Unavailable is for a dependency, like the database, that is down.
+func Unavailable(detail string) *Error {
+	return New(http.StatusServiceUnavailable, CodeUnavailable, detail)
+}
+
+// Lookup maps the error of loading a single record: a missing row becomes
+// NotFound with detail, any other failure goes through Wrap.
+func Lookup(err error, detail string) *Error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		e := NotFound(detail)
+		e.Err = err
+		return e
+	}
+	return Wrap(err, "Failed to load "+strings.TrimSuffix(detail, " not found"))
+}
+
+// Wrap maps a database error: a missing row becomes NotFound, a unique key
+// violation becomes Conflict and anything else Internal with detail. An
+// *Error is returned unchanged.
+func Wrap(err error, detail string) *Error {
+	var appErr *Error
+	switch {
+	case errors.As(err, &appErr):
+		return appErr
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		e := NotFound("Record not found")
+		e.Err = err
+		return e
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		e := Conflict("A record with the same unique value already exists")
+		e.Err = err
+		return e
+	}
+	return Internal(detail, err)
+}
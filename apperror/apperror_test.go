@@ -0,0 +1,99 @@
+package apperror_test
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"gorm.io/gorm"
+
+	"uas/apperror"
+	"uas/testutil"
+)
+
+type kode struct {
+	ID   int64
+	Kode string `gorm:"uniqueIndex"`
+}
+
+func TestWrap(t *testing.T) {
+	db := testutil.OpenDB(t, func(db *gorm.DB) error { return db.AutoMigrate(&kode{}) })
+	db.Create(&kode{Kode: "A"})
+	duplikat := db.Create(&kode{Kode: "A"}).Error
+	hilang := db.First(&kode{}, 99).Error
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"unique violation", duplikat, http.StatusConflict, apperror.CodeConflict},
+		{"missing row", hilang, http.StatusNotFound, apperror.CodeNotFound},
+		{"other failure", errors.New("connection reset"), http.StatusInternalServerError, apperror.CodeInternal},
+		{"already typed", apperror.Validation("bad"), http.StatusUnprocessableEntity, apperror.CodeValidation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := apperror.Wrap(tt.err, "Failed")
+			if e.Status != tt.status || e.Code != tt.code {
+				t.Errorf("got %d %s, want %d %s", e.Status, e.Code, tt.status, tt.code)
+			}
+		})
+	}
+}
+
+func TestHTTPErrorHandler(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = apperror.HTTPErrorHandler
+	e.Use(middleware.RequestID())
+	e.GET("/internal", func(c echo.Context) error {
+		return apperror.Internal("Failed to Get All", errors.New("dial tcp: secret-host"))
+	})
+	e.GET("/data", func(c echo.Context) error {
+		return apperror.Conflict("Already checked in today").WithData(map[string]int{"id": 7})
+	})
+	e.GET("/plain", func(c echo.Context) error {
+		return errors.New("boom")
+	})
+	srv := testutil.NewServer(t, e)
+
+	tests := []struct {
+		path   string
+		status int
+		code   string
+		detail string
+	}{
+		{"/internal", http.StatusInternalServerError, apperror.CodeInternal, "Failed to Get All"},
+		{"/data", http.StatusConflict, apperror.CodeConflict, "Already checked in today"},
+		{"/plain", http.StatusInternalServerError, apperror.CodeInternal, "Internal Server Error"},
+		{"/unknown", http.StatusNotFound, apperror.CodeNotFound, "Not Found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			res := srv.Do(http.MethodGet, tt.path, nil).Expect(tt.status)
+			p := res.Problem()
+			if p.Code != tt.code || p.Detail != tt.detail || p.Type != apperror.TypePrefix+tt.code || p.Instance != tt.path {
+				t.Errorf("got %+v", p)
+			}
+			if p.RequestID != res.Header.Get(echo.HeaderXRequestID) {
+				t.Errorf("request_id %q does not match header %q", p.RequestID, res.Header.Get(echo.HeaderXRequestID))
+			}
+			if strings.Contains(string(res.Body), "secret-host") {
+				t.Errorf("cause leaked to the client: %s", res.Body)
+			}
+		})
+	}
+
+	res := srv.Do(http.MethodGet, "/data", nil)
+	var body struct {
+		Data map[string]int `json:"data"`
+	}
+	res.Decode(&body)
+	if body.Data["id"] != 7 {
+		t.Errorf("data member = %v", body.Data)
+	}
+}
@@ -0,0 +1,121 @@
+package apperror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ContentType of every error response.
+const ContentType = "application/problem+json"
+
+// TypePrefix prefixes the code to build the RFC 7807 "type" URI.
+const TypePrefix = "urn:uas:problem:"
+
+// Problem is the RFC 7807 body, with code, request_id and data as extension
+// members.
+type Problem struct {
+	Type      string      `json:"type"`
+	Title     string      `json:"title"`
+	Status    int         `json:"status"`
+	Detail    string      `json:"detail,omitempty"`
+	Instance  string      `json:"instance,omitempty"`
+	Code      string      `json:"code"`
+	RequestID string      `json:"request_id,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// From turns any error into an *Error. Errors raised by Echo itself, like an
+// unknown route or a bad request body, keep their status.
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		e := New(httpErr.Code, codeFor(httpErr.Code), fmt.Sprint(httpErr.Message))
+		e.Err = httpErr.Internal
+		if httpErr.Code >= http.StatusInternalServerError {
+			e.Detail = http.StatusText(httpErr.Code)
+		}
+		return e
+	}
+	return Internal(http.StatusText(http.StatusInternalServerError), err)
+}
+
+func codeFor(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusUnprocessableEntity:
+		return CodeValidation
+	case http.StatusInternalServerError:
+		return CodeInternal
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// RequestID returns the ID set by middleware.RequestID, or the one sent by the
+// client.
+func RequestID(c echo.Context) string {
+	if id := c.Response().Header().Get(echo.HeaderXRequestID); id != "" {
+		return id
+	}
+	return c.Request().Header.Get(echo.HeaderXRequestID)
+}
+
+// HTTPErrorHandler is installed as echo.HTTPErrorHandler by every service.
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+	e := From(err)
+	p := Problem{
+		Type:      TypePrefix + e.Code,
+		Title:     http.StatusText(e.Status),
+		Status:    e.Status,
+		Detail:    e.Detail,
+		Instance:  c.Request().URL.Path,
+		Code:      e.Code,
+		RequestID: RequestID(c),
+		Data:      e.Data,
+	}
+	// logging.Middleware put the request ID into ctx
+	ctx := c.Request().Context()
+	if e.Status >= http.StatusInternalServerError {
+		slog.ErrorContext(ctx, "request failed", "method", c.Request().Method, "path", p.Instance, "error", e)
+	}
+
+	if c.Request().Method == http.MethodHead {
+		if err := c.NoContent(e.Status); err != nil {
+			slog.ErrorContext(ctx, "writing error response", "error", err)
+		}
+		return
+	}
+	body, err := json.Marshal(p)
+	if err != nil {
+		slog.ErrorContext(ctx, "encoding error response", "error", err)
+		return
+	}
+	if err := c.Blob(e.Status, ContentType, body); err != nil {
+		slog.ErrorContext(ctx, "writing error response", "error", err)
+	}
+}
@@ -0,0 +1,190 @@
+// Package cli is the command line of the services: one binary serves a
+// service and runs the tasks around it, migrations, seeds, import and
+// export, with the configuration and database setup of database.Connect.
+//
+//	uas [-service name] <command> [arguments]
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"uas/database"
+	"uas/encryption"
+	"uas/logging"
+	"uas/server"
+)
+
+// Service is what the commands need to know about a service.
+type Service struct {
+	Name string
+	// Migrate creates the tables of the service or brings them up to date.
+	Migrate func(db *gorm.DB) error
+	// Tables are the models Migrate keeps, "migrate status" checks them.
+	Tables []interface{}
+	// Rollback drops what Migrate created, nil drops Tables in reverse.
+	Rollback  func(db *gorm.DB) error
+	NewServer func(db *gorm.DB) (*echo.Echo, error)
+	// Data names the models import and export work on, e.g. "pegawai".
+	Data map[string]interface{}
+	// Commands are the commands only this service has, like "user create".
+	Commands []Command
+	// Jobs run in the background while the service serves.
+	Jobs []Job
+}
+
+// Command is a subcommand. Its name may have two words, "migrate up".
+type Command struct {
+	Name  string
+	Args  string
+	Short string
+	// Run gets the arguments after the name and the connected database,
+	// which is closed after Run returns.
+	Run func(ctx context.Context, db *gorm.DB, args []string) error
+	// serve keeps the database open, server.Run closes it.
+	serve bool
+}
+
+// ErrUsage is returned for a command line that names no known command, or
+// arguments a command cannot use.
+var ErrUsage = errors.New("usage")
+
+// Main runs the command in args and returns the exit code for os.Exit: 2
+// for a wrong command line, 1 when the command failed. With one service and
+// no command it serves, so "go run ." keeps starting the service.
+func Main(args []string, services ...Service) int {
+	logging.Setup()
+	ctx, stop := server.SignalContext()
+	defer stop()
+
+	err := Run(ctx, os.Stderr, args, services...)
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, ErrUsage):
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	default:
+		slog.Error("command failed", "error", err)
+		return 1
+	}
+}
+
+// Run runs the command in args, the usage goes to out.
+func Run(ctx context.Context, out io.Writer, args []string, services ...Service) error {
+	fs := flag.NewFlagSet("uas", flag.ContinueOnError)
+	fs.SetOutput(out)
+	nama := fs.String("service", services[0].Name, "the service the command works on")
+	fs.Usage = func() { usage(out, services) }
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return fmt.Errorf("%w: %v", ErrUsage, err)
+	}
+	args = fs.Args()
+	if len(args) == 0 {
+		if len(services) > 1 {
+			usage(out, services)
+			return fmt.Errorf("%w: no command", ErrUsage)
+		}
+		args = []string{"serve"}
+	}
+
+	svc, ok := cari(services, *nama)
+	if !ok {
+		return fmt.Errorf("%w: unknown service %q", ErrUsage, *nama)
+	}
+	cmd, rest, ok := perintah(commands(svc), args)
+	if !ok {
+		usage(out, services)
+		return fmt.Errorf("%w: unknown command %q", ErrUsage, strings.Join(args, " "))
+	}
+
+	if err := encryption.Setup(); err != nil {
+		return err
+	}
+	db, err := database.Connect(ctx, database.ConfigFromEnv())
+	if err != nil {
+		return err
+	}
+	if cmd.serve {
+		return cmd.Run(ctx, db, rest)
+	}
+	return errors.Join(cmd.Run(ctx, db, rest), database.Close(db))
+}
+
+func cari(services []Service, nama string) (Service, bool) {
+	for _, s := range services {
+		if s.Name == nama {
+			return s, true
+		}
+	}
+	return Service{}, false
+}
+
+// perintah finds the command args start with, a two word name first.
+func perintah(cmds []Command, args []string) (Command, []string, bool) {
+	for _, n := range []int{2, 1} {
+		if len(args) < n {
+			continue
+		}
+		nama := strings.Join(args[:n], " ")
+		for _, c := range cmds {
+			if c.Name == nama {
+				return c, args[n:], true
+			}
+		}
+	}
+	return Command{}, nil, false
+}
+
+func usage(out io.Writer, services []Service) {
+	fmt.Fprintln(out, "usage: uas [-service name] <command> [arguments]")
+	fmt.Fprintln(out)
+	nama := make([]string, len(services))
+	for i, s := range services {
+		nama[i] = s.Name
+	}
+	fmt.Fprintf(out, "services: %s (default %s)\n", strings.Join(nama, ", "), services[0].Name)
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "commands:")
+	tw := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	dilihat := map[string]bool{}
+	for _, s := range services {
+		for _, c := range commands(s) {
+			if dilihat[c.Name] {
+				continue
+			}
+			dilihat[c.Name] = true
+			fmt.Fprintf(tw, "  %s\t%s\n", strings.TrimSpace(c.Name+" "+c.Args), c.Short)
+		}
+	}
+	tw.Flush()
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "The database comes from DB_DRIVER and DB_DSN, like for the services.")
+}
+
+// parse parses the flags of a command, which takes exactly n arguments.
+func parse(fs *flag.FlagSet, args []string, n int) error {
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrUsage, fs.Name(), err)
+	}
+	if fs.NArg() != n {
+		return fmt.Errorf("%w: %s takes %d arguments, got %d", ErrUsage, fs.Name(), n, fs.NArg())
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"uas/cli"
+	"uas/database"
+	"uas/outbox"
+	"uas/referensi"
+)
+
+type Catatan struct {
+	ID  int64  `json:"id"`
+	Isi string `json:"isi"`
+}
+
+// layanan is a service with one table of its own, the database is a SQLite
+// file in a directory of t.
+func layanan(t *testing.T) (cli.Service, string, func() *gorm.DB) {
+	dir := t.TempDir()
+	dsn := filepath.Join(dir, "test.db")
+	t.Setenv("DB_DRIVER", database.SQLite)
+	t.Setenv("DB_DSN", dsn)
+
+	svc := cli.Service{
+		Name: "catatan",
+		Migrate: func(db *gorm.DB) error {
+			if err := outbox.Migrate(db); err != nil {
+				return err
+			}
+			return db.AutoMigrate(&Catatan{}, &referensi.Referensi{})
+		},
+		Tables: []interface{}{&Catatan{}, &referensi.Referensi{}, &outbox.Event{}, &outbox.Offset{}, &outbox.Sequence{}},
+		NewServer: func(db *gorm.DB) (*echo.Echo, error) {
+			return nil, errors.New("not in this test")
+		},
+		Data: map[string]interface{}{"catatan": &Catatan{}},
+		Commands: []cli.Command{{
+			Name: "catatan tulis",
+			Run: func(ctx context.Context, db *gorm.DB, args []string) error {
+				return db.Create(&Catatan{Isi: strings.Join(args, " ")}).Error
+			},
+		}},
+	}
+	open := func() *gorm.DB {
+		db, err := database.Open(database.Config{Driver: database.SQLite, DSN: dsn})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { database.Close(db) })
+		return db
+	}
+	return svc, dir, open
+}
+
+func TestRun(t *testing.T) {
+	svc, dir, open := layanan(t)
+	file := func(nama string) string { return filepath.Join(dir, nama) }
+	run := func(args ...string) error {
+		var out bytes.Buffer
+		return cli.Run(context.Background(), &out, args, svc, cli.Master("agama", "agama", cli.Akses{}))
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr error
+		check   func(t *testing.T, db *gorm.DB)
+	}{
+		{name: "no command", wantErr: cli.ErrUsage},
+		{name: "help", args: []string{"-h"}, wantErr: flag.ErrHelp},
+		{name: "unknown command", args: []string{"migrate sideways"}, wantErr: cli.ErrUsage},
+		{name: "unknown service", args: []string{"-service", "tidak_ada", "seed"}, wantErr: cli.ErrUsage},
+		{name: "status before migrating", args: []string{"migrate", "status"}, wantErr: errors.New("tables missing")},
+		{name: "migrate up", args: []string{"migrate", "up"}, check: func(t *testing.T, db *gorm.DB) {
+			if !db.Migrator().HasTable(&Catatan{}) {
+				t.Error("no catatans table")
+			}
+		}},
+		{name: "status after migrating", args: []string{"migrate", "status"}},
+		{name: "extra argument", args: []string{"migrate", "up", "lagi"}, wantErr: cli.ErrUsage},
+		{name: "command of the service", args: []string{"catatan", "tulis", "rapat", "pagi"}, check: func(t *testing.T, db *gorm.DB) {
+			var c Catatan
+			if err := db.First(&c).Error; err != nil || c.Isi != "rapat pagi" {
+				t.Errorf("got %+v, %v", c, err)
+			}
+		}},
+		{name: "seed", args: []string{"seed"}, check: func(t *testing.T, db *gorm.DB) {
+			var n int64
+			db.Model(&referensi.Referensi{}).Where("jenis = ?", "agama").Count(&n)
+			if n != 6 {
+				t.Errorf("got %d agama", n)
+			}
+		}},
+		{name: "seed twice adds nothing", args: []string{"seed"}, check: func(t *testing.T, db *gorm.DB) {
+			var n int64
+			db.Model(&referensi.Referensi{}).Count(&n)
+			if n != 55 {
+				t.Errorf("got %d referensi", n)
+			}
+		}},
+		{name: "export", args: []string{"export", "catatan", file("catatan.json")}, check: func(t *testing.T, db *gorm.DB) {
+			data, err := os.ReadFile(file("catatan.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var rows []Catatan
+			if err := json.Unmarshal(data, &rows); err != nil || len(rows) != 1 || rows[0].Isi != "rapat pagi" {
+				t.Errorf("got %s, %v", data, err)
+			}
+			// the import case below reads it back changed
+			rows[0].Isi = "rapat sore"
+			rows = append(rows, Catatan{ID: 7, Isi: "baru"})
+			data, _ = json.Marshal(rows)
+			if err := os.WriteFile(file("catatan.json"), data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{name: "export unknown data", args: []string{"export", "gaji", file("gaji.json")}, wantErr: cli.ErrUsage},
+		{name: "import updates and inserts", args: []string{"import", "catatan", file("catatan.json")}, check: func(t *testing.T, db *gorm.DB) {
+			var rows []Catatan
+			db.Order("id").Find(&rows)
+			if len(rows) != 2 || rows[0].Isi != "rapat sore" || rows[1].ID != 7 {
+				t.Errorf("got %+v", rows)
+			}
+		}},
+		{name: "import a missing file", args: []string{"import", "catatan", file("tidak_ada.json")}, wantErr: os.ErrNotExist},
+		{name: "export referensi of another service", args: []string{"-service", "agama", "export", "referensi", file("referensi.json")}, check: func(t *testing.T, db *gorm.DB) {
+			if _, err := os.Stat(file("referensi.json")); err != nil {
+				t.Error(err)
+			}
+		}},
+		{name: "down needs -yes", args: []string{"migrate", "down"}, wantErr: cli.ErrUsage},
+		{name: "down", args: []string{"migrate", "down", "-yes"}, check: func(t *testing.T, db *gorm.DB) {
+			if db.Migrator().HasTable(&Catatan{}) || db.Migrator().HasTable(&referensi.Referensi{}) {
+				t.Error("the tables are still there")
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := run(tt.args...)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("unexpected error %v", err)
+			case tt.wantErr != nil && err == nil:
+				t.Fatalf("no error, want %v", tt.wantErr)
+			case tt.wantErr != nil && !errors.Is(err, tt.wantErr) && !strings.Contains(err.Error(), tt.wantErr.Error()):
+				t.Fatalf("error %v, want %v", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, open())
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"uas/database"
+	"uas/referensi"
+	"uas/server"
+	"uas/tracing"
+)
+
+// commands returns the built-in commands on s followed by its own.
+func commands(s Service) []Command {
+	cmds := []Command{
+		{Name: "serve", Args: "[-addr :1324]", Short: "migrate, then serve the API until SIGTERM", Run: s.serve, serve: true},
+		{Name: "migrate up", Short: "create the tables or bring them up to date", Run: s.migrateUp},
+		{Name: "migrate down", Args: "-yes", Short: "drop the tables of the service and their data", Run: s.migrateDown},
+		{Name: "migrate status", Short: "list the tables, fails when one is missing", Run: s.migrateStatus},
+		{Name: "seed", Short: "add the built-in referensi values that are missing", Run: s.seed},
+		{Name: "export", Args: "<data> <file.json>", Short: "write every row of data to a JSON file", Run: s.export},
+		{Name: "import", Args: "<data> <file.json>", Short: "insert or update the rows of a JSON file made by export", Run: s.impor},
+	}
+	return append(cmds, s.Commands...)
+}
+
+func (s Service) serve(ctx context.Context, db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", ":1324", "the address to listen on")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	if err := s.Migrate(db); err != nil {
+		return errors.Join(err, database.Close(db))
+	}
+	e, err := s.NewServer(db)
+	if err != nil {
+		return errors.Join(err, database.Close(db))
+	}
+	shutdown, err := tracing.Setup(ctx, s.Name)
+	if err != nil {
+		return errors.Join(err, database.Close(db))
+	}
+	s.startJobs(ctx, db)
+	err = server.Run(ctx, e, *addr, db)
+	// send the spans still buffered before exiting
+	flushCtx, cancel := context.WithTimeout(context.Background(), server.ShutdownTimeout)
+	defer cancel()
+	return errors.Join(err, shutdown(flushCtx))
+}
+
+func (s Service) migrateUp(ctx context.Context, db *gorm.DB, args []string) error {
+	if err := parse(flag.NewFlagSet("migrate up", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	if err := s.Migrate(db.WithContext(ctx)); err != nil {
+		return err
+	}
+	fmt.Printf("%s: migrated\n", s.Name)
+	return nil
+}
+
+func (s Service) migrateDown(ctx context.Context, db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+	yes := fs.Bool("yes", false, "confirm that the data may go")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	if !*yes {
+		return fmt.Errorf("%w: migrate down drops the tables of %s with their data, pass -yes", ErrUsage, s.Name)
+	}
+	rollback := s.Rollback
+	if rollback == nil {
+		rollback = func(db *gorm.DB) error {
+			for i := len(s.Tables) - 1; i >= 0; i-- {
+				if err := db.Migrator().DropTable(s.Tables[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	if err := rollback(db.WithContext(ctx)); err != nil {
+		return err
+	}
+	fmt.Printf("%s: rolled back\n", s.Name)
+	return nil
+}
+
+func (s Service) migrateStatus(ctx context.Context, db *gorm.DB, args []string) error {
+	if err := parse(flag.NewFlagSet("migrate status", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	db = db.WithContext(ctx)
+	var kurang []string
+	for _, model := range s.Tables {
+		nama, err := tabel(db, model)
+		if err != nil {
+			return err
+		}
+		status := "ok"
+		if !db.Migrator().HasTable(model) {
+			status = "missing"
+			kurang = append(kurang, nama)
+		}
+		fmt.Printf("%-8s %s\n", status, nama)
+	}
+	if len(kurang) > 0 {
+		return fmt.Errorf("%s: tables missing, run migrate up: %s", s.Name, strings.Join(kurang, ", "))
+	}
+	return nil
+}
+
+func (s Service) seed(ctx context.Context, db *gorm.DB, args []string) error {
+	if err := parse(flag.NewFlagSet("seed", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	db = db.WithContext(ctx)
+	if err := s.Migrate(db); err != nil {
+		return err
+	}
+	registry, err := referensi.Bawaan()
+	if err != nil {
+		return err
+	}
+	n, err := referensi.Seed(db, registry)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("referensi: %d values added\n", n)
+	return nil
+}
+
+// data returns the model import and export use for nama, referensi is
+// there for every service.
+func (s Service) data(nama string) (interface{}, error) {
+	if model, ok := s.Data[nama]; ok {
+		return model, nil
+	}
+	if nama == "referensi" {
+		return &referensi.Referensi{}, nil
+	}
+	daftar := []string{"referensi"}
+	for n := range s.Data {
+		daftar = append(daftar, n)
+	}
+	sort.Strings(daftar)
+	return nil, fmt.Errorf("%w: unknown data %q, expected one of %s", ErrUsage, nama, strings.Join(daftar, ", "))
+}
+
+// rows returns a pointer to an empty slice of the type of model.
+func rows(model interface{}) interface{} {
+	return reflect.New(reflect.SliceOf(reflect.TypeOf(model).Elem())).Interface()
+}
+
+func (s Service) export(ctx context.Context, db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	if err := parse(fs, args, 2); err != nil {
+		return err
+	}
+	model, err := s.data(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	dest := rows(model)
+	if err := db.WithContext(ctx).Model(model).Order(clause.OrderByColumn{Column: clause.Column{Table: clause.CurrentTable, Name: clause.PrimaryKey}}).Find(dest).Error; err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(dest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(fs.Arg(1), append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	fmt.Printf("%s: %d rows written to %s\n", fs.Arg(0), reflect.ValueOf(dest).Elem().Len(), fs.Arg(1))
+	return nil
+}
+
+func (s Service) impor(ctx context.Context, db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	if err := parse(fs, args, 2); err != nil {
+		return err
+	}
+	model, err := s.data(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	dest := rows(model)
+	if err := json.Unmarshal(data, dest); err != nil {
+		return fmt.Errorf("%s: %w", fs.Arg(1), err)
+	}
+	n := reflect.ValueOf(dest).Elem().Len()
+	if n == 0 {
+		fmt.Printf("%s: nothing to import\n", fs.Arg(0))
+		return nil
+	}
+	// a row whose id is taken replaces it, so importing an export again
+	// changes nothing
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(dest, 500).Error
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: %d rows imported from %s\n", fs.Arg(0), n, fs.Arg(1))
+	return nil
+}
+
+// tabel returns the table name of model.
+func tabel(db *gorm.DB, model interface{}) (string, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return "", err
+	}
+	return stmt.Schema.Table, nil
+}
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Job is work serve repeats in the background, like the retention purge.
+type Job struct {
+	Name string
+	// Every is the time between runs, zero or less turns the job off.
+	Every time.Duration
+	Run   func(ctx context.Context, db *gorm.DB) error
+}
+
+// Every returns the duration in the environment variable name, def when it
+// is unset or not a duration.
+func Every(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		slog.Warn(name+" is not a duration, using the default", "value", v, "default", def.String(), "error", err)
+		return def
+	}
+	return d
+}
+
+// startJobs runs every job of s on its interval until ctx is cancelled. A
+// failed run is logged, the next one is tried as usual.
+func (s Service) startJobs(ctx context.Context, db *gorm.DB) {
+	for _, job := range s.Jobs {
+		if job.Every <= 0 {
+			slog.Info("job disabled", "job", job.Name)
+			continue
+		}
+		go func(job Job) {
+			ticker := time.NewTicker(job.Every)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+				mulai := time.Now()
+				if err := job.Run(ctx, db.WithContext(ctx)); err != nil {
+					if ctx.Err() == nil {
+						slog.Error("job failed", "job", job.Name, "error", err)
+					}
+					continue
+				}
+				slog.Info("job done", "job", job.Name, "duration", time.Since(mulai).String())
+			}
+		}(job)
+	}
+}
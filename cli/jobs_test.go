@@ -0,0 +1,64 @@
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"uas/cli"
+)
+
+func TestJobs(t *testing.T) {
+	svc, _, _ := layanan(t)
+	svc.NewServer = func(db *gorm.DB) (*echo.Echo, error) { return echo.New(), nil }
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var jalan, mati atomic.Int32
+	svc.Jobs = []cli.Job{
+		{Name: "hitung", Every: 10 * time.Millisecond, Run: func(ctx context.Context, db *gorm.DB) error {
+			// a failed run does not stop the job
+			if jalan.Add(1) == 3 {
+				cancel()
+			}
+			return errors.New("gagal")
+		}},
+		{Name: "mati", Run: func(ctx context.Context, db *gorm.DB) error {
+			mati.Add(1)
+			return nil
+		}},
+	}
+	var out bytes.Buffer
+	if err := cli.Run(ctx, &out, []string{"serve", "-addr", "127.0.0.1:0"}, svc); err != nil {
+		t.Fatal(err)
+	}
+	if jalan.Load() < 3 || mati.Load() != 0 {
+		t.Errorf("ran %d and %d times, want 3 and 0", jalan.Load(), mati.Load())
+	}
+}
+
+func TestEvery(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "unset", want: time.Hour},
+		{name: "set", value: "15m", want: 15 * time.Minute},
+		{name: "off", value: "0", want: 0},
+		{name: "not a duration", value: "sehari", want: time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("INTERVAL_TEST", tt.value)
+			if got := cli.Every("INTERVAL_TEST", time.Hour); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
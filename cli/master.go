@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"gorm.io/gorm"
+
+	"uas/api"
+	"uas/apperror"
+	"uas/logging"
+	"uas/metrics"
+	"uas/openapi"
+	"uas/outbox"
+	"uas/referensi"
+	"uas/server"
+	"uas/tracing"
+)
+
+// Akses guards the writes of a master-data service with the login accounts
+// of another service: Login resolves the login of a request, Tulis only
+// lets Peran through.
+type Akses struct {
+	Login func(db *gorm.DB) echo.MiddlewareFunc
+	Tulis echo.MiddlewareFunc
+	Peran []string
+}
+
+// Master is a master-data service like agama: the values of one referensi
+// type on the route of the old service, e.g. /agama, next to the generic
+// /referensi routes. Only logins akses lets through change the values.
+func Master(name, jenis string, akses Akses) Service {
+	return Service{
+		Name:      name,
+		Migrate:   migrateReferensi,
+		Tables:    []interface{}{&referensi.Referensi{}, &outbox.Event{}, &outbox.Offset{}, &outbox.Sequence{}},
+		NewServer: func(db *gorm.DB) (*echo.Echo, error) { return masterServer(db, jenis, akses) },
+	}
+}
+
+func migrateReferensi(db *gorm.DB) error {
+	registry, err := referensi.Bawaan()
+	if err != nil {
+		return err
+	}
+	return referensi.Migrate(db, registry)
+}
+
+// masterServer wires the handlers into a fresh Echo instance, the tests use
+// it with an in-memory database.
+func masterServer(db *gorm.DB, jenis string, akses Akses) (*echo.Echo, error) {
+	registry, err := referensi.Bawaan()
+	if err != nil {
+		return nil, err
+	}
+	j, ok := registry.Cari(jenis)
+	if !ok {
+		return nil, apperror.NotFound("Jenis " + jenis + " not found")
+	}
+	m := metrics.New()
+	if err := m.Instrument(db); err != nil {
+		return nil, err
+	}
+	if err := tracing.Instrument(db); err != nil {
+		return nil, err
+	}
+	e := echo.New()
+	e.HTTPErrorHandler = apperror.HTTPErrorHandler
+	e.JSONSerializer = tracing.JSONSerializer(e.JSONSerializer)
+	e.Use(tracing.Middleware())
+	e.Use(m.Middleware())
+	e.Use(middleware.RequestID())
+	e.Use(logging.Middleware())
+	e.Use(middleware.Recover())
+	e.Use(akses.Login(db))
+
+	h := referensi.NewReferensiHandler(referensi.NewGormService(db, registry))
+	v1 := append(h.Routes(), h.LegacyRoutes(jenis)...).GuardWrites(akses.Peran, akses.Tulis)
+
+	spec := openapi.New(j.Nama+" API", "1.0.0", j.Nama+" values on /api/v1"+j.LegacyPath+" and every lookup list on /api/v1/referensi.")
+	a := api.New(e, spec)
+	a.Version("v1", v1, nil)
+	a.Unversioned(v1, api.RootDeprecation)
+	a.Root(server.NewHealthHandler(db, &referensi.Referensi{}).Routes())
+	a.Root(m.Routes())
+	spec.Register(e)
+	return e, nil
+}
@@ -0,0 +1,232 @@
+package cli_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"uas/cli"
+	"uas/pegawai"
+	"uas/referensi"
+	"uas/testutil"
+)
+
+// TestMaster runs the routes of the old per-type services, e.g. /agama, for
+// every jenis of the registry that has them.
+func TestMaster(t *testing.T) {
+	registry, err := referensi.Bawaan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, j := range registry.Daftar() {
+		if j.LegacyPath == "" {
+			continue
+		}
+		t.Run(j.Kode, func(t *testing.T) {
+			testMaster(t, registry, j)
+		})
+	}
+}
+
+func testMaster(t *testing.T, registry *referensi.Registry, j referensi.Jenis) {
+	layanan := cli.Master(strings.TrimPrefix(j.LegacyPath, "/"), j.Kode, pegawai.AksesMaster())
+	newTestServer := func(t *testing.T) (*testutil.Server, *gorm.DB) {
+		// the login accounts belong to the pegawai service
+		db := testutil.OpenDB(t, func(db *gorm.DB) error {
+			if err := layanan.Migrate(db); err != nil {
+				return err
+			}
+			return db.AutoMigrate(&pegawai.Pengguna{}, &pegawai.Sesi{})
+		})
+		if _, err := referensi.Seed(db, registry); err != nil {
+			t.Fatal(err)
+		}
+		e, err := layanan.NewServer(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return testutil.NewServer(t, e), db
+	}
+	nilai := func(t *testing.T, db *gorm.DB) []referensi.Referensi {
+		var daftar []referensi.Referensi
+		if err := db.Where("jenis = ?", j.Kode).Order("id").Find(&daftar).Error; err != nil {
+			t.Fatal(err)
+		}
+		return daftar
+	}
+
+	_, db := newTestServer(t)
+	bawaan := nilai(t, db)
+	if len(bawaan) == 0 {
+		t.Fatalf("no values seeded for %s", j.Kode)
+	}
+	pertama, kedua := bawaan[0], bawaan[len(bawaan)-1]
+	// the first value typed in another case matches whatever contains it
+	cari := strings.ToUpper(pertama.Nama)
+	cocok := 0
+	for _, r := range bawaan {
+		if strings.Contains(strings.ToUpper(r.Nama), cari) {
+			cocok++
+		}
+	}
+
+	path := func(format string, a ...interface{}) string {
+		return j.LegacyPath + fmt.Sprintf(format, a...)
+	}
+	body := map[string]string{j.LegacyField: "Lainnya"}
+	hr := pegawai.PeranHR
+	tests := []struct {
+		name string
+		// peran logs in before the request, empty sends none
+		peran   string
+		method  string
+		path    string
+		body    interface{}
+		breakDB bool
+		panik   bool
+		code    int
+		check   func(t *testing.T, res *testutil.Response, db *gorm.DB)
+	}{
+		{name: "get all", method: http.MethodGet, path: path(""), code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data []map[string]interface{}
+				res.Data(&data)
+				if len(data) != len(bawaan) {
+					t.Errorf("got %d rows, want %d", len(data), len(bawaan))
+				}
+			}},
+		{name: "search ignores case", method: http.MethodGet, path: path("?search=%s", strings.ReplaceAll(cari, " ", "%20")), code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data []map[string]interface{}
+				res.Data(&data)
+				if len(data) != cocok {
+					t.Errorf("got %d rows, want %d", len(data), cocok)
+				}
+			}},
+		{name: "search escapes wildcards", method: http.MethodGet, path: path("?search=%%25"), code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data []map[string]interface{}
+				res.Data(&data)
+				if len(data) != 0 {
+					t.Errorf("got %d rows, want 0", len(data))
+				}
+			}},
+		{name: "get all db failure", method: http.MethodGet, path: path(""), breakDB: true, code: http.StatusInternalServerError},
+		{name: "panic is recovered", method: http.MethodGet, path: path(""), panik: true, code: http.StatusInternalServerError},
+
+		{name: "get by id", method: http.MethodGet, path: path("/%d", pertama.ID), code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data map[string]interface{}
+				res.Data(&data)
+				if data["id"] != float64(pertama.ID) || data[j.LegacyField] != pertama.Nama || data["kode"] != pertama.Kode {
+					t.Errorf("got %v", data)
+				}
+			}},
+		{name: "get by id missing", method: http.MethodGet, path: path("/99999"), code: http.StatusNotFound},
+		{name: "get by id db failure", method: http.MethodGet, path: path("/%d", pertama.ID), breakDB: true, code: http.StatusInternalServerError},
+
+		{name: "create", peran: hr, method: http.MethodPost, path: path(""), body: body, code: http.StatusCreated,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data map[string]interface{}
+				res.Data(&data)
+				var saved referensi.Referensi
+				if err := db.First(&saved, data["id"]).Error; err != nil || saved.Nama != "Lainnya" || saved.Jenis != j.Kode {
+					t.Errorf("saved %+v, err %v", saved, err)
+				}
+				if data[j.LegacyField] != "Lainnya" || data["kode"] != "LAINNYA" {
+					t.Errorf("got %v", data)
+				}
+			}},
+		{name: "create without name", peran: hr, method: http.MethodPost, path: path(""), body: map[string]string{j.LegacyField: "  "}, code: http.StatusUnprocessableEntity},
+		{name: "create bind failure", peran: hr, method: http.MethodPost, path: path(""), body: `{"` + j.LegacyField + `":`, code: http.StatusBadRequest},
+		{name: "create db failure", peran: hr, method: http.MethodPost, path: path(""), body: body, breakDB: true, code: http.StatusInternalServerError},
+
+		{name: "update", peran: hr, method: http.MethodPut, path: path("/%d", kedua.ID), body: body, code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var saved referensi.Referensi
+				if err := db.First(&saved, kedua.ID).Error; err != nil || saved.Nama != "Lainnya" {
+					t.Errorf("saved %+v, err %v", saved, err)
+				}
+			}},
+		{name: "update missing", peran: hr, method: http.MethodPut, path: path("/99999"), body: body, code: http.StatusNotFound},
+		{name: "update bind failure", peran: hr, method: http.MethodPut, path: path("/%d", kedua.ID), body: `{"` + j.LegacyField + `":`, code: http.StatusBadRequest},
+		{name: "update db failure", peran: hr, method: http.MethodPut, path: path("/%d", kedua.ID), body: body, breakDB: true, code: http.StatusInternalServerError},
+
+		{name: "delete", peran: hr, method: http.MethodDelete, path: path("/%d", pertama.ID), code: http.StatusNoContent,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				if n := len(nilai(t, db)); n != len(bawaan)-1 {
+					t.Errorf("got %d rows, want %d", n, len(bawaan)-1)
+				}
+			}},
+		{name: "delete missing", peran: hr, method: http.MethodDelete, path: path("/99999"), code: http.StatusNotFound},
+		{name: "delete treats id as a value", peran: hr, method: http.MethodDelete, path: path("/0%%20OR%%201=1"), code: http.StatusNotFound,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				if n := len(nilai(t, db)); n != len(bawaan) {
+					t.Errorf("got %d rows, want %d", n, len(bawaan))
+				}
+			}},
+		{name: "create without login", method: http.MethodPost, path: path(""), body: body, code: http.StatusUnauthorized},
+		{name: "create on /referensi without login", method: http.MethodPost, path: "/referensi/" + j.Kode, body: map[string]string{"nama": "Lainnya"}, code: http.StatusUnauthorized},
+		{name: "update as pegawai", peran: pegawai.PeranPegawai, method: http.MethodPut, path: path("/%d", kedua.ID), body: body, code: http.StatusForbidden},
+		{name: "delete on /referensi as pegawai", peran: pegawai.PeranPegawai, method: http.MethodDelete, path: fmt.Sprintf("/referensi/%s/%d", j.Kode, pertama.ID), code: http.StatusForbidden,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				if n := len(nilai(t, db)); n != len(bawaan) {
+					t.Errorf("got %d rows, want %d", n, len(bawaan))
+				}
+			}},
+		{name: "delete db failure", peran: hr, method: http.MethodDelete, path: path("/%d", pertama.ID), breakDB: true, code: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, db := newTestServer(t)
+			if tt.peran != "" {
+				masuk(t, srv, db, tt.peran)
+			}
+			if tt.breakDB && tt.peran != "" {
+				// the login still has to be found, only the values are gone
+				if err := db.Migrator().DropTable(&referensi.Referensi{}); err != nil {
+					t.Fatal(err)
+				}
+			} else if tt.breakDB {
+				testutil.BreakDB(t, db)
+			}
+			if tt.panik {
+				err := db.Callback().Query().Before("gorm:query").Register("panik", func(*gorm.DB) { panic("boom") })
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			res := srv.Do(tt.method, tt.path, tt.body).Expect(tt.code)
+			if tt.check != nil {
+				tt.check(t, res, db)
+			}
+		})
+	}
+
+	t.Run("openapi", func(t *testing.T) {
+		srv, _ := newTestServer(t)
+		testutil.CheckOpenAPI(t, srv)
+	})
+}
+
+// masuk logs srv in as a Pengguna with peran of the pegawai service.
+func masuk(t *testing.T, srv *testutil.Server, db *gorm.DB, peran string) {
+	t.Helper()
+	pengguna := &pegawai.Pengguna{Username: peran, Peran: peran}
+	if err := db.Create(pengguna).Error; err != nil {
+		t.Fatal(err)
+	}
+	token := "token-" + peran
+	hash := sha256.Sum256([]byte(token))
+	sesi := &pegawai.Sesi{PenggunaID: pengguna.ID, TokenHash: hex.EncodeToString(hash[:]), ExpiresAt: time.Now().Add(time.Hour)}
+	if err := db.Create(sesi).Error; err != nil {
+		t.Fatal(err)
+	}
+	srv.Header.Set("Authorization", "Bearer "+token)
+}
@@ -0,0 +1,23 @@
+// Command uas runs the pegawai service or one of the master-data services,
+// and the tasks around them: migrations, seeds, import, export and login
+// accounts. Run it without arguments for the list of commands.
+package main
+
+import (
+	"os"
+
+	"uas/cli"
+	"uas/pegawai"
+)
+
+func main() {
+	akses := pegawai.AksesMaster()
+	os.Exit(cli.Main(os.Args[1:],
+		pegawai.Service(),
+		cli.Master("agama", "agama", akses),
+		cli.Master("jeniskelamin", "jenis_kelamin", akses),
+		cli.Master("jenispegawai", "jenis_pegawai", akses),
+		cli.Master("pendidikan", "pendidikan", akses),
+		cli.Master("statuspegawai", "status_pegawai", akses),
+	))
+}
@@ -0,0 +1,200 @@
+// Package database opens the GORM connection of every service. The driver
+// and DSN come from the environment, so the same service runs on MySQL,
+// PostgreSQL or SQLite.
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"uas/logging"
+	"uas/outbox"
+)
+
+const (
+	MySQL    = "mysql"
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+// DefaultDSN is the local Laravel database used from the start.
+const DefaultDSN = "root:@tcp(127.0.0.1:3306)/laravel?charset=utf8mb4&parseTime=True&loc=Local"
+
+type Config struct {
+	Driver string
+	DSN    string
+	// LogLevel is the level of the SQL log, zero means logger.Info.
+	LogLevel logger.LogLevel
+	// ConnectTimeout is how long Connect keeps retrying, zero means
+	// DefaultConnectTimeout.
+	ConnectTimeout time.Duration
+}
+
+// DefaultConnectTimeout is long enough to wait for a MySQL container that just started.
+const DefaultConnectTimeout = time.Minute
+
+// ConfigFromEnv reads DB_DRIVER (mysql, postgres, sqlite), DB_DSN and
+// DB_CONNECT_TIMEOUT (a Go duration such as "90s"). Without any of them it is
+// still the local MySQL it always was.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Driver: strings.ToLower(strings.TrimSpace(os.Getenv("DB_DRIVER"))),
+		DSN:    os.Getenv("DB_DSN"),
+	}
+	if v := os.Getenv("DB_CONNECT_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.ConnectTimeout = d
+		} else {
+			slog.Warn("DB_CONNECT_TIMEOUT ignored", "value", v, "error", err)
+		}
+	}
+	switch cfg.Driver {
+	case "", "mariadb":
+		cfg.Driver = MySQL
+	case "postgresql", "pgx":
+		cfg.Driver = Postgres
+	case "sqlite3":
+		cfg.Driver = SQLite
+	}
+	if cfg.DSN == "" {
+		switch cfg.Driver {
+		case MySQL:
+			cfg.DSN = DefaultDSN
+		case Postgres:
+			cfg.DSN = "host=127.0.0.1 user=postgres dbname=laravel port=5432 sslmode=disable TimeZone=Asia/Jakarta"
+		case SQLite:
+			cfg.DSN = "laravel.db"
+		}
+	}
+	return cfg
+}
+
+func (c Config) dialector() (gorm.Dialector, error) {
+	switch c.Driver {
+	case MySQL:
+		return mysql.Open(c.DSN), nil
+	case Postgres:
+		return postgres.Open(c.DSN), nil
+	case SQLite:
+		dsn := c.DSN
+		// SQLite has foreign keys and the busy timeout off by default
+		if !strings.Contains(dsn, "_pragma=") {
+			sep := "?"
+			if strings.Contains(dsn, "?") {
+				sep = "&"
+			}
+			dsn += sep + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+		}
+		return sqlite.Open(dsn), nil
+	}
+	return nil, fmt.Errorf("database: unknown driver %q (mysql, postgres, sqlite)", c.Driver)
+}
+
+// Open connects as cfg says, with the SQL logger every service shares. Each
+// query is logged at debug level, see logging.Gorm. Every write to a model
+// tracked by the outbox is recorded as an event as well.
+func Open(cfg Config) (*gorm.DB, error) {
+	dialector, err := cfg.dialector()
+	if err != nil {
+		return nil, err
+	}
+	level := cfg.LogLevel
+	if level == 0 {
+		level = logger.Info
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{
+		// JSON through slog, with request_id and without the query parameters
+		Logger: logging.Gorm(level),
+		// unique violations come back as gorm.ErrDuplicatedKey on every dialect
+		TranslateError: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := outbox.Instrument(db); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// first and longest delay between attempts of Connect, changed by tests.
+var (
+	jedaAwal = 500 * time.Millisecond
+	jedaMaks = 10 * time.Second
+	open     = Open
+)
+
+// Connect opens the connection like Open, but while the database cannot be
+// reached (MySQL still starting under docker compose, say) it tries again,
+// doubling the delay each time, until cfg.ConnectTimeout runs out or ctx is
+// cancelled. An unknown driver fails right away.
+func Connect(ctx context.Context, cfg Config) (*gorm.DB, error) {
+	if _, err := cfg.dialector(); err != nil {
+		return nil, err
+	}
+	timeout := cfg.ConnectTimeout
+	if timeout <= 0 {
+		timeout = DefaultConnectTimeout
+	}
+	batas := time.Now().Add(timeout)
+	jeda := jedaAwal
+	for percobaan := 1; ; percobaan++ {
+		db, err := open(cfg)
+		if err == nil {
+			return db, nil
+		}
+		if time.Now().Add(jeda).After(batas) {
+			return nil, fmt.Errorf("database: not connected after %d attempts: %w", percobaan, err)
+		}
+		slog.WarnContext(ctx, "database cannot be reached yet", "percobaan", percobaan, "jeda", jeda.String(), "error", err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(jeda):
+		}
+		if jeda *= 2; jeda > jedaMaks {
+			jeda = jedaMaks
+		}
+	}
+}
+
+// Close closes the connection pool behind db.
+func Close(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// Driver returns the dialect of the connection: mysql, postgres or sqlite.
+func Driver(db *gorm.DB) string {
+	return db.Dialector.Name()
+}
+
+// Contains adds a case-insensitive "column contains value" condition. LIKE
+// already ignores case on MySQL and SQLite, PostgreSQL uses ILIKE. Wildcards
+// in value are escaped, so a "%" or "_" from the user is searched as is.
+func Contains(query *gorm.DB, column, value string) *gorm.DB {
+	op := "LIKE"
+	if Driver(query) == Postgres {
+		op = "ILIKE"
+	}
+	return query.Where(column+" "+op+" ? ESCAPE '!'", "%"+escapeLike(value)+"%")
+}
+
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		driver, dsn string
+		want        Config
+	}{
+		{"", "", Config{Driver: MySQL, DSN: DefaultDSN}},
+		{"MariaDB", "", Config{Driver: MySQL, DSN: DefaultDSN}},
+		{"postgresql", "host=db", Config{Driver: Postgres, DSN: "host=db"}},
+		{" sqlite3 ", "", Config{Driver: SQLite, DSN: "laravel.db"}},
+		{"oracle", "x", Config{Driver: "oracle", DSN: "x"}},
+	}
+	for _, tt := range tests {
+		t.Setenv("DB_DRIVER", tt.driver)
+		t.Setenv("DB_DSN", tt.dsn)
+		if got := ConfigFromEnv(); got != tt.want {
+			t.Errorf("DB_DRIVER=%q DB_DSN=%q: got %+v, want %+v", tt.driver, tt.dsn, got, tt.want)
+		}
+	}
+}
+
+func TestOpenUnknownDriver(t *testing.T) {
+	if _, err := Open(Config{Driver: "oracle"}); err == nil {
+		t.Fatal("expected an error for an unknown driver")
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	tests := map[string]string{
+		"budi": "budi",
+		"100%": "100!%",
+		"a_b":  "a!_b",
+		"hai!": "hai!!",
+		"!%_":  "!!!%!_",
+	}
+	for in, want := range tests {
+		if got := escapeLike(in); got != want {
+			t.Errorf("escapeLike(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestConnect(t *testing.T) {
+	jedaAwal, jedaMaks = time.Millisecond, 4*time.Millisecond
+	t.Cleanup(func() { jedaAwal, jedaMaks, open = 500*time.Millisecond, 10*time.Second, Open })
+	belumSiap := errors.New("dial tcp 127.0.0.1:3306: connect: connection refused")
+
+	tests := []struct {
+		name      string
+		gagal     int
+		timeout   time.Duration
+		batal     bool
+		percobaan int
+		err       error
+	}{
+		{name: "langsung terhubung", percobaan: 1},
+		{name: "terhubung setelah database siap", gagal: 3, timeout: time.Second, percobaan: 4},
+		{name: "menyerah setelah timeout", gagal: 1000, timeout: 20 * time.Millisecond, err: belumSiap},
+		{name: "berhenti saat dibatalkan", gagal: 1000, timeout: time.Second, batal: true, percobaan: 1, err: context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			percobaan := 0
+			open = func(cfg Config) (*gorm.DB, error) {
+				percobaan++
+				if tt.batal {
+					cancel()
+				}
+				if percobaan <= tt.gagal {
+					return nil, belumSiap
+				}
+				return Open(cfg)
+			}
+			db, err := Connect(ctx, Config{Driver: SQLite, DSN: ":memory:", LogLevel: logger.Silent, ConnectTimeout: tt.timeout})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if tt.percobaan != 0 && percobaan != tt.percobaan {
+				t.Errorf("%d percobaan, want %d", percobaan, tt.percobaan)
+			}
+			if err == nil {
+				if err := Close(db); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+	if _, err := Connect(context.Background(), Config{Driver: "oracle"}); err == nil {
+		t.Error("expected an error for an unknown driver")
+	}
+}
@@ -0,0 +1,200 @@
+// Package encryption encrypts personal data at rest. A model field tagged
+// gorm:"serializer:encrypted" is stored AES-256-GCM encrypted with the
+// current key of the Keyring and read back with whichever key it was
+// written with, so keys can be rotated. A blind index, a keyed hash of the
+// plaintext, lets a query find or deduplicate a value without decrypting.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// prefix marks an encrypted value: enc:<key id>:<base64 of nonce and
+// ciphertext>. A value without it is plaintext written before encryption
+// was turned on, it is read as is.
+const prefix = "enc:"
+
+// KeySize is the size of an encryption key and the minimum of an index key.
+const KeySize = 32
+
+// ErrUnknownKey is returned for a value encrypted with a key the Keyring
+// does not have, e.g. one removed too early after a rotation.
+var ErrUnknownKey = errors.New("encryption: unknown key")
+
+// Keyring holds the encryption keys by id and the blind index key.
+type Keyring struct {
+	current string
+	aead    map[string]cipher.AEAD
+	index   []byte
+}
+
+// NewKeyring encrypts with keys[current] and decrypts with any of keys. A
+// Keyring without keys stores plaintext, for development.
+func NewKeyring(current string, keys map[string][]byte, indexKey []byte) (*Keyring, error) {
+	k := &Keyring{current: current, aead: map[string]cipher.AEAD{}, index: indexKey}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("encryption: invalid key id %q", id)
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("encryption: key %s has %d bytes, want %d", id, len(key), KeySize)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if k.aead[id], err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	if len(keys) == 0 {
+		return k, nil
+	}
+	if _, ok := k.aead[current]; !ok {
+		return nil, fmt.Errorf("encryption: current key %q is not among the keys", current)
+	}
+	if len(indexKey) < KeySize {
+		return nil, fmt.Errorf("encryption: the index key needs at least %d bytes", KeySize)
+	}
+	return k, nil
+}
+
+// FromEnv reads ENCRYPTION_KEYS, a comma separated list of id:key with the
+// key in base64 and the current key first, and ENCRYPTION_INDEX_KEY, the
+// base64 blind index key. Rotating means putting a new key in front and
+// running "uas encrypt" before the old one is dropped.
+func FromEnv() (*Keyring, error) {
+	daftar := os.Getenv("ENCRYPTION_KEYS")
+	if daftar == "" {
+		return NewKeyring("", nil, nil)
+	}
+	keys := map[string][]byte{}
+	current := ""
+	for _, item := range strings.Split(daftar, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok {
+			return nil, fmt.Errorf("encryption: ENCRYPTION_KEYS item %q is not id:key", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("encryption: key %s: %w", id, err)
+		}
+		if _, dup := keys[id]; dup {
+			return nil, fmt.Errorf("encryption: key %s is listed twice", id)
+		}
+		keys[id] = key
+		if current == "" {
+			current = id
+		}
+	}
+	index, err := base64.StdEncoding.DecodeString(os.Getenv("ENCRYPTION_INDEX_KEY"))
+	if err != nil {
+		return nil, fmt.Errorf("encryption: ENCRYPTION_INDEX_KEY: %w", err)
+	}
+	return NewKeyring(current, keys, index)
+}
+
+// Enabled reports whether k encrypts.
+func (k *Keyring) Enabled() bool {
+	return len(k.aead) > 0
+}
+
+// Encrypt encrypts plain with the current key, bound to context, the
+// column it is written to, so it cannot be copied into another one. The
+// empty string stays empty.
+func (k *Keyring) Encrypt(plain, context string) (string, error) {
+	if plain == "" || !k.Enabled() {
+		return plain, nil
+	}
+	aead := k.aead[k.current]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), []byte(context))
+	return prefix + k.current + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the plaintext of value, a plaintext value as is.
+func (k *Keyring) Decrypt(value, context string) (string, error) {
+	if !strings.HasPrefix(value, prefix) {
+		return value, nil
+	}
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	if !ok {
+		return "", errors.New("encryption: malformed value")
+	}
+	aead, ok := k.aead[id]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("encryption: malformed value")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(context))
+	if err != nil {
+		return "", fmt.Errorf("encryption: value with key %s cannot be decrypted: %w", id, err)
+	}
+	return string(plain), nil
+}
+
+// Current reports whether value is encrypted with the current key, or is
+// plaintext when k does not encrypt, so it needs no rewrite.
+func (k *Keyring) Current(value string) bool {
+	if value == "" {
+		return true
+	}
+	if !k.Enabled() {
+		return !strings.HasPrefix(value, prefix)
+	}
+	return strings.HasPrefix(value, prefix+k.current+":")
+}
+
+// BlindIndex returns the keyed hash of value for the index named field, the
+// same value always gives the same hash and a field another hash.
+func (k *Keyring) BlindIndex(field, value string) string {
+	mac := hmac.New(sha256.New, k.index)
+	mac.Write([]byte(field))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+var bawaan atomic.Pointer[Keyring]
+
+func init() {
+	k, _ := NewKeyring("", nil, nil)
+	bawaan.Store(k)
+}
+
+// Use makes k the Keyring of the encrypted serializer.
+func Use(k *Keyring) {
+	bawaan.Store(k)
+}
+
+// Default returns the Keyring the encrypted serializer uses.
+func Default() *Keyring {
+	return bawaan.Load()
+}
+
+// Setup makes the Keyring of FromEnv the default.
+func Setup() error {
+	k, err := FromEnv()
+	if err != nil {
+		return err
+	}
+	Use(k)
+	return nil
+}
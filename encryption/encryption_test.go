@@ -0,0 +1,181 @@
+package encryption_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"uas/encryption"
+	"uas/testutil"
+)
+
+func kunci(b byte) []byte {
+	return bytes.Repeat([]byte{b}, encryption.KeySize)
+}
+
+func keyring(t *testing.T, current string, keys map[string][]byte) *encryption.Keyring {
+	t.Helper()
+	k, err := encryption.NewKeyring(current, keys, kunci(9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestKeyring(t *testing.T) {
+	lama := keyring(t, "k1", map[string][]byte{"k1": kunci(1)})
+	baru := keyring(t, "k2", map[string][]byte{"k1": kunci(1), "k2": kunci(2)})
+	tanpa := keyring(t, "", nil)
+	dariLama, err := lama.Encrypt("3273010101900001", "datadiri.nik")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		k       *encryption.Keyring
+		value   string
+		context string
+		want    string
+		wantErr string
+	}{
+		{name: "encrypted with an older key", k: baru, value: dariLama, context: "datadiri.nik", want: "3273010101900001"},
+		{name: "plaintext written before encryption", k: baru, value: "Bandung", context: "datadiri.tempat_lahir", want: "Bandung"},
+		{name: "empty", k: baru, context: "datadiri.nik", want: ""},
+		{name: "copied into another column", k: baru, value: dariLama, context: "datadiri.tempat_lahir", wantErr: "cannot be decrypted"},
+		{name: "tampered", k: baru, value: dariLama[:len(dariLama)-2] + "AA", context: "datadiri.nik", wantErr: "cannot be decrypted"},
+		{name: "key removed", k: keyring(t, "k2", map[string][]byte{"k2": kunci(2)}), value: dariLama, context: "datadiri.nik", wantErr: "unknown key"},
+		{name: "malformed", k: baru, value: "enc:k1", context: "datadiri.nik", wantErr: "malformed"},
+		{name: "without keys", k: tanpa, value: dariLama, context: "datadiri.nik", wantErr: "unknown key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.k.Decrypt(tt.value, tt.context)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("got %q, %v, want error %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("got %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	t.Run("rotation", func(t *testing.T) {
+		if lama.Current(dariLama) != true || baru.Current(dariLama) != false {
+			t.Error("a value of k1 is only current in the keyring of k1")
+		}
+		lagi, err := baru.Encrypt("3273010101900001", "datadiri.nik")
+		if err != nil || !strings.HasPrefix(lagi, "enc:k2:") || lagi == dariLama {
+			t.Errorf("got %q, %v", lagi, err)
+		}
+		if !errors.Is(func() error { _, err := lama.Decrypt(lagi, "datadiri.nik"); return err }(), encryption.ErrUnknownKey) {
+			t.Error("k1 alone decrypted a value of k2")
+		}
+	})
+	t.Run("blind index", func(t *testing.T) {
+		a := baru.BlindIndex("datadiri.nik", "3273010101900001")
+		if a != lama.BlindIndex("datadiri.nik", "3273010101900001") {
+			t.Error("the index depends on the encryption key")
+		}
+		if a == baru.BlindIndex("datadiri.nik", "3273010101900002") || a == baru.BlindIndex("keluarga.nik", "3273010101900001") {
+			t.Error("different values or fields share an index")
+		}
+	})
+	t.Run("plaintext without keys", func(t *testing.T) {
+		if got, err := tanpa.Encrypt("Bandung", "datadiri.tempat_lahir"); err != nil || got != "Bandung" {
+			t.Errorf("got %q, %v", got, err)
+		}
+	})
+}
+
+func TestFromEnv(t *testing.T) {
+	b64 := base64.StdEncoding.EncodeToString
+	tests := []struct {
+		name    string
+		keys    string
+		index   string
+		enabled bool
+		wantErr string
+	}{
+		{name: "unset"},
+		{name: "two keys", keys: "k2:" + b64(kunci(2)) + ", k1:" + b64(kunci(1)), index: b64(kunci(9)), enabled: true},
+		{name: "short key", keys: "k1:" + b64([]byte("pendek")), index: b64(kunci(9)), wantErr: "has 6 bytes"},
+		{name: "no id", keys: b64(kunci(1)), index: b64(kunci(9)), wantErr: "not id:key"},
+		{name: "listed twice", keys: "k1:" + b64(kunci(1)) + ",k1:" + b64(kunci(2)), index: b64(kunci(9)), wantErr: "listed twice"},
+		{name: "no index key", keys: "k1:" + b64(kunci(1)), wantErr: "index key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENCRYPTION_KEYS", tt.keys)
+			t.Setenv("ENCRYPTION_INDEX_KEY", tt.index)
+			k, err := encryption.FromEnv()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if k.Enabled() != tt.enabled {
+				t.Errorf("enabled %v", k.Enabled())
+			}
+			if got, _ := k.Encrypt("x", "t.c"); tt.enabled && !strings.HasPrefix(got, "enc:k2:") {
+				t.Errorf("encrypted with %q, want the first key", got)
+			}
+		})
+	}
+}
+
+type Rahasia struct {
+	ID      int64
+	Catatan string            `gorm:"serializer:encrypted"`
+	Data    map[string]string `gorm:"type:text;serializer:encrypted"`
+	Biasa   string
+}
+
+func TestSerializer(t *testing.T) {
+	db := testutil.OpenDB(t, func(db *gorm.DB) error { return db.AutoMigrate(&Rahasia{}) })
+	r := Rahasia{Catatan: "rahasia", Data: map[string]string{"nik": "3273010101900001"}, Biasa: "biasa"}
+	if err := db.Create(&r).Error; err != nil {
+		t.Fatal(err)
+	}
+	var catatan, data, biasa string
+	if err := db.Model(&Rahasia{}).Select("catatan, data, biasa").Row().Scan(&catatan, &data, &biasa); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(catatan, "enc:test:") || !strings.HasPrefix(data, "enc:test:") || biasa != "biasa" {
+		t.Errorf("stored %q, %q, %q", catatan, data, biasa)
+	}
+	var got Rahasia
+	if err := db.First(&got).Error; err != nil || got.Catatan != "rahasia" || got.Data["nik"] != "3273010101900001" {
+		t.Errorf("read %+v, %v", got, err)
+	}
+
+	// a plaintext row is encrypted by Reencrypt, an encrypted one left alone
+	if err := db.Exec("INSERT INTO rahasia (id, catatan, data, biasa) VALUES (2, 'lama', '{\"a\":\"b\"}', '')").Error; err != nil {
+		t.Fatal(err)
+	}
+	n, err := encryption.Reencrypt(db, &Rahasia{}, nil)
+	if err != nil || n != 1 {
+		t.Errorf("rewrote %d rows, %v", n, err)
+	}
+	if err := db.Model(&Rahasia{}).Where("id = ?", 2).Select("catatan").Row().Scan(&catatan); err != nil || !strings.HasPrefix(catatan, "enc:test:") {
+		t.Errorf("stored %q, %v", catatan, err)
+	}
+	var lama Rahasia
+	if err := db.First(&lama, 2).Error; err != nil || lama.Catatan != "lama" || lama.Data["a"] != "b" {
+		t.Errorf("read %+v, %v", lama, err)
+	}
+	if kolom, _ := encryption.Columns(db, &Rahasia{}); strings.Join(kolom, ",") != "catatan,data" {
+		t.Errorf("got columns %v", kolom)
+	}
+}
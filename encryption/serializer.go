@@ -0,0 +1,165 @@
+package encryption
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Serializer is the GORM serializer "encrypted". A string field is
+// encrypted as is, any other field as JSON. The value is bound to its
+// table and column.
+type Serializer struct{}
+
+func init() {
+	schema.RegisterSerializer("encrypted", Serializer{})
+}
+
+func konteks(field *schema.Field) string {
+	return field.Schema.Table + "." + field.DBName
+}
+
+// Scan decrypts dbValue into the field.
+func (Serializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var nilai string
+	switch v := dbValue.(type) {
+	case nil:
+	case string:
+		nilai = v
+	case []byte:
+		nilai = string(v)
+	default:
+		return fmt.Errorf("encryption: %s holds a %T, want text", konteks(field), dbValue)
+	}
+	plain, err := Default().Decrypt(nilai, konteks(field))
+	if err != nil {
+		return fmt.Errorf("%s: %w", konteks(field), err)
+	}
+	fieldValue := reflect.New(field.FieldType)
+	if field.FieldType.Kind() == reflect.String {
+		fieldValue.Elem().SetString(plain)
+	} else if plain != "" {
+		if err := json.Unmarshal([]byte(plain), fieldValue.Interface()); err != nil {
+			return fmt.Errorf("%s: %w", konteks(field), err)
+		}
+	}
+	field.ReflectValueOf(ctx, dst).Set(fieldValue.Elem())
+	return nil
+}
+
+// Value encrypts fieldValue for the database.
+func (Serializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	var plain string
+	if field.FieldType.Kind() == reflect.String {
+		plain = reflect.ValueOf(fieldValue).String()
+	} else {
+		b, err := json.Marshal(fieldValue)
+		if err != nil {
+			return nil, err
+		}
+		if string(b) != "null" {
+			plain = string(b)
+		}
+	}
+	return Default().Encrypt(plain, konteks(field))
+}
+
+// Columns returns the columns of model that are stored encrypted.
+func Columns(db *gorm.DB, model interface{}) ([]string, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+	var kolom []string
+	for _, field := range stmt.Schema.Fields {
+		if _, ok := field.Serializer.(Serializer); ok && field.DBName != "" {
+			kolom = append(kolom, field.DBName)
+		}
+	}
+	return kolom, nil
+}
+
+// Reencrypt rewrites the encrypted columns of the rows of model that db
+// selects with the current key of the default Keyring, plaintext values
+// included. extra gets every row and the plaintext of its encrypted
+// columns and returns other columns to update, e.g. a blind index. It
+// returns how many rows were updated.
+func Reencrypt(db *gorm.DB, model interface{}, extra func(row map[string]interface{}, plain map[string]string) map[string]interface{}) (int64, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return 0, err
+	}
+	pk := stmt.Schema.PrioritizedPrimaryField
+	if pk == nil {
+		return 0, fmt.Errorf("encryption: %s has no primary key", stmt.Schema.Table)
+	}
+	kolom, err := Columns(db, model)
+	if err != nil {
+		return 0, err
+	}
+	k := Default()
+	var diubah int64
+	var terakhir interface{}
+	for {
+		var rows []map[string]interface{}
+		query := db.Session(&gorm.Session{}).Table(stmt.Schema.Table).Order(pk.DBName).Limit(500)
+		if terakhir != nil {
+			query = query.Where(pk.DBName+" > ?", terakhir)
+		}
+		if err := query.Find(&rows).Error; err != nil {
+			return diubah, err
+		}
+		for _, row := range rows {
+			ubah := map[string]interface{}{}
+			plain := map[string]string{}
+			for _, c := range kolom {
+				nilai := teks(row[c])
+				konteks := stmt.Schema.Table + "." + c
+				if plain[c], err = k.Decrypt(nilai, konteks); err != nil {
+					return diubah, fmt.Errorf("%s %v: %s: %w", stmt.Schema.Table, row[pk.DBName], c, err)
+				}
+				if !k.Current(nilai) {
+					if ubah[c], err = k.Encrypt(plain[c], konteks); err != nil {
+						return diubah, err
+					}
+				}
+			}
+			if extra != nil {
+				for c, v := range extra(row, plain) {
+					ubah[c] = v
+				}
+			}
+			if len(ubah) == 0 {
+				continue
+			}
+			err := db.Session(&gorm.Session{NewDB: true}).Table(stmt.Schema.Table).
+				Where(pk.DBName+" = ?", row[pk.DBName]).UpdateColumns(ubah).Error
+			if err != nil {
+				return diubah, err
+			}
+			diubah++
+		}
+		if len(rows) < 500 {
+			return diubah, nil
+		}
+		terakhir = rows[len(rows)-1][pk.DBName]
+	}
+}
+
+// teks returns a column value read into a map as a string.
+func teks(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
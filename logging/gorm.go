@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// SlowQuery is the duration from which a query is logged as a warning.
+const SlowQuery = 200 * time.Millisecond
+
+// Gorm logs the queries of GORM to the default slog logger: failed ones as
+// errors, slow ones as warnings and, from logger.Info on, all others at
+// debug level. Statements are logged with their placeholders, never with
+// the values bound to them.
+func Gorm(level logger.LogLevel) logger.Interface {
+	return gormLogger{level: level}
+}
+
+type gormLogger struct {
+	level logger.LogLevel
+}
+
+func (l gormLogger) LogMode(level logger.LogLevel) logger.Interface {
+	return gormLogger{level: level}
+}
+
+func (l gormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Info {
+		slog.InfoContext(ctx, fmt.Sprintf(msg, data...))
+	}
+}
+
+func (l gormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Warn {
+		slog.WarnContext(ctx, fmt.Sprintf(msg, data...))
+	}
+}
+
+func (l gormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Error {
+		slog.ErrorContext(ctx, fmt.Sprintf(msg, data...))
+	}
+}
+
+func (l gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.level <= logger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	var level slog.Level
+	msg := "query"
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && l.level >= logger.Error:
+		level, msg = slog.LevelError, "query failed"
+	case elapsed >= SlowQuery && l.level >= logger.Warn:
+		level, msg = slog.LevelWarn, "slow query"
+	case l.level >= logger.Info:
+		level = slog.LevelDebug
+	default:
+		return
+	}
+	if !slog.Default().Enabled(ctx, level) {
+		return
+	}
+	sql, rows := fc()
+	attrs := []slog.Attr{
+		slog.String("sql", sql),
+		slog.Int64("rows", rows),
+		slog.Float64("duration_ms", float64(elapsed.Microseconds())/1000),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+	}
+	slog.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// ParamsFilter keeps the values out of the statements GORM hands to Trace.
+// Scan records its statement without it, there a NIK is still redacted by
+// the handler like in any other string.
+func (l gormLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
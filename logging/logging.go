@@ -0,0 +1,155 @@
+// Package logging sets up the structured JSON logs of every service. Records
+// logged with a request context carry its request_id and trace_id, and sensitive values
+// like a NIK, a password or a token are redacted before they are written.
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Redacted replaces a sensitive value.
+const Redacted = "[REDACTED]"
+
+// sensitive are the words that mark an attribute or JSON field as sensitive,
+// in any part of its name: nik, nik_lama, password_hash, Authorization.
+var sensitive = map[string]bool{
+	"nik": true, "password": true, "token": true, "authorization": true, "cookie": true,
+}
+
+// nikPattern finds a NIK inside free text, with or without separators.
+var nikPattern = regexp.MustCompile(`\b\d{4}[- ]?\d{4}[- ]?\d{4}[- ]?\d{4}\b`)
+
+// New returns a JSON logger writing to w from level on.
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(handler{slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact,
+	})})
+}
+
+// Setup makes a logger on stdout the default of slog and of the log package.
+// LOG_LEVEL is debug, info (the default), warn or error; debug shows every
+// SQL statement.
+func Setup() *slog.Logger {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(os.Getenv("LOG_LEVEL"))); err != nil {
+		level = slog.LevelInfo
+	}
+	logger := New(os.Stdout, level)
+	slog.SetDefault(logger)
+	return logger
+}
+
+// Fatal logs err and exits, for main.
+func Fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns ctx carrying the request ID id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID in ctx, empty outside a request.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// handler adds the request_id and the trace of the context to every record.
+type handler struct {
+	slog.Handler
+}
+
+func (h handler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return handler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h handler) WithGroup(name string) slog.Handler {
+	return handler{h.Handler.WithGroup(name)}
+}
+
+func isSensitive(name string) bool {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+	for _, w := range words {
+		if sensitive[w] {
+			return true
+		}
+	}
+	return false
+}
+
+func redact(_ []string, a slog.Attr) slog.Attr {
+	if isSensitive(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(nikPattern.ReplaceAllString(a.Value.String(), Redacted))
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case error:
+			a.Value = slog.StringValue(nikPattern.ReplaceAllString(v.Error(), Redacted))
+		default:
+			a.Value = slog.AnyValue(redactJSON(v))
+		}
+	}
+	return a
+}
+
+// redactJSON returns v as the JSON handler would write it, a struct or map
+// turned into its JSON fields, with the sensitive ones redacted.
+func redactJSON(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return v
+	}
+	return walk(decoded)
+}
+
+func walk(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			if isSensitive(k) {
+				v[k] = Redacted
+			} else {
+				v[k] = walk(field)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = walk(v[i])
+		}
+	case string:
+		return nikPattern.ReplaceAllString(v, Redacted)
+	}
+	return v
+}
@@ -0,0 +1,149 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm/logger"
+
+	"uas/apperror"
+	"uas/database"
+	"uas/logging"
+	"uas/testutil"
+)
+
+const nik = "3273010101900001"
+
+// capture makes a logger into the returned buffer the default for t.
+func capture(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	old := slog.Default()
+	slog.SetDefault(logging.New(&buf, slog.LevelDebug))
+	t.Cleanup(func() { slog.SetDefault(old) })
+	return &buf
+}
+
+// records decodes the JSON lines in buf.
+func records(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var out []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var r map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", line, err)
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+type pegawai struct {
+	Nama     string `json:"nama"`
+	Nik      string `json:"nik"`
+	Keluarga []struct {
+		NikAnggota string `json:"nik_anggota"`
+	} `json:"keluarga"`
+}
+
+func TestRedaction(t *testing.T) {
+	p := pegawai{Nama: "Budi", Nik: nik}
+	p.Keluarga = append(p.Keluarga, struct {
+		NikAnggota string `json:"nik_anggota"`
+	}{nik})
+	tests := []struct {
+		name string
+		args []interface{}
+		want string
+	}{
+		{name: "sensitive key", args: []interface{}{"nik", nik}, want: `"nik":"[REDACTED]"`},
+		{name: "key containing a sensitive word", args: []interface{}{"password_hash", "x"}, want: `"password_hash":"[REDACTED]"`},
+		{name: "header", args: []interface{}{"Authorization", "Bearer abc"}, want: `"Authorization":"[REDACTED]"`},
+		{name: "struct fields", args: []interface{}{"pegawai", p}, want: `"pegawai":{"keluarga":[{"nik_anggota":"[REDACTED]"}],"nama":"Budi","nik":"[REDACTED]"}`},
+		{name: "nik in free text", args: []interface{}{"detail", "NIK 3273-0101-0190-0001 is taken"}, want: `"detail":"NIK [REDACTED] is taken"`},
+		{name: "nik in an error", args: []interface{}{"error", errors.New("duplicate " + nik)}, want: `"error":"duplicate [REDACTED]"`},
+		{name: "group", args: []interface{}{slog.Group("input", "nik", nik, "nama", "Budi")}, want: `"input":{"nik":"[REDACTED]","nama":"Budi"}`},
+		{name: "other values stay", args: []interface{}{"teknik", "sipil", "id", 1234}, want: `"teknik":"sipil","id":1234`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logging.New(&buf, slog.LevelInfo).Info("test", tt.args...)
+			if !strings.Contains(buf.String(), tt.want) {
+				t.Errorf("got %s, want it to contain %s", buf.String(), tt.want)
+			}
+			if strings.Contains(buf.String(), nik) {
+				t.Errorf("the NIK leaked: %s", buf.String())
+			}
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	buf := capture(t)
+	db, err := database.Open(database.Config{Driver: database.SQLite, DSN: ":memory:", LogLevel: logger.Info})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close(db) })
+
+	e := echo.New()
+	e.HTTPErrorHandler = apperror.HTTPErrorHandler
+	e.Use(middleware.RequestID())
+	e.Use(logging.Middleware())
+	e.GET("/cari", func(ctx echo.Context) error {
+		var rows []map[string]interface{}
+		err := db.WithContext(ctx.Request().Context()).Table("tidak_ada").Where("nik = ?", ctx.QueryParam("nik")).Find(&rows).Error
+		return apperror.Internal("Failed to Find", err)
+	})
+	res := testutil.NewServer(t, e).Do(http.MethodGet, "/cari?nik="+nik, nil).Expect(http.StatusInternalServerError)
+	id := res.Header.Get(echo.HeaderXRequestID)
+	if id == "" || res.Problem().RequestID != id {
+		t.Fatalf("request id %q, problem %+v", id, res.Problem())
+	}
+
+	pesan := map[string]bool{}
+	for _, r := range records(t, buf) {
+		pesan[r["msg"].(string)] = true
+		if r["request_id"] != id {
+			t.Errorf("record without the request id: %v", r)
+		}
+	}
+	for _, msg := range []string{"query failed", "request failed", "request"} {
+		if !pesan[msg] {
+			t.Errorf("no %q record in %s", msg, buf)
+		}
+	}
+	if !strings.Contains(buf.String(), `WHERE nik = ?"`) || strings.Contains(buf.String(), nik) {
+		t.Errorf("the query values are logged: %s", buf)
+	}
+}
+
+func TestTraceID(t *testing.T) {
+	buf := capture(t)
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x4b, 0xf9, 0x2f, 0x35},
+		SpanID:  trace.SpanID{0x00, 0xf0, 0x67, 0xaa},
+	})
+	slog.InfoContext(trace.ContextWithSpanContext(context.Background(), sc), "test")
+	slog.Info("no trace")
+
+	rs := records(t, buf)
+	if rs[0]["trace_id"] != sc.TraceID().String() || rs[0]["span_id"] != sc.SpanID().String() {
+		t.Errorf("record without the trace: %v", rs[0])
+	}
+	if _, ok := rs[1]["trace_id"]; ok {
+		t.Errorf("record outside a trace has a trace_id: %v", rs[1])
+	}
+}
@@ -0,0 +1,54 @@
+package logging
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"uas/apperror"
+)
+
+// Middleware puts the request ID into the request context, so the logs of
+// the handler and of its queries carry it, and logs every request when it
+// is done. It goes after middleware.RequestID, which picks the ID.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			start := time.Now()
+			req := ctx.Request()
+			if id := apperror.RequestID(ctx); id != "" {
+				ctx.SetRequest(req.WithContext(WithRequestID(req.Context(), id)))
+			}
+
+			err := next(ctx)
+
+			status := ctx.Response().Status
+			if err != nil && !ctx.Response().Committed {
+				status = apperror.From(err).Status
+			}
+			level := slog.LevelInfo
+			switch {
+			case status >= 500:
+				level = slog.LevelError
+			case status >= 400:
+				level = slog.LevelWarn
+			}
+			attrs := []slog.Attr{
+				slog.String("method", req.Method),
+				slog.String("route", ctx.Path()),
+				// the path only, a query string may carry a NIK
+				slog.String("path", req.URL.Path),
+				slog.Int("status", status),
+				slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+				slog.Int64("bytes_out", ctx.Response().Size),
+				slog.String("remote_ip", ctx.RealIP()),
+			}
+			if err != nil {
+				attrs = append(attrs, slog.Any("error", err))
+			}
+			slog.LogAttrs(ctx.Request().Context(), level, "request", attrs...)
+			return err
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const startKey = "metrics:start"
+
+// registerer is what Before and After of a GORM callback processor return.
+type registerer interface {
+	Register(name string, fn func(*gorm.DB)) error
+}
+
+// plugin times every query GORM runs through its callbacks.
+type plugin struct {
+	m *Metrics
+}
+
+func (p *plugin) Name() string {
+	return "metrics"
+}
+
+func (p *plugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	register := func(operation string, before, after registerer) error {
+		if err := before.Register("metrics:before_"+operation, p.start); err != nil {
+			return err
+		}
+		return after.Register("metrics:after_"+operation, p.observe(operation))
+	}
+	return errors.Join(
+		register("create", cb.Create().Before("gorm:create"), cb.Create().After("gorm:create")),
+		register("query", cb.Query().Before("gorm:query"), cb.Query().After("gorm:query")),
+		register("update", cb.Update().Before("gorm:update"), cb.Update().After("gorm:update")),
+		register("delete", cb.Delete().Before("gorm:delete"), cb.Delete().After("gorm:delete")),
+		register("row", cb.Row().Before("gorm:row"), cb.Row().After("gorm:row")),
+		register("raw", cb.Raw().Before("gorm:raw"), cb.Raw().After("gorm:raw")),
+	)
+}
+
+func (p *plugin) start(db *gorm.DB) {
+	db.InstanceSet(startKey, time.Now())
+}
+
+func (p *plugin) observe(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		v, ok := db.InstanceGet(startKey)
+		if !ok {
+			return
+		}
+		start, ok := v.(time.Time)
+		if !ok {
+			return
+		}
+		table := db.Statement.Table
+		p.m.queries.WithLabelValues(operation, table).Observe(time.Since(start).Seconds())
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			p.m.errors.WithLabelValues(operation, table).Inc()
+		}
+	}
+}
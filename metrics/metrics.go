@@ -0,0 +1,149 @@
+// Package metrics exposes Prometheus metrics of a service on /metrics: the
+// requests per route, the queries GORM runs, the connection pool and the
+// gauges a service adds for its own data.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+
+	"uas/api"
+	"uas/apperror"
+	"uas/openapi"
+)
+
+// Namespace prefixes every metric name.
+const Namespace = "uas"
+
+// Metrics owns a registry of its own, so every Echo instance a test builds
+// can have one without clashing on the default registry.
+type Metrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	queries  *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+	handler  http.Handler
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace, Subsystem: "http", Name: "requests_total",
+			Help: "HTTP requests by route and status code.",
+		}, []string{"method", "route", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace, Subsystem: "http", Name: "request_duration_seconds",
+			Help:    "Latency of HTTP requests by route.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		queries: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace, Subsystem: "db", Name: "query_duration_seconds",
+			Help:    "Duration of the queries GORM runs, by operation and table.",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"operation", "table"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace, Subsystem: "db", Name: "query_errors_total",
+			Help: "Failed queries by operation and table, a missing record is not counted.",
+		}, []string{"operation", "table"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.duration, m.queries, m.errors,
+	)
+	// what could be collected is served, a failing gauge only misses from the scrape
+	m.handler = promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError})
+	return m
+}
+
+// Instrument times the queries of db and exports the stats of its
+// connection pool.
+func (m *Metrics) Instrument(db *gorm.DB) error {
+	if err := db.Use(&plugin{m: m}); err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return m.registry.Register(collectors.NewDBStatsCollector(sqlDB, db.Dialector.Name()))
+}
+
+// Middleware counts and times every request. The route label is the path
+// pattern, like /pegawai/:id, so ids do not end up as label values.
+func (m *Metrics) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			start := time.Now()
+			err := next(ctx)
+
+			status := ctx.Response().Status
+			if err != nil && !ctx.Response().Committed {
+				// HTTPErrorHandler writes the response after the middleware returns
+				status = apperror.From(err).Status
+			}
+			route := ctx.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			method := ctx.Request().Method
+			m.requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+			m.duration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
+// Gauge adds uas_<name> with one value per label, read by collect at every
+// scrape. A failing collect skips the gauge for that scrape.
+func (m *Metrics) Gauge(name, help, label string, collect func() (map[string]float64, error)) error {
+	return m.registry.Register(&gauge{
+		desc:    prometheus.NewDesc(prometheus.BuildFQName(Namespace, "", name), help, []string{label}, nil),
+		collect: collect,
+	})
+}
+
+type gauge struct {
+	desc    *prometheus.Desc
+	collect func() (map[string]float64, error)
+}
+
+func (g *gauge) Describe(ch chan<- *prometheus.Desc) {
+	ch <- g.desc
+}
+
+func (g *gauge) Collect(ch chan<- prometheus.Metric) {
+	values, err := g.collect()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(g.desc, err)
+		return
+	}
+	for label, v := range values {
+		ch <- prometheus.MustNewConstMetric(g.desc, prometheus.GaugeValue, v, label)
+	}
+}
+
+func (m *Metrics) GetMetrics(ctx echo.Context) error {
+	m.handler.ServeHTTP(ctx.Response(), ctx.Request())
+	return nil
+}
+
+// Routes are mounted at the root with api.Root.
+func (m *Metrics) Routes() api.Routes {
+	return api.Routes{
+		{Method: http.MethodGet, Path: "/metrics", Handler: m.GetMetrics, Doc: openapi.Operation{
+			Summary: "Prometheus metrics", Tag: "Health",
+			Description: "Requests per route, query durations, connection pool stats and the gauges of the service, " +
+				"in the Prometheus text format.",
+			Response: &openapi.Schema{Type: "string"}, ContentType: "text/plain"}},
+	}
+}
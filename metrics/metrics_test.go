@@ -0,0 +1,97 @@
+package metrics_test
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"gorm.io/gorm"
+
+	"uas/api"
+	"uas/apperror"
+	"uas/metrics"
+	"uas/testutil"
+)
+
+type Catatan struct {
+	ID  int64
+	Isi string
+}
+
+func TestMetrics(t *testing.T) {
+	db := testutil.OpenDB(t, func(db *gorm.DB) error { return db.AutoMigrate(&Catatan{}) })
+	m := metrics.New()
+	if err := m.Instrument(db); err != nil {
+		t.Fatal(err)
+	}
+	gagal := false
+	err := m.Gauge("catatan_total", "Catatan per isi.", "isi", func() (map[string]float64, error) {
+		if gagal {
+			return nil, errors.New("database is closed")
+		}
+		return map[string]float64{"a": 2, "b": 1}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.HTTPErrorHandler = apperror.HTTPErrorHandler
+	e.Use(m.Middleware())
+	e.Use(middleware.RequestID())
+	e.GET("/catatan/:id", func(ctx echo.Context) error {
+		var c Catatan
+		if err := db.First(&c, ctx.Param("id")).Error; err != nil {
+			return apperror.Lookup(err, "Catatan not found")
+		}
+		return ctx.JSON(http.StatusOK, c)
+	})
+	e.POST("/catatan", func(ctx echo.Context) error {
+		if err := db.Create(&Catatan{Isi: "a"}).Error; err != nil {
+			return err
+		}
+		return ctx.NoContent(http.StatusCreated)
+	})
+	api.New(e, nil).Root(m.Routes())
+	srv := testutil.NewServer(t, e)
+
+	srv.Do(http.MethodPost, "/catatan", nil).Expect(http.StatusCreated)
+	srv.Do(http.MethodGet, "/catatan/1", nil).Expect(http.StatusOK)
+	srv.Do(http.MethodGet, "/catatan/2", nil).Expect(http.StatusNotFound)
+	srv.Do(http.MethodGet, "/catatan/3", nil).Expect(http.StatusNotFound)
+	srv.Do(http.MethodGet, "/tidak/ada", nil).Expect(http.StatusNotFound)
+	db.Exec("SELECT * FROM tidak_ada")
+
+	res := srv.Do(http.MethodGet, "/metrics", nil).Expect(http.StatusOK)
+	body := string(res.Body)
+	for _, want := range []string{
+		`uas_http_requests_total{method="POST",route="/catatan",status="201"} 1`,
+		`uas_http_requests_total{method="GET",route="/catatan/:id",status="200"} 1`,
+		`uas_http_requests_total{method="GET",route="/catatan/:id",status="404"} 2`,
+		`uas_http_request_duration_seconds_count{method="GET",route="/catatan/:id"} 3`,
+		`uas_db_query_duration_seconds_count{operation="create",table="catatans"} 1`,
+		`uas_db_query_duration_seconds_count{operation="query",table="catatans"} 3`,
+		`uas_db_query_errors_total{operation="raw",table=""} 1`,
+		`go_sql_open_connections{db_name="sqlite"}`,
+		`uas_catatan_total{isi="a"} 2`,
+		`uas_catatan_total{isi="b"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/metrics is missing %s", want)
+		}
+	}
+	// the missing records are not query errors, an unknown path is no label
+	if strings.Contains(body, `uas_db_query_errors_total{operation="query"`) || strings.Contains(body, "/tidak/ada") {
+		t.Errorf("/metrics has\n%s", body)
+	}
+
+	// a failing gauge does not take the other metrics down with it
+	gagal = true
+	body = string(srv.Do(http.MethodGet, "/metrics", nil).Expect(http.StatusOK).Body)
+	if !strings.Contains(body, "uas_http_requests_total") || strings.Contains(body, "uas_catatan_total") {
+		t.Errorf("/metrics with a failing gauge is\n%s", body)
+	}
+}
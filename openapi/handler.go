@@ -0,0 +1,35 @@
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+//go:embed docs.html
+var docsHTML []byte
+
+// Router is satisfied by both *echo.Echo and *echo.Group.
+type Router interface {
+	GET(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
+}
+
+// Register serves the document at /openapi.json and the docs UI at /docs,
+// both routes are documented in s as well.
+func (s *Spec) Register(r Router) {
+	s.Add(http.MethodGet, "/openapi.json", Operation{Summary: "This OpenAPI document", Tag: "Docs", Response: &Schema{Type: "object"}})
+	s.Add(http.MethodGet, "/docs", Operation{Summary: "Interactive API docs", Tag: "Docs", Response: &Schema{Type: "string"}, ContentType: echo.MIMETextHTML})
+	r.GET("/openapi.json", s.GetDocument)
+	r.GET("/docs", GetDocs)
+}
+
+func (s *Spec) GetDocument(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, s.Document())
+}
+
+// GetDocs serves the docs UI, a single page that reads openapi.json next to
+// it and needs nothing from the internet.
+func GetDocs(ctx echo.Context) error {
+	return ctx.HTMLBlob(http.StatusOK, docsHTML)
+}
@@ -0,0 +1,458 @@
+// Package openapi builds the OpenAPI 3 document of a service from its route
+// table and the Go types of its requests and responses. Every route is
+// described with Add next to where it is registered, Drift reports routes
+// and operations that no longer match.
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"uas/apperror"
+)
+
+// Version is the OpenAPI version of the generated documents.
+const Version = "3.0.3"
+
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+	Tags       []Tag               `json:"tags,omitempty"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Tag struct {
+	Name string `json:"name"`
+}
+
+// PathItem maps a lower case method to its operation.
+type PathItem map[string]*OperationObject
+
+type OperationObject struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []ParameterObject     `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+}
+
+type ParameterObject struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme"`
+}
+
+// Schema is the subset of the JSON schema dialect the generator emits.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// Param describes a query parameter, Type is a value of its Go type.
+type Param struct {
+	Name        string
+	Description string
+	Type        interface{}
+}
+
+// Operation describes one route. Body, Data and the values of Extra are
+// values of the Go types they stand for: []*Pegawai{} is a list of Pegawai.
+// A non-empty map[string]interface{} describes an object with exactly those
+// members, a []map[string]interface{} with one such element a list of them.
+// A *Schema is used as it is.
+type Operation struct {
+	Summary     string
+	Description string
+	Tag         string
+	Query       []Param
+	// Body is the JSON request body, nil for none.
+	Body interface{}
+	// Status is the success status, 200 when zero. 204 has no body.
+	Status int
+	// Data is the "data" member of the success response.
+	Data interface{}
+	// Extra are the members next to message and data.
+	Extra map[string]interface{}
+	// Response replaces the message and data envelope for the few routes
+	// that answer with something else, sent as ContentType (JSON if empty).
+	Response    interface{}
+	ContentType string
+	// Also lists further success statuses with the same body, like the 202
+	// of an update waiting for approval.
+	Also []int
+	// Auth marks routes that need a bearer token, Peran names the roles
+	// that may call it.
+	Auth  bool
+	Peran []string
+	// Deprecated marks routes that are going away.
+	Deprecated bool
+}
+
+type route struct {
+	method, path string
+}
+
+// Spec collects the operations of one service.
+type Spec struct {
+	info  Info
+	ops   map[route]Operation
+	order []route
+}
+
+func New(title, version, description string) *Spec {
+	return &Spec{info: Info{Title: title, Version: version, Description: description}, ops: map[route]Operation{}}
+}
+
+// Add documents method on path, path is in Echo form like /pegawai/:id.
+// Adding a route twice replaces the first description.
+func (s *Spec) Add(method, path string, op Operation) {
+	r := route{method, path}
+	if _, ok := s.ops[r]; !ok {
+		s.order = append(s.order, r)
+	}
+	s.ops[r] = op
+}
+
+// Path turns an Echo path into an OpenAPI one: /pegawai/:id becomes
+// /pegawai/{id}.
+func Path(echoPath string) string {
+	segments := strings.Split(echoPath, "/")
+	for i, seg := range segments {
+		if strings.HasPrefix(seg, ":") {
+			segments[i] = "{" + seg[1:] + "}"
+		}
+	}
+	if p := strings.Join(segments, "/"); p != "" {
+		return p
+	}
+	return "/"
+}
+
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, seg := range strings.Split(path, "/") {
+		seg = strings.TrimPrefix(seg, ":")
+		if seg == "" {
+			continue
+		}
+		id += "_" + strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+				return r
+			}
+			return '_'
+		}, seg)
+	}
+	return id
+}
+
+// Document renders the spec.
+func (s *Spec) Document() Document {
+	g := newGenerator()
+	doc := Document{
+		OpenAPI: Version,
+		Info:    s.info,
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas:         g.schemas,
+			SecuritySchemes: map[string]SecurityScheme{"bearer": {Type: "http", Scheme: "bearer"}},
+		},
+	}
+	problem := g.schema(reflect.TypeOf(apperror.Problem{}))
+	tags := map[string]bool{}
+	for _, r := range s.order {
+		op := s.ops[r]
+		path := Path(r.path)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = PathItem{}
+		}
+		o := &OperationObject{
+			OperationID: operationID(r.method, r.path),
+			Summary:     op.Summary,
+			Description: op.Description,
+			Responses:   map[string]Response{},
+			Deprecated:  op.Deprecated,
+		}
+		if op.Tag != "" {
+			o.Tags = []string{op.Tag}
+			if !tags[op.Tag] {
+				tags[op.Tag] = true
+				doc.Tags = append(doc.Tags, Tag{Name: op.Tag})
+			}
+		}
+		for _, seg := range strings.Split(r.path, "/") {
+			if name, ok := strings.CutPrefix(seg, ":"); ok {
+				schema := &Schema{Type: "string"}
+				if name == "id" {
+					schema = &Schema{Type: "integer", Format: "int64"}
+				}
+				o.Parameters = append(o.Parameters, ParameterObject{Name: name, In: "path", Required: true, Schema: schema})
+			}
+		}
+		for _, q := range op.Query {
+			typ := q.Type
+			if typ == nil {
+				typ = ""
+			}
+			o.Parameters = append(o.Parameters, ParameterObject{Name: q.Name, In: "query", Description: q.Description, Schema: g.value(typ)})
+		}
+		if op.Body != nil {
+			o.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{echo.MIMEApplicationJSON: {Schema: g.value(op.Body)}}}
+		}
+		status := op.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		for _, code := range append([]int{status}, op.Also...) {
+			res := Response{Description: http.StatusText(code)}
+			switch {
+			case code == http.StatusNoContent:
+			case op.Response != nil:
+				contentType := op.ContentType
+				if contentType == "" {
+					contentType = echo.MIMEApplicationJSON
+				}
+				res.Content = map[string]MediaType{contentType: {Schema: g.value(op.Response)}}
+			default:
+				res.Content = map[string]MediaType{echo.MIMEApplicationJSON: {Schema: g.envelope(op.Data, op.Extra)}}
+			}
+			o.Responses[fmt.Sprint(code)] = res
+		}
+		o.Responses["default"] = Response{Description: "Error", Content: map[string]MediaType{apperror.ContentType: {Schema: problem}}}
+		if op.Auth {
+			o.Security = []map[string][]string{{"bearer": {}}}
+			if len(op.Peran) > 0 {
+				peran := "Only for peran " + strings.Join(op.Peran, ", ") + "."
+				o.Description = strings.TrimSpace(o.Description + "\n\n" + peran)
+			}
+		}
+		doc.Paths[path][strings.ToLower(r.method)] = o
+	}
+	return doc
+}
+
+// Drift compares the operations of doc with the routes an Echo instance
+// serves and describes every difference, nil means they match.
+func Drift(doc Document, routes []*echo.Route) []string {
+	served := map[string]bool{}
+	var drift []string
+	for _, r := range routes {
+		if r.Method == echo.RouteNotFound {
+			continue
+		}
+		key := r.Method + " " + Path(r.Path)
+		if served[key] {
+			continue
+		}
+		served[key] = true
+		if item, ok := doc.Paths[Path(r.Path)]; !ok || item[strings.ToLower(r.Method)] == nil {
+			drift = append(drift, key+" is served but not documented")
+		}
+	}
+	for path, item := range doc.Paths {
+		for method := range item {
+			key := strings.ToUpper(method) + " " + path
+			if !served[key] {
+				drift = append(drift, key+" is documented but not served")
+			}
+		}
+	}
+	sort.Strings(drift)
+	return drift
+}
+
+// generator turns Go types into schemas, named structs end up in schemas
+// and are referenced.
+type generator struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+func newGenerator() *generator {
+	return &generator{schemas: map[string]*Schema{}, names: map[reflect.Type]string{}}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// envelope is the success body: message, data and any extra members.
+func (g *generator) envelope(data interface{}, extra map[string]interface{}) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{"message": {Type: "string"}}}
+	if data != nil {
+		s.Properties["data"] = g.value(data)
+	}
+	for name, v := range extra {
+		s.Properties[name] = g.value(v)
+	}
+	return s
+}
+
+func (g *generator) value(v interface{}) *Schema {
+	switch v := v.(type) {
+	case *Schema:
+		return v
+	case map[string]interface{}:
+		if len(v) > 0 {
+			s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+			for name, member := range v {
+				s.Properties[name] = g.value(member)
+			}
+			return s
+		}
+	case []map[string]interface{}:
+		if len(v) > 0 {
+			return &Schema{Type: "array", Items: g.value(v[0])}
+		}
+	}
+	return g.schema(reflect.TypeOf(v))
+}
+
+func (g *generator) schema(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := *g.schema(t.Elem())
+		if s.Ref != "" {
+			// siblings of $ref are ignored in OpenAPI 3.0
+			return &s
+		}
+		s.Nullable = true
+		return &s
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t == timeType {
+			return &Schema{Type: "string", Format: "date-time"}
+		}
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		return g.ref(t)
+	}
+	// interface{} and anything unknown accept any value
+	return &Schema{}
+}
+
+// ref registers a named struct under components and refers to it. Two types
+// with the same name in different packages are told apart by the package.
+func (g *generator) ref(t reflect.Type) *Schema {
+	name, ok := g.names[t]
+	if !ok {
+		name = t.Name()
+		if _, taken := g.schemas[name]; taken {
+			pkg := t.PkgPath()
+			name = pkg[strings.LastIndex(pkg, "/")+1:] + "." + name
+		}
+		g.names[t] = name
+		g.schemas[name] = &Schema{Type: "object"}
+		*g.schemas[name] = *g.object(t)
+	}
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// object lists the exported fields the way encoding/json writes them.
+func (g *generator) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && ft != timeType {
+				for k, v := range g.object(ft).Properties {
+					if _, ok := s.Properties[k]; !ok {
+						s.Properties[k] = v
+					}
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		field := g.schema(f.Type)
+		if param := f.Tag.Get("param"); name == "" && param != "" {
+			// encoding/json still reads it from the body, ignoring case
+			name = param
+			field.Description = "Taken from the path where the route has :" + param
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = field
+	}
+	return s
+}
@@ -0,0 +1,109 @@
+package openapi_test
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"uas/openapi"
+)
+
+type alamat struct {
+	Kota string `json:"kota"`
+}
+
+type orang struct {
+	ID       int64      `param:"id"`
+	Nama     string     `json:"nama"`
+	Lahir    *time.Time `json:"lahir"`
+	Rahasia  string     `json:"-"`
+	Alamat   []alamat   `json:"alamat"`
+	Atasan   *orang     `json:"atasan"`
+	Label    map[string]string
+	internal int
+}
+
+func TestDocument(t *testing.T) {
+	spec := openapi.New("Test API", "1.0.0", "")
+	spec.Add(http.MethodPut, "/orang/:id", openapi.Operation{Body: orang{}, Data: orang{}, Also: []int{http.StatusAccepted}, Auth: true})
+	spec.Add(http.MethodDelete, "/orang/:id", openapi.Operation{Status: http.StatusNoContent})
+	spec.Add(http.MethodGet, "/orang", openapi.Operation{
+		Data:  []map[string]interface{}{{"nama": "", "umur": 0}},
+		Extra: map[string]interface{}{"filter": ""},
+	})
+	doc := spec.Document()
+
+	put := doc.Paths["/orang/{id}"]["put"]
+	if put == nil || put.OperationID != "put_orang_id" || len(put.Security) != 1 {
+		t.Fatalf("put is %+v", put)
+	}
+	if p := put.Parameters; len(p) != 1 || p[0].In != "path" || p[0].Schema.Type != "integer" {
+		t.Errorf("parameters are %+v", p)
+	}
+	for _, code := range []string{"200", "202", "default"} {
+		if _, ok := put.Responses[code]; !ok {
+			t.Errorf("no %s response", code)
+		}
+	}
+	if res := doc.Paths["/orang/{id}"]["delete"].Responses["204"]; res.Content != nil {
+		t.Errorf("204 has content %+v", res.Content)
+	}
+
+	s := doc.Components.Schemas["orang"]
+	if s == nil {
+		t.Fatal("orang is not a component")
+	}
+	var names []string
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	for _, name := range []string{"id", "nama", "lahir", "alamat", "atasan", "Label"} {
+		if s.Properties[name] == nil {
+			t.Errorf("no property %s in %v", name, names)
+		}
+	}
+	if len(s.Properties) != 6 {
+		t.Errorf("properties %v, want 6", names)
+	}
+	if l := s.Properties["lahir"]; l.Format != "date-time" || !l.Nullable {
+		t.Errorf("lahir is %+v", l)
+	}
+	if a := s.Properties["atasan"]; a.Ref != "#/components/schemas/orang" {
+		t.Errorf("atasan is %+v", a)
+	}
+	if a := s.Properties["alamat"]; a.Type != "array" || a.Items.Ref != "#/components/schemas/alamat" {
+		t.Errorf("alamat is %+v", a)
+	}
+
+	list := doc.Paths["/orang"]["get"].Responses["200"].Content[echo.MIMEApplicationJSON].Schema
+	if data := list.Properties["data"]; data.Type != "array" || data.Items.Properties["umur"].Type != "integer" {
+		t.Errorf("data is %+v", data)
+	}
+	if list.Properties["filter"] == nil || list.Properties["message"] == nil {
+		t.Errorf("envelope is %+v", list.Properties)
+	}
+}
+
+func TestDrift(t *testing.T) {
+	spec := openapi.New("Test API", "1.0.0", "")
+	spec.Add(http.MethodGet, "/orang/:id", openapi.Operation{})
+	spec.Add(http.MethodPost, "/orang", openapi.Operation{})
+
+	e := echo.New()
+	noop := func(echo.Context) error { return nil }
+	e.GET("/orang/:id", noop)
+	e.DELETE("/orang/:id", noop)
+	e.RouteNotFound("/*", noop)
+	spec.Register(e)
+
+	want := []string{
+		"DELETE /orang/{id} is served but not documented",
+		"POST /orang is documented but not served",
+	}
+	if got := openapi.Drift(spec.Document(), e.Routes()); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,154 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Poll is how often a Broker reads the outbox while it has subscribers.
+var Poll = time.Second
+
+// ErrClosed is what Subscribe answers once the Broker is closed.
+var ErrClosed = errors.New("outbox: broker closed")
+
+// Broker fans the outbox out to subscribers in this process, like the
+// server-sent event streams. It reads the outbox itself instead of being
+// told of writes, so every replica sees the events of all of them.
+type Broker struct {
+	db *gorm.DB
+	// Buffer is how many events a subscriber may fall behind before it is
+	// dropped.
+	Buffer int
+
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	stop   context.CancelFunc
+	closed bool
+}
+
+func NewBroker(db *gorm.DB) *Broker {
+	return &Broker{db: db, Buffer: 256, subs: map[*Subscription]struct{}{}}
+}
+
+// Subscription receives the events written after it was made.
+type Subscription struct {
+	// C is closed when the subscription ends: on Close, when the subscriber
+	// fell Buffer events behind or when the Broker closed. A subscriber that
+	// wants to go on subscribes again and reads what it missed with After.
+	C <-chan Event
+	c chan Event
+	b *Broker
+}
+
+// Subscribe starts a Subscription. Every event with an id above the last
+// one at this moment reaches it, so After from any earlier id
+// followed by C misses nothing.
+func (b *Broker) Subscribe() (*Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+	if b.stop == nil {
+		var cursor int64
+		err := b.db.Model(&Event{}).Select("COALESCE(MAX(id), 0)").Scan(&cursor).Error
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		b.stop = cancel
+		go b.poll(ctx, cursor)
+	}
+	c := make(chan Event, b.Buffer)
+	s := &Subscription{C: c, c: c, b: b}
+	b.subs[s] = struct{}{}
+	return s, nil
+}
+
+// Close ends s, closing it again does nothing.
+func (s *Subscription) Close() {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	s.b.drop(s)
+}
+
+// drop ends s and stops polling after the last subscriber, b.mu is held.
+func (b *Broker) drop(s *Subscription) {
+	if _, ok := b.subs[s]; !ok {
+		return
+	}
+	delete(b.subs, s)
+	close(s.c)
+	if len(b.subs) == 0 && b.stop != nil {
+		b.stop()
+		b.stop = nil
+	}
+}
+
+// Close ends every subscription and refuses new ones, the server calls it
+// on shutdown so open streams do not hold up the drain.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for s := range b.subs {
+		b.drop(s)
+	}
+}
+
+func (b *Broker) poll(ctx context.Context, cursor int64) {
+	ticker := time.NewTicker(Poll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for {
+			events, err := After(b.db.WithContext(ctx), cursor, 500)
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Error("outbox poll failed", "error", err)
+				}
+				break
+			}
+			if len(events) == 0 {
+				break
+			}
+			cursor = events[len(events)-1].ID
+			b.publish(ctx, events)
+			if len(events) < 500 {
+				break
+			}
+		}
+	}
+}
+
+// publish hands events to every subscriber without waiting for any, one
+// that has no room left is dropped.
+func (b *Broker) publish(ctx context.Context, events []Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// a poll stopped while reading must not reach the subscribers of the
+	// one started after it
+	if ctx.Err() != nil {
+		return
+	}
+	for s := range b.subs {
+		for _, e := range events {
+			select {
+			case s.c <- e:
+				continue
+			default:
+			}
+			b.drop(s)
+			break
+		}
+	}
+}
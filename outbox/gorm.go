@@ -0,0 +1,167 @@
+package outbox
+
+import (
+	"errors"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Instrument adds an Event for every row of a tracked model db creates,
+// updates or deletes, written with the row so both commit or neither does.
+// Writes through Table without a model, like the key rotation, are not
+// changes of the row and add none.
+func Instrument(db *gorm.DB) error {
+	return db.Use(&plugin{})
+}
+
+type plugin struct{}
+
+func (p *plugin) Name() string {
+	return "outbox"
+}
+
+func (p *plugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	// only after would sort them behind the commit of the default
+	// transaction, the events have to be written before it
+	const commit = "gorm:commit_or_rollback_transaction"
+	return errors.Join(
+		cb.Create().After("gorm:after_create").Before(commit).Register("outbox:after_create", created),
+		cb.Update().After("gorm:before_update").Before("gorm:update").Register("outbox:before_update", sebelum),
+		cb.Update().After("gorm:after_update").Before(commit).Register("outbox:after_update", updated),
+		cb.Delete().After("gorm:before_delete").Before("gorm:delete").Register("outbox:before_delete", sebelum),
+		cb.Delete().After("gorm:after_delete").Before(commit).Register("outbox:after_delete", deleted),
+	)
+}
+
+// rowsKey holds the rows an update or delete is about to change.
+const rowsKey = "outbox:rows"
+
+// session runs in the transaction of db, without its conditions.
+func session(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true})
+}
+
+func created(db *gorm.DB) {
+	resource, ok := resourceOf(db)
+	if !ok {
+		return
+	}
+	for _, row := range baris(db.Statement.ReflectValue) {
+		db.AddError(publish(session(db), resource, Created, idOf(db, row), row.Interface()))
+	}
+}
+
+// sebelum loads the rows matching an update or delete, the conditions of the
+// statement and the primary key of its model, before they change.
+func sebelum(db *gorm.DB) {
+	if _, ok := resourceOf(db); !ok {
+		return
+	}
+	stmt := db.Statement
+	q := session(db).Model(reflect.New(stmt.Schema.ModelType).Interface())
+	where, bersyarat := stmt.Clauses["WHERE"]
+	if bersyarat {
+		q = q.Clauses(where.Expression)
+	}
+	var ids []interface{}
+	for _, row := range baris(stmt.ReflectValue) {
+		if id, zero := stmt.Schema.PrioritizedPrimaryField.ValueOf(stmt.Context, row); !zero {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > 0 {
+		q = q.Where(clause.IN{Column: clause.Column{Table: clause.CurrentTable, Name: stmt.Schema.PrioritizedPrimaryField.DBName}, Values: ids})
+	} else if !bersyarat {
+		// without conditions GORM refuses the statement
+		return
+	}
+	rows := reflect.New(reflect.SliceOf(stmt.Schema.ModelType))
+	if err := q.Find(rows.Interface()).Error; err != nil {
+		db.AddError(err)
+		return
+	}
+	stmt.Settings.Store(rowsKey, rows.Elem())
+}
+
+// dimuat returns the rows sebelum loaded, none when the statement changed
+// nothing.
+func dimuat(db *gorm.DB) []reflect.Value {
+	if _, ok := resourceOf(db); !ok || db.RowsAffected == 0 {
+		return nil
+	}
+	v, ok := db.Statement.Settings.Load(rowsKey)
+	if !ok {
+		return nil
+	}
+	return baris(v.(reflect.Value))
+}
+
+func updated(db *gorm.DB) {
+	rows := dimuat(db)
+	if len(rows) == 0 {
+		return
+	}
+	resource, _ := resourceOf(db)
+	stmt := db.Statement
+	ids := make([]interface{}, len(rows))
+	for i, row := range rows {
+		ids[i], _ = stmt.Schema.PrioritizedPrimaryField.ValueOf(stmt.Context, row)
+	}
+	// read back, so the event has what the update wrote and not what the
+	// model held
+	pk := stmt.Schema.PrioritizedPrimaryField.DBName
+	sesudah := reflect.New(reflect.SliceOf(stmt.Schema.ModelType))
+	err := session(db).Model(reflect.New(stmt.Schema.ModelType).Interface()).
+		Where(clause.IN{Column: clause.Column{Table: clause.CurrentTable, Name: pk}, Values: ids}).
+		Order(clause.OrderByColumn{Column: clause.Column{Table: clause.CurrentTable, Name: pk}}).
+		Find(sesudah.Interface()).Error
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	for _, row := range baris(sesudah.Elem()) {
+		db.AddError(publish(session(db), resource, Updated, idOf(db, row), row.Interface()))
+	}
+}
+
+func deleted(db *gorm.DB) {
+	rows := dimuat(db)
+	resource, _ := resourceOf(db)
+	for _, row := range rows {
+		db.AddError(publish(session(db), resource, Deleted, idOf(db, row), row.Interface()))
+	}
+}
+
+// baris returns the structs in v, a struct or a slice of structs or
+// pointers to them.
+func baris(v reflect.Value) []reflect.Value {
+	v = reflect.Indirect(v)
+	switch v.Kind() {
+	case reflect.Struct:
+		return []reflect.Value{v}
+	case reflect.Slice, reflect.Array:
+		rows := make([]reflect.Value, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if row := reflect.Indirect(v.Index(i)); row.Kind() == reflect.Struct {
+				rows = append(rows, row)
+			}
+		}
+		return rows
+	}
+	return nil
+}
+
+func idOf(db *gorm.DB, row reflect.Value) int64 {
+	id, _ := db.Statement.Schema.PrioritizedPrimaryField.ValueOf(db.Statement.Context, row)
+	v := reflect.ValueOf(id)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint())
+	}
+	return 0
+}
@@ -0,0 +1,64 @@
+package outbox
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"uas/apperror"
+)
+
+const (
+	// DefaultLimit and MaxLimit bound how many events GetEvents answers.
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// Handler serves the outbox to consumers that cannot receive webhooks: they
+// keep the next of the last answer and ask for the events after it.
+type Handler struct {
+	db *gorm.DB
+}
+
+func NewHandler(db *gorm.DB) *Handler {
+	return &Handler{db: db}
+}
+
+// GetEvents answers the events after ?after=, at most ?limit=, of the
+// comma-separated ?resource= when given. next is the id to ask after next
+// time, after itself when there was nothing new.
+func (h *Handler) GetEvents(ctx echo.Context) error {
+	var after int64
+	if v := ctx.QueryParam("after"); v != "" {
+		var err error
+		if after, err = strconv.ParseInt(v, 10, 64); err != nil || after < 0 {
+			return apperror.Validation("Invalid after, expected an event id")
+		}
+	}
+	limit := DefaultLimit
+	if v := ctx.QueryParam("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > MaxLimit {
+			return apperror.Validation("Invalid limit, expected 1 to " + strconv.Itoa(MaxLimit))
+		}
+	}
+	var resources []string
+	for _, r := range strings.Split(ctx.QueryParam("resource"), ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			resources = append(resources, r)
+		}
+	}
+
+	events, err := After(h.db.WithContext(ctx.Request().Context()), after, limit, resources...)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Get All Events")
+	}
+	next := after
+	if len(events) > 0 {
+		next = events[len(events)-1].ID
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get All Events", "data": events, "next": next})
+}
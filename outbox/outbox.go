@@ -0,0 +1,200 @@
+// Package outbox records a domain event for every write to a tracked model,
+// in the transaction of the write, so webhooks, search indexes and caches
+// fed from it never see a change that was rolled back nor miss one that was
+// committed.
+//
+// A model is tracked with Track, usually from the init of its package, and
+// the events are written by the GORM plugin installed with Instrument.
+// Consumers either read them with Dispatch, which keeps an offset per
+// consumer in the database, or pull them from GET /events?after=.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	// registers the encrypted serializer Event.Data is stored with
+	_ "uas/encryption"
+)
+
+// Event is one change of a tracked row. ID only grows and is the offset
+// consumers resume from.
+type Event struct {
+	ID int64 `json:"id"`
+	// Event is the resource followed by created, updated or deleted, e.g.
+	// pegawai.updated.
+	Event      string `json:"event" gorm:"size:100"`
+	Resource   string `json:"resource" gorm:"size:50;index"`
+	ResourceID int64  `json:"resource_id"`
+	// Data is the row after the change, or before it for a delete.
+	Data      json.RawMessage `json:"data" gorm:"type:text;serializer:encrypted"`
+	CreatedAt time.Time       `json:"created_at" gorm:"index"`
+}
+
+func (Event) TableName() string {
+	return "outbox"
+}
+
+// Offset is the id of the last event a consumer of Dispatch has handled.
+type Offset struct {
+	Consumer  string `json:"consumer" gorm:"primaryKey;size:100"`
+	Position  int64  `json:"position"`
+	UpdatedAt time.Time
+}
+
+func (Offset) TableName() string {
+	return "outbox_offset"
+}
+
+// Sequence hands out the event ids. publish takes the next one by updating
+// the row, which stays locked until its transaction ends: transactions
+// writing events commit one after the other in id order, and one rolled back
+// gives its id back. Everything up to the highest id a reader sees has been
+// committed, so no offset can move past an event that shows up later.
+type Sequence struct {
+	Name string `gorm:"primaryKey;size:50"`
+	Last int64
+}
+
+func (Sequence) TableName() string {
+	return "outbox_sequence"
+}
+
+const sequence = "outbox"
+
+// Migrate creates the outbox tables, before any tracked row is written. The
+// sequence starts after the events already in the outbox.
+func Migrate(db *gorm.DB) error {
+	if err := db.AutoMigrate(&Event{}, &Offset{}, &Sequence{}); err != nil {
+		return err
+	}
+	var last int64
+	if err := db.Model(&Event{}).Select("COALESCE(MAX(id), 0)").Scan(&last).Error; err != nil {
+		return err
+	}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&Sequence{Name: sequence, Last: last}).Error
+}
+
+const (
+	Created = "created"
+	Updated = "updated"
+	Deleted = "deleted"
+)
+
+var (
+	mu      sync.RWMutex
+	tracked = map[reflect.Type]string{}
+)
+
+// Track makes every write to the table of model an event of resource.
+func Track(model interface{}, resource string) {
+	t := reflect.Indirect(reflect.ValueOf(model)).Type()
+	mu.Lock()
+	defer mu.Unlock()
+	tracked[t] = resource
+}
+
+func resourceOf(db *gorm.DB) (string, bool) {
+	if db.Error != nil || db.Statement.Schema == nil || db.Statement.Schema.PrioritizedPrimaryField == nil {
+		return "", false
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	resource, ok := tracked[db.Statement.Schema.ModelType]
+	return resource, ok
+}
+
+// errNoSequence means the outbox was migrated before it had a Sequence.
+var errNoSequence = errors.New("outbox: no sequence, run migrate")
+
+// nextID takes the next event id in tx, see Sequence.
+func nextID(tx *gorm.DB) (int64, error) {
+	res := tx.Model(&Sequence{}).Where("name = ?", sequence).Update("last", gorm.Expr("last + 1"))
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return 0, errNoSequence
+	}
+	var s Sequence
+	if err := tx.Where("name = ?", sequence).Take(&s).Error; err != nil {
+		return 0, err
+	}
+	return s.Last, nil
+}
+
+// publish adds an event in tx.
+func publish(tx *gorm.DB, resource, kind string, id int64, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	eventID, err := nextID(tx)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&Event{ID: eventID, Event: resource + "." + kind, Resource: resource, ResourceID: id, Data: b}).Error
+}
+
+// After returns up to limit events with an id above after, oldest first.
+// resources narrows them down when given.
+func After(db *gorm.DB, after int64, limit int, resources ...string) ([]Event, error) {
+	q := db.Where("id > ?", after).Order("id").Limit(limit)
+	if len(resources) > 0 {
+		q = q.Where("resource IN ?", resources)
+	}
+	var events []Event
+	err := q.Find(&events).Error
+	return events, err
+}
+
+// errMoved means another worker moved the offset while a batch was handled.
+var errMoved = errors.New("outbox: offset moved")
+
+// Dispatch hands the next events of consumer, at most limit, to handle and
+// moves the offset of consumer past them in the transaction handle writes
+// in. Every event is handled once per consumer: a failed handle leaves the
+// offset so the events come again, and of two workers racing on a batch
+// only the first to move the offset commits. It returns how many events
+// were handled.
+func Dispatch(ctx context.Context, db *gorm.DB, consumer string, limit int, handle func(tx *gorm.DB, events []Event) error) (int, error) {
+	db = db.WithContext(ctx)
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&Offset{Consumer: consumer}).Error; err != nil {
+		return 0, err
+	}
+	var n int
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var o Offset
+		if err := tx.Where("consumer = ?", consumer).Take(&o).Error; err != nil {
+			return err
+		}
+		events, err := After(tx, o.Position, limit)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		if err := handle(tx, events); err != nil {
+			return err
+		}
+		res := tx.Model(&Offset{}).Where("consumer = ? AND position = ?", consumer, o.Position).
+			Update("position", events[len(events)-1].ID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errMoved
+		}
+		n = len(events)
+		return nil
+	})
+	if errors.Is(err, errMoved) {
+		return 0, nil
+	}
+	return n, err
+}
@@ -0,0 +1,369 @@
+package outbox_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"uas/database"
+	"uas/outbox"
+	"uas/testutil"
+)
+
+type Catatan struct {
+	ID  int64  `json:"id"`
+	Isi string `json:"isi"`
+}
+
+// Lain is not tracked.
+type Lain struct {
+	ID  int64
+	Isi string
+}
+
+func init() {
+	outbox.Track(&Catatan{}, "catatan")
+}
+
+func openDB(t *testing.T) *gorm.DB {
+	return testutil.OpenDB(t, func(db *gorm.DB) error {
+		if err := outbox.Migrate(db); err != nil {
+			return err
+		}
+		if err := db.AutoMigrate(&Catatan{}, &Lain{}); err != nil {
+			return err
+		}
+		return db.Create(&[]Catatan{{Isi: "satu"}, {Isi: "dua"}, {Isi: "tiga"}}).Error
+	})
+}
+
+// ringkas lists the events after the three of openDB as "event id data".
+func ringkas(t *testing.T, db *gorm.DB) string {
+	t.Helper()
+	events, err := outbox.After(db, 3, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s []string
+	for _, e := range events {
+		var c Catatan
+		if err := json.Unmarshal(e.Data, &c); err != nil {
+			t.Fatal(err)
+		}
+		s = append(s, fmt.Sprintf("%s %d %s", e.Event, e.ResourceID, c.Isi))
+	}
+	return strings.Join(s, ", ")
+}
+
+func TestInstrument(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(db *gorm.DB) error
+		want  string
+	}{
+		{name: "create", write: func(db *gorm.DB) error {
+			return db.Create(&Catatan{Isi: "empat"}).Error
+		}, want: "catatan.created 4 empat"},
+		{name: "save", write: func(db *gorm.DB) error {
+			return db.Save(&Catatan{ID: 2, Isi: "dua lagi"}).Error
+		}, want: "catatan.updated 2 dua lagi"},
+		{name: "update of a model", write: func(db *gorm.DB) error {
+			return db.Model(&Catatan{ID: 1}).Update("isi", "satu lagi").Error
+		}, want: "catatan.updated 1 satu lagi"},
+		{name: "update by condition", write: func(db *gorm.DB) error {
+			return db.Model(&Catatan{}).Where("id > ?", 1).Update("isi", "banyak").Error
+		}, want: "catatan.updated 2 banyak, catatan.updated 3 banyak"},
+		{name: "update matching nothing", write: func(db *gorm.DB) error {
+			return db.Model(&Catatan{}).Where("id = ?", 9).Update("isi", "tidak ada").Error
+		}},
+		{name: "delete by id", write: func(db *gorm.DB) error {
+			return db.Delete(&Catatan{}, "id = ?", 3).Error
+		}, want: "catatan.deleted 3 tiga"},
+		{name: "delete of a model", write: func(db *gorm.DB) error {
+			return db.Delete(&Catatan{ID: 2}).Error
+		}, want: "catatan.deleted 2 dua"},
+		{name: "in a transaction", write: func(db *gorm.DB) error {
+			return db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Create(&Catatan{Isi: "empat"}).Error; err != nil {
+					return err
+				}
+				return tx.Delete(&Catatan{ID: 1}).Error
+			})
+		}, want: "catatan.created 4 empat, catatan.deleted 1 satu"},
+		{name: "rolled back", write: func(db *gorm.DB) error {
+			db.Transaction(func(tx *gorm.DB) error {
+				tx.Create(&Catatan{Isi: "empat"})
+				return errors.New("batal")
+			})
+			return nil
+		}},
+		{name: "without a model", write: func(db *gorm.DB) error {
+			return db.Table("catatans").Where("id = ?", 1).Update("isi", "diam-diam").Error
+		}},
+		{name: "untracked", write: func(db *gorm.DB) error {
+			return db.Create(&Lain{Isi: "lain"}).Error
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openDB(t)
+			if err := tt.write(db); err != nil {
+				t.Fatal(err)
+			}
+			if got := ringkas(t, db); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("no outbox table", func(t *testing.T) {
+		db := testutil.OpenDB(t, func(db *gorm.DB) error { return db.AutoMigrate(&Catatan{}) })
+		if err := db.Create(&Catatan{Isi: "hilang"}).Error; err == nil {
+			t.Fatal("a write without its event succeeded")
+		}
+		var n int64
+		if db.Model(&Catatan{}).Count(&n); n != 0 {
+			t.Errorf("%d rows written", n)
+		}
+	})
+}
+
+func TestDispatch(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	var diterima []int64
+	terima := func(tx *gorm.DB, events []outbox.Event) error {
+		for _, e := range events {
+			diterima = append(diterima, e.ResourceID)
+		}
+		return nil
+	}
+
+	n, err := outbox.Dispatch(ctx, db, "indeks", 2, terima)
+	if err != nil || n != 2 {
+		t.Fatalf("first batch %d, %v", n, err)
+	}
+	if n, err := outbox.Dispatch(ctx, db, "indeks", 2, func(tx *gorm.DB, events []outbox.Event) error {
+		return errors.New("indeks mati")
+	}); err == nil || n != 0 {
+		t.Fatalf("failed batch %d, %v", n, err)
+	}
+	if n, err := outbox.Dispatch(ctx, db, "indeks", 2, terima); err != nil || n != 1 {
+		t.Fatalf("retried batch %d, %v", n, err)
+	}
+	if n, err := outbox.Dispatch(ctx, db, "indeks", 2, terima); err != nil || n != 0 {
+		t.Fatalf("nothing new %d, %v", n, err)
+	}
+	if fmt.Sprint(diterima) != "[1 2 3]" {
+		t.Errorf("handled %v", diterima)
+	}
+
+	// every consumer has its own offset
+	var cache []int64
+	n, err = outbox.Dispatch(ctx, db, "cache", 10, func(tx *gorm.DB, events []outbox.Event) error {
+		for _, e := range events {
+			cache = append(cache, e.ResourceID)
+		}
+		return nil
+	})
+	if err != nil || n != 3 || fmt.Sprint(cache) != "[1 2 3]" {
+		t.Errorf("cache got %v, %d, %v", cache, n, err)
+	}
+
+	// what handle writes commits with the offset, or not at all
+	_, err = outbox.Dispatch(ctx, db, "tulis", 10, func(tx *gorm.DB, events []outbox.Event) error {
+		if err := tx.Create(&Lain{Isi: "ditulis"}).Error; err != nil {
+			return err
+		}
+		return errors.New("gagal setelah menulis")
+	})
+	var n64 int64
+	if db.Model(&Lain{}).Count(&n64); err == nil || n64 != 0 {
+		t.Errorf("%d rows kept, %v", n64, err)
+	}
+	var o outbox.Offset
+	if db.Take(&o, "consumer = ?", "tulis"); o.Position != 0 {
+		t.Errorf("offset moved to %d", o.Position)
+	}
+}
+
+func TestBroker(t *testing.T) {
+	db := openDB(t)
+	broker := outbox.NewBroker(db)
+	tulis := func(isi ...string) {
+		t.Helper()
+		for _, s := range isi {
+			if err := db.Create(&Catatan{Isi: s}).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// terima reads n events of s, it gives up after a second. false means C
+	// was closed.
+	terima := func(s *outbox.Subscription, n int) ([]int64, bool) {
+		var ids []int64
+		for len(ids) < n {
+			select {
+			case e, ok := <-s.C:
+				if !ok {
+					return ids, false
+				}
+				ids = append(ids, e.ResourceID)
+			case <-time.After(time.Second):
+				return ids, true
+			}
+		}
+		return ids, true
+	}
+
+	t.Run("every subscriber gets every new event", func(t *testing.T) {
+		subs := make([]*outbox.Subscription, 20)
+		for i := range subs {
+			s, err := broker.Subscribe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			subs[i] = s
+		}
+		var wg sync.WaitGroup
+		hasil := make([]string, len(subs))
+		for i, s := range subs {
+			wg.Add(1)
+			go func(i int, s *outbox.Subscription) {
+				defer wg.Done()
+				ids, _ := terima(s, 3)
+				hasil[i] = fmt.Sprint(ids)
+			}(i, s)
+		}
+		// the three of openDB were there before, they are not new
+		tulis("empat", "lima", "enam")
+		wg.Wait()
+		for i, h := range hasil {
+			if h != "[4 5 6]" {
+				t.Errorf("subscriber %d got %s", i, h)
+			}
+		}
+		for _, s := range subs {
+			s.Close()
+			s.Close()
+		}
+	})
+
+	t.Run("a slow subscriber is dropped", func(t *testing.T) {
+		broker.Buffer = 1
+		lambat, err := broker.Subscribe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		broker.Buffer = 256
+		cepat, err := broker.Subscribe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cepat.Close()
+		tulis("tujuh", "delapan")
+		if ids, _ := terima(cepat, 2); fmt.Sprint(ids) != "[7 8]" {
+			t.Errorf("fast one got %v", ids)
+		}
+		if ids, terbuka := terima(lambat, 2); terbuka || fmt.Sprint(ids) != "[7]" {
+			t.Errorf("slow one got %v, still open %v", ids, terbuka)
+		}
+	})
+
+	t.Run("close ends every subscription", func(t *testing.T) {
+		s, err := broker.Subscribe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		broker.Close()
+		if _, terbuka := terima(s, 1); terbuka {
+			t.Error("subscription still open")
+		}
+		if _, err := broker.Subscribe(); !errors.Is(err, outbox.ErrClosed) {
+			t.Errorf("subscribe after close: %v", err)
+		}
+	})
+}
+
+// A transaction that takes an event id and commits after a later writer has
+// started must not be passed: the later writer waits for it, so no reader
+// sees a higher id before the lower one.
+func TestLateCommit(t *testing.T) {
+	ctx := context.Background()
+	// a file, so the transactions below have connections of their own
+	db, err := database.Open(database.Config{Driver: database.SQLite, DSN: filepath.Join(t.TempDir(), "outbox.db"), LogLevel: logger.Silent})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close(db) })
+	if err := outbox.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&Catatan{}); err != nil {
+		t.Fatal(err)
+	}
+
+	lambat := db.Begin()
+	if err := lambat.Create(&Catatan{Isi: "lambat"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	cepat := make(chan error, 1)
+	go func() { cepat <- db.Create(&Catatan{Isi: "cepat"}).Error }()
+
+	var diterima []string
+	terima := func(tx *gorm.DB, events []outbox.Event) error {
+		for _, e := range events {
+			var c Catatan
+			if err := json.Unmarshal(e.Data, &c); err != nil {
+				return err
+			}
+			diterima = append(diterima, fmt.Sprintf("%d %s", e.ID, c.Isi))
+		}
+		return nil
+	}
+	select {
+	case err := <-cepat:
+		t.Fatalf("the later write committed before the earlier one: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if events, err := outbox.After(db, 0, 10); err != nil || len(events) != 0 {
+		t.Fatalf("events before any commit: %v, %v", events, err)
+	}
+
+	if err := lambat.Commit().Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-cepat; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := outbox.Dispatch(ctx, db, "indeks", 10, terima); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(diterima, ", "); got != "1 lambat, 2 cepat" {
+		t.Errorf("handled %s", got)
+	}
+
+	// a rolled back transaction gives its id back
+	db.Transaction(func(tx *gorm.DB) error {
+		tx.Create(&Catatan{Isi: "batal"})
+		return errors.New("batal")
+	})
+	if err := db.Create(&Catatan{Isi: "tiga"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := outbox.Dispatch(ctx, db, "indeks", 10, terima); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(diterima, ", "); got != "1 lambat, 2 cepat, 3 tiga" {
+		t.Errorf("handled %s", got)
+	}
+}
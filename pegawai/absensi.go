@@ -0,0 +1,571 @@
+package pegawai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"uas/apperror"
+)
+
+const layoutJam = "15:04"
+
+// Klasifikasi kehadiran harian.
+const (
+	KehadiranHadir       = "hadir"
+	KehadiranTerlambat   = "terlambat"
+	KehadiranPulangCepat = "pulang_cepat"
+	KehadiranAlpa        = "alpa"
+	KehadiranCuti        = "cuti"
+	KehadiranLibur       = "libur"
+)
+
+// HariLibur is a public holiday or collective leave day (cuti bersama).
+type HariLibur struct {
+	ID         int64     `json:"id"`
+	Tanggal    time.Time `json:"tanggal" gorm:"uniqueIndex"`
+	Keterangan string    `json:"keterangan"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (HariLibur) TableName() string {
+	return "hari_libur"
+}
+
+// JadwalKerja is the working schedule of a unit. HariKerja lists the working
+// weekdays as numbers separated by commas, 0 being Sunday.
+type JadwalKerja struct {
+	ID             int64     `json:"id"`
+	Unit           string    `json:"unit" gorm:"size:100;uniqueIndex"`
+	JamMasuk       string    `json:"jam_masuk" gorm:"size:5"`
+	JamPulang      string    `json:"jam_pulang" gorm:"size:5"`
+	ToleransiMenit int       `json:"toleransi_menit"`
+	HariKerja      string    `json:"hari_kerja" gorm:"size:20"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func (JadwalKerja) TableName() string {
+	return "jadwal_kerja"
+}
+
+// jadwalDefault applies to units without their own JadwalKerja.
+var jadwalDefault = JadwalKerja{JamMasuk: "08:00", JamPulang: "16:00", HariKerja: "1,2,3,4,5"}
+
+// isHariKerja reports whether the weekday of t is a working day.
+func (j *JadwalKerja) isHariKerja(t time.Time) bool {
+	for _, s := range strings.Split(j.HariKerja, ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(s)); err == nil && time.Weekday(n) == t.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// jam returns the time of day jam ("HH:MM") on the date of t.
+func jam(t time.Time, jam string) time.Time {
+	j, _ := time.ParseInLocation(layoutJam, jam, t.Location())
+	return time.Date(t.Year(), t.Month(), t.Day(), j.Hour(), j.Minute(), 0, 0, t.Location())
+}
+
+func validJadwal(j *JadwalKerja) error {
+	masuk, err := time.Parse(layoutJam, j.JamMasuk)
+	if err != nil {
+		return errors.New("Invalid jam_masuk, expected HH:MM")
+	}
+	pulang, err := time.Parse(layoutJam, j.JamPulang)
+	if err != nil {
+		return errors.New("Invalid jam_pulang, expected HH:MM")
+	}
+	if !pulang.After(masuk) {
+		return errors.New("jam_pulang must be after jam_masuk")
+	}
+	if j.ToleransiMenit < 0 {
+		return errors.New("toleransi_menit must not be negative")
+	}
+	for _, s := range strings.Split(j.HariKerja, ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(s)); err != nil || n < 0 || n > 6 {
+			return errors.New("Invalid hari_kerja, expected weekday numbers 0-6 separated by commas")
+		}
+	}
+	return nil
+}
+
+// jadwalKerjaUnit returns the schedule of a unit, falling back to jadwalDefault.
+func jadwalKerjaUnit(db *gorm.DB, unit string) (*JadwalKerja, error) {
+	var jadwal JadwalKerja
+	err := db.Where("unit = ?", unit).First(&jadwal).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		jadwal = jadwalDefault
+		jadwal.Unit = unit
+		return &jadwal, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &jadwal, nil
+}
+
+// hariLiburAntara returns the holidays between awal and akhir inclusive,
+// keyed by date.
+func hariLiburAntara(db *gorm.DB, awal, akhir time.Time) (map[string]string, error) {
+	rows := make([]*HariLibur, 0)
+	if err := db.Where("tanggal >= ? AND tanggal <= ?", awal, akhir).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	libur := make(map[string]string, len(rows))
+	for _, r := range rows {
+		libur[r.Tanggal.Format(layoutTanggal)] = r.Keterangan
+	}
+	return libur, nil
+}
+
+// Absensi is the attendance record of one Pegawai on one day.
+type Absensi struct {
+	ID         int64      `json:"id"`
+	PegawaiID  int64      `json:"pegawai_id" gorm:"uniqueIndex:idx_absensi_harian"`
+	Tanggal    time.Time  `json:"tanggal" gorm:"uniqueIndex:idx_absensi_harian"`
+	JamMasuk   *time.Time `json:"jam_masuk"`
+	JamPulang  *time.Time `json:"jam_pulang"`
+	Keterangan string     `json:"keterangan"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+func (Absensi) TableName() string {
+	return "absensi"
+}
+
+type AbsensiHandler struct {
+	db *gorm.DB
+}
+
+func NewAbsensiHandler(db *gorm.DB) *AbsensiHandler {
+	return &AbsensiHandler{db: db}
+}
+
+type HariLiburRequest struct {
+	ID         int64  `param:"id"`
+	Tanggal    string `json:"tanggal"`
+	Keterangan string `json:"keterangan"`
+}
+
+type JadwalKerjaRequest struct {
+	ID             int64  `param:"id"`
+	Unit           string `json:"unit"`
+	JamMasuk       string `json:"jam_masuk"`
+	JamPulang      string `json:"jam_pulang"`
+	ToleransiMenit int    `json:"toleransi_menit"`
+	HariKerja      string `json:"hari_kerja"`
+}
+
+type AbsensiRequest struct {
+	ID        int64  `param:"id"`
+	JamMasuk  string `json:"jam_masuk"`
+	JamPulang string `json:"jam_pulang"`
+	// Keterangan is left as it is when absent.
+	Keterangan *string `json:"keterangan"`
+}
+
+func (h *AbsensiHandler) GetAllHariLibur(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	hariLibur := make([]*HariLibur, 0)
+	query := db.Model(&HariLibur{})
+	if tahun := ctx.QueryParam("tahun"); tahun != "" {
+		t, err := strconv.Atoi(tahun)
+		if err != nil {
+			return apperror.Validation("Invalid tahun")
+		}
+		awal := time.Date(t, time.January, 1, 0, 0, 0, 0, time.Local)
+		query = query.Where("tanggal >= ? AND tanggal < ?", awal, awal.AddDate(1, 0, 0))
+	}
+	if err := query.Order("tanggal").Find(&hariLibur).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Get All Hari Libur")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get All Hari Libur", "data": hariLibur})
+}
+
+func (h *AbsensiHandler) CreateHariLibur(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	var input HariLiburRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+	tanggal, err := time.ParseInLocation(layoutTanggal, input.Tanggal, time.Local)
+	if err != nil {
+		return apperror.Validation("Invalid tanggal, expected YYYY-MM-DD")
+	}
+
+	hariLibur := &HariLibur{Tanggal: tanggal, Keterangan: input.Keterangan}
+	if err := db.Create(hariLibur).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Create Hari Libur")
+	}
+	return ctx.JSON(http.StatusCreated, map[string]interface{}{"message": "Successfully Create a Hari Libur", "data": hariLibur})
+}
+
+func (h *AbsensiHandler) DeleteHariLibur(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	id := ctx.Param("id")
+	if err := db.Delete(&HariLibur{}, "id = ?", id).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Delete Hari Libur")
+	}
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+func (h *AbsensiHandler) GetAllJadwalKerja(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	jadwal := make([]*JadwalKerja, 0)
+	if err := db.Order("unit").Find(&jadwal).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Get All Jadwal Kerja")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get All Jadwal Kerja", "data": jadwal, "default": jadwalDefault})
+}
+
+func (h *AbsensiHandler) CreateJadwalKerja(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	var input JadwalKerjaRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+	if input.Unit == "" {
+		return apperror.Validation("Unit is required")
+	}
+
+	jadwal := &JadwalKerja{
+		Unit:           input.Unit,
+		JamMasuk:       input.JamMasuk,
+		JamPulang:      input.JamPulang,
+		ToleransiMenit: input.ToleransiMenit,
+		HariKerja:      input.HariKerja,
+	}
+	if err := validJadwal(jadwal); err != nil {
+		return apperror.Validation(err.Error())
+	}
+	if err := db.Create(jadwal).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Create Jadwal Kerja")
+	}
+	return ctx.JSON(http.StatusCreated, map[string]interface{}{"message": "Successfully Create a Jadwal Kerja", "data": jadwal})
+}
+
+func (h *AbsensiHandler) UpdateJadwalKerja(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	var input JadwalKerjaRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+
+	var jadwal JadwalKerja
+	if err := db.First(&jadwal, input.ID).Error; err != nil {
+		return apperror.Lookup(err, "Jadwal Kerja not found")
+	}
+	jadwal.JamMasuk = input.JamMasuk
+	jadwal.JamPulang = input.JamPulang
+	jadwal.ToleransiMenit = input.ToleransiMenit
+	jadwal.HariKerja = input.HariKerja
+	if err := validJadwal(&jadwal); err != nil {
+		return apperror.Validation(err.Error())
+	}
+
+	if err := db.Save(&jadwal).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Update Jadwal Kerja")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Update Jadwal Kerja", "data": jadwal})
+}
+
+func (h *AbsensiHandler) DeleteJadwalKerja(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	id := ctx.Param("id")
+	if err := db.Delete(&JadwalKerja{}, "id = ?", id).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Delete Jadwal Kerja")
+	}
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// CheckIn records the check-in time of today's attendance of the Pegawai
+// linked to the caller.
+func (h *AbsensiHandler) CheckIn(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	pegawaiID := *penggunaDari(ctx).PegawaiID
+	if err := db.First(&Pegawai{}, pegawaiID).Error; err != nil {
+		return apperror.Lookup(err, "Pegawai not found")
+	}
+
+	now := time.Now()
+	tanggal := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	var absensi Absensi
+	err := db.Where("pegawai_id = ? AND tanggal = ?", pegawaiID, tanggal).First(&absensi).Error
+	if err == nil && absensi.JamMasuk != nil {
+		return apperror.Conflict("Already checked in today").WithData(absensi)
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return apperror.Wrap(err, "Failed to Check In")
+	}
+
+	absensi.PegawaiID = pegawaiID
+	absensi.Tanggal = tanggal
+	absensi.JamMasuk = &now
+	if err := db.Save(&absensi).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Check In")
+	}
+	return ctx.JSON(http.StatusCreated, map[string]interface{}{"message": "Successfully Check In", "data": absensi})
+}
+
+// CheckOut records the check-out time of today's attendance of the Pegawai
+// linked to the caller. Checking out again overwrites the previous
+// check-out time.
+func (h *AbsensiHandler) CheckOut(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	pegawaiID := *penggunaDari(ctx).PegawaiID
+
+	now := time.Now()
+	tanggal := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	var absensi Absensi
+	if err := db.Where("pegawai_id = ? AND tanggal = ?", pegawaiID, tanggal).First(&absensi).Error; err != nil {
+		return apperror.Conflict("Not checked in today")
+	}
+
+	absensi.JamPulang = &now
+	if err := db.Save(&absensi).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Check Out")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Check Out", "data": absensi})
+}
+
+func (h *AbsensiHandler) GetAllAbsensi(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	absensi := make([]*Absensi, 0)
+	query := db.Model(&Absensi{})
+	if pegawaiID := ctx.QueryParam("pegawai_id"); pegawaiID != "" {
+		query = query.Where("pegawai_id = ?", pegawaiID)
+	}
+	if q := ctx.QueryParam("tanggal"); q != "" {
+		tanggal, err := time.ParseInLocation(layoutTanggal, q, time.Local)
+		if err != nil {
+			return apperror.Validation("Invalid tanggal, expected YYYY-MM-DD")
+		}
+		query = query.Where("tanggal = ?", tanggal)
+	}
+	if err := query.Order("tanggal DESC, pegawai_id").Find(&absensi).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Get All Absensi")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get All Absensi", "data": absensi})
+}
+
+// UpdateAbsensi lets HR correct the check-in and check-out times (HH:MM) of
+// a record, e.g. when an employee forgot to check out.
+func (h *AbsensiHandler) UpdateAbsensi(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	var input AbsensiRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+
+	var absensi Absensi
+	if err := db.First(&absensi, input.ID).Error; err != nil {
+		return apperror.Lookup(err, "Absensi not found")
+	}
+	for _, f := range []struct {
+		nilai string
+		ke    **time.Time
+	}{{input.JamMasuk, &absensi.JamMasuk}, {input.JamPulang, &absensi.JamPulang}} {
+		if f.nilai == "" {
+			continue
+		}
+		if _, err := time.Parse(layoutJam, f.nilai); err != nil {
+			return apperror.Validation("Invalid jam, expected HH:MM")
+		}
+		t := jam(absensi.Tanggal, f.nilai)
+		*f.ke = &t
+	}
+	if input.Keterangan != nil {
+		absensi.Keterangan = *input.Keterangan
+	}
+
+	if err := db.Save(&absensi).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Update Absensi")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Update Absensi", "data": absensi})
+}
+
+// KehadiranHarian is the classification of one day in a recap.
+type KehadiranHarian struct {
+	Tanggal    string     `json:"tanggal"`
+	Status     []string   `json:"status"`
+	JamMasuk   *time.Time `json:"jam_masuk"`
+	JamPulang  *time.Time `json:"jam_pulang"`
+	Keterangan string     `json:"keterangan,omitempty"`
+}
+
+// RekapAbsensi summarizes the attendance of one Pegawai in one month.
+type RekapAbsensi struct {
+	PegawaiID   int64              `json:"pegawai_id"`
+	Nama        string             `json:"nama"`
+	Unit        string             `json:"unit"`
+	Bulan       string             `json:"bulan"`
+	HariKerja   int                `json:"hari_kerja"`
+	Hadir       int                `json:"hadir"`
+	Terlambat   int                `json:"terlambat"`
+	PulangCepat int                `json:"pulang_cepat"`
+	Alpa        int                `json:"alpa"`
+	Cuti        int                `json:"cuti"`
+	Libur       int                `json:"libur"`
+	Harian      []*KehadiranHarian `json:"harian,omitempty"`
+}
+
+// rekap classifies every day of the month for a Pegawai up to today. Days
+// that are not working days by the unit schedule or are holidays count as
+// libur; approved leave counts as cuti and is never alpa.
+func (h *AbsensiHandler) rekap(ctx context.Context, pegawai *Pegawai, awal time.Time, libur map[string]string) (*RekapAbsensi, error) {
+	db := h.db.WithContext(ctx)
+	akhir := awal.AddDate(0, 1, -1)
+	jadwal, err := jadwalKerjaUnit(db, pegawai.Unit)
+	if err != nil {
+		return nil, err
+	}
+
+	absensi := make([]*Absensi, 0)
+	if err := db.Where("pegawai_id = ? AND tanggal >= ? AND tanggal <= ?", pegawai.ID, awal, akhir).Find(&absensi).Error; err != nil {
+		return nil, err
+	}
+	perTanggal := make(map[string]*Absensi, len(absensi))
+	for _, a := range absensi {
+		perTanggal[a.Tanggal.Format(layoutTanggal)] = a
+	}
+
+	cuti := make([]*PengajuanCuti, 0)
+	err = db.Where("pegawai_id = ? AND status = ?", pegawai.ID, StatusCutiDisetujui).
+		Where("tanggal_mulai <= ? AND tanggal_selesai >= ?", akhir, awal).
+		Find(&cuti).Error
+	if err != nil {
+		return nil, err
+	}
+	isCuti := func(d time.Time) bool {
+		for _, c := range cuti {
+			if !d.Before(c.TanggalMulai) && !d.After(c.TanggalSelesai) {
+				return true
+			}
+		}
+		return false
+	}
+
+	rekap := &RekapAbsensi{PegawaiID: pegawai.ID, Nama: pegawai.Nama, Unit: pegawai.Unit, Bulan: awal.Format("2006-01")}
+	hariIni := time.Now()
+	for d := awal; !d.After(akhir) && !d.After(hariIni); d = d.AddDate(0, 0, 1) {
+		key := d.Format(layoutTanggal)
+		harian := &KehadiranHarian{Tanggal: key, Status: make([]string, 0, 2)}
+		if a, ok := perTanggal[key]; ok {
+			harian.JamMasuk, harian.JamPulang, harian.Keterangan = a.JamMasuk, a.JamPulang, a.Keterangan
+		}
+		rekap.Harian = append(rekap.Harian, harian)
+
+		if ket, ok := libur[key]; ok || !jadwal.isHariKerja(d) {
+			if ok && harian.Keterangan == "" {
+				harian.Keterangan = ket
+			}
+			harian.Status = append(harian.Status, KehadiranLibur)
+			rekap.Libur++
+			continue
+		}
+		rekap.HariKerja++
+		if isCuti(d) {
+			harian.Status = append(harian.Status, KehadiranCuti)
+			rekap.Cuti++
+			continue
+		}
+		if harian.JamMasuk == nil {
+			harian.Status = append(harian.Status, KehadiranAlpa)
+			rekap.Alpa++
+			continue
+		}
+
+		rekap.Hadir++
+		batasMasuk := jam(d, jadwal.JamMasuk).Add(time.Duration(jadwal.ToleransiMenit) * time.Minute)
+		if harian.JamMasuk.After(batasMasuk) {
+			harian.Status = append(harian.Status, KehadiranTerlambat)
+			rekap.Terlambat++
+		}
+		// A missing check-out only counts once the day is over.
+		selesai := harian.JamPulang != nil || key != hariIni.Format(layoutTanggal)
+		if selesai && (harian.JamPulang == nil || harian.JamPulang.Before(jam(d, jadwal.JamPulang))) {
+			harian.Status = append(harian.Status, KehadiranPulangCepat)
+			rekap.PulangCepat++
+		}
+		if len(harian.Status) == 0 {
+			harian.Status = append(harian.Status, KehadiranHadir)
+		}
+	}
+	return rekap, nil
+}
+
+// GetRekapAbsensi returns the monthly recap (?bulan=YYYY-MM) for one Pegawai
+// (?pegawai_id=) with daily details, or for every Pegawai of a unit (?unit=).
+// Only peranLihatData see the recap of others, a Pegawai sees their own.
+func (h *AbsensiHandler) GetRekapAbsensi(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	pengguna := penggunaDari(ctx)
+	pegawaiID := ctx.QueryParam("pegawai_id")
+	unit := ctx.QueryParam("unit")
+	if pegawaiID == "" && unit == "" {
+		return apperror.Validation("pegawai_id or unit is required")
+	}
+	var id int64
+	if pegawaiID != "" {
+		var err error
+		if id, err = strconv.ParseInt(pegawaiID, 10, 64); err != nil {
+			return apperror.Validation("Invalid pegawai_id")
+		}
+	}
+	if !slices.Contains(peranLihatData, pengguna.Peran) && (pegawaiID == "" || pengguna.PegawaiID == nil || *pengguna.PegawaiID != id) {
+		return apperror.Forbidden("Only your own Rekap Absensi is allowed for peran " + pengguna.Peran)
+	}
+
+	now := time.Now()
+	awal := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	if q := ctx.QueryParam("bulan"); q != "" {
+		t, err := time.ParseInLocation("2006-01", q, time.Local)
+		if err != nil {
+			return apperror.Validation("Invalid bulan, expected YYYY-MM")
+		}
+		awal = t
+	}
+	libur, err := hariLiburAntara(db, awal, awal.AddDate(0, 1, -1))
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Get Rekap Absensi")
+	}
+
+	if pegawaiID != "" {
+		var pegawai Pegawai
+		if err := db.First(&pegawai, id).Error; err != nil {
+			return apperror.Lookup(err, "Pegawai not found")
+		}
+		rekap, err := h.rekap(ctx.Request().Context(), &pegawai, awal, libur)
+		if err != nil {
+			return apperror.Wrap(err, "Failed to Get Rekap Absensi")
+		}
+		return ctx.JSON(http.StatusOK, map[string]interface{}{"message": fmt.Sprintf("Successfully Get Rekap Absensi By Pegawai ID: %s", pegawaiID), "data": rekap})
+	}
+
+	pegawais := make([]*Pegawai, 0)
+	if err := db.Where("unit = ?", unit).Order("nama").Find(&pegawais).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Get Rekap Absensi")
+	}
+	rekaps := make([]*RekapAbsensi, 0, len(pegawais))
+	for _, p := range pegawais {
+		rekap, err := h.rekap(ctx.Request().Context(), p, awal, libur)
+		if err != nil {
+			return apperror.Wrap(err, "Failed to Get Rekap Absensi")
+		}
+		rekap.Harian = nil
+		rekaps = append(rekaps, rekap)
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": fmt.Sprintf("Successfully Get Rekap Absensi By Unit: %s", unit), "data": rekaps})
+}
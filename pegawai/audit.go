@@ -0,0 +1,73 @@
+package pegawai
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"uas/apperror"
+)
+
+// Aksi of an Audit entry.
+const (
+	AuditEkspor      = "ekspor_data_pribadi"
+	AuditAnonimisasi = "anonimisasi"
+)
+
+// Audit is an entry of the audit log of what was done with personal data.
+// PenggunaID is who did it, nil for the system.
+type Audit struct {
+	ID         int64     `json:"id"`
+	Aksi       string    `json:"aksi" gorm:"size:30;index"`
+	Entitas    string    `json:"entitas" gorm:"size:50;index:idx_audit_entitas"`
+	EntitasID  int64     `json:"entitas_id" gorm:"index:idx_audit_entitas"`
+	PenggunaID *int64    `json:"pengguna_id"`
+	Keterangan string    `json:"keterangan"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (Audit) TableName() string {
+	return "audit_log"
+}
+
+// catatAudit adds an Audit entry.
+func catatAudit(tx *gorm.DB, aksi, entitas string, entitasID int64, oleh *int64, keterangan string) error {
+	return tx.Create(&Audit{Aksi: aksi, Entitas: entitas, EntitasID: entitasID, PenggunaID: oleh, Keterangan: keterangan}).Error
+}
+
+// idPengguna returns the id of the logged in account, nil without one.
+func idPengguna(ctx echo.Context) *int64 {
+	if pengguna := penggunaDari(ctx); pengguna != nil {
+		return &pengguna.ID
+	}
+	return nil
+}
+
+type AuditHandler struct {
+	db *gorm.DB
+}
+
+func NewAuditHandler(db *gorm.DB) *AuditHandler {
+	return &AuditHandler{db: db}
+}
+
+func (h *AuditHandler) GetAllAudit(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	audit := make([]*Audit, 0)
+	query := db.Model(&Audit{})
+	if aksi := ctx.QueryParam("aksi"); aksi != "" {
+		query = query.Where("aksi = ?", aksi)
+	}
+	if entitas := ctx.QueryParam("entitas"); entitas != "" {
+		query = query.Where("entitas = ?", entitas)
+	}
+	if entitasID := ctx.QueryParam("entitas_id"); entitasID != "" {
+		query = query.Where("entitas_id = ?", entitasID)
+	}
+	if err := query.Order("id DESC").Find(&audit).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Get All Audit")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get All Audit", "data": audit})
+}
@@ -0,0 +1,342 @@
+package pegawai
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"uas/apperror"
+)
+
+// Peran pengguna.
+const (
+	PeranAdmin     = "admin"
+	PeranHR        = "hr"
+	PeranPenyetuju = "penyetuju"
+	PeranPegawai   = "pegawai"
+)
+
+var daftarPeran = []string{PeranAdmin, PeranHR, PeranPenyetuju, PeranPegawai}
+
+const masaBerlakuSesi = 24 * time.Hour
+
+// Pengguna is an account that can log in to the API. PegawaiID links the
+// account to the employee it belongs to, if any.
+type Pengguna struct {
+	ID           int64     `json:"id"`
+	Username     string    `json:"username" gorm:"size:100;uniqueIndex"`
+	PasswordHash string    `json:"-"`
+	Peran        string    `json:"peran" gorm:"size:20"`
+	PegawaiID    *int64    `json:"pegawai_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+func (Pengguna) TableName() string {
+	return "pengguna"
+}
+
+// Sesi is a bearer token issued at login. Only the SHA-256 of the token is
+// stored.
+type Sesi struct {
+	ID         int64     `json:"id"`
+	PenggunaID int64     `json:"pengguna_id" gorm:"index"`
+	TokenHash  string    `json:"-" gorm:"size:64;uniqueIndex"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (Sesi) TableName() string {
+	return "sesi"
+}
+
+type AuthHandler struct {
+	db *gorm.DB
+}
+
+func NewAuthHandler(db *gorm.DB) *AuthHandler {
+	return &AuthHandler{db: db}
+}
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type PenggunaRequest struct {
+	ID        int64  `param:"id"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	Peran     string `json:"peran"`
+	PegawaiID *int64 `json:"pegawai_id"`
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// bootstrapAdmin creates the "admin" account from ADMIN_PASSWORD when there
+// are no accounts yet, so a fresh install can be administered.
+func bootstrapAdmin(db *gorm.DB) error {
+	var jumlah int64
+	if err := db.Model(&Pengguna{}).Count(&jumlah).Error; err != nil {
+		return err
+	}
+	if jumlah > 0 {
+		return nil
+	}
+	password := os.Getenv("ADMIN_PASSWORD")
+	if password == "" {
+		slog.Warn("No pengguna yet, set ADMIN_PASSWORD to create the admin account")
+		return nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return db.Create(&Pengguna{Username: "admin", PasswordHash: string(hash), Peran: PeranAdmin}).Error
+}
+
+// penggunaDari returns the authenticated account of the request, or nil.
+func penggunaDari(ctx echo.Context) *Pengguna {
+	pengguna, _ := ctx.Get("pengguna").(*Pengguna)
+	return pengguna
+}
+
+// AuthMiddleware resolves the bearer token of a request to its Pengguna.
+// Requests without a token pass through anonymously; use RequirePeran to
+// protect a route.
+func AuthMiddleware(db *gorm.DB) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			header := ctx.Request().Header.Get(echo.HeaderAuthorization)
+			if header == "" {
+				return next(ctx)
+			}
+			token, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok {
+				return apperror.Unauthorized("Invalid Authorization header")
+			}
+
+			db := db.WithContext(ctx.Request().Context())
+			var sesi Sesi
+			err := db.Where("token_hash = ? AND expires_at > ?", hashToken(token), time.Now()).First(&sesi).Error
+			if err != nil {
+				return apperror.Unauthorized("Invalid or expired token")
+			}
+			var pengguna Pengguna
+			if err := db.First(&pengguna, sesi.PenggunaID).Error; err != nil {
+				return apperror.Unauthorized("Invalid or expired token")
+			}
+			ctx.Set("pengguna", &pengguna)
+			ctx.Set("sesi", &sesi)
+			return next(ctx)
+		}
+	}
+}
+
+// RequirePeran rejects requests that are not authenticated or whose
+// Pengguna has none of the given roles. Without roles any login is enough.
+func RequirePeran(peran ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			pengguna := penggunaDari(ctx)
+			if pengguna == nil {
+				return apperror.Unauthorized("Login required")
+			}
+			if len(peran) > 0 && !slices.Contains(peran, pengguna.Peran) {
+				return apperror.Forbidden("Not allowed for peran " + pengguna.Peran)
+			}
+			return next(ctx)
+		}
+	}
+}
+
+func (h *AuthHandler) Login(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	var input LoginRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+
+	var pengguna Pengguna
+	if err := db.Where("username = ?", input.Username).First(&pengguna).Error; err != nil {
+		return apperror.Unauthorized("Invalid username or password")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(pengguna.PasswordHash), []byte(input.Password)); err != nil {
+		return apperror.Unauthorized("Invalid username or password")
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return apperror.Wrap(err, "Failed to Login")
+	}
+	token := hex.EncodeToString(buf)
+	sesi := &Sesi{PenggunaID: pengguna.ID, TokenHash: hashToken(token), ExpiresAt: time.Now().Add(masaBerlakuSesi)}
+	if err := db.Create(sesi).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Login")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Login", "data": map[string]interface{}{"token": token, "expires_at": sesi.ExpiresAt, "pengguna": pengguna}})
+}
+
+func (h *AuthHandler) Logout(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	sesi, _ := ctx.Get("sesi").(*Sesi)
+	if sesi != nil {
+		if err := db.Delete(sesi).Error; err != nil {
+			return apperror.Wrap(err, "Failed to Logout")
+		}
+	}
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+func (h *AuthHandler) GetAllPengguna(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	pengguna := make([]*Pengguna, 0)
+	if err := db.Order("username").Find(&pengguna).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Get All Pengguna")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get All Pengguna", "data": pengguna})
+}
+
+func (h *AuthHandler) validPengguna(ctx context.Context, input *PenggunaRequest) error {
+	db := h.db.WithContext(ctx)
+	if !slices.Contains(daftarPeran, input.Peran) {
+		return fmt.Errorf("Invalid peran, expected one of %s", strings.Join(daftarPeran, ", "))
+	}
+	if input.PegawaiID != nil {
+		if err := db.First(&Pegawai{}, *input.PegawaiID).Error; err != nil {
+			return errors.New("Pegawai not found")
+		}
+	}
+	return nil
+}
+
+// buatPengguna validates input and creates its account, for CreatePengguna
+// and the "user create" command.
+func (h *AuthHandler) buatPengguna(ctx context.Context, input PenggunaRequest) (*Pengguna, error) {
+	if input.Username == "" || len(input.Password) < 8 {
+		return nil, apperror.Validation("Username is required and password needs at least 8 characters")
+	}
+	if err := h.validPengguna(ctx, &input); err != nil {
+		return nil, apperror.Validation(err.Error())
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, apperror.Wrap(err, "Failed to Create Pengguna")
+	}
+	pengguna := &Pengguna{
+		Username:     input.Username,
+		PasswordHash: string(hash),
+		Peran:        input.Peran,
+		PegawaiID:    input.PegawaiID,
+	}
+	if err := h.db.WithContext(ctx).Create(pengguna).Error; err != nil {
+		return nil, apperror.Wrap(err, "Failed to Create Pengguna")
+	}
+	return pengguna, nil
+}
+
+func (h *AuthHandler) CreatePengguna(ctx echo.Context) error {
+	var input PenggunaRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+	pengguna, err := h.buatPengguna(ctx.Request().Context(), input)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusCreated, map[string]interface{}{"message": "Successfully Create a Pengguna", "data": pengguna})
+}
+
+// UpdatePengguna changes the role and linked Pegawai of an account, and its
+// password when one is given. A new role or password logs the account out
+// everywhere, so old tokens do not keep the old rights.
+func (h *AuthHandler) UpdatePengguna(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	var input PenggunaRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+	if err := h.validPengguna(ctx.Request().Context(), &input); err != nil {
+		return apperror.Validation(err.Error())
+	}
+
+	var pengguna Pengguna
+	if err := db.First(&pengguna, input.ID).Error; err != nil {
+		return apperror.Lookup(err, "Pengguna not found")
+	}
+	keluar := pengguna.Peran != input.Peran || input.Password != ""
+	pengguna.Peran = input.Peran
+	pengguna.PegawaiID = input.PegawaiID
+	if input.Password != "" {
+		if len(input.Password) < 8 {
+			return apperror.Validation("Password needs at least 8 characters")
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return apperror.Wrap(err, "Failed to Update Pengguna")
+		}
+		pengguna.PasswordHash = string(hash)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&pengguna).Error; err != nil {
+			return err
+		}
+		if !keluar {
+			return nil
+		}
+		return tx.Where("pengguna_id = ?", pengguna.ID).Delete(&Sesi{}).Error
+	})
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Update Pengguna")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Update Pengguna", "data": pengguna})
+}
+
+func (h *AuthHandler) DeletePengguna(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	id := ctx.Param("id")
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("pengguna_id = ?", id).Delete(&Sesi{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Pengguna{}, "id = ?", id).Error
+	})
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Delete Pengguna")
+	}
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// RequirePegawai rejects requests whose Pengguna is not linked to a Pegawai.
+func RequirePegawai() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			pengguna := penggunaDari(ctx)
+			if pengguna == nil {
+				return apperror.Unauthorized("Login required")
+			}
+			if pengguna.PegawaiID == nil {
+				return apperror.NotFound("Pengguna is not linked to a Pegawai")
+			}
+			return next(ctx)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package pegawai
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"uas/cli"
+	"uas/outbox"
+	"uas/referensi"
+)
+
+// Service is the pegawai service for package cli.
+func Service() cli.Service {
+	return cli.Service{
+		Name:      "pegawai",
+		Migrate:   migrate,
+		Tables:    semuaTabel(),
+		Rollback:  rollback,
+		NewServer: newServer,
+		Data: map[string]interface{}{
+			"pegawai":          &Pegawai{},
+			"kontak_pegawai":   &KontakPegawai{},
+			"anggota_keluarga": &AnggotaKeluarga{},
+			"jenis_cuti":       &JenisCuti{},
+			"jatah_cuti":       &JatahCuti{},
+			"kepala_unit":      &KepalaUnit{},
+			"pengajuan_cuti":   &PengajuanCuti{},
+			"hari_libur":       &HariLibur{},
+			"jadwal_kerja":     &JadwalKerja{},
+			"absensi":          &Absensi{},
+		},
+		Commands: []cli.Command{
+			{Name: "seed demo", Args: "[-n 100] [-seed number]", Short: "create made-up Pegawai with valid NIKs for demos and load tests", Run: seedDemo},
+			{Name: "encrypt", Short: "rewrite the encrypted data with the current key, after a key rotation", Run: encrypt},
+			{Name: "retention", Args: "[-dry-run]", Short: "apply the retention rules once, or list what they would purge", Run: retention},
+			{Name: "user create", Args: "-username name -peran peran [-pegawai-id id] < password", Short: "create a login account, the password is read from stdin", Run: userCreate},
+		},
+		Jobs: []cli.Job{
+			{Name: "retention", Every: cli.Every("RETENTION_INTERVAL", 24*time.Hour), Run: purgeRetensi},
+			{Name: "webhook", Every: cli.Every("WEBHOOK_INTERVAL", 5*time.Second), Run: kirimWebhook},
+		},
+	}
+}
+
+// AksesMaster lets the admin and hr logins of this service change the values
+// of the master-data services.
+func AksesMaster() cli.Akses {
+	peran := []string{PeranAdmin, PeranHR}
+	return cli.Akses{Login: AuthMiddleware, Tulis: RequirePeran(peran...), Peran: peran}
+}
+
+// semuaTabel are datadiri, referensi, the outbox and the tables of tabel,
+// the ones /readyz and "migrate status" check.
+func semuaTabel() []interface{} {
+	return append([]interface{}{&Pegawai{}, &referensi.Referensi{}, &outbox.Event{}, &outbox.Offset{}, &outbox.Sequence{}}, tabel...)
+}
+
+// rollback drops the tables of tabel. datadiri belongs to the Laravel app,
+// referensi and the outbox are shared with the master-data services, they
+// all stay.
+func rollback(db *gorm.DB) error {
+	for i := len(tabel) - 1; i >= 0; i-- {
+		if err := db.Migrator().DropTable(tabel[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stdin is where "user create" reads the password, a test replaces it.
+var stdin io.Reader = os.Stdin
+
+func userCreate(ctx context.Context, db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("user create", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var input PenggunaRequest
+	fs.StringVar(&input.Username, "username", "", "the login name")
+	fs.StringVar(&input.Peran, "peran", "", "one of "+strings.Join(daftarPeran, ", "))
+	pegawaiID := fs.Int64("pegawai-id", 0, "the Pegawai the account belongs to")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return fmt.Errorf("%w: user create -username name -peran peran [-pegawai-id id]", cli.ErrUsage)
+	}
+	if *pegawaiID != 0 {
+		input.PegawaiID = pegawaiID
+	}
+	password, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	input.Password = strings.TrimRight(password, "\r\n")
+
+	if err := migrate(db.WithContext(ctx)); err != nil {
+		return err
+	}
+	pengguna, err := NewAuthHandler(db).buatPengguna(ctx, input)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("pengguna %s created with id %d\n", pengguna.Username, pengguna.ID)
+	return nil
+}
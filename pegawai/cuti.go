@@ -0,0 +1,713 @@
+package pegawai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"uas/apperror"
+)
+
+const layoutTanggal = "2006-01-02"
+
+// Status pengajuan cuti.
+const (
+	StatusCutiDiajukan   = "diajukan"
+	StatusCutiDisetujui  = "disetujui"
+	StatusCutiDitolak    = "ditolak"
+	StatusCutiDibatalkan = "dibatalkan"
+)
+
+// JenisCuti is a leave type, e.g. cuti tahunan, cuti sakit, cuti melahirkan.
+// Only types with PotongSaldo set are counted against the yearly entitlement.
+type JenisCuti struct {
+	ID          int64     `json:"id"`
+	Kode        string    `json:"kode" gorm:"size:32;uniqueIndex"`
+	Nama        string    `json:"nama"`
+	PotongSaldo bool      `json:"potong_saldo"`
+	MaksHari    int       `json:"maks_hari"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (JenisCuti) TableName() string {
+	return "jenis_cuti"
+}
+
+// JatahCuti is the yearly entitlement of a leave type for one JenisPegawai.
+// MaksCarryOver caps how many unused days of the previous year are added.
+type JatahCuti struct {
+	ID            int64     `json:"id"`
+	JenisPegawai  string    `json:"jenis_pegawai" gorm:"size:100;uniqueIndex:idx_jatah_cuti"`
+	JenisCutiID   int64     `json:"jenis_cuti_id" gorm:"uniqueIndex:idx_jatah_cuti"`
+	Tahun         int       `json:"tahun" gorm:"uniqueIndex:idx_jatah_cuti"`
+	JumlahHari    int       `json:"jumlah_hari"`
+	MaksCarryOver int       `json:"maks_carry_over"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func (JatahCuti) TableName() string {
+	return "jatah_cuti"
+}
+
+// KepalaUnit maps a Unit to the Pegawai who approves leave in that unit.
+type KepalaUnit struct {
+	ID        int64     `json:"id"`
+	Unit      string    `json:"unit" gorm:"size:100;uniqueIndex"`
+	PegawaiID int64     `json:"pegawai_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (KepalaUnit) TableName() string {
+	return "kepala_unit"
+}
+
+// PengajuanCuti is a leave request submitted by a Pegawai.
+type PengajuanCuti struct {
+	ID                 int64      `json:"id"`
+	PegawaiID          int64      `json:"pegawai_id" gorm:"index"`
+	JenisCutiID        int64      `json:"jenis_cuti_id"`
+	TanggalMulai       time.Time  `json:"tanggal_mulai" gorm:"index"`
+	TanggalSelesai     time.Time  `json:"tanggal_selesai" gorm:"index"`
+	JumlahHari         int        `json:"jumlah_hari"`
+	Alasan             string     `json:"alasan"`
+	Status             string     `json:"status" gorm:"size:20;index"`
+	DiprosesOleh       *int64     `json:"diproses_oleh"`
+	CatatanPersetujuan string     `json:"catatan_persetujuan"`
+	TanggalDiproses    *time.Time `json:"tanggal_diproses"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+func (PengajuanCuti) TableName() string {
+	return "pengajuan_cuti"
+}
+
+type CutiHandler struct {
+	db *gorm.DB
+}
+
+func NewCutiHandler(db *gorm.DB) *CutiHandler {
+	return &CutiHandler{db: db}
+}
+
+type JenisCutiRequest struct {
+	ID          int64  `param:"id"`
+	Kode        string `json:"kode"`
+	Nama        string `json:"nama"`
+	PotongSaldo bool   `json:"potong_saldo"`
+	MaksHari    int    `json:"maks_hari"`
+}
+
+type JatahCutiRequest struct {
+	ID            int64  `param:"id"`
+	JenisPegawai  string `json:"jenis_pegawai"`
+	JenisCutiID   int64  `json:"jenis_cuti_id"`
+	Tahun         int    `json:"tahun"`
+	JumlahHari    int    `json:"jumlah_hari"`
+	MaksCarryOver int    `json:"maks_carry_over"`
+}
+
+type KepalaUnitRequest struct {
+	ID        int64  `param:"id"`
+	Unit      string `json:"unit"`
+	PegawaiID int64  `json:"pegawai_id"`
+}
+
+type PengajuanCutiRequest struct {
+	JenisCutiID    int64  `json:"jenis_cuti_id"`
+	TanggalMulai   string `json:"tanggal_mulai"`
+	TanggalSelesai string `json:"tanggal_selesai"`
+	Alasan         string `json:"alasan"`
+}
+
+type PersetujuanCutiRequest struct {
+	ID      int64  `param:"id"`
+	Catatan string `json:"catatan"`
+}
+
+// SaldoCuti is the balance of one leave type for one Pegawai in one year.
+type SaldoCuti struct {
+	JenisCutiID int64  `json:"jenis_cuti_id"`
+	JenisCuti   string `json:"jenis_cuti"`
+	Tahun       int    `json:"tahun"`
+	Jatah       int    `json:"jatah"`
+	CarryOver   int    `json:"carry_over"`
+	Terpakai    int    `json:"terpakai"`
+	Menunggu    int    `json:"menunggu"`
+	Sisa        int    `json:"sisa"`
+	Tersedia    int    `json:"tersedia"`
+}
+
+// hitungHariKerja counts the working days between mulai and selesai
+// inclusive, skipping days off by the schedule and holidays.
+func hitungHariKerja(jadwal *JadwalKerja, libur map[string]string, mulai, selesai time.Time) int {
+	jumlah := 0
+	for d := mulai; !d.After(selesai); d = d.AddDate(0, 0, 1) {
+		if _, ok := libur[d.Format(layoutTanggal)]; ok || !jadwal.isHariKerja(d) {
+			continue
+		}
+		jumlah++
+	}
+	return jumlah
+}
+
+// hariDipakai sums the days of requests with the given status for a leave
+// type in a year.
+func (h *CutiHandler) hariDipakai(ctx context.Context, pegawaiID, jenisCutiID int64, tahun int, status string) (int, error) {
+	db := h.db.WithContext(ctx)
+	var total int64
+	awal := time.Date(tahun, time.January, 1, 0, 0, 0, 0, time.Local)
+	akhir := awal.AddDate(1, 0, 0)
+	err := db.Model(&PengajuanCuti{}).
+		Where("pegawai_id = ? AND jenis_cuti_id = ? AND status = ?", pegawaiID, jenisCutiID, status).
+		Where("tanggal_mulai >= ? AND tanggal_mulai < ?", awal, akhir).
+		Select("COALESCE(SUM(jumlah_hari), 0)").
+		Scan(&total).Error
+	return int(total), err
+}
+
+// hitungSaldo computes the balance of a leave type for a year. Unused days
+// of the previous year are carried over, capped by MaksCarryOver of the
+// current year's entitlement. Years without an entitlement have no balance.
+func (h *CutiHandler) hitungSaldo(ctx context.Context, pegawai *Pegawai, jenisCuti *JenisCuti, tahun int) (*SaldoCuti, error) {
+	db := h.db.WithContext(ctx)
+	saldo := &SaldoCuti{JenisCutiID: jenisCuti.ID, JenisCuti: jenisCuti.Nama, Tahun: tahun}
+
+	var jatah JatahCuti
+	err := db.Where("jenis_pegawai = ? AND jenis_cuti_id = ? AND tahun = ?", pegawai.JenisPegawai, jenisCuti.ID, tahun).First(&jatah).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if err == nil {
+		saldo.Jatah = jatah.JumlahHari
+		if jatah.MaksCarryOver > 0 {
+			sebelumnya, err := h.hitungSaldo(ctx, pegawai, jenisCuti, tahun-1)
+			if err != nil {
+				return nil, err
+			}
+			saldo.CarryOver = min(max(sebelumnya.Sisa, 0), jatah.MaksCarryOver)
+		}
+	}
+
+	if saldo.Terpakai, err = h.hariDipakai(ctx, pegawai.ID, jenisCuti.ID, tahun, StatusCutiDisetujui); err != nil {
+		return nil, err
+	}
+	if saldo.Menunggu, err = h.hariDipakai(ctx, pegawai.ID, jenisCuti.ID, tahun, StatusCutiDiajukan); err != nil {
+		return nil, err
+	}
+	saldo.Sisa = saldo.Jatah + saldo.CarryOver - saldo.Terpakai
+	saldo.Tersedia = saldo.Sisa - saldo.Menunggu
+	return saldo, nil
+}
+
+func (h *CutiHandler) GetAllJenisCuti(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	jenisCuti := make([]*JenisCuti, 0)
+	if err := db.Order("id").Find(&jenisCuti).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Get All Jenis Cuti")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get All Jenis Cuti", "data": jenisCuti})
+}
+
+func (h *CutiHandler) CreateJenisCuti(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	var input JenisCutiRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+	if input.Kode == "" || input.Nama == "" {
+		return apperror.Validation("Kode and Nama are required")
+	}
+
+	jenisCuti := &JenisCuti{
+		Kode:        input.Kode,
+		Nama:        input.Nama,
+		PotongSaldo: input.PotongSaldo,
+		MaksHari:    input.MaksHari,
+	}
+	if err := db.Create(jenisCuti).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Create Jenis Cuti")
+	}
+	return ctx.JSON(http.StatusCreated, map[string]interface{}{"message": "Successfully Create a Jenis Cuti", "data": jenisCuti})
+}
+
+func (h *CutiHandler) UpdateJenisCuti(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	var input JenisCutiRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+
+	var jenisCuti JenisCuti
+	if err := db.First(&jenisCuti, input.ID).Error; err != nil {
+		return apperror.Lookup(err, "Jenis Cuti not found")
+	}
+	jenisCuti.Kode = input.Kode
+	jenisCuti.Nama = input.Nama
+	jenisCuti.PotongSaldo = input.PotongSaldo
+	jenisCuti.MaksHari = input.MaksHari
+
+	if err := db.Save(&jenisCuti).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Update Jenis Cuti")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Update Jenis Cuti", "data": jenisCuti})
+}
+
+func (h *CutiHandler) DeleteJenisCuti(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	id := ctx.Param("id")
+	if err := db.Delete(&JenisCuti{}, "id = ?", id).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Delete Jenis Cuti")
+	}
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+func (h *CutiHandler) GetAllJatahCuti(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	jatahCuti := make([]*JatahCuti, 0)
+	query := db.Model(&JatahCuti{})
+	if jenisPegawai := ctx.QueryParam("jenis_pegawai"); jenisPegawai != "" {
+		query = query.Where("jenis_pegawai = ?", jenisPegawai)
+	}
+	if tahun := ctx.QueryParam("tahun"); tahun != "" {
+		query = query.Where("tahun = ?", tahun)
+	}
+	if err := query.Order("tahun, jenis_pegawai, jenis_cuti_id").Find(&jatahCuti).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Get All Jatah Cuti")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get All Jatah Cuti", "data": jatahCuti})
+}
+
+func (h *CutiHandler) CreateJatahCuti(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	var input JatahCutiRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+	if input.JenisPegawai == "" || input.Tahun == 0 || input.JumlahHari < 0 || input.MaksCarryOver < 0 {
+		return apperror.Validation("Invalid Jatah Cuti")
+	}
+	if err := db.First(&JenisCuti{}, input.JenisCutiID).Error; err != nil {
+		return apperror.Validation("Jenis Cuti not found")
+	}
+
+	jatahCuti := &JatahCuti{
+		JenisPegawai:  input.JenisPegawai,
+		JenisCutiID:   input.JenisCutiID,
+		Tahun:         input.Tahun,
+		JumlahHari:    input.JumlahHari,
+		MaksCarryOver: input.MaksCarryOver,
+	}
+	if err := db.Create(jatahCuti).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Create Jatah Cuti")
+	}
+	return ctx.JSON(http.StatusCreated, map[string]interface{}{"message": "Successfully Create a Jatah Cuti", "data": jatahCuti})
+}
+
+func (h *CutiHandler) UpdateJatahCuti(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	var input JatahCutiRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+	if input.JumlahHari < 0 || input.MaksCarryOver < 0 {
+		return apperror.Validation("Invalid Jatah Cuti")
+	}
+
+	var jatahCuti JatahCuti
+	if err := db.First(&jatahCuti, input.ID).Error; err != nil {
+		return apperror.Lookup(err, "Jatah Cuti not found")
+	}
+	jatahCuti.JumlahHari = input.JumlahHari
+	jatahCuti.MaksCarryOver = input.MaksCarryOver
+
+	if err := db.Save(&jatahCuti).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Update Jatah Cuti")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Update Jatah Cuti", "data": jatahCuti})
+}
+
+func (h *CutiHandler) DeleteJatahCuti(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	id := ctx.Param("id")
+	if err := db.Delete(&JatahCuti{}, "id = ?", id).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Delete Jatah Cuti")
+	}
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+func (h *CutiHandler) GetAllKepalaUnit(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	kepalaUnit := make([]*KepalaUnit, 0)
+	if err := db.Order("unit").Find(&kepalaUnit).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Get All Kepala Unit")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get All Kepala Unit", "data": kepalaUnit})
+}
+
+// SetKepalaUnit assigns the head of a unit, replacing the previous one.
+func (h *CutiHandler) SetKepalaUnit(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	var input KepalaUnitRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+	// /api/v1 names the unit in the path, the root route in the body
+	if unit := ctx.Param("unit"); unit != "" {
+		input.Unit = unit
+	}
+	if input.Unit == "" {
+		return apperror.Validation("Unit is required")
+	}
+	if err := db.First(&Pegawai{}, input.PegawaiID).Error; err != nil {
+		return apperror.Validation("Pegawai not found")
+	}
+
+	var kepalaUnit KepalaUnit
+	if err := db.Where(KepalaUnit{Unit: input.Unit}).FirstOrInit(&kepalaUnit).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Set Kepala Unit")
+	}
+	kepalaUnit.PegawaiID = input.PegawaiID
+	if err := db.Save(&kepalaUnit).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Set Kepala Unit")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Set Kepala Unit", "data": kepalaUnit})
+}
+
+func (h *CutiHandler) DeleteKepalaUnit(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	id := ctx.Param("id")
+	if err := db.Delete(&KepalaUnit{}, "id = ?", id).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Delete Kepala Unit")
+	}
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+func (h *CutiHandler) GetAllPengajuanCuti(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	pengajuan := make([]*PengajuanCuti, 0)
+	query := db.Model(&PengajuanCuti{})
+	if pegawaiID := ctx.QueryParam("pegawai_id"); pegawaiID != "" {
+		query = query.Where("pegawai_id = ?", pegawaiID)
+	}
+	if status := ctx.QueryParam("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if unit := ctx.QueryParam("unit"); unit != "" {
+		query = query.Where("pegawai_id IN (?)", db.Model(&Pegawai{}).Select("id").Where("unit = ?", unit))
+	}
+	if err := query.Order("tanggal_mulai DESC").Find(&pengajuan).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Get All Pengajuan Cuti")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get All Pengajuan Cuti", "data": pengajuan})
+}
+
+func (h *CutiHandler) GetPengajuanCutiByID(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	id := ctx.Param("id")
+	var pengajuan PengajuanCuti
+	if err := db.First(&pengajuan, "id = ?", id).Error; err != nil {
+		return apperror.Lookup(err, "Pengajuan Cuti not found")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": fmt.Sprintf("Successfully Get Pengajuan Cuti By ID: %s", id), "data": pengajuan})
+}
+
+// CreatePengajuanCuti submits a leave request for the Pegawai linked to the
+// pengguna. Requests for leave types that deduct the yearly balance are
+// rejected when the available balance is short.
+func (h *CutiHandler) CreatePengajuanCuti(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	pengguna := penggunaDari(ctx)
+	var input PengajuanCutiRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+
+	mulai, err := time.ParseInLocation(layoutTanggal, input.TanggalMulai, time.Local)
+	if err != nil {
+		return apperror.Validation("Invalid tanggal_mulai, expected YYYY-MM-DD")
+	}
+	selesai, err := time.ParseInLocation(layoutTanggal, input.TanggalSelesai, time.Local)
+	if err != nil {
+		return apperror.Validation("Invalid tanggal_selesai, expected YYYY-MM-DD")
+	}
+	if selesai.Before(mulai) {
+		return apperror.Validation("tanggal_selesai is before tanggal_mulai")
+	}
+	if selesai.Year() != mulai.Year() {
+		return apperror.Validation("Pengajuan Cuti must not cross years, submit one per year")
+	}
+
+	var pegawai Pegawai
+	if err := db.First(&pegawai, *pengguna.PegawaiID).Error; err != nil {
+		return apperror.Lookup(err, "Pegawai not found")
+	}
+	var jenisCuti JenisCuti
+	if err := db.First(&jenisCuti, input.JenisCutiID).Error; err != nil {
+		return apperror.Validation("Jenis Cuti not found")
+	}
+
+	jadwal, err := jadwalKerjaUnit(db, pegawai.Unit)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Create Pengajuan Cuti")
+	}
+	libur, err := hariLiburAntara(db, mulai, selesai)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Create Pengajuan Cuti")
+	}
+	jumlahHari := hitungHariKerja(jadwal, libur, mulai, selesai)
+	if jumlahHari == 0 {
+		return apperror.Validation("Pengajuan Cuti has no working days")
+	}
+	if jenisCuti.MaksHari > 0 && jumlahHari > jenisCuti.MaksHari {
+		return apperror.Validation(fmt.Sprintf("%s is limited to %d days", jenisCuti.Nama, jenisCuti.MaksHari))
+	}
+
+	var bentrok int64
+	err = db.Model(&PengajuanCuti{}).
+		Where("pegawai_id = ? AND status IN ?", pegawai.ID, []string{StatusCutiDiajukan, StatusCutiDisetujui}).
+		Where("tanggal_mulai <= ? AND tanggal_selesai >= ?", selesai, mulai).
+		Count(&bentrok).Error
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Create Pengajuan Cuti")
+	}
+	if bentrok > 0 {
+		return apperror.Conflict("Pengajuan Cuti overlaps an existing request")
+	}
+
+	if jenisCuti.PotongSaldo {
+		saldo, err := h.hitungSaldo(ctx.Request().Context(), &pegawai, &jenisCuti, mulai.Year())
+		if err != nil {
+			return apperror.Wrap(err, "Failed to Calculate Saldo Cuti")
+		}
+		if saldo.Tersedia < jumlahHari {
+			return apperror.Validation("Saldo Cuti is not sufficient").WithData(saldo)
+		}
+	}
+
+	pengajuan := &PengajuanCuti{
+		PegawaiID:      pegawai.ID,
+		JenisCutiID:    jenisCuti.ID,
+		TanggalMulai:   mulai,
+		TanggalSelesai: selesai,
+		JumlahHari:     jumlahHari,
+		Alasan:         input.Alasan,
+		Status:         StatusCutiDiajukan,
+	}
+	if err := db.Create(pengajuan).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Create Pengajuan Cuti")
+	}
+	return ctx.JSON(http.StatusCreated, map[string]interface{}{"message": "Successfully Create a Pengajuan Cuti", "data": pengajuan})
+}
+
+// prosesPengajuan approves or rejects a pending request. Only the head of the
+// requester's unit, logged in with the account linked to them, may do so,
+// and never for their own request.
+func (h *CutiHandler) prosesPengajuan(ctx echo.Context, status string) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	pengguna := penggunaDari(ctx)
+	var input PersetujuanCutiRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+
+	var pengajuan PengajuanCuti
+	if err := db.First(&pengajuan, input.ID).Error; err != nil {
+		return apperror.Lookup(err, "Pengajuan Cuti not found")
+	}
+	if pengajuan.Status != StatusCutiDiajukan {
+		return apperror.Conflict(fmt.Sprintf("Pengajuan Cuti is already %s", pengajuan.Status))
+	}
+
+	var pegawai Pegawai
+	if err := db.First(&pegawai, pengajuan.PegawaiID).Error; err != nil {
+		return apperror.Lookup(err, "Pegawai not found")
+	}
+	var kepalaUnit KepalaUnit
+	if err := db.Where("unit = ?", pegawai.Unit).First(&kepalaUnit).Error; err != nil {
+		return apperror.Forbidden(fmt.Sprintf("Unit %q has no Kepala Unit", pegawai.Unit))
+	}
+	if pengguna.PegawaiID == nil || kepalaUnit.PegawaiID != *pengguna.PegawaiID || *pengguna.PegawaiID == pengajuan.PegawaiID {
+		return apperror.Forbidden("Only the Kepala Unit may process this Pengajuan Cuti")
+	}
+
+	now := time.Now()
+	approver := *pengguna.PegawaiID
+	pengajuan.Status = status
+	pengajuan.DiprosesOleh = &approver
+	pengajuan.CatatanPersetujuan = input.Catatan
+	pengajuan.TanggalDiproses = &now
+
+	// The status guard keeps two concurrent approvals from both succeeding.
+	result := db.Model(&PengajuanCuti{}).
+		Where("id = ? AND status = ?", pengajuan.ID, StatusCutiDiajukan).
+		Updates(map[string]interface{}{
+			"status":              pengajuan.Status,
+			"diproses_oleh":       pengajuan.DiprosesOleh,
+			"catatan_persetujuan": pengajuan.CatatanPersetujuan,
+			"tanggal_diproses":    pengajuan.TanggalDiproses,
+		})
+	if result.Error != nil {
+		return apperror.Wrap(result.Error, "Failed to Process Pengajuan Cuti")
+	}
+	if result.RowsAffected == 0 {
+		return apperror.Conflict("Pengajuan Cuti was processed concurrently")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": fmt.Sprintf("Successfully set Pengajuan Cuti to %s", status), "data": pengajuan})
+}
+
+func (h *CutiHandler) ApprovePengajuanCuti(ctx echo.Context) error {
+	return h.prosesPengajuan(ctx, StatusCutiDisetujui)
+}
+
+func (h *CutiHandler) RejectPengajuanCuti(ctx echo.Context) error {
+	return h.prosesPengajuan(ctx, StatusCutiDitolak)
+}
+
+// CancelPengajuanCuti withdraws a request that has not started yet. Only the
+// requester, or admin and hr, may do so.
+func (h *CutiHandler) CancelPengajuanCuti(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	pengguna := penggunaDari(ctx)
+	id := ctx.Param("id")
+	var pengajuan PengajuanCuti
+	if err := db.First(&pengajuan, "id = ?", id).Error; err != nil {
+		return apperror.Lookup(err, "Pengajuan Cuti not found")
+	}
+	pemilik := pengguna.PegawaiID != nil && *pengguna.PegawaiID == pengajuan.PegawaiID
+	if !pemilik && pengguna.Peran != PeranAdmin && pengguna.Peran != PeranHR {
+		return apperror.Forbidden("Only the requester may cancel this Pengajuan Cuti")
+	}
+	if pengajuan.Status != StatusCutiDiajukan && pengajuan.Status != StatusCutiDisetujui {
+		return apperror.Conflict(fmt.Sprintf("Pengajuan Cuti is already %s", pengajuan.Status))
+	}
+	if pengajuan.Status == StatusCutiDisetujui && !pengajuan.TanggalMulai.After(time.Now()) {
+		return apperror.Conflict("Pengajuan Cuti has already started")
+	}
+
+	// The status guard keeps a cancel from overwriting a concurrent approval
+	// or reviving a rejected request.
+	status := pengajuan.Status
+	pengajuan.Status = StatusCutiDibatalkan
+	result := db.Model(&pengajuan).Where("status = ?", status).Update("status", pengajuan.Status)
+	if result.Error != nil {
+		return apperror.Wrap(result.Error, "Failed to Cancel Pengajuan Cuti")
+	}
+	if result.RowsAffected == 0 {
+		return apperror.Conflict("Pengajuan Cuti was processed concurrently")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Cancel Pengajuan Cuti", "data": pengajuan})
+}
+
+// GetSaldoCuti returns the balance of every leave type that deducts from the
+// yearly entitlement. The year defaults to the current one.
+func (h *CutiHandler) GetSaldoCuti(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	id := ctx.Param("id")
+	tahun := time.Now().Year()
+	if q := ctx.QueryParam("tahun"); q != "" {
+		t, err := strconv.Atoi(q)
+		if err != nil {
+			return apperror.Validation("Invalid tahun")
+		}
+		tahun = t
+	}
+
+	var pegawai Pegawai
+	if err := db.First(&pegawai, "id = ?", id).Error; err != nil {
+		return apperror.Lookup(err, "Pegawai not found")
+	}
+
+	jenisCuti := make([]*JenisCuti, 0)
+	if err := db.Where("potong_saldo = ?", true).Order("id").Find(&jenisCuti).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Get Saldo Cuti")
+	}
+
+	saldo := make([]*SaldoCuti, 0, len(jenisCuti))
+	for _, jc := range jenisCuti {
+		s, err := h.hitungSaldo(ctx.Request().Context(), &pegawai, jc, tahun)
+		if err != nil {
+			return apperror.Wrap(err, "Failed to Get Saldo Cuti")
+		}
+		saldo = append(saldo, s)
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": fmt.Sprintf("Successfully Get Saldo Cuti By Pegawai ID: %s", id), "data": saldo})
+}
+
+// KalenderCuti is one employee on approved leave on a given day.
+type KalenderCuti struct {
+	PengajuanID int64  `json:"pengajuan_id"`
+	PegawaiID   int64  `json:"pegawai_id"`
+	Nama        string `json:"nama"`
+	SubUnit     string `json:"sub_unit"`
+	JenisCuti   string `json:"jenis_cuti"`
+}
+
+// GetKalenderCuti lists, per day of the month, who in a unit is on approved
+// leave. The month is given as ?bulan=YYYY-MM and defaults to the current one.
+func (h *CutiHandler) GetKalenderCuti(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	unit := ctx.QueryParam("unit")
+	if unit == "" {
+		return apperror.Validation("unit is required")
+	}
+	now := time.Now()
+	awal := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	if q := ctx.QueryParam("bulan"); q != "" {
+		t, err := time.ParseInLocation("2006-01", q, time.Local)
+		if err != nil {
+			return apperror.Validation("Invalid bulan, expected YYYY-MM")
+		}
+		awal = t
+	}
+	akhir := awal.AddDate(0, 1, -1)
+
+	type baris struct {
+		PengajuanCuti
+		Nama      string
+		SubUnit   string
+		JenisCuti string
+	}
+	rows := make([]baris, 0)
+	err := db.Table("pengajuan_cuti").
+		Select("pengajuan_cuti.*, datadiri.nama, datadiri.sub_unit, jenis_cuti.nama AS jenis_cuti").
+		Joins("JOIN datadiri ON datadiri.id = pengajuan_cuti.pegawai_id").
+		Joins("JOIN jenis_cuti ON jenis_cuti.id = pengajuan_cuti.jenis_cuti_id").
+		Where("datadiri.unit = ? AND pengajuan_cuti.status = ?", unit, StatusCutiDisetujui).
+		Where("pengajuan_cuti.tanggal_mulai <= ? AND pengajuan_cuti.tanggal_selesai >= ?", akhir, awal).
+		Order("pengajuan_cuti.tanggal_mulai").
+		Scan(&rows).Error
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Get Kalender Cuti")
+	}
+
+	kalender := make(map[string][]KalenderCuti)
+	for d := awal; !d.After(akhir); d = d.AddDate(0, 0, 1) {
+		kalender[d.Format(layoutTanggal)] = make([]KalenderCuti, 0)
+	}
+	for _, r := range rows {
+		for d := r.TanggalMulai; !d.After(r.TanggalSelesai); d = d.AddDate(0, 0, 1) {
+			key := d.Format(layoutTanggal)
+			if _, ok := kalender[key]; !ok {
+				continue
+			}
+			kalender[key] = append(kalender[key], KalenderCuti{
+				PengajuanID: r.ID,
+				PegawaiID:   r.PegawaiID,
+				Nama:        r.Nama,
+				SubUnit:     r.SubUnit,
+				JenisCuti:   r.JenisCuti,
+			})
+		}
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get Kalender Cuti", "data": kalender, "unit": unit, "bulan": awal.Format("2006-01")})
+}
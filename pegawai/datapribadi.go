@@ -0,0 +1,350 @@
+package pegawai
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"uas/apperror"
+	"uas/outbox"
+)
+
+// statusMasihBekerja are the status_pegawai of someone still employed,
+// their records are needed for the employment and cannot be anonymized.
+var statusMasihBekerja = []string{"Aktif", "Cuti", "Tugas Belajar"}
+
+// PerubahanLengkap is a PerubahanData with its comments and audit trail.
+type PerubahanLengkap struct {
+	PerubahanData
+	Komentar []*KomentarPerubahan `json:"komentar"`
+	Riwayat  []*RiwayatPerubahan  `json:"riwayat"`
+}
+
+// berkas is one file of the archive.
+type berkas struct {
+	nama string
+	isi  interface{}
+}
+
+// kumpulkanDataPribadi gathers everything held about a Pegawai for a
+// request under UU PDP, as the files of the archive.
+func kumpulkanDataPribadi(db *gorm.DB, pegawaiID int64) ([]berkas, error) {
+	var pegawai Pegawai
+	if err := db.First(&pegawai, pegawaiID).Error; err != nil {
+		return nil, err
+	}
+	kontak := make([]*KontakPegawai, 0)
+	keluarga := make([]*AnggotaKeluarga, 0)
+	pengguna := make([]*Pengguna, 0)
+	cuti := make([]*PengajuanCuti, 0)
+	absensi := make([]*Absensi, 0)
+	kepalaUnit := make([]*KepalaUnit, 0)
+	penggabungan := make([]*PenggabunganPegawai, 0)
+	audit := make([]*Audit, 0)
+	events := make([]*outbox.Event, 0)
+	queries := []struct {
+		dest  interface{}
+		query *gorm.DB
+	}{
+		{&kontak, db.Where("pegawai_id = ?", pegawaiID)},
+		{&keluarga, db.Where("pegawai_id = ?", pegawaiID).Order("id")},
+		{&pengguna, db.Where("pegawai_id = ?", pegawaiID).Order("id")},
+		{&cuti, db.Where("pegawai_id = ?", pegawaiID).Order("tanggal_mulai")},
+		{&absensi, db.Where("pegawai_id = ?", pegawaiID).Order("tanggal")},
+		{&kepalaUnit, db.Where("pegawai_id = ?", pegawaiID)},
+		{&penggabungan, db.Where("target_id = ? OR sumber_id = ?", pegawaiID, pegawaiID).Order("id")},
+		{&audit, db.Where("entitas = ? AND entitas_id = ?", "pegawai", pegawaiID).Order("id")},
+		{&events, db.Where("resource = ? AND resource_id = ?", sumberPegawai, pegawaiID).Order("id")},
+	}
+	for _, q := range queries {
+		if err := q.query.Find(q.dest).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	idPengguna := make([]int64, 0, len(pengguna))
+	for _, p := range pengguna {
+		idPengguna = append(idPengguna, p.ID)
+	}
+	notifikasi := make([]*Notifikasi, 0)
+	if err := db.Where("pengguna_id IN ?", idPengguna).Order("id").Find(&notifikasi).Error; err != nil {
+		return nil, err
+	}
+
+	var daftarPerubahan []*PerubahanData
+	if err := db.Where("pegawai_id = ?", pegawaiID).Order("id").Find(&daftarPerubahan).Error; err != nil {
+		return nil, err
+	}
+	perubahan := make([]*PerubahanLengkap, 0, len(daftarPerubahan))
+	for _, p := range daftarPerubahan {
+		lengkap := &PerubahanLengkap{PerubahanData: *p, Komentar: make([]*KomentarPerubahan, 0), Riwayat: make([]*RiwayatPerubahan, 0)}
+		if err := db.Where("perubahan_id = ?", p.ID).Order("id").Find(&lengkap.Komentar).Error; err != nil {
+			return nil, err
+		}
+		if err := db.Where("perubahan_id = ?", p.ID).Order("id").Find(&lengkap.Riwayat).Error; err != nil {
+			return nil, err
+		}
+		perubahan = append(perubahan, lengkap)
+	}
+
+	return []berkas{
+		{"pegawai.json", pegawai},
+		{"kontak.json", kontak},
+		{"keluarga.json", keluarga},
+		{"pengguna.json", pengguna},
+		{"notifikasi.json", notifikasi},
+		{"cuti.json", cuti},
+		{"absensi.json", absensi},
+		{"kepala_unit.json", kepalaUnit},
+		{"perubahan.json", perubahan},
+		{"penggabungan.json", penggabungan},
+		{"audit.json", audit},
+		{"outbox.json", events},
+	}, nil
+}
+
+// arsipDataPribadi writes the files as a zip archive, with the photo as a
+// file of its own when it is stored as a data URL.
+func arsipDataPribadi(daftar []berkas) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	tulis := func(nama string, isi []byte) error {
+		f, err := w.CreateHeader(&zip.FileHeader{Name: nama, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(isi)
+		return err
+	}
+	for _, b := range daftar {
+		isi, err := json.MarshalIndent(b.isi, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := tulis(b.nama, isi); err != nil {
+			return nil, err
+		}
+		if p, ok := b.isi.(Pegawai); ok {
+			if nama, foto, ok := fotoDataURL(p.Foto); ok {
+				if err := tulis(nama, foto); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fotoDataURL decodes a photo stored as data:image/png;base64,... into a
+// file name and its content.
+func fotoDataURL(foto string) (string, []byte, bool) {
+	header, data, ok := strings.Cut(strings.TrimPrefix(foto, "data:"), ",")
+	if !ok || !strings.HasPrefix(foto, "data:") || !strings.HasSuffix(header, ";base64") {
+		return "", nil, false
+	}
+	isi, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", nil, false
+	}
+	ext := ".bin"
+	if daftar, _ := mime.ExtensionsByType(strings.TrimSuffix(header, ";base64")); len(daftar) > 0 {
+		ext = daftar[0]
+	}
+	return "foto" + ext, isi, true
+}
+
+// anonimkan scrubs what identifies a former Pegawai and keeps what the
+// statistics count: the record itself with its status, unit, education,
+// sex and religion, the year of birth, and the leave and attendance dates.
+func anonimkan(tx *gorm.DB, pegawaiID int64, alasan string, oleh *int64) (*Pegawai, error) {
+	var p Pegawai
+	if err := tx.First(&p, pegawaiID).Error; err != nil {
+		return nil, err
+	}
+	if slices.Contains(statusMasihBekerja, p.StatusPegawai) {
+		return nil, apperror.Conflict(fmt.Sprintf("Pegawai is still %s, only former employees can be anonymized", p.StatusPegawai))
+	}
+
+	// the outbox events of the Pegawai keep what happened, not the rows;
+	// the update below adds one with the anonymized row
+	err := tx.Model(&outbox.Event{}).Where("resource = ? AND resource_id = ?", sumberPegawai, pegawaiID).
+		Select("data").Updates(&outbox.Event{Data: json.RawMessage(fmt.Sprintf(`{"id":%d}`, pegawaiID))}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// so do the webhook deliveries made of them, which may still be sent
+	var pengiriman []*PengirimanWebhook
+	if err := tx.Where("pegawai_id = ?", pegawaiID).Find(&pengiriman).Error; err != nil {
+		return nil, err
+	}
+	for _, k := range pengiriman {
+		var payload map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(k.Payload), &payload); err != nil {
+			return nil, err
+		}
+		payload["data"] = json.RawMessage(fmt.Sprintf(`{"id":%d}`, pegawaiID))
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.Model(k).Select("payload").Updates(&PengirimanWebhook{Payload: string(b)}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	p.Nama = fmt.Sprintf("Anonim %d", p.ID)
+	p.Nik = ""
+	p.Tempat_lahir = ""
+	p.Foto = ""
+	if len(p.Tanggal_lahir) >= 4 {
+		p.Tanggal_lahir = p.Tanggal_lahir[:4] + "-01-01"
+	}
+	if err := tx.Model(&p).Select("nama", "nik", "nik_index", "tempat_lahir", "tanggal_lahir", "foto").Updates(&p).Error; err != nil {
+		return nil, err
+	}
+
+	for _, model := range []interface{}{&KontakPegawai{}, &AnggotaKeluarga{}} {
+		if err := tx.Where("pegawai_id = ?", pegawaiID).Delete(model).Error; err != nil {
+			return nil, err
+		}
+	}
+	kosongkan := []struct {
+		model interface{}
+		where string
+		kolom map[string]interface{}
+	}{
+		{&PengajuanCuti{}, "pegawai_id = @id", map[string]interface{}{"alasan": "", "catatan_persetujuan": ""}},
+		{&Absensi{}, "pegawai_id = @id", map[string]interface{}{"keterangan": ""}},
+		{&PenggabunganPegawai{}, "target_id = @id OR sumber_id = @id", map[string]interface{}{"data_sumber": ""}},
+	}
+	for _, k := range kosongkan {
+		if err := tx.Model(k.model).Where(k.where, sql.Named("id", pegawaiID)).UpdateColumns(k.kolom).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// change requests keep which fields changed, not the values
+	var daftarPerubahan []*PerubahanData
+	if err := tx.Where("pegawai_id = ?", pegawaiID).Find(&daftarPerubahan).Error; err != nil {
+		return nil, err
+	}
+	for _, pr := range daftarPerubahan {
+		for f := range pr.Perubahan {
+			pr.Perubahan[f] = NilaiPerubahan{}
+		}
+		pr.CatatanKeputusan = ""
+		if err := tx.Model(pr).Select("perubahan", "catatan_keputusan").Updates(pr).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Model(&KomentarPerubahan{}).Where("perubahan_id = ?", pr.ID).UpdateColumn("isi", "").Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Model(&RiwayatPerubahan{}).Where("perubahan_id = ?", pr.ID).UpdateColumn("catatan", "").Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// accounts stay for the audit trail they appear in, but cannot log in
+	var pengguna []*Pengguna
+	if err := tx.Where("pegawai_id = ?", pegawaiID).Find(&pengguna).Error; err != nil {
+		return nil, err
+	}
+	for _, akun := range pengguna {
+		err := tx.Model(akun).Select("username", "password_hash", "pegawai_id").
+			Updates(&Pengguna{Username: fmt.Sprintf("anonim-%d", akun.ID)}).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, model := range []interface{}{&Sesi{}, &Notifikasi{}} {
+			if err := tx.Where("pengguna_id = ?", akun.ID).Delete(model).Error; err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := catatAudit(tx, AuditAnonimisasi, "pegawai", pegawaiID, oleh, alasan); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+type DataPribadiHandler struct {
+	db *gorm.DB
+}
+
+func NewDataPribadiHandler(db *gorm.DB) *DataPribadiHandler {
+	return &DataPribadiHandler{db: db}
+}
+
+type AnonimisasiRequest struct {
+	ID     int64  `param:"id"`
+	Alasan string `json:"alasan"`
+}
+
+// ekspor answers with the archive of a Pegawai and records who took it.
+func (h *DataPribadiHandler) ekspor(ctx echo.Context, pegawaiID int64) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	daftar, err := kumpulkanDataPribadi(db, pegawaiID)
+	if err != nil {
+		return apperror.Lookup(err, "Pegawai not found")
+	}
+	arsip, err := arsipDataPribadi(daftar)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Export Data Pribadi")
+	}
+	if err := catatAudit(db, AuditEkspor, "pegawai", pegawaiID, idPengguna(ctx), ""); err != nil {
+		return apperror.Wrap(err, "Failed to Export Data Pribadi")
+	}
+	ctx.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="data-pribadi-pegawai-%d.zip"`, pegawaiID))
+	return ctx.Blob(http.StatusOK, "application/zip", arsip)
+}
+
+// ExportDataPribadi is the archive of a Pegawai for HR.
+func (h *DataPribadiHandler) ExportDataPribadi(ctx echo.Context) error {
+	id, err := pegawaiID(ctx)
+	if err != nil {
+		return err
+	}
+	return h.ekspor(ctx, id)
+}
+
+// ExportDataPribadiSaya is the archive of the logged in employee.
+func (h *DataPribadiHandler) ExportDataPribadiSaya(ctx echo.Context) error {
+	return h.ekspor(ctx, pegawaiSaya(ctx))
+}
+
+func (h *DataPribadiHandler) AnonimkanPegawai(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	var input AnonimisasiRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+	if strings.TrimSpace(input.Alasan) == "" {
+		return apperror.Validation("Alasan is required, name the legal basis of the anonymization")
+	}
+	var pegawai *Pegawai
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		pegawai, err = anonimkan(tx, input.ID, input.Alasan, idPengguna(ctx))
+		return err
+	})
+	if err != nil {
+		return apperror.Lookup(err, "Pegawai not found")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": fmt.Sprintf("Successfully Anonymize Pegawai %d", input.ID), "data": pegawai})
+}
@@ -0,0 +1,177 @@
+package pegawai
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"uas/apperror"
+	"uas/cli"
+)
+
+// kota are birth places with the kode wilayah (province, regency and
+// district) a NIK issued there starts with.
+var kota = []struct {
+	Nama    string
+	Wilayah string
+}{
+	{"Jakarta Selatan", "317401"},
+	{"Jakarta Timur", "317501"},
+	{"Bandung", "327301"},
+	{"Bogor", "327101"},
+	{"Bekasi", "327501"},
+	{"Semarang", "337401"},
+	{"Surakarta", "337201"},
+	{"Yogyakarta", "347101"},
+	{"Surabaya", "357801"},
+	{"Malang", "357301"},
+	{"Denpasar", "517101"},
+	{"Medan", "127101"},
+	{"Padang", "137101"},
+	{"Palembang", "167101"},
+	{"Makassar", "737101"},
+	{"Manado", "717101"},
+	{"Balikpapan", "647101"},
+	{"Kupang", "537101"},
+}
+
+var (
+	namaDepanL = []string{
+		"Budi", "Agus", "Andi", "Bambang", "Dedi", "Eko", "Fajar", "Hendra", "Irfan", "Joko",
+		"Made", "Nyoman", "Putu", "Rizky", "Slamet", "Teguh", "Wahyu", "Yohanes", "Asep", "Ucok",
+	}
+	namaDepanP = []string{
+		"Siti", "Dewi", "Ayu", "Fitri", "Indah", "Kartika", "Lestari", "Maria", "Nur", "Putri",
+		"Rina", "Sri", "Tuti", "Wulan", "Yuliana", "Ketut", "Ani", "Desi", "Ratna", "Lia",
+	}
+	namaBelakang = []string{
+		"Santoso", "Wibowo", "Saputra", "Hidayat", "Kurniawan", "Setiawan", "Nugroho", "Pratama",
+		"Siregar", "Nasution", "Simanjuntak", "Gunawan", "Susanto", "Rahmawati", "Wijaya",
+		"Halim", "Sembiring", "Tanjung", "Lubis", "Sinaga", "Permana", "Suryadi", "Hutapea", "Manurung",
+	}
+	unitDemo = map[string][]string{
+		"Keuangan":    {"Anggaran", "Perbendaharaan", "Akuntansi"},
+		"Kepegawaian": {"Mutasi", "Pengembangan", "Kesejahteraan"},
+		"Umum":        {"Rumah Tangga", "Arsip", "Perlengkapan"},
+		"Perencanaan": {"Program", "Evaluasi"},
+	}
+	// the values are weighted by how common they are, Islam is chosen 87 in
+	// 100 times like in the census
+	agamaDemo         = berbobot{"Islam": 87, "Kristen": 7, "Katolik": 3, "Hindu": 2, "Buddha": 1}
+	pendidikanDemo    = berbobot{"SMA": 15, "D3": 15, "D4": 5, "S1": 45, "S2": 17, "S3": 3}
+	jenisPegawaiDemo  = berbobot{"PNS": 60, "PPPK": 25, "Honorer": 10, "Kontrak": 5}
+	statusPegawaiDemo = berbobot{"Aktif": 90, "Cuti": 5, "Tugas Belajar": 3, "Pensiun": 2}
+)
+
+// berbobot maps a value to its weight.
+type berbobot map[string]int
+
+func (b berbobot) pilih(r *rand.Rand) string {
+	total := 0
+	for _, w := range b {
+		total += w
+	}
+	n := r.Intn(total)
+	// the order of a map changes between runs, the same seed has to give the
+	// same Pegawai
+	for _, v := range urutKunci(b) {
+		if n < b[v] {
+			return v
+		}
+		n -= b[v]
+	}
+	return ""
+}
+
+func urutKunci[V any](m map[string]V) []string {
+	kunci := make([]string, 0, len(m))
+	for k := range m {
+		kunci = append(kunci, k)
+	}
+	sort.Strings(kunci)
+	return kunci
+}
+
+func pilih[T any](r *rand.Rand, daftar []T) T {
+	return daftar[r.Intn(len(daftar))]
+}
+
+// pegawaiDemo returns a made-up Pegawai. Its NIK is valid like one on a
+// KTP: the kode wilayah of its birth place, the birth date as DDMMYY with
+// 40 added to the day for a woman, then a serial number.
+func pegawaiDemo(r *rand.Rand) Pegawai {
+	perempuan := r.Intn(2) == 1
+	depan, kelamin := pilih(r, namaDepanL), "Laki-laki"
+	if perempuan {
+		depan, kelamin = pilih(r, namaDepanP), "Perempuan"
+	}
+	tempat := pilih(r, kota)
+	// born 1968 to 2005, not from the clock so a seed always gives the same
+	lahir := time.Date(1968, time.January, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, r.Intn(38*365))
+	hari := lahir.Day()
+	if perempuan {
+		hari += 40
+	}
+	unit := pilih(r, urutKunci(unitDemo))
+	return Pegawai{
+		Nama:          depan + " " + pilih(r, namaBelakang),
+		Nik:           fmt.Sprintf("%s%02d%02d%02d%04d", tempat.Wilayah, hari, int(lahir.Month()), lahir.Year()%100, 1+r.Intn(9999)),
+		JenisPegawai:  jenisPegawaiDemo.pilih(r),
+		StatusPegawai: statusPegawaiDemo.pilih(r),
+		Unit:          unit,
+		SubUnit:       pilih(r, unitDemo[unit]),
+		Pendidikan:    pendidikanDemo.pilih(r),
+		Tanggal_lahir: lahir.Format(time.DateOnly),
+		Tempat_lahir:  tempat.Nama,
+		Jenis_kelamin: kelamin,
+		Agama:         agamaDemo.pilih(r),
+	}
+}
+
+// buatDemo creates n made-up Pegawai through PegawaiService, so they pass
+// the same checks as the ones the API creates. A NIK that is taken is drawn
+// again.
+func buatDemo(ctx context.Context, db *gorm.DB, r *rand.Rand, n int) ([]Pegawai, error) {
+	svc := NewPegawaiService(db)
+	dibuat := make([]Pegawai, 0, n)
+	for coba := 0; len(dibuat) < n; {
+		p := pegawaiDemo(r)
+		err := svc.Create(ctx, &p)
+		var appErr *apperror.Error
+		switch {
+		case err == nil:
+			dibuat = append(dibuat, p)
+			coba = 0
+		case errors.As(err, &appErr) && appErr.Code == apperror.CodeConflict:
+			if coba++; coba > 100 {
+				return dibuat, fmt.Errorf("no free NIK after %d tries", coba)
+			}
+		default:
+			return dibuat, err
+		}
+	}
+	return dibuat, nil
+}
+
+func seedDemo(ctx context.Context, db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("seed demo", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	n := fs.Int("n", 100, "how many Pegawai to create")
+	seed := fs.Int64("seed", time.Now().UnixNano(), "the random seed, the same seed gives the same Pegawai")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 || *n < 1 {
+		return fmt.Errorf("%w: seed demo [-n 100] [-seed number]", cli.ErrUsage)
+	}
+	if err := migrate(db.WithContext(ctx)); err != nil {
+		return err
+	}
+	dibuat, err := buatDemo(ctx, db, rand.New(rand.NewSource(*seed)), *n)
+	fmt.Printf("pegawai: %d demo Pegawai created with seed %d\n", len(dibuat), *seed)
+	return err
+}
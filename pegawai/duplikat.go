@@ -0,0 +1,502 @@
+package pegawai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"uas/apperror"
+)
+
+const indeksNIK = "idx_datadiri_nik_index"
+
+// normalisasiNIK drops the separators people type into a NIK, so
+// "3201-0123 4567 0001" and "3201012345670001" are the same NIK.
+func normalisasiNIK(nik string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		if unicode.IsSpace(r) || r == '.' || r == '-' {
+			return -1
+		}
+		return r
+	}, nik)
+}
+
+// validNIK reports whether nik is a 16 digit Nomor Induk Kependudukan.
+func validNIK(nik string) bool {
+	if len(nik) != 16 {
+		return false
+	}
+	for _, r := range nik {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// nikTerpakai reports whether another Pegawai than kecuali already has nik.
+// A row the Laravel app wrote since the last migrate has no blind index yet
+// and its nik in plaintext.
+func nikTerpakai(db *gorm.DB, nik string, kecuali int64) (bool, error) {
+	var jumlah int64
+	err := db.Model(&Pegawai{}).
+		Where("(nik_index = ? OR nik = ?) AND id <> ?", indeksNIKDari(nik), nik, kecuali).
+		Count(&jumlah).Error
+	return jumlah > 0, err
+}
+
+// pastikanIndeksNIK adds the unique index on datadiri.nik_index. Existing
+// duplicates are reported instead, so they can be merged first through
+// /pegawai/duplikat and /pegawai/:id/gabung.
+func pastikanIndeksNIK(db *gorm.DB) error {
+	if db.Migrator().HasIndex(&Pegawai{}, indeksNIK) {
+		return nil
+	}
+	var duplikat int64
+	err := db.Model(&Pegawai{}).Select("nik_index").Where("nik_index IS NOT NULL").
+		Group("nik_index").Having("COUNT(*) > 1").Count(&duplikat).Error
+	if err != nil {
+		return err
+	}
+	if duplikat > 0 {
+		slog.Warn("NIK values are used by more than one Pegawai, merge them before the unique index can be created",
+			"duplikat", duplikat, "index", indeksNIK)
+		return nil
+	}
+	return db.Migrator().CreateIndex(&Pegawai{}, indeksNIK)
+}
+
+// normalisasiNama lowercases a name, drops academic titles after the first
+// comma and everything that is not a letter.
+func normalisasiNama(nama string) string {
+	if i := strings.Index(nama, ","); i >= 0 {
+		nama = nama[:i]
+	}
+	nama = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) {
+			return unicode.ToLower(r)
+		}
+		return ' '
+	}, nama)
+	return strings.Join(strings.Fields(nama), " ")
+}
+
+// jaroWinkler returns the Jaro-Winkler similarity of a and b, from 0 for
+// nothing in common to 1 for equal strings.
+func jaroWinkler(a, b string) float64 {
+	s1, s2 := []rune(a), []rune(b)
+	if len(s1) == 0 && len(s2) == 0 {
+		return 1
+	}
+	if len(s1) == 0 || len(s2) == 0 {
+		return 0
+	}
+	jarak := max(len(s1), len(s2))/2 - 1
+	cocok1 := make([]bool, len(s1))
+	cocok2 := make([]bool, len(s2))
+	cocok := 0
+	for i := range s1 {
+		for j := max(0, i-jarak); j < min(len(s2), i+jarak+1); j++ {
+			if !cocok2[j] && s1[i] == s2[j] {
+				cocok1[i], cocok2[j] = true, true
+				cocok++
+				break
+			}
+		}
+	}
+	if cocok == 0 {
+		return 0
+	}
+	transposisi, k := 0, 0
+	for i := range s1 {
+		if !cocok1[i] {
+			continue
+		}
+		for !cocok2[k] {
+			k++
+		}
+		if s1[i] != s2[k] {
+			transposisi++
+		}
+		k++
+	}
+	m := float64(cocok)
+	jaro := (m/float64(len(s1)) + m/float64(len(s2)) + (m-float64(transposisi)/2)/m) / 3
+
+	prefiks := 0
+	for prefiks < min(4, len(s1), len(s2)) && s1[prefiks] == s2[prefiks] {
+		prefiks++
+	}
+	return jaro + float64(prefiks)*0.1*(1-jaro)
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	s1, s2 := []rune(a), []rune(b)
+	baris := make([]int, len(s2)+1)
+	for j := range baris {
+		baris[j] = j
+	}
+	for i := 1; i <= len(s1); i++ {
+		diagonal := baris[0]
+		baris[0] = i
+		for j := 1; j <= len(s2); j++ {
+			sebelumnya := baris[j]
+			biaya := 1
+			if s1[i-1] == s2[j-1] {
+				biaya = 0
+			}
+			baris[j] = min(baris[j]+1, baris[j-1]+1, diagonal+biaya)
+			diagonal = sebelumnya
+		}
+	}
+	return baris[len(s2)]
+}
+
+// KandidatDuplikat is a pair of Pegawai that are probably the same person.
+type KandidatDuplikat struct {
+	Pegawai  *Pegawai `json:"pegawai"`
+	Duplikat *Pegawai `json:"duplikat"`
+	Skor     float64  `json:"skor"`
+	Alasan   []string `json:"alasan"`
+}
+
+// skorDuplikat weighs name similarity (50%), the same birth date (30%) and
+// birth place similarity (20%). The same NIK is always a duplicate and a NIK
+// one or two typos away adds to the score.
+func skorDuplikat(a, b *Pegawai) (float64, []string) {
+	alasan := make([]string, 0, 4)
+	nikA, nikB := normalisasiNIK(a.Nik), normalisasiNIK(b.Nik)
+	if nikA != "" && nikA == nikB {
+		return 1, []string{"nik sama"}
+	}
+
+	simNama := jaroWinkler(normalisasiNama(a.Nama), normalisasiNama(b.Nama))
+	skor := 0.5 * simNama
+	if simNama >= 0.9 {
+		alasan = append(alasan, fmt.Sprintf("nama mirip (%.2f)", simNama))
+	}
+	if a.Tanggal_lahir != "" && a.Tanggal_lahir == b.Tanggal_lahir {
+		skor += 0.3
+		alasan = append(alasan, "tanggal lahir sama")
+	}
+	simTempat := jaroWinkler(normalisasiNama(a.Tempat_lahir), normalisasiNama(b.Tempat_lahir))
+	if a.Tempat_lahir != "" && b.Tempat_lahir != "" {
+		skor += 0.2 * simTempat
+		if simTempat >= 0.9 {
+			alasan = append(alasan, fmt.Sprintf("tempat lahir mirip (%.2f)", simTempat))
+		}
+	}
+	if nikA != "" && nikB != "" && len(nikA) == len(nikB) && levenshtein(nikA, nikB) <= 2 {
+		skor = min(1, skor+0.2)
+		alasan = append(alasan, "nik hampir sama")
+	}
+	return skor, alasan
+}
+
+// cariDuplikat returns the pairs of daftar scoring at least minSkor, best
+// first.
+func cariDuplikat(daftar []*Pegawai, minSkor float64) []*KandidatDuplikat {
+	hasil := make([]*KandidatDuplikat, 0)
+	for i, a := range daftar {
+		hasil = append(hasil, duplikatDari(a, daftar[i+1:], minSkor)...)
+	}
+	sort.SliceStable(hasil, func(i, j int) bool { return hasil[i].Skor > hasil[j].Skor })
+	return hasil
+}
+
+// duplikatDari compares p with every Pegawai of daftar.
+func duplikatDari(p *Pegawai, daftar []*Pegawai, minSkor float64) []*KandidatDuplikat {
+	hasil := make([]*KandidatDuplikat, 0)
+	for _, b := range daftar {
+		if b.ID == p.ID {
+			continue
+		}
+		if skor, alasan := skorDuplikat(p, b); skor >= minSkor {
+			hasil = append(hasil, &KandidatDuplikat{Pegawai: p, Duplikat: b, Skor: skor, Alasan: alasan})
+		}
+	}
+	sort.SliceStable(hasil, func(i, j int) bool { return hasil[i].Skor > hasil[j].Skor })
+	return hasil
+}
+
+type DuplikatHandler struct {
+	db *gorm.DB
+}
+
+func NewDuplikatHandler(db *gorm.DB) *DuplikatHandler {
+	return &DuplikatHandler{db: db}
+}
+
+type GabungPegawaiRequest struct {
+	ID       int64 `param:"id"`
+	SumberID int64 `json:"sumber_id"`
+	// Pilih names the fields whose value is taken from the source record.
+	// Other fields keep the target's value, or the source's when empty.
+	Pilih []string `json:"pilih"`
+}
+
+// PenggabunganPegawai records a merge. DataSumber is the source Pegawai as it
+// was before it was deleted.
+type PenggabunganPegawai struct {
+	ID           int64     `json:"id"`
+	TargetID     int64     `json:"target_id" gorm:"index"`
+	SumberID     int64     `json:"sumber_id"`
+	DataSumber   string    `json:"data_sumber" gorm:"type:text;serializer:encrypted"`
+	DigabungOleh *int64    `json:"digabung_oleh"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (PenggabunganPegawai) TableName() string {
+	return "penggabungan_pegawai"
+}
+
+func minSkorDari(ctx echo.Context) (float64, error) {
+	minSkor := 0.85
+	if q := ctx.QueryParam("min_skor"); q != "" {
+		s, err := strconv.ParseFloat(q, 64)
+		if err != nil || s < 0 || s > 1 {
+			return 0, errors.New("Invalid min_skor, expected a number between 0 and 1")
+		}
+		minSkor = s
+	}
+	return minSkor, nil
+}
+
+// GetAllDuplikat lists likely duplicate pairs among all Pegawai.
+func (h *DuplikatHandler) GetAllDuplikat(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	minSkor, err := minSkorDari(ctx)
+	if err != nil {
+		return apperror.Validation(err.Error())
+	}
+	pegawais := make([]*Pegawai, 0)
+	if err := db.Order("id").Find(&pegawais).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Get Duplikat")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get Duplikat", "data": cariDuplikat(pegawais, minSkor)})
+}
+
+// GetDuplikatByID lists the likely duplicates of one Pegawai.
+func (h *DuplikatHandler) GetDuplikatByID(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	id := ctx.Param("id")
+	minSkor, err := minSkorDari(ctx)
+	if err != nil {
+		return apperror.Validation(err.Error())
+	}
+	var pegawai Pegawai
+	if err := db.First(&pegawai, "id = ?", id).Error; err != nil {
+		return apperror.Lookup(err, "Pegawai not found")
+	}
+	pegawais := make([]*Pegawai, 0)
+	if err := db.Where("id <> ?", pegawai.ID).Order("id").Find(&pegawais).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Get Duplikat")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": fmt.Sprintf("Successfully Get Duplikat By ID: %s", id), "data": duplikatDari(&pegawai, pegawais, minSkor)})
+}
+
+// referensiPegawai are the columns that point at datadiri.id and are moved to
+// the target on a merge. Tables with one row per Pegawai (or per day) are
+// handled separately in gabungkan.
+var referensiPegawai = []struct{ tabel, kolom string }{
+	{"pengajuan_cuti", "pegawai_id"},
+	{"perubahan_data", "pegawai_id"},
+	{"keluarga_pegawai", "pegawai_id"},
+	{"kepala_unit", "pegawai_id"},
+	{"pengguna", "pegawai_id"},
+}
+
+// gabungkan merges sumber into target inside tx and deletes sumber. Fields
+// under an aturan persetujuan keep the target's value and are returned as a
+// PerubahanData of pengaju, like any other update.
+func gabungkan(tx *gorm.DB, target, sumber *Pegawai, pilih []string, pengaju *Pengguna) (*PerubahanData, error) {
+	existing := *target
+	nilaiTarget := nilaiPegawai(target)
+	nilaiSumber := nilaiPegawai(sumber)
+	for f, v := range nilaiSumber {
+		if nilaiTarget[f] == "" || slices.Contains(pilih, f) {
+			nilaiTarget[f] = v
+		}
+	}
+	if err := terapkanNilai(target, nilaiTarget); err != nil {
+		return nil, err
+	}
+	perubahan, err := ajukanPerubahan(tx, &existing, target, pengaju)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pending changes of the source were made against data that is gone.
+	err = tx.Model(&PerubahanData{}).
+		Where("pegawai_id = ? AND status = ?", sumber.ID, StatusPerubahanMenunggu).
+		Update("status", StatusPerubahanDibatalkan).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range referensiPegawai {
+		if err := tx.Table(r.tabel).Where(r.kolom+" = ?", sumber.ID).Update(r.kolom, target.ID).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// Absensi is unique per day: keep the earliest check-in and the latest
+	// check-out when both have a record.
+	absensiSumber := make([]*Absensi, 0)
+	if err := tx.Where("pegawai_id = ?", sumber.ID).Find(&absensiSumber).Error; err != nil {
+		return nil, err
+	}
+	for _, a := range absensiSumber {
+		var t Absensi
+		err := tx.Where("pegawai_id = ? AND tanggal = ?", target.ID, a.Tanggal).First(&t).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if err := tx.Model(a).Update("pegawai_id", target.ID).Error; err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if t.JamMasuk == nil || a.JamMasuk != nil && a.JamMasuk.Before(*t.JamMasuk) {
+			t.JamMasuk = a.JamMasuk
+		}
+		if t.JamPulang == nil || a.JamPulang != nil && a.JamPulang.After(*t.JamPulang) {
+			t.JamPulang = a.JamPulang
+		}
+		if err := tx.Save(&t).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Delete(a).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// Kontak is one row per Pegawai: fill the target's empty fields.
+	var kontakSumber KontakPegawai
+	err = tx.Where("pegawai_id = ?", sumber.ID).First(&kontakSumber).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if err == nil {
+		var kontak KontakPegawai
+		if err := tx.Where(KontakPegawai{PegawaiID: target.ID}).FirstOrInit(&kontak).Error; err != nil {
+			return nil, err
+		}
+		kontak.Email = atau(kontak.Email, kontakSumber.Email)
+		kontak.NoHP = atau(kontak.NoHP, kontakSumber.NoHP)
+		kontak.Alamat = atau(kontak.Alamat, kontakSumber.Alamat)
+		if err := tx.Delete(&kontakSumber).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Save(&kontak).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// The source goes first, the NIK it may hand over to the target is unique.
+	if err := tx.Delete(sumber).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Save(target).Error; err != nil {
+		return nil, err
+	}
+	if perubahan != nil {
+		if err := simpanPerubahan(tx, perubahan); err != nil {
+			return nil, err
+		}
+	}
+	return perubahan, nil
+}
+
+// atau returns a unless it is empty, then b.
+func atau(a, b string) string {
+	if a != "" {
+		return a
+	}
+	return b
+}
+
+// GabungPegawai merges the Pegawai sumber_id into :id. The history of the
+// source (leave, attendance, change requests, family, contact, accounts) is
+// moved to the target and the source record is deleted. Values taken over
+// for fields under an aturan persetujuan wait for approval.
+func (h *DuplikatHandler) GabungPegawai(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	var input GabungPegawaiRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+	if input.SumberID == input.ID {
+		return apperror.Validation("A Pegawai cannot be merged into itself")
+	}
+	for _, f := range input.Pilih {
+		if !slices.Contains(fieldPegawai, f) {
+			return apperror.Validation(fmt.Sprintf("Invalid field %s in pilih", f))
+		}
+	}
+
+	var target, sumber Pegawai
+	if err := db.First(&target, input.ID).Error; err != nil {
+		return apperror.Lookup(err, "Pegawai not found")
+	}
+	if err := db.First(&sumber, input.SumberID).Error; err != nil {
+		return apperror.Lookup(err, "Sumber Pegawai not found")
+	}
+	dataSumber, err := json.Marshal(sumber)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Merge Pegawai")
+	}
+
+	pengguna := penggunaDari(ctx)
+	catatan := &PenggabunganPegawai{TargetID: target.ID, SumberID: sumber.ID, DataSumber: string(dataSumber), DigabungOleh: &pengguna.ID}
+	var perubahan *PerubahanData
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if perubahan, err = gabungkan(tx, &target, &sumber, input.Pilih, pengguna); err != nil {
+			return err
+		}
+		return tx.Create(catatan).Error
+	})
+	var tertunda *errPerubahanTertunda
+	if errors.As(err, &tertunda) {
+		return apperror.Conflict(tertunda.Error())
+	}
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Merge Pegawai")
+	}
+	if perubahan != nil {
+		return ctx.JSON(http.StatusAccepted, map[string]interface{}{
+			"message":      fmt.Sprintf("Successfully Merge Pegawai %d into %d, changes to %s are waiting for approval", sumber.ID, target.ID, strings.Join(perubahan.fields(), ", ")),
+			"data":         target,
+			"penggabungan": catatan,
+			"perubahan":    perubahan,
+		})
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": fmt.Sprintf("Successfully Merge Pegawai %d into %d", sumber.ID, target.ID), "data": target, "penggabungan": catatan})
+}
+
+// GetPenggabungan lists the merges into a Pegawai.
+func (h *DuplikatHandler) GetPenggabungan(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	id := ctx.Param("id")
+	penggabungan := make([]*PenggabunganPegawai, 0)
+	if err := db.Where("target_id = ?", id).Order("id").Find(&penggabungan).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Get Penggabungan")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": fmt.Sprintf("Successfully Get Penggabungan By Pegawai ID: %s", id), "data": penggabungan})
+}
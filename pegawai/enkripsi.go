@@ -0,0 +1,145 @@
+package pegawai
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"uas/cli"
+	"uas/encryption"
+	"uas/outbox"
+)
+
+// indeksLama is the unique index on the plaintext nik that the blind index
+// replaces, ciphertexts of the same NIK differ.
+const indeksLama = "idx_datadiri_nik"
+
+// indeksNIKDari returns the blind index of nik, nil for an empty nik so
+// Pegawai without one do not collide in the unique index.
+func indeksNIKDari(nik string) *string {
+	if nik == "" {
+		return nil
+	}
+	indeks := encryption.Default().BlindIndex("datadiri.nik", nik)
+	return &indeks
+}
+
+// BeforeSave keeps NikIndex in step with Nik. With Model(...).Updates(&p)
+// the hook runs on the model, the values are in the Dest.
+func (p *Pegawai) BeforeSave(tx *gorm.DB) error {
+	if dest, ok := tx.Statement.Dest.(*Pegawai); ok && dest != p {
+		dest.NikIndex = indeksNIKDari(dest.Nik)
+		return nil
+	}
+	p.NikIndex = indeksNIKDari(p.Nik)
+	return nil
+}
+
+// siapkanEnkripsi prepares a datadiri written before encryption: the
+// encrypted columns get room for a ciphertext, nik_index is added, and
+// rows without an index or with plaintext, such as the ones the Laravel
+// app writes, are encrypted and indexed.
+func siapkanEnkripsi(db *gorm.DB) error {
+	if !encryption.Default().Enabled() {
+		slog.Warn("ENCRYPTION_KEYS is not set, personal data is stored in plaintext")
+	}
+	m := db.Migrator()
+	if !m.HasColumn(&Pegawai{}, "NikIndex") {
+		if err := m.AddColumn(&Pegawai{}, "NikIndex"); err != nil {
+			return err
+		}
+	}
+	kolom, err := encryption.Columns(db, &Pegawai{})
+	if err != nil {
+		return err
+	}
+	types, err := m.ColumnTypes(&Pegawai{})
+	if err != nil {
+		return err
+	}
+	for _, ct := range types {
+		if !slices.Contains(kolom, ct.Name()) {
+			continue
+		}
+		jenis := strings.ToLower(ct.DatabaseTypeName())
+		panjang, ok := ct.Length()
+		teks := strings.Contains(jenis, "char") || strings.Contains(jenis, "text")
+		if !teks || (strings.Contains(jenis, "char") && ok && panjang < 255) {
+			if err := m.AlterColumn(&Pegawai{}, ct.Name()); err != nil {
+				return err
+			}
+		}
+	}
+	if m.HasIndex(&Pegawai{}, indeksLama) {
+		if err := m.DropIndex(&Pegawai{}, indeksLama); err != nil {
+			return err
+		}
+	}
+
+	belum := []string{"(nik <> '' AND nik_index IS NULL)"}
+	if encryption.Default().Enabled() {
+		for _, c := range kolom {
+			belum = append(belum, fmt.Sprintf("(%s <> '' AND %s NOT LIKE 'enc:%%')", c, c))
+		}
+	}
+	n, err := encryption.Reencrypt(db.Where(strings.Join(belum, " OR ")), &Pegawai{}, indeksBaru)
+	if n > 0 {
+		slog.Info("datadiri rows encrypted", "rows", n)
+	}
+	return err
+}
+
+// indeksBaru returns nik_index when it is not the blind index of the nik
+// of row.
+func indeksBaru(row map[string]interface{}, plain map[string]string) map[string]interface{} {
+	indeks := indeksNIKDari(plain["nik"])
+	var lama *string
+	switch v := row["nik_index"].(type) {
+	case string:
+		lama = &v
+	case []byte:
+		s := string(v)
+		lama = &s
+	}
+	if (indeks == nil) == (lama == nil) && (indeks == nil || *indeks == *lama) {
+		return nil
+	}
+	return map[string]interface{}{"nik_index": indeks}
+}
+
+// encrypt rewrites every encrypted value with the current key and the nik
+// index with the current index key, after a key was added in front of
+// ENCRYPTION_KEYS or ENCRYPTION_INDEX_KEY changed.
+func encrypt(ctx context.Context, db *gorm.DB, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("%w: encrypt", cli.ErrUsage)
+	}
+	db = db.WithContext(ctx)
+	if err := migrate(db); err != nil {
+		return err
+	}
+	for _, model := range []interface{}{&Pegawai{}, &PerubahanData{}, &PenggabunganPegawai{}, &Webhook{}, &PengirimanWebhook{}, &outbox.Event{}} {
+		var extra func(map[string]interface{}, map[string]string) map[string]interface{}
+		if _, ok := model.(*Pegawai); ok {
+			extra = indeksBaru
+		}
+		n, err := encryption.Reencrypt(db, model, extra)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %d rows rewritten\n", tabelDari(db, model), n)
+	}
+	return nil
+}
+
+func tabelDari(db *gorm.DB, model interface{}) string {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return fmt.Sprintf("%T", model)
+	}
+	return stmt.Schema.Table
+}
@@ -1,31 +1,45 @@
-package main
+package pegawai
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
-	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
+
+	"uas/api"
+	"uas/apperror"
+	"uas/logging"
+	"uas/metrics"
+	"uas/openapi"
+	"uas/outbox"
+	"uas/referensi"
+	"uas/repository"
+	"uas/server"
+	"uas/tracing"
 )
 
-// Pegawai struct represents the Pegawai model in Go.
+// Pegawai struct represents the Pegawai model in Go. Nik, Tanggal_lahir and
+// Tempat_lahir are stored encrypted, NikIndex is the blind index of Nik that
+// lookups and the unique index use.
 type Pegawai struct {
 	ID           int64     `json:"id"`
 	Nama         string    `json:"nama"`
-	Nik          string    `json:"nik"`
+	Nik          string    `json:"nik" gorm:"size:255;serializer:encrypted"`
+	NikIndex     *string   `json:"-" gorm:"size:64;uniqueIndex:idx_datadiri_nik_index"`
 	JenisPegawai string       `json:"jenis_pegawai"`
 	StatusPegawai string      `json:"status_pegawai"`
 	Unit         string    `json:"unit"`
 	SubUnit      string    `json:"sub_unit"`
 	Pendidikan   string       `json:"pendidikan"`
-	Tanggal_lahir    string    `json:"tanggal_lahir"`
-	Tempat_lahir   string    `json:"tempat_lahir"`
+	Tanggal_lahir    string    `json:"tanggal_lahir" gorm:"size:255;serializer:encrypted"`
+	Tempat_lahir   string    `json:"tempat_lahir" gorm:"size:255;serializer:encrypted"`
 	Jenis_kelamin      string       `json:"jenis_kelamin"`
 	Agama        string       `json:"agama"`
 	Foto       string    `json:"foto"`
@@ -38,11 +52,11 @@ func (Pegawai) TableName() string {
 }
 
 type PegawaiHandler struct {
-	db *gorm.DB
+	svc PegawaiService
 }
 
-func NewPegawaiHandler(db *gorm.DB) *PegawaiHandler {
-	return &PegawaiHandler{db: db}
+func NewPegawaiHandler(svc PegawaiService) *PegawaiHandler {
+	return &PegawaiHandler{svc: svc}
 }
 
 type PegawaiRequest struct {
@@ -62,150 +76,241 @@ type PegawaiRequest struct {
 }
 
 func (h *PegawaiHandler) GetAllPegawai(ctx echo.Context) error {
-	pegawais := make([]*Pegawai, 0)
-	query := h.db.Model(&Pegawai{})
+	pegawais, err := h.svc.List(ctx.Request().Context())
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Get All Pegawai")
+	}
+	data, err := bentukPegawai.Apply(ctx, pegawais, api.Fields(ctx))
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Get All Pegawai")
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get All Pegawai", "data": data})
+}
 
-	if err := query.Find(&pegawais).Error; err != nil {
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to Get All Pegawai"})
+// gagalPegawai maps a PegawaiService error, an unknown id is a 404.
+func gagalPegawai(err error, detail string) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return apperror.NotFound("Pegawai not found")
 	}
+	return apperror.Wrap(err, detail)
+}
 
-	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get All Pegawai", "data": pegawais})
+// pegawaiID parses the :id parameter, anything but a number cannot exist.
+func pegawaiID(ctx echo.Context) (int64, error) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		return 0, apperror.NotFound("Pegawai not found")
+	}
+	return id, nil
+}
+
+func (input PegawaiRequest) pegawai() *Pegawai {
+	return &Pegawai{
+		ID:            input.ID,
+		Nama:          input.Nama,
+		Nik:           input.Nik,
+		JenisPegawai:  input.JenisPegawai,
+		StatusPegawai: input.StatusPegawai,
+		Unit:          input.Unit,
+		SubUnit:       input.SubUnit,
+		Pendidikan:    input.Pendidikan,
+		Tanggal_lahir: input.Tanggal_lahir,
+		Tempat_lahir:  input.Tempat_lahir,
+		Jenis_kelamin: input.Jenis_kelamin,
+		Agama:         input.Agama,
+		Foto:          input.Foto,
+	}
 }
 
 func (h *PegawaiHandler) CreatePegawai(ctx echo.Context) error {
 	var input PegawaiRequest
 	if err := ctx.Bind(&input); err != nil {
-		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Failed to Bind Input"})
+		return apperror.BadRequest("Failed to Bind Input")
 	}
 
-	pegawai := &Pegawai{
-		Nama:         input.Nama,
-		Nik:          input.Nik,
-		JenisPegawai: input.JenisPegawai,
-		StatusPegawai: input.StatusPegawai,
-		Unit:         input.Unit,
-		SubUnit:      input.SubUnit,
-		Pendidikan:   input.Pendidikan,
-		Tanggal_lahir:    input.Tanggal_lahir,
-		Tempat_lahir:   input.Tempat_lahir,
-		Jenis_kelamin:      input.Jenis_kelamin,
-		Agama:        input.Agama,
-		Foto:       input.Foto,
+	pegawai := input.pegawai()
+	pegawai.ID = 0
+	if err := h.svc.Create(ctx.Request().Context(), pegawai); err != nil {
+		return apperror.Wrap(err, "Failed to Create Pegawai")
 	}
-
-	if err := h.db.Create(pegawai).Error; err != nil {
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to Create Pegawai", "error": err.Error()})
+	data, err := bentukPegawai.Apply(ctx, pegawai, nil)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Create Pegawai")
 	}
 
-	return ctx.JSON(http.StatusCreated, map[string]interface{}{"message": "Successfully Create a Pegawai", "data": pegawai})
+	return ctx.JSON(http.StatusCreated, map[string]interface{}{"message": "Successfully Create a Pegawai", "data": data})
 }
 
 func (h *PegawaiHandler) GetPegawaiByID(ctx echo.Context) error {
-	id := ctx.Param("id")
-	var pegawai Pegawai
-	result := h.db.First(&pegawai, id)
-	if result.Error != nil {
-		return ctx.JSON(http.StatusNotFound, map[string]string{"message": "Pegawai not found"})
+	id, err := pegawaiID(ctx)
+	if err != nil {
+		return err
+	}
+	pegawai, err := h.svc.Get(ctx.Request().Context(), id)
+	if err != nil {
+		return gagalPegawai(err, "Failed to Get Pegawai By ID")
+	}
+	data, err := bentukPegawai.Apply(ctx, pegawai, api.Fields(ctx))
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Get Pegawai By ID")
 	}
 
-	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": fmt.Sprintf("Successfully Get Pegawai By ID: %s", id), "data": pegawai})
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": fmt.Sprintf("Successfully Get Pegawai By ID: %d", id), "data": data})
 }
 
+// UpdatePegawai is the root route, it takes the id in the body.
 func (h *PegawaiHandler) UpdatePegawai(ctx echo.Context) error {
 	var input PegawaiRequest
 	if err := ctx.Bind(&input); err != nil {
-		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Failed to Bind Input"})
+		return apperror.BadRequest("Failed to Bind Input")
 	}
+	return h.update(ctx, input)
+}
 
-	// Check if pegawai with the given ID exists
-	var existingPegawai Pegawai
-	result := h.db.First(&existingPegawai, input.ID)
-	if result.Error != nil {
-		return ctx.JSON(http.StatusNotFound, map[string]string{"message": "Pegawai not found"})
+// UpdatePegawaiByID takes the id from the path like every other update.
+func (h *PegawaiHandler) UpdatePegawaiByID(ctx echo.Context) error {
+	id, err := pegawaiID(ctx)
+	if err != nil {
+		return err
 	}
+	var input PegawaiRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+	input.ID = id
+	return h.update(ctx, input)
+}
 
-	pegawai := &Pegawai{
-		ID:           input.ID,
-		Nama:         input.Nama,
-		Nik:          input.Nik,
-		JenisPegawai: input.JenisPegawai,
-		StatusPegawai: input.StatusPegawai,
-		Unit:         input.Unit,
-		SubUnit:      input.SubUnit,
-		Pendidikan:   input.Pendidikan,
-		Tanggal_lahir:    input.Tanggal_lahir,
-		Tempat_lahir:   input.Tempat_lahir,
-		Jenis_kelamin:      input.Jenis_kelamin,
-		Agama:        input.Agama,
-		Foto:       input.Foto,
+func (h *PegawaiHandler) update(ctx echo.Context, input PegawaiRequest) error {
+	pegawai := input.pegawai()
+	perubahan, err := h.svc.Update(ctx.Request().Context(), pegawai, penggunaDari(ctx))
+	if err != nil {
+		return gagalPegawai(err, "Failed to Update Pegawai")
+	}
+	data, err := bentukPegawai.Apply(ctx, pegawai, nil)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Update Pegawai")
 	}
 
-	fmt.Println("Updating pegawai with ID:", input.ID)
+	if perubahan != nil {
+		return ctx.JSON(http.StatusAccepted, map[string]interface{}{
+			"message":   fmt.Sprintf("Successfully Update Pegawai, changes to %s are waiting for approval", strings.Join(perubahan.fields(), ", ")),
+			"data":      data,
+			"perubahan": perubahan,
+		})
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Update Pegawai", "data": data})
+}
 
-	if err := h.db.Save(pegawai).Error; err != nil {
-		fmt.Println("Error updating pegawai:", err)
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to Update Pegawai", "error": err.Error()})
+func (h *PegawaiHandler) DeletePegawai(ctx echo.Context) error {
+	id, err := pegawaiID(ctx)
+	if err != nil {
+		return err
+	}
+	if err := h.svc.Delete(ctx.Request().Context(), id); err != nil {
+		return gagalPegawai(err, "Failed to Delete Pegawai")
 	}
 
-	fmt.Println("Pegawai updated successfully")
+	return ctx.NoContent(http.StatusNoContent)
+}
 
-	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Update Pegawai", "data": pegawai})
+// tabel are the tables migrate keeps up to date next to datadiri and
+// referensi, /readyz checks that they exist.
+var tabel = []interface{}{
+	&JenisCuti{}, &JatahCuti{}, &KepalaUnit{}, &PengajuanCuti{},
+	&HariLibur{}, &JadwalKerja{}, &Absensi{},
+	&Pengguna{}, &Sesi{},
+	&AturanPersetujuan{}, &PerubahanData{}, &KomentarPerubahan{}, &RiwayatPerubahan{}, &Notifikasi{},
+	&KontakPegawai{}, &AnggotaKeluarga{}, &PenggabunganPegawai{},
+	&Audit{}, &AturanRetensi{},
+	&Webhook{}, &PengirimanWebhook{},
 }
 
-func (h *PegawaiHandler) DeletePegawai(ctx echo.Context) error {
-	id := ctx.Param("id")
-	if err := h.db.Delete(&Pegawai{}, id).Error; err != nil {
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to Delete Pegawai"})
-	}
-
-	return ctx.JSON(http.StatusNoContent, nil)
-}
-
-func initDB() (*gorm.DB, error) {
-	dsn := "root:@tcp(127.0.0.1:3306)/laravel?charset=utf8mb4&parseTime=True&loc=Local"
-	newLogger := logger.New(
-		log.New(os.Stdout, "\r\n", log.LstdFlags),
-		logger.Config{
-			SlowThreshold:             time.Second,
-			LogLevel:                  logger.Info,
-			IgnoreRecordNotFoundError: true,
-			ParameterizedQueries:      false,
-			Colorful:                  true,
-		},
-	)
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
-		Logger: newLogger,
-	})
+// migrate creates the tables and seeds the approval rules and first admin.
+func migrate(db *gorm.DB) error {
+	// datadiri belongs to the Laravel app on the original MySQL database,
+	// so it is only created here on a fresh database.
+	if !db.Migrator().HasTable(&Pegawai{}) {
+		if err := db.Migrator().CreateTable(&Pegawai{}); err != nil {
+			return err
+		}
+	}
+	if err := db.AutoMigrate(tabel...); err != nil {
+		return err
+	}
+	if err := siapkanEnkripsi(db); err != nil {
+		return err
+	}
+	if err := pastikanIndeksNIK(db); err != nil {
+		return err
+	}
+	if err := seedAturanPersetujuan(db); err != nil {
+		return err
+	}
+	if err := seedAturanRetensi(db); err != nil {
+		return err
+	}
+	registry, err := referensi.Bawaan()
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if err := referensi.Migrate(db, registry); err != nil {
+		return err
 	}
-	return db, nil
+	return bootstrapAdmin(db)
 }
 
-func main() {
-	// Initialize database
-	db, err := initDB()
+// newServer wires every handler and middleware into a fresh Echo instance.
+func newServer(db *gorm.DB) (*echo.Echo, error) {
+	registry, err := referensi.Bawaan()
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	// Initialize handler
-	pegawaiHandler := NewPegawaiHandler(db)
+	referensiHandler := referensi.NewReferensiHandler(referensi.NewGormService(db, registry))
+	broker := outbox.NewBroker(db)
+	v1, lama := rute(db, referensiHandler, NewStreamHandler(db, broker))
+
+	m := metrics.New()
+	if err := m.Instrument(db); err != nil {
+		return nil, err
+	}
+	if err := tracing.Instrument(db); err != nil {
+		return nil, err
+	}
+	headcount := NewPegawaiService(db).Headcount
+	err = m.Gauge("pegawai_headcount", "Pegawai per status_pegawai.", "status_pegawai", func() (map[string]float64, error) {
+		return headcount(context.Background())
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	// Initialize Echo framework
 	e := echo.New()
+	// open event streams end on shutdown instead of holding up the drain
+	e.Server.RegisterOnShutdown(broker.Close)
+	e.HTTPErrorHandler = apperror.HTTPErrorHandler
+	e.JSONSerializer = tracing.JSONSerializer(e.JSONSerializer)
 
 	// Middleware
-	e.Use(middleware.Logger())
+	e.Use(tracing.Middleware())
+	e.Use(m.Middleware())
+	e.Use(middleware.RequestID())
+	e.Use(logging.Middleware())
 	e.Use(middleware.Recover())
+	e.Use(AuthMiddleware(db))
 
 	// Routing
-	e.GET("/pegawai", pegawaiHandler.GetAllPegawai)
-	e.GET("/pegawai/:id", pegawaiHandler.GetPegawaiByID)
-	e.POST("/pegawai", pegawaiHandler.CreatePegawai)
-	e.PUT("/pegawai", pegawaiHandler.UpdatePegawai)
-	e.DELETE("/pegawai/:id", pegawaiHandler.DeletePegawai)
-
-	// Start server
-	e.Logger.Fatal(e.Start(":1324"))
+	spec := openapi.New("Pegawai API", "1.0.0", "Pegawai, cuti, absensi, approvals and the referensi lookup lists.")
+	a := api.New(e, spec)
+	a.Version("v1", v1, nil)
+	a.Unversioned(lama, api.RootDeprecation)
+	a.Root(server.NewHealthHandler(db, semuaTabel()...).Routes())
+	a.Root(m.Routes())
+	spec.Register(e)
+
+	return e, nil
 }
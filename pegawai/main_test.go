@@ -0,0 +1,2043 @@
+package pegawai
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"uas/api"
+	"uas/cli"
+	"uas/encryption"
+	"uas/outbox"
+	"uas/testutil"
+)
+
+func newTestServer(t *testing.T) (*testutil.Server, *gorm.DB) {
+	db := testutil.OpenDB(t, migrate)
+	testutil.LoadFixtures(t, db, "pegawai.json", &[]Pegawai{})
+	e, err := newServer(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testutil.NewServer(t, e), db
+}
+
+func muatPegawai(t *testing.T, db *gorm.DB, id int64) Pegawai {
+	t.Helper()
+	var p Pegawai
+	if err := db.First(&p, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// masuk logs srv in as a Pengguna with peran linked to Pegawai pegawaiID.
+func masuk(t *testing.T, srv *testutil.Server, db *gorm.DB, peran string, pegawaiID int64) *Pengguna {
+	t.Helper()
+	pengguna := &Pengguna{Username: peran, Peran: peran, PegawaiID: &pegawaiID}
+	if err := db.Create(pengguna).Error; err != nil {
+		t.Fatal(err)
+	}
+	token := "token-" + peran
+	sesi := &Sesi{PenggunaID: pengguna.ID, TokenHash: hashToken(token), ExpiresAt: time.Now().Add(time.Hour)}
+	if err := db.Create(sesi).Error; err != nil {
+		t.Fatal(err)
+	}
+	srv.Header.Set("Authorization", "Bearer "+token)
+	return pengguna
+}
+
+// ubahPegawai is the body of PUT /pegawai for fixture 1 with one field changed.
+func ubahPegawai(field, nilai string) map[string]interface{} {
+	body := map[string]interface{}{
+		"id": 1, "nama": "Budi Santoso", "nik": "3273010101900001", "jenis_pegawai": "PNS",
+		"status_pegawai": "Aktif", "unit": "Keuangan", "sub_unit": "Anggaran", "pendidikan": "S1",
+		"tanggal_lahir": "1990-01-01", "tempat_lahir": "Bandung", "jenis_kelamin": "Laki-laki", "agama": "Islam",
+	}
+	body[field] = nilai
+	return body
+}
+
+func TestPegawaiHandler(t *testing.T) {
+	baru := map[string]string{"nama": "Dewi Lestari", "nik": "3201-0147-0395-0004", "unit": "Umum"}
+	// the id in the body of /api/v1 is ignored
+	idLain := ubahPegawai("nama", "Budi")
+	idLain["id"] = 2
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    interface{}
+		peran   string
+		breakDB bool
+		code    int
+		check   func(t *testing.T, res *testutil.Response, db *gorm.DB)
+	}{
+		{name: "get all", method: http.MethodGet, path: "/pegawai", code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data []Pegawai
+				res.Data(&data)
+				if len(data) != 3 {
+					t.Errorf("got %d rows, want 3", len(data))
+				}
+			}},
+		{name: "get all db failure", method: http.MethodGet, path: "/pegawai", breakDB: true, code: http.StatusInternalServerError},
+
+		{name: "get by id", method: http.MethodGet, path: "/pegawai/2", code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data Pegawai
+				res.Data(&data)
+				if data.Nama != "Siti Aminah" || data.Nik != "3273********0002" || data.Tanggal_lahir != "1992-**-**" {
+					t.Errorf("got %+v, want nik and tanggal_lahir masked", data)
+				}
+			}},
+		{name: "get by id as hr", method: http.MethodGet, path: "/pegawai/2", peran: PeranHR, code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data Pegawai
+				res.Data(&data)
+				if data.Nik != "3273014502920002" || data.Tanggal_lahir != "1992-02-05" {
+					t.Errorf("got %+v", data)
+				}
+			}},
+		{name: "get all as pegawai 2", method: http.MethodGet, path: "/pegawai", peran: PeranPegawai, code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data []Pegawai
+				res.Data(&data)
+				if len(data) != 3 || data[0].Nik != "3273********0001" || data[1].Nik != "3273014502920002" {
+					t.Errorf("got %+v, want only their own NIK in full", data)
+				}
+			}},
+		{name: "get all with fields", method: http.MethodGet, path: "/pegawai?fields=nama,%20nik", code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data []map[string]interface{}
+				res.Data(&data)
+				if len(data) != 3 || len(data[0]) != 2 || data[0]["nama"] != "Budi Santoso" || data[0]["nik"] != "3273********0001" {
+					t.Errorf("got %v", data)
+				}
+			}},
+		{name: "get by id with fields", method: http.MethodGet, path: "/api/v1/pegawai/2?fields=unit", code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data map[string]interface{}
+				res.Data(&data)
+				if len(data) != 1 || data["unit"] != "Kepegawaian" {
+					t.Errorf("got %v", data)
+				}
+			}},
+		{name: "get all with unknown field", method: http.MethodGet, path: "/pegawai?fields=nama,gaji", code: http.StatusUnprocessableEntity},
+		{name: "profil as hr", peran: PeranHR, method: http.MethodGet, path: "/pegawai/1/profil", code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data Profil
+				res.Data(&data)
+				if data.Pegawai.Nik != "3273010101900001" || data.Kontak == nil {
+					t.Errorf("got %+v", data)
+				}
+			}},
+		{name: "profil without login", method: http.MethodGet, path: "/pegawai/1/profil", code: http.StatusUnauthorized},
+		{name: "profil as pegawai", peran: PeranPegawai, method: http.MethodGet, path: "/pegawai/2/profil", code: http.StatusForbidden},
+		{name: "get by id missing", method: http.MethodGet, path: "/pegawai/99", code: http.StatusNotFound},
+		{name: "get by id db failure", method: http.MethodGet, path: "/pegawai/2", breakDB: true, code: http.StatusInternalServerError},
+
+		{name: "create", peran: PeranHR, method: http.MethodPost, path: "/pegawai", body: baru, code: http.StatusCreated,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data Pegawai
+				res.Data(&data)
+				if saved := muatPegawai(t, db, data.ID); saved.Nik != "3201014703950004" {
+					t.Errorf("nik saved as %q, want it normalized", saved.Nik)
+				}
+			}},
+		{name: "create invalid nik", peran: PeranHR, method: http.MethodPost, path: "/pegawai", body: map[string]string{"nama": "Dewi", "nik": "12345"}, code: http.StatusUnprocessableEntity},
+		{name: "create duplicate nik", peran: PeranHR, method: http.MethodPost, path: "/pegawai", body: map[string]string{"nama": "Dewi", "nik": "3273 0101 0190 0001"}, code: http.StatusConflict},
+		{name: "create without login", method: http.MethodPost, path: "/pegawai", body: baru, code: http.StatusUnauthorized},
+		{name: "create as pegawai", peran: PeranPegawai, method: http.MethodPost, path: "/pegawai", body: baru, code: http.StatusForbidden},
+		{name: "create bind failure", peran: PeranHR, method: http.MethodPost, path: "/pegawai", body: `{"nama":`, code: http.StatusBadRequest},
+		{name: "create db failure", peran: PeranHR, method: http.MethodPost, path: "/pegawai", body: baru, breakDB: true, code: http.StatusInternalServerError},
+		{name: "create referensi as hr", peran: PeranHR, method: http.MethodPost, path: "/referensi/agama", body: map[string]string{"nama": "Konghucu"}, code: http.StatusCreated},
+		{name: "create referensi without login", method: http.MethodPost, path: "/referensi/agama", body: map[string]string{"nama": "Konghucu"}, code: http.StatusUnauthorized},
+		{name: "delete referensi as pegawai", peran: PeranPegawai, method: http.MethodDelete, path: "/referensi/agama/1", code: http.StatusForbidden},
+		{name: "list referensi without login", method: http.MethodGet, path: "/referensi/agama", code: http.StatusOK},
+
+		{name: "update", peran: PeranHR, method: http.MethodPut, path: "/pegawai", body: ubahPegawai("nama", "Budi Santoso, S.E."), code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				if saved := muatPegawai(t, db, 1); saved.Nama != "Budi Santoso, S.E." {
+					t.Errorf("nama saved as %q", saved.Nama)
+				}
+			}},
+		{name: "update sensitive field waits for approval", peran: PeranHR, method: http.MethodPut, path: "/pegawai", body: ubahPegawai("unit", "Umum"), code: http.StatusAccepted,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				if saved := muatPegawai(t, db, 1); saved.Unit != "Keuangan" {
+					t.Errorf("unit changed to %q before approval", saved.Unit)
+				}
+				var perubahan []PerubahanData
+				db.Where("pegawai_id = ?", 1).Find(&perubahan)
+				if len(perubahan) != 1 || perubahan[0].Perubahan["unit"].Baru != "Umum" {
+					t.Errorf("got change requests %+v", perubahan)
+				}
+			}},
+		{name: "update with the masked values keeps them", peran: PeranHR, method: http.MethodPut, path: "/pegawai",
+			body: map[string]interface{}{"id": 1, "nama": "Budi S.", "nik": "3273********0001", "tanggal_lahir": "1990-**-**", "tempat_lahir": "Bandung",
+				"jenis_pegawai": "PNS", "status_pegawai": "Aktif", "unit": "Keuangan", "sub_unit": "Anggaran", "pendidikan": "S1",
+				"jenis_kelamin": "Laki-laki", "agama": "Islam"},
+			code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				if saved := muatPegawai(t, db, 1); saved.Nama != "Budi S." || saved.Nik != "3273010101900001" || saved.Tanggal_lahir != "1990-01-01" {
+					t.Errorf("saved %+v", saved)
+				}
+			}},
+		{name: "update invalid nik", peran: PeranHR, method: http.MethodPut, path: "/pegawai", body: ubahPegawai("nik", "12345"), code: http.StatusUnprocessableEntity},
+		{name: "update duplicate nik", peran: PeranHR, method: http.MethodPut, path: "/pegawai", body: ubahPegawai("nik", "3273014502920002"), code: http.StatusConflict},
+		{name: "update missing", peran: PeranHR, method: http.MethodPut, path: "/pegawai", body: map[string]interface{}{"id": 99, "nama": "X"}, code: http.StatusNotFound},
+		{name: "update without login", method: http.MethodPut, path: "/pegawai", body: ubahPegawai("unit", "Umum"), code: http.StatusUnauthorized,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var n int64
+				if db.Model(&PerubahanData{}).Count(&n); n != 0 {
+					t.Errorf("%d anonymous change requests", n)
+				}
+			}},
+		{name: "v1 update as pegawai", peran: PeranPegawai, method: http.MethodPut, path: "/api/v1/pegawai/2", body: ubahPegawai("nama", "Siti"), code: http.StatusForbidden},
+		{name: "update bind failure", peran: PeranHR, method: http.MethodPut, path: "/pegawai", body: `{"id":`, code: http.StatusBadRequest},
+		{name: "update db failure", peran: PeranHR, method: http.MethodPut, path: "/pegawai", body: ubahPegawai("nama", "Budi"), breakDB: true, code: http.StatusInternalServerError},
+
+		{name: "v1 update takes the id from the path", peran: PeranHR, method: http.MethodPut, path: "/api/v1/pegawai/1", body: idLain, code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				if res.Header.Get("Deprecation") != "" || res.Header.Get(api.HeaderVersion) != "v1" {
+					t.Errorf("got headers %v", res.Header)
+				}
+				if saved := muatPegawai(t, db, 1); saved.Nama != "Budi" {
+					t.Errorf("pegawai 1 saved as %q", saved.Nama)
+				}
+				if saved := muatPegawai(t, db, 2); saved.Nama != "Siti Aminah" {
+					t.Errorf("pegawai 2 renamed to %q", saved.Nama)
+				}
+			}},
+		{name: "v1 update missing", peran: PeranHR, method: http.MethodPut, path: "/api/v1/pegawai/99", body: ubahPegawai("nama", "X"), code: http.StatusNotFound},
+		{name: "v1 update bad id", peran: PeranHR, method: http.MethodPut, path: "/api/v1/pegawai/abc", body: ubahPegawai("nama", "X"), code: http.StatusNotFound},
+		{name: "v1 has no update without id", peran: PeranHR, method: http.MethodPut, path: "/api/v1/pegawai", body: ubahPegawai("nama", "X"), code: http.StatusMethodNotAllowed},
+		{name: "root routes are deprecated", peran: PeranHR, method: http.MethodPut, path: "/pegawai", body: ubahPegawai("nama", "Budi"), code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				if res.Header.Get("Deprecation") == "" || res.Header.Get("Sunset") == "" {
+					t.Errorf("got headers %v", res.Header)
+				}
+				if link := res.Header.Get("Link"); link != `</api/v1/pegawai/{id}>; rel="successor-version"` {
+					t.Errorf("got Link %q", link)
+				}
+			}},
+
+		{name: "delete", peran: PeranHR, method: http.MethodDelete, path: "/pegawai/3", code: http.StatusNoContent,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				if err := db.First(&Pegawai{}, 3).Error; err != gorm.ErrRecordNotFound {
+					t.Errorf("pegawai 3 still there, err %v", err)
+				}
+			}},
+		{name: "delete missing", peran: PeranHR, method: http.MethodDelete, path: "/pegawai/99", code: http.StatusNotFound},
+		{name: "delete treats id as a value", peran: PeranHR, method: http.MethodDelete, path: "/pegawai/0%20OR%201=1", code: http.StatusNotFound,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var n int64
+				db.Model(&Pegawai{}).Count(&n)
+				if n != 3 {
+					t.Errorf("got %d rows, want 3", n)
+				}
+			}},
+		{name: "delete without login", method: http.MethodDelete, path: "/pegawai/3", code: http.StatusUnauthorized},
+		{name: "delete db failure", peran: PeranHR, method: http.MethodDelete, path: "/pegawai/3", breakDB: true, code: http.StatusInternalServerError},
+
+		{name: "metrics", method: http.MethodGet, path: "/metrics", code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				for _, want := range []string{
+					`uas_pegawai_headcount{status_pegawai="Aktif"} 2`,
+					`uas_pegawai_headcount{status_pegawai="Cuti"} 1`,
+					`go_sql_open_connections{db_name="sqlite"}`,
+				} {
+					if !strings.Contains(string(res.Body), want) {
+						t.Errorf("/metrics is missing %s", want)
+					}
+				}
+			}},
+		{name: "ready", method: http.MethodGet, path: "/readyz", code: http.StatusOK},
+		{name: "not ready without database", method: http.MethodGet, path: "/readyz", breakDB: true, code: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, db := newTestServer(t)
+			if tt.peran != "" {
+				masuk(t, srv, db, tt.peran, 2)
+			}
+			if tt.breakDB && tt.peran != "" {
+				// the login still has to be found, only the Pegawai are gone
+				if err := db.Migrator().DropTable(&Pegawai{}); err != nil {
+					t.Fatal(err)
+				}
+			} else if tt.breakDB {
+				testutil.BreakDB(t, db)
+			}
+			res := srv.Do(tt.method, tt.path, tt.body).Expect(tt.code)
+			if tt.check != nil {
+				tt.check(t, res, db)
+			}
+		})
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	srv, _ := newTestServer(t)
+	doc := testutil.CheckOpenAPI(t, srv)
+	// the root PUT /pegawai is the one update that takes its id in the body
+	put := doc.Paths["/pegawai"]["put"]
+	if put == nil || len(put.Parameters) != 0 || put.RequestBody == nil {
+		t.Errorf("PUT /pegawai is documented as %+v", put)
+	}
+	if put == nil || !put.Deprecated {
+		t.Error("PUT /pegawai is not documented as deprecated")
+	}
+	if v1 := doc.Paths["/api/v1/pegawai/{id}"]["put"]; v1 == nil || v1.Deprecated || len(v1.Parameters) != 1 {
+		t.Errorf("PUT /api/v1/pegawai/{id} is documented as %+v", v1)
+	}
+	if _, ok := doc.Components.Schemas["Pengguna"].Properties["password_hash"]; ok {
+		t.Error("the schema of Pengguna shows its password hash")
+	}
+}
+
+func TestUserCreate(t *testing.T) {
+	db := testutil.OpenDB(t, migrate)
+	testutil.LoadFixtures(t, db, "pegawai.json", &[]Pegawai{})
+	tests := []struct {
+		name     string
+		args     []string
+		password string
+		wantErr  string
+	}{
+		{name: "created", args: []string{"-username", "siti", "-peran", PeranHR, "-pegawai-id", "1"}, password: "rahasia123\n"},
+		{name: "taken username", args: []string{"-username", "siti", "-peran", PeranHR}, password: "rahasia123\n", wantErr: "conflict"},
+		{name: "short password", args: []string{"-username", "andi", "-peran", PeranHR}, password: "pendek\n", wantErr: "validation_failed"},
+		{name: "unknown peran", args: []string{"-username", "andi", "-peran", "raja"}, password: "rahasia123", wantErr: "Invalid peran"},
+		{name: "unknown pegawai", args: []string{"-username", "andi", "-peran", PeranPegawai, "-pegawai-id", "99"}, password: "rahasia123", wantErr: "Pegawai not found"},
+		{name: "stray argument", args: []string{"andi"}, wantErr: cli.ErrUsage.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdin = strings.NewReader(tt.password)
+			t.Cleanup(func() { stdin = os.Stdin })
+			err := userCreate(context.Background(), db, tt.args)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				var p Pengguna
+				if err := db.Where("username = ?", "siti").First(&p).Error; err != nil || p.Peran != PeranHR || p.PegawaiID == nil {
+					t.Errorf("got %+v, %v", p, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSeedDemo(t *testing.T) {
+	db := testutil.OpenDB(t, migrate)
+	testutil.LoadFixtures(t, db, "pegawai.json", &[]Pegawai{})
+	dibuat, err := buatDemo(context.Background(), db, rand.New(rand.NewSource(1)), 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dibuat) != 200 {
+		t.Fatalf("got %d Pegawai", len(dibuat))
+	}
+	wilayah := map[string]string{}
+	for _, k := range kota {
+		wilayah[k.Nama] = k.Wilayah
+	}
+	nik := map[string]bool{}
+	for _, p := range dibuat {
+		lahir, err := time.Parse(time.DateOnly, p.Tanggal_lahir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hari := lahir.Day()
+		if p.Jenis_kelamin == "Perempuan" {
+			hari += 40
+		}
+		want := fmt.Sprintf("%s%02d%02d%02d", wilayah[p.Tempat_lahir], hari, int(lahir.Month()), lahir.Year()%100)
+		if !validNIK(p.Nik) || !strings.HasPrefix(p.Nik, want) || p.Nik[12:] == "0000" {
+			t.Errorf("NIK %s of %+v does not start with %s", p.Nik, p, want)
+		}
+		if nik[p.Nik] {
+			t.Errorf("NIK %s is used twice", p.Nik)
+		}
+		nik[p.Nik] = true
+		if p.Nama == "" || p.Agama == "" || p.Pendidikan == "" || p.SubUnit == "" {
+			t.Errorf("incomplete %+v", p)
+		}
+	}
+	var n int64
+	db.Model(&Pegawai{}).Count(&n)
+	if n != 203 {
+		t.Errorf("got %d rows, want the 3 fixtures and 200 demo Pegawai", n)
+	}
+
+	// the same seed makes the same Pegawai
+	lagi := pegawaiDemo(rand.New(rand.NewSource(1)))
+	if lagi.Nik != dibuat[0].Nik || lagi.Nama != dibuat[0].Nama {
+		t.Errorf("seed 1 gave %+v, then %+v", dibuat[0], lagi)
+	}
+}
+
+// kolomMentah returns the stored value of column of datadiri row id.
+func kolomMentah(t *testing.T, db *gorm.DB, id int64, column string) string {
+	t.Helper()
+	var nilai *string
+	if err := db.Table("datadiri").Where("id = ?", id).Select(column).Row().Scan(&nilai); err != nil {
+		t.Fatal(err)
+	}
+	if nilai == nil {
+		return ""
+	}
+	return *nilai
+}
+
+func TestEnkripsi(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		run    func(t *testing.T, db *gorm.DB)
+		id     int64
+		nik    string
+		tempat string
+		kunci  string
+	}{
+		{name: "fixture", run: func(t *testing.T, db *gorm.DB) {}, id: 1, nik: "3273010101900001", tempat: "Bandung", kunci: "test"},
+		{name: "profile update", run: func(t *testing.T, db *gorm.DB) {
+			if err := terapkanProfil(db, 1, map[string]string{"nik": "3273010101900009", "tempat_lahir": "Cimahi"}); err != nil {
+				t.Fatal(err)
+			}
+		}, id: 1, nik: "3273010101900009", tempat: "Cimahi", kunci: "test"},
+		{name: "row of the Laravel app", run: func(t *testing.T, db *gorm.DB) {
+			err := db.Exec("INSERT INTO datadiri (id, nama, nik, tempat_lahir) VALUES (9, 'Ani', '3273015505950009', 'Garut')").Error
+			if err != nil {
+				t.Fatal(err)
+			}
+			if terpakai, err := nikTerpakai(db, "3273015505950009", 0); err != nil || !terpakai {
+				t.Errorf("plaintext NIK not found: %v, %v", terpakai, err)
+			}
+			if err := migrate(db); err != nil {
+				t.Fatal(err)
+			}
+		}, id: 9, nik: "3273015505950009", tempat: "Garut", kunci: "test"},
+		{name: "key rotation", run: func(t *testing.T, db *gorm.DB) {
+			baru, err := encryption.NewKeyring("baru", map[string][]byte{
+				"baru": bytes.Repeat([]byte{3}, encryption.KeySize),
+				"test": bytes.Repeat([]byte{1}, encryption.KeySize),
+			}, bytes.Repeat([]byte{2}, encryption.KeySize))
+			if err != nil {
+				t.Fatal(err)
+			}
+			encryption.Use(baru)
+			t.Cleanup(func() { encryption.Use(testutil.Keyring) })
+			if err := encrypt(ctx, db, nil); err != nil {
+				t.Fatal(err)
+			}
+			// the old key can go once everything is rewritten
+			tanpaLama, err := encryption.NewKeyring("baru", map[string][]byte{"baru": bytes.Repeat([]byte{3}, encryption.KeySize)}, bytes.Repeat([]byte{2}, encryption.KeySize))
+			if err != nil {
+				t.Fatal(err)
+			}
+			encryption.Use(tanpaLama)
+			if _, err := outbox.After(db, 0, 10); err != nil {
+				t.Errorf("outbox after the rotation: %v", err)
+			}
+		}, id: 2, nik: "3273014502920002", tempat: "Bogor", kunci: "baru"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.OpenDB(t, migrate)
+			testutil.LoadFixtures(t, db, "pegawai.json", &[]Pegawai{})
+			tt.run(t, db)
+
+			for _, column := range []string{"nik", "tempat_lahir"} {
+				if mentah := kolomMentah(t, db, tt.id, column); !strings.HasPrefix(mentah, "enc:"+tt.kunci+":") {
+					t.Errorf("%s stored as %q, want it encrypted with key %s", column, mentah, tt.kunci)
+				}
+			}
+			if indeks := kolomMentah(t, db, tt.id, "nik_index"); indeks != encryption.Default().BlindIndex("datadiri.nik", tt.nik) {
+				t.Errorf("nik_index is %q", indeks)
+			}
+			if p := muatPegawai(t, db, tt.id); p.Nik != tt.nik || p.Tempat_lahir != tt.tempat {
+				t.Errorf("read back %+v", p)
+			}
+			// uniqueness still holds on the encrypted NIK
+			p := Pegawai{Nama: "Lain", Nik: tt.nik}
+			if err := NewPegawaiService(db).Create(ctx, &p); err == nil {
+				t.Errorf("a second Pegawai got NIK %s", tt.nik)
+			}
+		})
+	}
+}
+
+// isiZip returns the files of a zip archive by name.
+func isiZip(t *testing.T, body []byte) map[string][]byte {
+	t.Helper()
+	r, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	isi := map[string][]byte{}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		isi[f.Name] = b
+	}
+	return isi
+}
+
+func TestDataPribadi(t *testing.T) {
+	pensiun := func(t *testing.T, db *gorm.DB) {
+		if err := db.Model(&Pegawai{}).Where("id = ?", 2).Update("status_pegawai", "Pensiun").Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name    string
+		peran   string
+		method  string
+		path    string
+		body    interface{}
+		siapkan func(t *testing.T, db *gorm.DB)
+		code    int
+		check   func(t *testing.T, res *testutil.Response, db *gorm.DB)
+	}{
+		{name: "export as hr", peran: PeranHR, method: http.MethodGet, path: "/pegawai/2/datapribadi", code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				if ct := res.Header.Get(echo.HeaderContentType); ct != "application/zip" {
+					t.Errorf("content type %q", ct)
+				}
+				isi := isiZip(t, res.Body)
+				var p Pegawai
+				if err := json.Unmarshal(isi["pegawai.json"], &p); err != nil || p.Nik != "3273014502920002" {
+					t.Errorf("pegawai.json is %s, %v", isi["pegawai.json"], err)
+				}
+				if !strings.Contains(string(isi["kontak.json"]), "siti@example.com") || !strings.Contains(string(isi["keluarga.json"]), "Ahmad") {
+					t.Errorf("kontak %s, keluarga %s", isi["kontak.json"], isi["keluarga.json"])
+				}
+				if !strings.Contains(string(isi["cuti.json"]), "menikah") || string(isi["foto.png"]) != "png" {
+					t.Errorf("cuti %s, foto %q", isi["cuti.json"], isi["foto.png"])
+				}
+				var events []outbox.Event
+				if err := json.Unmarshal(isi["outbox.json"], &events); err != nil || len(events) != 2 ||
+					events[0].Event != "pegawai.created" || !strings.Contains(string(events[0].Data), "3273014502920002") {
+					t.Errorf("outbox.json is %s, %v", isi["outbox.json"], err)
+				}
+				var audit []Audit
+				db.Where("entitas_id = ?", 2).Find(&audit)
+				if len(audit) != 1 || audit[0].Aksi != AuditEkspor || audit[0].PenggunaID == nil {
+					t.Errorf("audit log %+v", audit)
+				}
+			}},
+		{name: "export of your own", peran: PeranPegawai, method: http.MethodGet, path: "/me/datapribadi", code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				if _, ok := isiZip(t, res.Body)["pengguna.json"]; !ok {
+					t.Error("pengguna.json is missing")
+				}
+			}},
+		{name: "export of another as pegawai", peran: PeranPegawai, method: http.MethodGet, path: "/pegawai/1/datapribadi", code: http.StatusForbidden},
+		{name: "export not found", peran: PeranHR, method: http.MethodGet, path: "/pegawai/99/datapribadi", code: http.StatusNotFound},
+
+		{name: "anonymize still employed", peran: PeranAdmin, method: http.MethodPost, path: "/pegawai/2/anonimisasi",
+			body: map[string]string{"alasan": "masa retensi habis"}, code: http.StatusConflict},
+		{name: "anonymize without alasan", peran: PeranAdmin, method: http.MethodPost, path: "/pegawai/2/anonimisasi",
+			body: map[string]string{}, siapkan: pensiun, code: http.StatusUnprocessableEntity},
+		{name: "anonymize as hr", peran: PeranHR, method: http.MethodPost, path: "/pegawai/2/anonimisasi",
+			body: map[string]string{"alasan": "masa retensi habis"}, siapkan: pensiun, code: http.StatusForbidden},
+		{name: "anonymize", peran: PeranAdmin, method: http.MethodPost, path: "/pegawai/2/anonimisasi",
+			body: map[string]string{"alasan": "masa retensi habis"}, code: http.StatusOK,
+			siapkan: func(t *testing.T, db *gorm.DB) {
+				pensiun(t, db)
+				// a webhook delivery of the change still waiting to be sent
+				payload := `{"event":"pegawai.updated","created_at":"2026-01-02T00:00:00Z","data":{"id":2,"nama":"Siti Aminah","nik":"3273014502920002"}}`
+				if err := db.Create(&PengirimanWebhook{WebhookID: 1, PegawaiID: 2, Event: EventPegawaiDiubah, Payload: payload, Status: StatusPengirimanMenunggu}).Error; err != nil {
+					t.Fatal(err)
+				}
+			},
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				p := muatPegawai(t, db, 2)
+				if p.Nama != "Anonim 2" || p.Nik != "" || p.NikIndex != nil || p.Tempat_lahir != "" || p.Foto != "" || p.Tanggal_lahir != "1992-01-01" {
+					t.Errorf("still identifying: %+v", p)
+				}
+				if p.Unit != "Kepegawaian" || p.Jenis_kelamin != "Perempuan" || p.StatusPegawai != "Pensiun" {
+					t.Errorf("statistics changed: %+v", p)
+				}
+				var kontak, keluarga, cuti, sesi int64
+				db.Model(&KontakPegawai{}).Where("pegawai_id = ?", 2).Count(&kontak)
+				db.Model(&AnggotaKeluarga{}).Where("pegawai_id = ?", 2).Count(&keluarga)
+				db.Model(&PengajuanCuti{}).Where("pegawai_id = ? AND alasan = ''", 2).Count(&cuti)
+				db.Model(&Sesi{}).Joins("JOIN pengguna ON pengguna.id = sesi.pengguna_id").Where("pengguna.username = ?", PeranPegawai).Count(&sesi)
+				if kontak != 0 || keluarga != 0 || cuti != 1 || sesi != 0 {
+					t.Errorf("kontak %d, keluarga %d, cuti kept %d, sesi of the account %d", kontak, keluarga, cuti, sesi)
+				}
+				var audit Audit
+				if err := db.Where("aksi = ?", AuditAnonimisasi).First(&audit).Error; err != nil || audit.Keterangan != "masa retensi habis" {
+					t.Errorf("audit %+v, %v", audit, err)
+				}
+				var events []outbox.Event
+				db.Where("resource = ? AND resource_id = ?", sumberPegawai, 2).Order("id").Find(&events)
+				if len(events) < 3 || !strings.Contains(string(events[len(events)-1].Data), "Anonim 2") {
+					t.Errorf("got %d events", len(events))
+				}
+				for _, e := range events {
+					if strings.Contains(string(e.Data), "Siti") || strings.Contains(string(e.Data), "3273014502920002") {
+						t.Errorf("event %d still identifying: %s", e.ID, e.Data)
+					}
+				}
+				var kirim PengirimanWebhook
+				db.First(&kirim)
+				if kirim.Payload != `{"created_at":"2026-01-02T00:00:00Z","data":{"id":2},"event":"pegawai.updated"}` {
+					t.Errorf("delivery still identifying: %s", kirim.Payload)
+				}
+			}},
+		{name: "audit log", peran: PeranAdmin, method: http.MethodGet, path: "/audit?aksi=" + AuditEkspor, code: http.StatusOK,
+			siapkan: func(t *testing.T, db *gorm.DB) {
+				catatAudit(db, AuditEkspor, "pegawai", 2, nil, "")
+				catatAudit(db, AuditAnonimisasi, "pegawai", 3, nil, "")
+			},
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data []Audit
+				res.Data(&data)
+				if len(data) != 1 || data[0].EntitasID != 2 {
+					t.Errorf("got %+v", data)
+				}
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, db := newTestServer(t)
+			// the data of Pegawai 2 and an account that logs in as them
+			if err := db.Model(&Pegawai{}).Where("id = ?", 2).Update("foto", "data:image/png;base64,"+base64.StdEncoding.EncodeToString([]byte("png"))).Error; err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range []interface{}{
+				&KontakPegawai{PegawaiID: 2, Email: "siti@example.com"},
+				&AnggotaKeluarga{PegawaiID: 2, Nama: "Ahmad", Hubungan: "Suami"},
+				&PengajuanCuti{PegawaiID: 2, JenisCutiID: 1, Alasan: "menikah", Status: "Disetujui"},
+			} {
+				if err := db.Create(v).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			masuk(t, srv, db, PeranPegawai, 2)
+			if tt.peran != PeranPegawai {
+				masuk(t, srv, db, tt.peran, 1)
+			}
+			if tt.siapkan != nil {
+				tt.siapkan(t, db)
+			}
+			res := srv.Do(tt.method, tt.path, tt.body).Expect(tt.code)
+			if tt.check != nil {
+				tt.check(t, res, db)
+			}
+		})
+	}
+}
+
+func TestRetensi(t *testing.T) {
+	lama := time.Now().AddDate(-11, 0, 0)
+	tests := []struct {
+		name    string
+		peran   string
+		method  string
+		path    string
+		body    interface{}
+		siapkan func(t *testing.T, db *gorm.DB)
+		code    int
+		check   func(t *testing.T, res *testutil.Response, db *gorm.DB)
+	}{
+		{name: "dry run", method: http.MethodGet, path: "/retensi", code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data []HasilRetensi
+				res.Data(&data)
+				dipilih := map[string][]int64{}
+				for _, h := range data {
+					dipilih[h.Aturan.Entitas] = h.ID
+					if h.Diproses != 0 {
+						t.Errorf("dry run purged %+v", h)
+					}
+				}
+				if len(dipilih["referensi"]) != 1 || fmt.Sprint(dipilih["pegawai"]) != "[3]" || len(dipilih["notifikasi"]) != 1 {
+					t.Errorf("got %v", dipilih)
+				}
+				var n int64
+				db.Model(&Audit{}).Count(&n)
+				if p := muatPegawai(t, db, 3); p.Nama != "Yohanes Wibowo" || n != 0 {
+					t.Errorf("dry run changed %+v, %d audit entries", p, n)
+				}
+			}},
+		{name: "purge", method: http.MethodPost, path: "/retensi", code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var referensi, notifikasi int64
+				db.Table("referensi").Where("kode = ?", "LAMA").Count(&referensi)
+				db.Model(&Notifikasi{}).Count(&notifikasi)
+				if referensi != 0 || notifikasi != 1 {
+					t.Errorf("left %d old referensi, %d notifikasi, want 0 and the unread one", referensi, notifikasi)
+				}
+				if p := muatPegawai(t, db, 3); p.Nama != "Anonim 3" || p.Unit != "Keuangan" {
+					t.Errorf("got %+v", p)
+				}
+				if p := muatPegawai(t, db, 2); p.Nama != "Siti Aminah" {
+					t.Errorf("a recent former employee was anonymized: %+v", p)
+				}
+				var audit []Audit
+				db.Order("id").Find(&audit)
+				aksi := make([]string, len(audit))
+				for i, a := range audit {
+					aksi[i] = a.Entitas + ":" + a.Aksi
+					if a.PenggunaID == nil || !strings.HasPrefix(a.Keterangan, "aturan retensi") {
+						t.Errorf("audit %+v", a)
+					}
+				}
+				var events []int64
+				db.Model(&outbox.Event{}).Where("id <= ?", 2).Pluck("id", &events)
+				if fmt.Sprint(events) != "[2]" {
+					t.Errorf("left old events %v, want the one a consumer has not handled", events)
+				}
+				var pengiriman []string
+				db.Model(&PengirimanWebhook{}).Pluck("status", &pengiriman)
+				if fmt.Sprint(pengiriman) != "[menunggu]" {
+					t.Errorf("left deliveries %v, want the one still retried", pengiriman)
+				}
+				if strings.Join(aksi, ",") != "referensi:hapus_retensi,notifikasi:hapus_retensi,pegawai:anonimisasi,outbox:hapus_retensi,pengiriman_webhook:hapus_retensi" {
+					t.Errorf("audit log %v", aksi)
+				}
+				// what was purged is not purged again
+				hasil, err := jalankanRetensi(db, time.Now(), false, nil)
+				for _, h := range hasil {
+					if len(h.ID) > 0 {
+						t.Errorf("purged again %+v, %v", h, err)
+					}
+				}
+			}},
+		{name: "purge as hr", peran: PeranHR, method: http.MethodPost, path: "/retensi", code: http.StatusForbidden},
+		{name: "rule per status", method: http.MethodPost, path: "/aturanretensi",
+			body: map[string]interface{}{"entitas": "pegawai", "jenis": "Pensiun", "aksi": "anonimkan", "hari": 30, "aktif": true},
+			code: http.StatusCreated,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				// Pegawai 2 left just now, the rule takes it along with 3 in a month
+				hasil, err := jalankanRetensi(db, time.Now().AddDate(0, 0, 31), true, nil)
+				if err != nil || len(hasil) != 6 || fmt.Sprint(hasil[5].ID) != "[2 3]" {
+					t.Errorf("got %v, %v", hasil, err)
+				}
+			}},
+		{name: "rule exists", method: http.MethodPost, path: "/aturanretensi",
+			body: map[string]interface{}{"entitas": "referensi", "aksi": "hapus", "hari": 30}, code: http.StatusConflict},
+		{name: "wrong aksi", method: http.MethodPost, path: "/aturanretensi",
+			body: map[string]interface{}{"entitas": "referensi", "jenis": "agama", "aksi": "anonimkan", "hari": 30}, code: http.StatusUnprocessableEntity},
+		{name: "unknown entitas", method: http.MethodPost, path: "/aturanretensi",
+			body: map[string]interface{}{"entitas": "absensi", "aksi": "hapus", "hari": 30}, code: http.StatusUnprocessableEntity},
+		{name: "turn off", method: http.MethodPut, path: "/aturanretensi/1",
+			body: map[string]interface{}{"entitas": "pegawai", "aksi": "hapus", "hari": 90, "aktif": false}, code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data AturanRetensi
+				res.Data(&data)
+				if data.Entitas != "referensi" || data.Aktif {
+					t.Errorf("got %+v", data)
+				}
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, db := newTestServer(t)
+			// an inactive referensi, two read notifikasi of which one is
+			// old, and Pegawai 3 left 11 years ago while 2 left just now
+			siapkan := []*gorm.DB{
+				db.Exec("INSERT INTO referensi (jenis, kode, nama, aktif, updated_at) VALUES ('agama', 'LAMA', 'Lama', false, ?)", lama),
+				db.Exec("INSERT INTO notifikasi (pengguna_id, judul, dibaca, created_at) VALUES (1, 'lama', true, ?), (1, 'baru', false, ?)", lama, lama),
+				db.Model(&Pegawai{}).Where("id IN ?", []int64{2, 3}).UpdateColumn("status_pegawai", "Pensiun"),
+				db.Model(&Pegawai{}).Where("id = ?", 3).UpdateColumn("updated_at", lama),
+				db.Model(&AturanRetensi{}).Where("entitas = ?", "pegawai").UpdateColumn("aktif", true),
+				// old events of which a consumer has handled only the first
+				db.Model(&outbox.Event{}).Where("id <= ?", 2).UpdateColumn("created_at", lama),
+				db.Create(&outbox.Offset{Consumer: "lambat", Position: 1}),
+				// an old delivery that was sent and an old one still retried
+				db.Create(&[]PengirimanWebhook{
+					{WebhookID: 1, Event: EventPegawaiDibuat, Status: StatusPengirimanTerkirim, CreatedAt: lama},
+					{WebhookID: 1, Event: EventPegawaiDibuat, Status: StatusPengirimanMenunggu, CreatedAt: lama},
+				}),
+			}
+			for _, q := range siapkan {
+				if q.Error != nil {
+					t.Fatal(q.Error)
+				}
+			}
+			peran := tt.peran
+			if peran == "" {
+				peran = PeranAdmin
+			}
+			masuk(t, srv, db, peran, 1)
+			res := srv.Do(tt.method, tt.path, tt.body).Expect(tt.code)
+			if tt.check != nil {
+				tt.check(t, res, db)
+			}
+		})
+	}
+}
+
+// penerima is a local HTTP receiver of webhooks that answers with kode.
+type penerima struct {
+	mu    sync.Mutex
+	kode  int
+	masuk []*http.Request
+	body  [][]byte
+}
+
+func (p *penerima) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := io.ReadAll(r.Body)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.masuk = append(p.masuk, r)
+	p.body = append(p.body, b)
+	w.WriteHeader(p.kode)
+}
+
+func TestWebhook(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		events []string
+		kode   int
+		run    func(t *testing.T, srv *testutil.Server, db *gorm.DB)
+		check  func(t *testing.T, p *penerima, db *gorm.DB, rahasia string)
+	}{
+		{name: "created, signed", events: []string{EventPegawaiDibuat}, kode: http.StatusNoContent,
+			run: func(t *testing.T, srv *testutil.Server, db *gorm.DB) {
+				srv.Do(http.MethodPost, "/pegawai", map[string]string{"nama": "Dewi Lestari", "nik": "3201014703950004"}).Expect(http.StatusCreated)
+				srv.Do(http.MethodDelete, "/pegawai/3", nil).Expect(http.StatusNoContent)
+			},
+			check: func(t *testing.T, p *penerima, db *gorm.DB, rahasia string) {
+				if len(p.masuk) != 1 {
+					t.Fatalf("got %d requests, want only the created one", len(p.masuk))
+				}
+				r, body := p.masuk[0], p.body[0]
+				ts, _, _ := strings.Cut(strings.TrimPrefix(r.Header.Get("X-Webhook-Signature"), "t="), ",")
+				detik, _ := strconv.ParseInt(ts, 10, 64)
+				if want := tandaTangan(rahasia, time.Unix(detik, 0), body); r.Header.Get("X-Webhook-Signature") != want {
+					t.Errorf("signature %q, want %q", r.Header.Get("X-Webhook-Signature"), want)
+				}
+				var payload struct {
+					Event string  `json:"event"`
+					Data  Pegawai `json:"data"`
+				}
+				if err := json.Unmarshal(body, &payload); err != nil || payload.Event != EventPegawaiDibuat || payload.Data.Nik != "3201014703950004" {
+					t.Errorf("payload %s, %v", body, err)
+				}
+				var kirim PengirimanWebhook
+				db.First(&kirim)
+				if kirim.Status != StatusPengirimanTerkirim || kirim.KodeRespons != http.StatusNoContent || r.Header.Get("X-Webhook-Delivery") != fmt.Sprint(kirim.ID) {
+					t.Errorf("logged %+v", kirim)
+				}
+			}},
+		{name: "all events", kode: http.StatusOK,
+			run: func(t *testing.T, srv *testutil.Server, db *gorm.DB) {
+				srv.Do(http.MethodPut, "/pegawai", ubahPegawai("sub_unit", "Akuntansi")).Expect(http.StatusOK)
+				srv.Do(http.MethodDelete, "/pegawai/3", nil).Expect(http.StatusNoContent)
+				// a rolled back change sends nothing
+				srv.Do(http.MethodPost, "/pegawai", map[string]string{"nama": "Ganda", "nik": "3273010101900001"}).Expect(http.StatusConflict)
+			},
+			check: func(t *testing.T, p *penerima, db *gorm.DB, rahasia string) {
+				var events []string
+				for _, r := range p.masuk {
+					events = append(events, r.Header.Get("X-Webhook-Event"))
+				}
+				if strings.Join(events, ",") != "pegawai.updated,pegawai.deleted" {
+					t.Errorf("got %v", events)
+				}
+			}},
+		{name: "retries with backoff", kode: http.StatusBadGateway,
+			run: func(t *testing.T, srv *testutil.Server, db *gorm.DB) {
+				srv.Do(http.MethodDelete, "/pegawai/3", nil).Expect(http.StatusNoContent)
+			},
+			check: func(t *testing.T, p *penerima, db *gorm.DB, rahasia string) {
+				var kirim PengirimanWebhook
+				db.First(&kirim)
+				jeda := time.Until(kirim.Berikutnya)
+				if kirim.Status != StatusPengirimanMenunggu || kirim.Percobaan != 1 || jeda < 25*time.Second || jeda > jedaAwal || kirim.Galat == "" {
+					t.Fatalf("after the first attempt %+v", kirim)
+				}
+				// not due yet
+				if err := kirimWebhook(ctx, db); err != nil || len(p.masuk) != 1 {
+					t.Errorf("sent %d times, %v", len(p.masuk), err)
+				}
+				db.Model(&kirim).UpdateColumn("berikutnya", time.Now().Add(-time.Second))
+				if err := kirimWebhook(ctx, db); err != nil {
+					t.Fatal(err)
+				}
+				db.First(&kirim)
+				if jeda := time.Until(kirim.Berikutnya); kirim.Percobaan != 2 || jeda < 55*time.Second || jeda > 2*jedaAwal {
+					t.Errorf("after the second attempt %+v", kirim)
+				}
+				db.Model(&kirim).UpdateColumns(map[string]interface{}{"percobaan": maxPercobaan - 1, "berikutnya": time.Now().Add(-time.Second)})
+				if err := kirimWebhook(ctx, db); err != nil {
+					t.Fatal(err)
+				}
+				db.First(&kirim)
+				if kirim.Status != StatusPengirimanGagal || kirim.Percobaan != maxPercobaan {
+					t.Errorf("after the last attempt %+v", kirim)
+				}
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, db := newTestServer(t)
+			p := &penerima{kode: tt.kode}
+			ts := httptest.NewServer(p)
+			defer ts.Close()
+			masuk(t, srv, db, PeranAdmin, 1)
+
+			var webhook Webhook
+			srv.Do(http.MethodPost, "/webhook", map[string]interface{}{"url": ts.URL, "events": tt.events, "aktif": true}).
+				Expect(http.StatusCreated).Data(&webhook)
+			if !strings.HasPrefix(webhook.Rahasia, "whsec_") || !strings.HasPrefix(kolomWebhook(t, db, webhook.ID), "enc:") {
+				t.Fatalf("rahasia %q stored as %q", webhook.Rahasia, kolomWebhook(t, db, webhook.ID))
+			}
+			tt.run(t, srv, db)
+			if err := kirimWebhook(ctx, db); err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, p, db, webhook.Rahasia)
+		})
+	}
+
+	t.Run("manage", func(t *testing.T) {
+		srv, db := newTestServer(t)
+		p := &penerima{kode: http.StatusInternalServerError}
+		ts := httptest.NewServer(p)
+		defer ts.Close()
+		masuk(t, srv, db, PeranAdmin, 1)
+		srv.Do(http.MethodPost, "/webhook", map[string]interface{}{"url": "ftp://payroll", "aktif": true}).Expect(http.StatusUnprocessableEntity)
+		srv.Do(http.MethodPost, "/webhook", map[string]interface{}{"url": ts.URL, "events": []string{"pegawai.hired"}}).Expect(http.StatusUnprocessableEntity)
+		var webhook Webhook
+		srv.Do(http.MethodPost, "/webhook", map[string]interface{}{"url": ts.URL, "aktif": true}).Expect(http.StatusCreated).Data(&webhook)
+
+		var daftar []Webhook
+		srv.Do(http.MethodGet, "/webhook", nil).Expect(http.StatusOK).Data(&daftar)
+		if len(daftar) != 1 || daftar[0].Rahasia != "" {
+			t.Errorf("list shows %+v", daftar)
+		}
+
+		srv.Do(http.MethodDelete, "/pegawai/3", nil).Expect(http.StatusNoContent)
+		if err := kirimWebhook(ctx, db); err != nil {
+			t.Fatal(err)
+		}
+		var log []PengirimanWebhook
+		srv.Do(http.MethodGet, fmt.Sprintf("/webhook/%d/pengiriman?status=menunggu", webhook.ID), nil).Expect(http.StatusOK).Data(&log)
+		if len(log) != 1 || log[0].KodeRespons != http.StatusInternalServerError {
+			t.Fatalf("log %+v", log)
+		}
+
+		// while an attempt holds the delivery, neither the job nor a
+		// KirimUlang sends it
+		klaimLain := db.Model(&PengirimanWebhook{}).Where("id = ?", log[0].ID).
+			UpdateColumns(map[string]interface{}{"berikutnya": time.Now().Add(-time.Second), "diklaim_sampai": time.Now().Add(masaKlaim)})
+		if klaimLain.Error != nil {
+			t.Fatal(klaimLain.Error)
+		}
+		srv.Do(http.MethodPost, fmt.Sprintf("/webhook/%d/pengiriman/%d/ulang", webhook.ID, log[0].ID), nil).Expect(http.StatusConflict)
+		if err := kirimWebhook(ctx, db); err != nil || len(p.masuk) != 1 {
+			t.Errorf("sent a claimed delivery, %d requests, %v", len(p.masuk), err)
+		}
+		db.Model(&PengirimanWebhook{}).Where("id = ?", log[0].ID).UpdateColumn("diklaim_sampai", time.Now().Add(-time.Second))
+
+		// the receiver is fixed, the delivery is sent again by hand and the
+		// attempt counts along with the first one
+		p.kode = http.StatusOK
+		var ulang PengirimanWebhook
+		srv.Do(http.MethodPost, fmt.Sprintf("/webhook/%d/pengiriman/%d/ulang", webhook.ID, log[0].ID), nil).Expect(http.StatusOK).Data(&ulang)
+		if ulang.Status != StatusPengirimanTerkirim || ulang.Percobaan != 2 || len(p.masuk) != 2 || p.masuk[1].Header.Get("X-Webhook-Delivery") != fmt.Sprint(log[0].ID) {
+			t.Errorf("redelivered %+v", ulang)
+		}
+		var tersimpan PengirimanWebhook
+		if db.First(&tersimpan, log[0].ID); tersimpan.Percobaan != 2 || tersimpan.DiklaimSampai != nil || tersimpan.PegawaiID != 3 {
+			t.Errorf("logged %+v", tersimpan)
+		}
+		srv.Do(http.MethodPost, fmt.Sprintf("/webhook/%d/pengiriman/%d/ulang", webhook.ID+1, log[0].ID), nil).Expect(http.StatusNotFound)
+
+		// inactive webhooks get no new events
+		srv.Do(http.MethodPut, fmt.Sprintf("/webhook/%d", webhook.ID), map[string]interface{}{"url": ts.URL}).Expect(http.StatusOK)
+		srv.Do(http.MethodDelete, "/pegawai/2", nil).Expect(http.StatusNoContent)
+		if err := kirimWebhook(ctx, db); err != nil {
+			t.Fatal(err)
+		}
+		var n int64
+		db.Model(&PengirimanWebhook{}).Count(&n)
+		if n != 1 {
+			t.Errorf("%d deliveries, want 1", n)
+		}
+
+		// and their queued retries are given up instead of sent
+		menunggu := &PengirimanWebhook{WebhookID: webhook.ID, Event: EventPegawaiDihapus, PegawaiID: 2, Payload: `{}`,
+			Status: StatusPengirimanMenunggu, Percobaan: 1, Berikutnya: time.Now().Add(-time.Second)}
+		if err := db.Create(menunggu).Error; err != nil {
+			t.Fatal(err)
+		}
+		srv.Do(http.MethodPost, fmt.Sprintf("/webhook/%d/pengiriman/%d/ulang", webhook.ID, menunggu.ID), nil).Expect(http.StatusConflict)
+		if err := kirimWebhook(ctx, db); err != nil || len(p.masuk) != 2 {
+			t.Errorf("sent to an inactive webhook, %d requests, %v", len(p.masuk), err)
+		}
+		if db.First(menunggu); menunggu.Status != StatusPengirimanGagal || menunggu.Percobaan != 1 || menunggu.Galat != "webhook is inactive" || menunggu.DiklaimSampai != nil {
+			t.Errorf("left %+v", menunggu)
+		}
+		srv.Do(http.MethodDelete, fmt.Sprintf("/webhook/%d", webhook.ID), nil).Expect(http.StatusNoContent)
+		if db.Model(&PengirimanWebhook{}).Count(&n); n != 0 {
+			t.Errorf("%d deliveries left", n)
+		}
+	})
+}
+
+func kolomWebhook(t *testing.T, db *gorm.DB, id int64) string {
+	t.Helper()
+	var rahasia string
+	if err := db.Table("webhook").Where("id = ?", id).Select("rahasia").Row().Scan(&rahasia); err != nil {
+		t.Fatal(err)
+	}
+	return rahasia
+}
+
+func TestEvents(t *testing.T) {
+	srv, db := newTestServer(t)
+	masuk(t, srv, db, PeranHR, 1)
+	type jawaban struct {
+		Data []outbox.Event `json:"data"`
+		Next int64          `json:"next"`
+	}
+	ambil := func(query string) jawaban {
+		t.Helper()
+		var j jawaban
+		srv.Do(http.MethodGet, "/events"+query, nil).Expect(http.StatusOK).Decode(&j)
+		return j
+	}
+	ringkas := func(events []outbox.Event) string {
+		var s []string
+		for _, e := range events {
+			s = append(s, fmt.Sprintf("%s %d", e.Event, e.ResourceID))
+		}
+		return strings.Join(s, ", ")
+	}
+
+	awal := ambil("")
+	if got := ringkas(awal.Data); got != "pegawai.created 1, pegawai.created 2, pegawai.created 3" || awal.Next != awal.Data[2].ID {
+		t.Fatalf("fixtures gave %s, next %d", got, awal.Next)
+	}
+
+	srv.Do(http.MethodPut, "/pegawai", ubahPegawai("sub_unit", "Akuntansi")).Expect(http.StatusOK)
+	srv.Do(http.MethodDelete, "/pegawai/3", nil).Expect(http.StatusNoContent)
+	srv.Do(http.MethodPost, "/referensi/agama", map[string]interface{}{"nama": "Konghucu"}).Expect(http.StatusCreated)
+	// a rolled back change is no event
+	srv.Do(http.MethodPost, "/pegawai", map[string]string{"nama": "Ganda", "nik": "3273010101900001"}).Expect(http.StatusConflict)
+
+	baru := ambil(fmt.Sprintf("?after=%d", awal.Next))
+	if got := ringkas(baru.Data); !strings.HasPrefix(got, "pegawai.updated 1, pegawai.deleted 3, referensi.created ") || len(baru.Data) != 3 {
+		t.Fatalf("after the changes got %s", got)
+	}
+	var diubah, dihapus Pegawai
+	json.Unmarshal(baru.Data[0].Data, &diubah)
+	json.Unmarshal(baru.Data[1].Data, &dihapus)
+	if diubah.SubUnit != "Akuntansi" || dihapus.Nama != "Yohanes Wibowo" {
+		t.Errorf("data %s and %s", baru.Data[0].Data, baru.Data[1].Data)
+	}
+	var mentah string
+	db.Raw("SELECT data FROM outbox WHERE id = ?", baru.Data[0].ID).Scan(&mentah)
+	if !strings.HasPrefix(mentah, "enc:") {
+		t.Errorf("data stored as %q", mentah)
+	}
+
+	if got := ringkas(ambil(fmt.Sprintf("?after=%d&resource=referensi", awal.Next)).Data); !strings.HasPrefix(got, "referensi.created ") {
+		t.Errorf("resource=referensi got %s", got)
+	}
+	if j := ambil("?limit=1"); len(j.Data) != 1 || j.Next != awal.Data[0].ID {
+		t.Errorf("limit=1 got %s, next %d", ringkas(j.Data), j.Next)
+	}
+	if j := ambil(fmt.Sprintf("?after=%d", baru.Next)); len(j.Data) != 0 || j.Next != baru.Next {
+		t.Errorf("nothing new got %s, next %d", ringkas(j.Data), j.Next)
+	}
+	srv.Do(http.MethodGet, "/events?after=kemarin", nil).Expect(http.StatusUnprocessableEntity)
+	srv.Do(http.MethodGet, "/events?limit=0", nil).Expect(http.StatusUnprocessableEntity)
+
+	masuk(t, srv, db, PeranPegawai, 2)
+	srv.Do(http.MethodGet, "/events", nil).Expect(http.StatusForbidden)
+}
+
+// pesanSSE is one server-sent event as the stream wrote it.
+type pesanSSE struct {
+	id, event string
+	data      PesanStream
+}
+
+// bukaStream opens GET /events/stream on ts and sends its events to the
+// returned channel until the test ends.
+func bukaStream(t *testing.T, ts *httptest.Server, query, lastEventID string) <-chan pesanSSE {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/api/v1/events/stream"+query, nil)
+	req.Header.Set("Authorization", "Bearer token-"+PeranHR)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || res.Header.Get(echo.HeaderContentType) != "text/event-stream" {
+		t.Fatalf("status %d, content type %q", res.StatusCode, res.Header.Get(echo.HeaderContentType))
+	}
+	pesan := make(chan pesanSSE, 100)
+	go func() {
+		defer res.Body.Close()
+		defer close(pesan)
+		var p pesanSSE
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			kunci, nilai, _ := strings.Cut(scanner.Text(), ": ")
+			switch kunci {
+			case "id":
+				p.id = nilai
+			case "event":
+				p.event = nilai
+			case "data":
+				json.Unmarshal([]byte(nilai), &p.data)
+			case "":
+				if p.id != "" {
+					pesan <- p
+				}
+				p = pesanSSE{}
+			}
+		}
+	}()
+	return pesan
+}
+
+// tunggu reads n messages of pesan as "event resource_id unit", it gives up
+// after two seconds.
+func tunggu(t *testing.T, pesan <-chan pesanSSE, n int) []string {
+	t.Helper()
+	var got []string
+	for len(got) < n {
+		select {
+		case p, ok := <-pesan:
+			if !ok {
+				t.Fatalf("stream ended after %v", got)
+			}
+			got = append(got, fmt.Sprintf("%s %d %s", p.event, p.data.ResourceID, p.data.Unit))
+		case <-time.After(2 * time.Second):
+			t.Fatalf("got %v, want %d", got, n)
+		}
+	}
+	return got
+}
+
+func TestStream(t *testing.T) {
+	db := testutil.OpenDB(t, migrate)
+	testutil.LoadFixtures(t, db, "pegawai.json", &[]Pegawai{})
+	e, err := newServer(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := testutil.NewServer(t, e)
+	// on the http.Server of e, which closes the streams when it shuts down
+	ts := httptest.NewUnstartedServer(e)
+	e.Server.Handler = e
+	ts.Config = e.Server
+	ts.Start()
+	t.Cleanup(ts.Close)
+	masuk(t, srv, db, PeranHR, 1)
+
+	keuangan := bukaStream(t, ts, "?unit=keuangan&resource=pegawai", "")
+	semua := bukaStream(t, ts, "", "")
+
+	srv.Do(http.MethodPut, "/pegawai", ubahPegawai("sub_unit", "Akuntansi")).Expect(http.StatusOK)
+	srv.Do(http.MethodPost, "/referensi/agama", map[string]interface{}{"nama": "Konghucu"}).Expect(http.StatusCreated)
+	srv.Do(http.MethodDelete, "/pegawai/2", nil).Expect(http.StatusNoContent)
+	srv.Do(http.MethodDelete, "/pegawai/3", nil).Expect(http.StatusNoContent)
+
+	if got := strings.Join(tunggu(t, keuangan, 2), ", "); got != "pegawai.updated 1 Keuangan, pegawai.deleted 3 Keuangan" {
+		t.Errorf("unit=keuangan got %s", got)
+	}
+	got := tunggu(t, semua, 4)
+	if !strings.HasPrefix(got[1], "referensi.created ") || got[2] != "pegawai.deleted 2 Kepegawaian" {
+		t.Errorf("unfiltered got %v", got)
+	}
+
+	// resuming after the update sends what came after it, then goes on live
+	var diubah outbox.Event
+	db.Where("event = ?", EventPegawaiDiubah).First(&diubah)
+	lanjut := bukaStream(t, ts, "", fmt.Sprint(diubah.ID))
+	if got := tunggu(t, lanjut, 3); !strings.HasPrefix(got[0], "referensi.created ") || got[2] != "pegawai.deleted 3 Keuangan" {
+		t.Errorf("resumed got %v", got)
+	}
+	srv.Do(http.MethodPost, "/pegawai", map[string]string{"nama": "Dewi Lestari", "nik": "3201014703950004"}).Expect(http.StatusCreated)
+	if got := tunggu(t, lanjut, 1); got[0] != "pegawai.created 4 " {
+		t.Errorf("live after resuming got %v", got)
+	}
+
+	srv.Do(http.MethodGet, "/events/stream?resource=cuti", nil).Expect(http.StatusUnprocessableEntity)
+	srv.Header.Set("Last-Event-ID", "kemarin")
+	srv.Do(http.MethodGet, "/events/stream", nil).Expect(http.StatusUnprocessableEntity)
+	srv.Header.Del("Last-Event-ID")
+	srv.Header.Del("Authorization")
+	srv.Do(http.MethodGet, "/events/stream", nil).Expect(http.StatusUnauthorized)
+
+	// shutting down ends the open streams
+	if err := ts.Config.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for selesai := time.After(2 * time.Second); ; {
+		select {
+		case _, ok := <-semua:
+			if ok {
+				// the Pegawai created above
+				continue
+			}
+		case <-selesai:
+			t.Error("stream still open after shutdown")
+		}
+		break
+	}
+}
+
+func TestCuti(t *testing.T) {
+	tanggal := func(s string) time.Time {
+		d, _ := time.ParseInLocation(layoutTanggal, s, time.Local)
+		return d
+	}
+	status := func(t *testing.T, db *gorm.DB, id int64) PengajuanCuti {
+		t.Helper()
+		var p PengajuanCuti
+		if err := db.First(&p, id).Error; err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	tests := []struct {
+		name      string
+		peran     string
+		pegawaiID int64
+		method    string
+		path      string
+		body      interface{}
+		siapkan   func(t *testing.T, db *gorm.DB)
+		code      int
+		check     func(t *testing.T, res *testutil.Response, db *gorm.DB)
+	}{
+		{name: "saldo carries over across years", method: http.MethodGet, path: "/pegawai/1/saldocuti?tahun=2026", code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data []SaldoCuti
+				res.Data(&data)
+				// 2024 leaves 10, of which 5 go to 2025; 2025 leaves 12+5-10 = 7
+				want := SaldoCuti{JenisCutiID: 1, JenisCuti: "Cuti Tahunan", Tahun: 2026, Jatah: 12, CarryOver: 7, Menunggu: 2, Sisa: 19, Tersedia: 17}
+				if len(data) != 1 || data[0] != want {
+					t.Errorf("got %+v, want %+v", data, want)
+				}
+			}},
+		{name: "saldo of a year without jatah", method: http.MethodGet, path: "/pegawai/1/saldocuti?tahun=2023", code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data []SaldoCuti
+				res.Data(&data)
+				if len(data) != 1 || data[0].Sisa != 0 || data[0].CarryOver != 0 {
+					t.Errorf("got %+v", data)
+				}
+			}},
+		{name: "request", peran: PeranPegawai, pegawaiID: 1, method: http.MethodPost, path: "/cuti", code: http.StatusCreated,
+			body: map[string]interface{}{"jenis_cuti_id": 1, "tanggal_mulai": "2026-11-02", "tanggal_selesai": "2026-11-08"},
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data PengajuanCuti
+				res.Data(&data)
+				if data.PegawaiID != 1 || data.JumlahHari != 5 || data.Status != StatusCutiDiajukan {
+					t.Errorf("got %+v, want 5 working days waiting", data)
+				}
+			}},
+		{name: "pegawai_id in the body is ignored", peran: PeranPegawai, pegawaiID: 3, method: http.MethodPost, path: "/cuti", code: http.StatusCreated,
+			body: map[string]interface{}{"pegawai_id": 1, "jenis_cuti_id": 1, "tanggal_mulai": "2026-11-02", "tanggal_selesai": "2026-11-08"},
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data PengajuanCuti
+				res.Data(&data)
+				if data.PegawaiID != 3 {
+					t.Errorf("filed for Pegawai %d, want the caller", data.PegawaiID)
+				}
+			}},
+		{name: "request without login", method: http.MethodPost, path: "/cuti", code: http.StatusUnauthorized,
+			body: map[string]interface{}{"pegawai_id": 1, "jenis_cuti_id": 1, "tanggal_mulai": "2026-11-02", "tanggal_selesai": "2026-11-08"}},
+		{name: "request beyond saldo", peran: PeranPegawai, pegawaiID: 1, method: http.MethodPost, path: "/cuti", code: http.StatusUnprocessableEntity,
+			body: map[string]interface{}{"jenis_cuti_id": 1, "tanggal_mulai": "2026-11-02", "tanggal_selesai": "2026-11-30"}},
+		{name: "request overlapping", peran: PeranPegawai, pegawaiID: 1, method: http.MethodPost, path: "/cuti", code: http.StatusConflict,
+			body: map[string]interface{}{"jenis_cuti_id": 1, "tanggal_mulai": "2026-07-07", "tanggal_selesai": "2026-07-07"}},
+
+		{name: "cancel your own", peran: PeranPegawai, pegawaiID: 1, method: http.MethodPut, path: "/cuti/2/batal", code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				if p := status(t, db, 2); p.Status != StatusCutiDibatalkan {
+					t.Errorf("got %+v", p)
+				}
+			}},
+		{name: "cancel as hr", peran: PeranHR, pegawaiID: 2, method: http.MethodPut, path: "/cuti/2/batal", code: http.StatusOK},
+		{name: "cancel of another", peran: PeranPegawai, pegawaiID: 3, method: http.MethodPut, path: "/cuti/2/batal", code: http.StatusForbidden},
+		{name: "cancel without login", method: http.MethodPut, path: "/cuti/2/batal", code: http.StatusUnauthorized},
+		{name: "cancel started leave", peran: PeranPegawai, pegawaiID: 1, method: http.MethodPut, path: "/cuti/1/batal", code: http.StatusConflict},
+		{name: "cancel racing a rejection", peran: PeranPegawai, pegawaiID: 1, method: http.MethodPut, path: "/cuti/2/batal", code: http.StatusConflict,
+			siapkan: func(t *testing.T, db *gorm.DB) {
+				// the kepala unit rejects the request right after it was read
+				ditolak := false
+				err := db.Callback().Query().After("gorm:query").Register("tolak", func(tx *gorm.DB) {
+					if tx.Statement.Table == "pengajuan_cuti" && !ditolak {
+						ditolak = true
+						db.Exec("UPDATE pengajuan_cuti SET status = ? WHERE id = 2", StatusCutiDitolak)
+					}
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				if p := status(t, db, 2); p.Status != StatusCutiDitolak {
+					t.Errorf("got %+v", p)
+				}
+			}},
+
+		{name: "approve as kepala unit", peran: PeranPegawai, pegawaiID: 3, method: http.MethodPut, path: "/cuti/2/setujui",
+			body: map[string]string{"catatan": "silakan"}, code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				if p := status(t, db, 2); p.Status != StatusCutiDisetujui || p.DiprosesOleh == nil || *p.DiprosesOleh != 3 || p.CatatanPersetujuan != "silakan" {
+					t.Errorf("got %+v", p)
+				}
+			}},
+		{name: "reject as kepala unit", peran: PeranPegawai, pegawaiID: 3, method: http.MethodPut, path: "/cuti/2/tolak", code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				if p := status(t, db, 2); p.Status != StatusCutiDitolak {
+					t.Errorf("got %+v", p)
+				}
+			}},
+		{name: "approver_id in the body is ignored", peran: PeranPegawai, pegawaiID: 2, method: http.MethodPut, path: "/cuti/2/setujui",
+			body: map[string]interface{}{"approver_id": 3}, code: http.StatusForbidden,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				if p := status(t, db, 2); p.Status != StatusCutiDiajukan {
+					t.Errorf("got %+v", p)
+				}
+			}},
+		{name: "approve own request", peran: PeranPegawai, pegawaiID: 3, method: http.MethodPut, path: "/cuti/3/setujui", code: http.StatusForbidden},
+		{name: "approve without login", method: http.MethodPut, path: "/cuti/2/setujui", body: map[string]interface{}{"approver_id": 3}, code: http.StatusUnauthorized},
+		{name: "approve twice", peran: PeranPegawai, pegawaiID: 3, method: http.MethodPut, path: "/cuti/1/setujui", code: http.StatusConflict},
+
+		{name: "set kepala unit as hr", peran: PeranHR, pegawaiID: 2, method: http.MethodPut, path: "/api/v1/kepalaunit/Keuangan",
+			body: map[string]interface{}{"pegawai_id": 1}, code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var k KepalaUnit
+				if db.Where("unit = ?", "Keuangan").First(&k); k.PegawaiID != 1 {
+					t.Errorf("got %+v", k)
+				}
+			}},
+		{name: "make yourself kepala unit", peran: PeranPegawai, pegawaiID: 1, method: http.MethodPut, path: "/api/v1/kepalaunit/Keuangan",
+			body: map[string]interface{}{"pegawai_id": 1}, code: http.StatusForbidden},
+		{name: "make yourself kepala unit on the root route", peran: PeranPegawai, pegawaiID: 1, method: http.MethodPut, path: "/kepalaunit",
+			body: map[string]interface{}{"unit": "Keuangan", "pegawai_id": 1}, code: http.StatusForbidden},
+		{name: "grant jatah cuti as pegawai", peran: PeranPegawai, pegawaiID: 1, method: http.MethodPost, path: "/jatahcuti",
+			body: map[string]interface{}{"jenis_pegawai": "PNS", "jenis_cuti_id": 1, "tahun": 2027, "jumlah_hari": 365}, code: http.StatusForbidden},
+		{name: "grant jatah cuti without login", method: http.MethodPut, path: "/jatahcuti/3",
+			body: map[string]interface{}{"jumlah_hari": 365}, code: http.StatusUnauthorized},
+		{name: "create jenis cuti without login", method: http.MethodPost, path: "/jeniscuti",
+			body: map[string]interface{}{"kode": "BEBAS", "nama": "Cuti Bebas"}, code: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, db := newTestServer(t)
+			// Pegawai 1 took 10 days in 2025, waits for 2 in 2026 and so does
+			// Pegawai 3, the kepala of their unit
+			for _, v := range []interface{}{
+				&JenisCuti{ID: 1, Kode: "CT", Nama: "Cuti Tahunan", PotongSaldo: true},
+				&[]JatahCuti{
+					{JenisPegawai: "PNS", JenisCutiID: 1, Tahun: 2024, JumlahHari: 10},
+					{JenisPegawai: "PNS", JenisCutiID: 1, Tahun: 2025, JumlahHari: 12, MaksCarryOver: 5},
+					{JenisPegawai: "PNS", JenisCutiID: 1, Tahun: 2026, JumlahHari: 12, MaksCarryOver: 10},
+				},
+				&KepalaUnit{Unit: "Keuangan", PegawaiID: 3},
+				&[]PengajuanCuti{
+					{PegawaiID: 1, JenisCutiID: 1, TanggalMulai: tanggal("2025-03-03"), TanggalSelesai: tanggal("2025-03-14"), JumlahHari: 10, Status: StatusCutiDisetujui},
+					{PegawaiID: 1, JenisCutiID: 1, TanggalMulai: tanggal("2026-07-06"), TanggalSelesai: tanggal("2026-07-07"), JumlahHari: 2, Status: StatusCutiDiajukan},
+					{PegawaiID: 3, JenisCutiID: 1, TanggalMulai: tanggal("2026-07-06"), TanggalSelesai: tanggal("2026-07-07"), JumlahHari: 2, Status: StatusCutiDiajukan},
+				},
+			} {
+				if err := db.Create(v).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.peran != "" {
+				masuk(t, srv, db, tt.peran, tt.pegawaiID)
+			}
+			if tt.siapkan != nil {
+				tt.siapkan(t, db)
+			}
+			res := srv.Do(tt.method, tt.path, tt.body).Expect(tt.code)
+			if tt.check != nil {
+				tt.check(t, res, db)
+			}
+		})
+	}
+}
+
+func TestAbsensi(t *testing.T) {
+	pada := func(tanggal, j string) *time.Time {
+		d, _ := time.ParseInLocation(layoutTanggal+" "+layoutJam, tanggal+" "+j, time.Local)
+		return &d
+	}
+	hari := func(tanggal string) time.Time {
+		d, _ := time.ParseInLocation(layoutTanggal, tanggal, time.Local)
+		return d
+	}
+	hariIni := func(t *testing.T, db *gorm.DB, pegawaiID int64) Absensi {
+		t.Helper()
+		now := time.Now()
+		var a Absensi
+		db.Where("pegawai_id = ? AND tanggal = ?", pegawaiID, time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)).Find(&a)
+		return a
+	}
+	checkIn := func(t *testing.T, srv *testutil.Server, db *gorm.DB) {
+		srv.Do(http.MethodPost, "/absensi/masuk", nil).Expect(http.StatusCreated)
+	}
+	tests := []struct {
+		name    string
+		peran   string
+		method  string
+		path    string
+		body    interface{}
+		siapkan func(t *testing.T, srv *testutil.Server, db *gorm.DB)
+		code    int
+		check   func(t *testing.T, res *testutil.Response, db *gorm.DB)
+	}{
+		{name: "check in", peran: PeranPegawai, method: http.MethodPost, path: "/absensi/masuk", body: map[string]interface{}{"pegawai_id": 2}, code: http.StatusCreated,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				if a := hariIni(t, db, 1); a.JamMasuk == nil || a.JamPulang != nil {
+					t.Errorf("got %+v for the caller", a)
+				}
+				if a := hariIni(t, db, 2); a.ID != 0 {
+					t.Errorf("checked in pegawai_id of the body: %+v", a)
+				}
+			}},
+		{name: "check in twice", peran: PeranPegawai, method: http.MethodPost, path: "/absensi/masuk", siapkan: checkIn, code: http.StatusConflict},
+		{name: "check in without login", method: http.MethodPost, path: "/absensi/masuk", body: map[string]interface{}{"pegawai_id": 1}, code: http.StatusUnauthorized},
+		{name: "check out", peran: PeranPegawai, method: http.MethodPost, path: "/absensi/pulang", siapkan: checkIn, code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				if a := hariIni(t, db, 1); a.JamMasuk == nil || a.JamPulang == nil {
+					t.Errorf("got %+v", a)
+				}
+			}},
+		{name: "check out without check in", peran: PeranPegawai, method: http.MethodPost, path: "/absensi/pulang", code: http.StatusConflict},
+		{name: "check out without login", method: http.MethodPost, path: "/absensi/pulang", body: map[string]interface{}{"pegawai_id": 1}, code: http.StatusUnauthorized},
+
+		{name: "correct as hr keeps keterangan", peran: PeranHR, method: http.MethodPut, path: "/absensi/3", body: map[string]string{"jam_pulang": "16:30"}, code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var a Absensi
+				db.First(&a, 3)
+				if a.Keterangan != "izin pulang" || a.JamPulang.Format(layoutJam) != "16:30" || a.JamMasuk.Format(layoutJam) != "07:50" {
+					t.Errorf("got %+v", a)
+				}
+			}},
+		{name: "correct keterangan", peran: PeranHR, method: http.MethodPut, path: "/absensi/3", body: map[string]string{"keterangan": ""}, code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var a Absensi
+				if db.First(&a, 3); a.Keterangan != "" {
+					t.Errorf("got %+v", a)
+				}
+			}},
+		{name: "correct as pegawai", peran: PeranPegawai, method: http.MethodPut, path: "/absensi/3", body: map[string]string{"jam_pulang": "16:30"}, code: http.StatusForbidden},
+		{name: "correct without login", method: http.MethodPut, path: "/absensi/3", body: map[string]string{"jam_pulang": "16:30"}, code: http.StatusUnauthorized},
+
+		{name: "rekap of your own", peran: PeranPegawai, method: http.MethodGet, path: "/absensi/rekap?pegawai_id=1&bulan=2026-09", code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data RekapAbsensi
+				res.Data(&data)
+				// 22 weekdays, one of them a holiday
+				if data.HariKerja != 21 || data.Libur != 9 || data.Hadir != 3 || data.Terlambat != 1 || data.PulangCepat != 1 || data.Cuti != 1 || data.Alpa != 17 {
+					t.Errorf("got %+v", data)
+				}
+				status := map[string]string{}
+				for _, h := range data.Harian {
+					status[h.Tanggal] = strings.Join(h.Status, ",") + " " + h.Keterangan
+				}
+				for tanggal, want := range map[string]string{
+					"2026-09-01": "hadir ", "2026-09-02": "terlambat ", "2026-09-03": "pulang_cepat izin pulang",
+					"2026-09-04": "cuti ", "2026-09-05": "libur ", "2026-09-07": "libur Libur daerah", "2026-09-08": "alpa ",
+				} {
+					if status[tanggal] != want {
+						t.Errorf("%s is %q, want %q", tanggal, status[tanggal], want)
+					}
+				}
+			}},
+		{name: "rekap of a unit", peran: PeranHR, method: http.MethodGet, path: "/absensi/rekap?unit=Keuangan&bulan=2026-09", code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data []RekapAbsensi
+				res.Data(&data)
+				if len(data) != 2 || data[0].Nama != "Budi Santoso" || data[0].Hadir != 3 || data[1].Alpa != 21 || data[0].Harian != nil {
+					t.Errorf("got %+v", data)
+				}
+			}},
+		{name: "rekap without pegawai or unit", peran: PeranHR, method: http.MethodGet, path: "/absensi/rekap?bulan=2026-09", code: http.StatusUnprocessableEntity},
+		{name: "rekap of another as pegawai", peran: PeranPegawai, method: http.MethodGet, path: "/absensi/rekap?pegawai_id=2&bulan=2026-09", code: http.StatusForbidden},
+		{name: "rekap of a unit as pegawai", peran: PeranPegawai, method: http.MethodGet, path: "/absensi/rekap?unit=Keuangan&bulan=2026-09", code: http.StatusForbidden},
+		{name: "rekap without login", method: http.MethodGet, path: "/absensi/rekap?pegawai_id=1&bulan=2026-09", code: http.StatusUnauthorized},
+		// pegawai_id=1=0 OR nama LIKE 'B%' must not reach the SQL
+		{name: "rekap treats pegawai_id as a number", peran: PeranHR, method: http.MethodGet,
+			path: "/absensi/rekap?pegawai_id=1%3D0%20OR%20nama%20LIKE%20%27B%25%27&bulan=2026-09", code: http.StatusUnprocessableEntity},
+		{name: "rekap of a missing pegawai", peran: PeranHR, method: http.MethodGet, path: "/absensi/rekap?pegawai_id=99&bulan=2026-09", code: http.StatusNotFound},
+
+		{name: "create hari libur as hr", peran: PeranHR, method: http.MethodPost, path: "/harilibur",
+			body: map[string]string{"tanggal": "2026-09-08", "keterangan": "Cuti bersama"}, code: http.StatusCreated},
+		{name: "create hari libur as pegawai", peran: PeranPegawai, method: http.MethodPost, path: "/harilibur",
+			body: map[string]string{"tanggal": "2026-09-08", "keterangan": "Cuti bersama"}, code: http.StatusForbidden},
+		{name: "create hari libur without login", method: http.MethodPost, path: "/harilibur",
+			body: map[string]string{"tanggal": "2026-09-08", "keterangan": "Cuti bersama"}, code: http.StatusUnauthorized},
+		{name: "delete hari libur as hr", peran: PeranHR, method: http.MethodDelete, path: "/harilibur/1", code: http.StatusNoContent,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				if len(res.Body) != 0 {
+					t.Errorf("204 with body %q", res.Body)
+				}
+			}},
+		{name: "delete hari libur as pegawai", peran: PeranPegawai, method: http.MethodDelete, path: "/harilibur/1", code: http.StatusForbidden},
+		{name: "delete hari libur without login", method: http.MethodDelete, path: "/harilibur/1", code: http.StatusUnauthorized},
+		{name: "create jadwal kerja as pegawai", peran: PeranPegawai, method: http.MethodPost, path: "/jadwalkerja",
+			body: map[string]interface{}{"unit": "Keuangan", "jam_masuk": "10:00", "jam_pulang": "12:00", "hari_kerja": "1"}, code: http.StatusForbidden},
+		{name: "create jadwal kerja without login", method: http.MethodPost, path: "/jadwalkerja",
+			body: map[string]interface{}{"unit": "Keuangan", "jam_masuk": "10:00", "jam_pulang": "12:00", "hari_kerja": "1"}, code: http.StatusUnauthorized},
+		{name: "update jadwal kerja as pegawai", peran: PeranPegawai, method: http.MethodPut, path: "/jadwalkerja/1",
+			body: map[string]interface{}{"unit": "Keuangan", "jam_masuk": "10:00", "jam_pulang": "12:00", "hari_kerja": "1"}, code: http.StatusForbidden},
+		{name: "update jadwal kerja without login", method: http.MethodPut, path: "/jadwalkerja/1",
+			body: map[string]interface{}{"unit": "Keuangan", "jam_masuk": "10:00", "jam_pulang": "12:00", "hari_kerja": "1"}, code: http.StatusUnauthorized},
+		{name: "delete jadwal kerja as pegawai", peran: PeranPegawai, method: http.MethodDelete, path: "/jadwalkerja/1", code: http.StatusForbidden},
+		{name: "delete jadwal kerja without login", method: http.MethodDelete, path: "/jadwalkerja/1", code: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, db := newTestServer(t)
+			// September 2026 of Pegawai 1: on time, late, early home, on
+			// leave, and a holiday on Monday the 7th
+			for _, v := range []interface{}{
+				&[]Absensi{
+					{PegawaiID: 1, Tanggal: hari("2026-09-01"), JamMasuk: pada("2026-09-01", "07:55"), JamPulang: pada("2026-09-01", "16:05")},
+					{PegawaiID: 1, Tanggal: hari("2026-09-02"), JamMasuk: pada("2026-09-02", "08:20"), JamPulang: pada("2026-09-02", "16:00")},
+					{PegawaiID: 1, Tanggal: hari("2026-09-03"), JamMasuk: pada("2026-09-03", "07:50"), JamPulang: pada("2026-09-03", "15:00"), Keterangan: "izin pulang"},
+				},
+				&PengajuanCuti{PegawaiID: 1, JenisCutiID: 1, TanggalMulai: hari("2026-09-04"), TanggalSelesai: hari("2026-09-04"), JumlahHari: 1, Status: StatusCutiDisetujui},
+				&HariLibur{Tanggal: hari("2026-09-07"), Keterangan: "Libur daerah"},
+			} {
+				if err := db.Create(v).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.peran != "" {
+				masuk(t, srv, db, tt.peran, 1)
+			}
+			if tt.siapkan != nil {
+				tt.siapkan(t, srv, db)
+			}
+			res := srv.Do(tt.method, tt.path, tt.body).Expect(tt.code)
+			if tt.check != nil {
+				tt.check(t, res, db)
+			}
+		})
+	}
+}
+
+func TestPerubahan(t *testing.T) {
+	unit := func(t *testing.T, db *gorm.DB) string {
+		return muatPegawai(t, db, 1).Unit
+	}
+	tests := []struct {
+		name    string
+		peran   string
+		path    string
+		siapkan func(t *testing.T, db *gorm.DB)
+		code    int
+		check   func(t *testing.T, db *gorm.DB)
+	}{
+		{name: "maker cannot approve their own", peran: PeranAdmin, path: "/perubahan/1/setujui", code: http.StatusForbidden,
+			check: func(t *testing.T, db *gorm.DB) {
+				if u := unit(t, db); u != "Keuangan" {
+					t.Errorf("unit changed to %q", u)
+				}
+			}},
+		{name: "maker cannot reject their own", peran: PeranAdmin, path: "/perubahan/1/tolak", code: http.StatusForbidden},
+		{name: "approved by a penyetuju", peran: PeranPenyetuju, path: "/perubahan/1/setujui", code: http.StatusOK,
+			check: func(t *testing.T, db *gorm.DB) {
+				var p PerubahanData
+				db.First(&p, 1)
+				if u := unit(t, db); u != "Umum" || p.Status != StatusPerubahanDisetujui || *p.DiajukanOleh == *p.DiprosesOleh {
+					t.Errorf("unit %q, perubahan %+v", u, p)
+				}
+			}},
+		{name: "hr lacks the peran of the field", peran: PeranHR, path: "/perubahan/1/setujui", code: http.StatusForbidden},
+		{name: "pegawai cannot decide", peran: PeranPegawai, path: "/perubahan/1/setujui", code: http.StatusForbidden},
+		{name: "without login", path: "/perubahan/1/setujui", code: http.StatusUnauthorized},
+		{name: "change without maker is not approved", peran: PeranPenyetuju, path: "/perubahan/2/setujui", code: http.StatusConflict,
+			check: func(t *testing.T, db *gorm.DB) {
+				if s := muatPegawai(t, db, 1).StatusPegawai; s != "Aktif" {
+					t.Errorf("status_pegawai changed to %q", s)
+				}
+			}},
+		{name: "change without maker is not rejected", peran: PeranAdmin, path: "/perubahan/2/tolak", code: http.StatusConflict},
+		{name: "change without maker is cancelled", peran: PeranAdmin, path: "/perubahan/2/batal", code: http.StatusOK},
+		{name: "cancel racing an approval", peran: PeranAdmin, path: "/perubahan/1/batal", code: http.StatusConflict,
+			siapkan: func(t *testing.T, db *gorm.DB) {
+				// a penyetuju approves the change right after it was read
+				disetujui := false
+				err := db.Callback().Query().After("gorm:query").Register("setujui", func(tx *gorm.DB) {
+					if tx.Statement.Table == "perubahan_data" && !disetujui {
+						disetujui = true
+						db.Exec("UPDATE perubahan_data SET status = ? WHERE id = 1", StatusPerubahanDisetujui)
+					}
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			check: func(t *testing.T, db *gorm.DB) {
+				var p PerubahanData
+				if db.First(&p, 1); p.Status != StatusPerubahanDisetujui {
+					t.Errorf("got %+v", p)
+				}
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, db := newTestServer(t)
+			// an admin moves Pegawai 1 to another unit, and a change without
+			// a maker is left from before updates needed a login
+			masuk(t, srv, db, PeranAdmin, 1)
+			srv.Do(http.MethodPut, "/pegawai", ubahPegawai("unit", "Umum")).Expect(http.StatusAccepted)
+			anonim := &PerubahanData{PegawaiID: 1, Status: StatusPerubahanMenunggu,
+				Perubahan: map[string]NilaiPerubahan{"status_pegawai": {Lama: "Aktif", Baru: "Pensiun"}}}
+			if err := db.Create(anonim).Error; err != nil {
+				t.Fatal(err)
+			}
+			switch tt.peran {
+			case "":
+				srv.Header.Del("Authorization")
+			case PeranAdmin:
+			default:
+				masuk(t, srv, db, tt.peran, 2)
+			}
+			if tt.siapkan != nil {
+				tt.siapkan(t, db)
+			}
+			srv.Do(http.MethodPut, tt.path, map[string]string{"catatan": "dicek"}).Expect(tt.code)
+			if tt.check != nil {
+				tt.check(t, db)
+			}
+		})
+	}
+}
+
+func TestPengguna(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		body   interface{}
+		code   int
+		// keluar is whether the sessions of the account end
+		keluar bool
+	}{
+		{name: "new peran", method: http.MethodPut, body: map[string]interface{}{"peran": PeranHR, "pegawai_id": 2}, code: http.StatusOK, keluar: true},
+		{name: "new password", method: http.MethodPut, body: map[string]interface{}{"peran": PeranPegawai, "pegawai_id": 2, "password": "rahasia-baru"},
+			code: http.StatusOK, keluar: true},
+		{name: "new pegawai only", method: http.MethodPut, body: map[string]interface{}{"peran": PeranPegawai, "pegawai_id": 3}, code: http.StatusOK},
+		{name: "short password", method: http.MethodPut, body: map[string]interface{}{"peran": PeranHR, "password": "pendek"}, code: http.StatusUnprocessableEntity},
+		{name: "delete", method: http.MethodDelete, code: http.StatusNoContent, keluar: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, db := newTestServer(t)
+			pengguna := masuk(t, srv, db, PeranPegawai, 2)
+			masuk(t, srv, db, PeranAdmin, 1)
+			res := srv.Do(tt.method, fmt.Sprintf("/pengguna/%d", pengguna.ID), tt.body).Expect(tt.code)
+			if tt.code == http.StatusNoContent && len(res.Body) != 0 {
+				t.Errorf("204 with body %q", res.Body)
+			}
+			var sesi int64
+			db.Model(&Sesi{}).Where("pengguna_id = ?", pengguna.ID).Count(&sesi)
+			if (sesi == 0) != tt.keluar {
+				t.Errorf("%d sessions left", sesi)
+			}
+		})
+	}
+}
+
+func TestProfilSaya(t *testing.T) {
+	swalayan := func(field, mode string) func(t *testing.T, db *gorm.DB) {
+		return func(t *testing.T, db *gorm.DB) {
+			if err := db.Model(&AturanPersetujuan{}).Where("field = ?", field).Update("swalayan", mode).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	menunggu := func(t *testing.T, db *gorm.DB) []PerubahanData {
+		var daftar []PerubahanData
+		if err := db.Where("status = ?", StatusPerubahanMenunggu).Order("id").Find(&daftar).Error; err != nil {
+			t.Fatal(err)
+		}
+		return daftar
+	}
+	kontak := func(t *testing.T, db *gorm.DB) KontakPegawai {
+		var k KontakPegawai
+		db.Where("pegawai_id = ?", 1).Limit(1).Find(&k)
+		return k
+	}
+	tests := []struct {
+		name    string
+		peran   string
+		siapkan func(t *testing.T, db *gorm.DB)
+		method  string
+		path    string
+		body    interface{}
+		code    int
+		check   func(t *testing.T, res *testutil.Response, db *gorm.DB)
+	}{
+		{name: "get", peran: PeranPegawai, method: http.MethodGet, path: "/api/v1/me", code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var body struct {
+					Data     Profil            `json:"data"`
+					Swalayan map[string]string `json:"swalayan"`
+				}
+				res.Decode(&body)
+				if body.Data.Pegawai.ID != 1 || body.Swalayan["email"] != SwalayanLangsung ||
+					body.Swalayan["foto"] != SwalayanPersetujuan || body.Swalayan["nik"] != "" {
+					t.Errorf("got %+v", body)
+				}
+			}},
+		{name: "get without login", method: http.MethodGet, path: "/api/v1/me", code: http.StatusUnauthorized},
+		{name: "get without a linked Pegawai", peran: PeranPegawai, method: http.MethodGet, path: "/api/v1/me", code: http.StatusNotFound,
+			siapkan: func(t *testing.T, db *gorm.DB) {
+				db.Model(&Pengguna{}).Where("username = ?", PeranPegawai).Update("pegawai_id", nil)
+			}},
+		{name: "kontak is written right away", peran: PeranPegawai, method: http.MethodPut, path: "/api/v1/me/kontak",
+			body: KontakRequest{Email: "budi@example.com", NoHP: "0812", Alamat: "Bandung"}, code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				if k := kontak(t, db); k.Email != "budi@example.com" || k.NoHP != "0812" || k.Alamat != "Bandung" {
+					t.Errorf("kontak %+v", k)
+				}
+				if p := menunggu(t, db); len(p) != 0 {
+					t.Errorf("perubahan %+v", p)
+				}
+			}},
+		{name: "kontak with a field under persetujuan", peran: PeranPegawai, siapkan: swalayan("email", SwalayanPersetujuan),
+			method: http.MethodPut, path: "/api/v1/me/kontak", body: KontakRequest{Email: "budi@example.com", NoHP: "0812"}, code: http.StatusAccepted,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				if k := kontak(t, db); k.Email != "" || k.NoHP != "0812" {
+					t.Errorf("kontak %+v", k)
+				}
+				p := menunggu(t, db)
+				if len(p) != 1 || len(p[0].Perubahan) != 1 || p[0].Perubahan["email"].Baru != "budi@example.com" {
+					t.Errorf("perubahan %+v", p)
+				}
+			}},
+		{name: "kontak left as it is is not a change", peran: PeranPegawai, siapkan: swalayan("email", SwalayanPersetujuan),
+			method: http.MethodPut, path: "/api/v1/me/kontak", body: KontakRequest{NoHP: "0812"}, code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				if p := menunggu(t, db); len(p) != 0 {
+					t.Errorf("perubahan %+v", p)
+				}
+			}},
+		{name: "kontak field without swalayan", peran: PeranPegawai, siapkan: swalayan("no_hp", ""),
+			method: http.MethodPut, path: "/api/v1/me/kontak", body: KontakRequest{Email: "budi@example.com", NoHP: "0812"}, code: http.StatusForbidden,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				if k := kontak(t, db); k.Email != "" {
+					t.Errorf("kontak %+v", k)
+				}
+			}},
+		{name: "kontak with invalid email", peran: PeranPegawai, method: http.MethodPut, path: "/api/v1/me/kontak",
+			body: KontakRequest{Email: "budi"}, code: http.StatusUnprocessableEntity},
+		{name: "kontak without login", method: http.MethodPut, path: "/api/v1/me/kontak", body: KontakRequest{NoHP: "0812"}, code: http.StatusUnauthorized},
+		{name: "foto waits for approval", peran: PeranPegawai, method: http.MethodPut, path: "/api/v1/me/foto",
+			body: FotoRequest{Foto: "budi.jpg"}, code: http.StatusAccepted,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				if f := muatPegawai(t, db, 1).Foto; f != "" {
+					t.Errorf("foto changed to %q", f)
+				}
+				var pengguna Pengguna
+				db.Where("username = ?", PeranPegawai).First(&pengguna)
+				p := menunggu(t, db)
+				if len(p) != 1 || p[0].Perubahan["foto"].Baru != "budi.jpg" || p[0].DiajukanOleh == nil || *p[0].DiajukanOleh != pengguna.ID {
+					t.Errorf("perubahan %+v", p)
+				}
+			}},
+		{name: "foto already waiting", peran: PeranPegawai, method: http.MethodPut, path: "/api/v1/me/foto",
+			siapkan: func(t *testing.T, db *gorm.DB) {
+				if err := db.Create(&PerubahanData{PegawaiID: 1, Status: StatusPerubahanMenunggu,
+					Perubahan: map[string]NilaiPerubahan{"foto": {Baru: "lama.jpg"}}}).Error; err != nil {
+					t.Fatal(err)
+				}
+			},
+			body: FotoRequest{Foto: "budi.jpg"}, code: http.StatusConflict},
+		{name: "foto is required", peran: PeranPegawai, method: http.MethodPut, path: "/api/v1/me/foto", body: FotoRequest{}, code: http.StatusUnprocessableEntity},
+		{name: "keluarga waits for approval", peran: PeranPegawai, method: http.MethodPut, path: "/api/v1/me/keluarga",
+			body: []AnggotaKeluargaRequest{{Nama: "Ani", Hubungan: "Istri"}}, code: http.StatusAccepted,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var jumlah int64
+				db.Model(&AnggotaKeluarga{}).Count(&jumlah)
+				p := menunggu(t, db)
+				if jumlah != 0 || len(p) != 1 || !strings.Contains(p[0].Perubahan[fieldKeluarga].Baru, "Ani") {
+					t.Errorf("%d anggota, perubahan %+v", jumlah, p)
+				}
+			}},
+		{name: "keluarga written right away", peran: PeranPegawai, siapkan: swalayan(fieldKeluarga, SwalayanLangsung),
+			method: http.MethodPut, path: "/api/v1/me/keluarga", body: []AnggotaKeluargaRequest{{Nama: "Ani", Hubungan: "Istri"}}, code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data Profil
+				res.Data(&data)
+				if len(data.Keluarga) != 1 || data.Keluarga[0].Nama != "Ani" {
+					t.Errorf("got %+v", data.Keluarga)
+				}
+			}},
+		{name: "keluarga without hubungan", peran: PeranPegawai, method: http.MethodPut, path: "/api/v1/me/keluarga",
+			body: []AnggotaKeluargaRequest{{Nama: "Ani"}}, code: http.StatusUnprocessableEntity},
+		{name: "own perubahan only", peran: PeranPegawai, method: http.MethodGet, path: "/api/v1/me/perubahan", code: http.StatusOK,
+			siapkan: func(t *testing.T, db *gorm.DB) {
+				for _, id := range []int64{1, 2} {
+					if err := db.Create(&PerubahanData{PegawaiID: id, Status: StatusPerubahanMenunggu,
+						Perubahan: map[string]NilaiPerubahan{"foto": {Baru: "baru.jpg"}}}).Error; err != nil {
+						t.Fatal(err)
+					}
+				}
+			},
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data []PerubahanData
+				res.Data(&data)
+				if len(data) != 1 || data[0].PegawaiID != 1 {
+					t.Errorf("got %+v", data)
+				}
+			}},
+		{name: "perubahan without login", method: http.MethodGet, path: "/api/v1/me/perubahan", code: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, db := newTestServer(t)
+			if tt.peran != "" {
+				masuk(t, srv, db, tt.peran, 1)
+			}
+			if tt.siapkan != nil {
+				tt.siapkan(t, db)
+			}
+			res := srv.Do(tt.method, tt.path, tt.body).Expect(tt.code)
+			if tt.check != nil {
+				tt.check(t, res, db)
+			}
+		})
+	}
+}
+
+func TestDuplikat(t *testing.T) {
+	t.Run("jaroWinkler", func(t *testing.T) {
+		for _, tt := range []struct {
+			a, b string
+			want float64
+		}{
+			{"martha", "marhta", 0.9611},
+			{"dwayne", "duane", 0.84},
+			{"dixon", "dicksonx", 0.8133},
+			{"budi", "budi", 1},
+			{"", "", 1},
+			{"budi", "", 0},
+			{"abc", "xyz", 0},
+		} {
+			if got := jaroWinkler(tt.a, tt.b); got < tt.want-0.001 || got > tt.want+0.001 {
+				t.Errorf("jaroWinkler(%q, %q) = %.4f, want %.4f", tt.a, tt.b, got, tt.want)
+			}
+		}
+	})
+	t.Run("levenshtein", func(t *testing.T) {
+		for _, tt := range []struct {
+			a, b string
+			want int
+		}{
+			{"kitten", "sitting", 3},
+			{"3273010101900001", "3273010101900009", 1},
+			{"", "abc", 3},
+			{"abc", "", 3},
+			{"budi", "budi", 0},
+		} {
+			if got := levenshtein(tt.a, tt.b); got != tt.want {
+				t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+		}
+	})
+	t.Run("skorDuplikat", func(t *testing.T) {
+		budi := &Pegawai{Nama: "Budi Santoso", Nik: "3273010101900001", Tanggal_lahir: "1990-01-01", Tempat_lahir: "Bandung"}
+		for _, tt := range []struct {
+			name   string
+			b      *Pegawai
+			skor   float64
+			alasan []string
+		}{
+			{name: "same nik typed with separators", b: &Pegawai{Nama: "Siti", Nik: "3273-0101 0190.0001"},
+				skor: 1, alasan: []string{"nik sama"}},
+			{name: "same person with a title", b: &Pegawai{Nama: "BUDI SANTOSO, S.E.", Nik: "3201019912990005", Tanggal_lahir: "1990-01-01", Tempat_lahir: "bandung"},
+				skor: 1, alasan: []string{"nama mirip (1.00)", "tanggal lahir sama", "tempat lahir mirip (1.00)"}},
+			{name: "nik one typo away", b: &Pegawai{Nama: "Budi Santoso", Nik: "3273010101900009"},
+				skor: 0.7, alasan: []string{"nama mirip (1.00)", "nik hampir sama"}},
+			{name: "someone else", b: &Pegawai{Nama: "Yohanes Wibowo", Nik: "3374011203880003", Tanggal_lahir: "1988-03-12", Tempat_lahir: "Semarang"},
+				skor: 0.4198, alasan: []string{}},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				skor, alasan := skorDuplikat(budi, tt.b)
+				if skor < tt.skor-0.001 || skor > tt.skor+0.001 || strings.Join(alasan, "|") != strings.Join(tt.alasan, "|") {
+					t.Errorf("got %.4f %q, want %.4f %q", skor, alasan, tt.skor, tt.alasan)
+				}
+			})
+		}
+	})
+}
+
+func TestGabungPegawai(t *testing.T) {
+	pada := func(j string) *time.Time {
+		d, _ := time.ParseInLocation(layoutTanggal+" "+layoutJam, "2026-09-01 "+j, time.Local)
+		return &d
+	}
+	tanggal, _ := time.ParseInLocation(layoutTanggal, "2026-09-01", time.Local)
+	// Pegawai 4 is Budi again, entered by someone else
+	duplikat := &Pegawai{ID: 4, Nama: "Budi Santoso, S.E.", Nik: "3273010101900009", JenisPegawai: "PNS", StatusPegawai: "Aktif",
+		Unit: "Umum", Tanggal_lahir: "1990-01-01", Tempat_lahir: "Bandung", Foto: "budi.jpg"}
+	menunggu := func(t *testing.T, db *gorm.DB, pegawaiID int64) []PerubahanData {
+		var daftar []PerubahanData
+		if err := db.Where("pegawai_id = ? AND status = ?", pegawaiID, StatusPerubahanMenunggu).Find(&daftar).Error; err != nil {
+			t.Fatal(err)
+		}
+		return daftar
+	}
+	tests := []struct {
+		name    string
+		peran   string
+		siapkan func(t *testing.T, db *gorm.DB)
+		path    string
+		body    interface{}
+		code    int
+		check   func(t *testing.T, res *testutil.Response, db *gorm.DB)
+	}{
+		{name: "merge", peran: PeranHR, path: "/api/v1/pegawai/1/gabung", body: map[string]interface{}{"sumber_id": 4}, code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				p := muatPegawai(t, db, 1)
+				if p.Foto != "budi.jpg" || p.Unit != "Keuangan" || p.Nik != "3273010101900001" || p.Nama != "Budi Santoso" {
+					t.Errorf("target %+v", p)
+				}
+				var jumlah int64
+				db.Model(&Pegawai{}).Where("id = ?", 4).Count(&jumlah)
+				if jumlah != 0 {
+					t.Error("source still exists")
+				}
+				var absensi []Absensi
+				db.Find(&absensi)
+				if len(absensi) != 1 || absensi[0].PegawaiID != 1 || !absensi[0].JamMasuk.Equal(*pada("07:45")) || !absensi[0].JamPulang.Equal(*pada("16:30")) {
+					t.Errorf("absensi %+v", absensi)
+				}
+				var kontak KontakPegawai
+				db.Where("pegawai_id = ?", 1).First(&kontak)
+				if kontak.Email != "budi@example.com" {
+					t.Errorf("kontak %+v", kontak)
+				}
+				var dibatalkan PerubahanData
+				db.First(&dibatalkan, 1)
+				if dibatalkan.PegawaiID != 1 || dibatalkan.Status != StatusPerubahanDibatalkan || len(menunggu(t, db, 1)) != 0 {
+					t.Errorf("perubahan of the source %+v", dibatalkan)
+				}
+				var catatan PenggabunganPegawai
+				db.First(&catatan)
+				if catatan.TargetID != 1 || catatan.SumberID != 4 || catatan.DigabungOleh == nil || !strings.Contains(catatan.DataSumber, "Umum") {
+					t.Errorf("penggabungan %+v", catatan)
+				}
+			}},
+		{name: "chosen fields under persetujuan wait for approval", peran: PeranHR, path: "/api/v1/pegawai/1/gabung",
+			body: map[string]interface{}{"sumber_id": 4, "pilih": []string{"nama", "nik", "unit"}}, code: http.StatusAccepted,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				p := muatPegawai(t, db, 1)
+				if p.Nama != "Budi Santoso, S.E." || p.Nik != "3273010101900001" || p.Unit != "Keuangan" {
+					t.Errorf("target %+v", p)
+				}
+				var pengguna Pengguna
+				db.Where("username = ?", PeranHR).First(&pengguna)
+				d := menunggu(t, db, 1)
+				if len(d) != 1 || len(d[0].Perubahan) != 2 || d[0].Perubahan["nik"].Baru != "3273010101900009" ||
+					d[0].Perubahan["unit"].Baru != "Umum" || *d[0].DiajukanOleh != pengguna.ID {
+					t.Errorf("perubahan %+v", d)
+				}
+			}},
+		{name: "empty field under persetujuan waits for approval", peran: PeranHR, path: "/api/v1/pegawai/1/gabung",
+			siapkan: func(t *testing.T, db *gorm.DB) {
+				db.Model(&Pegawai{ID: 1}).Update("unit", "")
+			},
+			body: map[string]interface{}{"sumber_id": 4}, code: http.StatusAccepted,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				if u := muatPegawai(t, db, 1).Unit; u != "" {
+					t.Errorf("unit set to %q", u)
+				}
+				if d := menunggu(t, db, 1); len(d) != 1 || d[0].Perubahan["unit"].Baru != "Umum" {
+					t.Errorf("perubahan %+v", d)
+				}
+			}},
+		{name: "field already waiting", peran: PeranHR, path: "/api/v1/pegawai/1/gabung",
+			siapkan: func(t *testing.T, db *gorm.DB) {
+				if err := db.Create(&PerubahanData{PegawaiID: 1, Status: StatusPerubahanMenunggu,
+					Perubahan: map[string]NilaiPerubahan{"unit": {Lama: "Keuangan", Baru: "Umum"}}}).Error; err != nil {
+					t.Fatal(err)
+				}
+			},
+			body: map[string]interface{}{"sumber_id": 4, "pilih": []string{"unit"}}, code: http.StatusConflict,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				muatPegawai(t, db, 4)
+			}},
+		{name: "into itself", peran: PeranHR, path: "/api/v1/pegawai/4/gabung", body: map[string]interface{}{"sumber_id": 4}, code: http.StatusUnprocessableEntity},
+		{name: "unknown field", peran: PeranHR, path: "/api/v1/pegawai/1/gabung", body: map[string]interface{}{"sumber_id": 4, "pilih": []string{"gaji"}}, code: http.StatusUnprocessableEntity},
+		{name: "missing source", peran: PeranHR, path: "/api/v1/pegawai/1/gabung", body: map[string]interface{}{"sumber_id": 99}, code: http.StatusNotFound},
+		{name: "as pegawai", peran: PeranPegawai, path: "/api/v1/pegawai/1/gabung", body: map[string]interface{}{"sumber_id": 4}, code: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, db := newTestServer(t)
+			sumber := *duplikat
+			for _, v := range []interface{}{
+				&sumber,
+				&[]Absensi{
+					{PegawaiID: 1, Tanggal: tanggal, JamMasuk: pada("07:55"), JamPulang: pada("16:30")},
+					{PegawaiID: 4, Tanggal: tanggal, JamMasuk: pada("07:45"), JamPulang: pada("16:00")},
+				},
+				&KontakPegawai{PegawaiID: 4, Email: "budi@example.com"},
+				&PerubahanData{PegawaiID: 4, Status: StatusPerubahanMenunggu, Perubahan: map[string]NilaiPerubahan{"agama": {Baru: "Kristen"}}},
+			} {
+				if err := db.Create(v).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.siapkan != nil {
+				tt.siapkan(t, db)
+			}
+			masuk(t, srv, db, tt.peran, 2)
+			res := srv.Do(http.MethodPost, tt.path, tt.body).Expect(tt.code)
+			if tt.check != nil {
+				tt.check(t, res, db)
+			}
+		})
+	}
+}
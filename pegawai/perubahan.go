@@ -0,0 +1,651 @@
+package pegawai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"uas/apperror"
+)
+
+// Status perubahan data.
+const (
+	StatusPerubahanMenunggu   = "menunggu"
+	StatusPerubahanDisetujui  = "disetujui"
+	StatusPerubahanDitolak    = "ditolak"
+	StatusPerubahanDibatalkan = "dibatalkan"
+)
+
+// Aksi pada riwayat perubahan data.
+const (
+	AksiDiajukan    = "diajukan"
+	AksiDikomentari = "dikomentari"
+	AksiDisetujui   = "disetujui"
+	AksiDitolak     = "ditolak"
+	AksiDibatalkan  = "dibatalkan"
+)
+
+// fieldPegawai lists the Pegawai fields by their JSON name, which is also
+// their column name in datadiri.
+var fieldPegawai = []string{
+	"nama", "nik", "jenis_pegawai", "status_pegawai", "unit", "sub_unit", "pendidikan",
+	"tanggal_lahir", "tempat_lahir", "jenis_kelamin", "agama", "foto",
+}
+
+// nilaiPegawai returns the editable fields of p keyed by field name.
+func nilaiPegawai(p *Pegawai) map[string]string {
+	return map[string]string{
+		"nama":           p.Nama,
+		"nik":            p.Nik,
+		"jenis_pegawai":  p.JenisPegawai,
+		"status_pegawai": p.StatusPegawai,
+		"unit":           p.Unit,
+		"sub_unit":       p.SubUnit,
+		"pendidikan":     p.Pendidikan,
+		"tanggal_lahir":  p.Tanggal_lahir,
+		"tempat_lahir":   p.Tempat_lahir,
+		"jenis_kelamin":  p.Jenis_kelamin,
+		"agama":          p.Agama,
+		"foto":           p.Foto,
+	}
+}
+
+// terapkanNilai sets the fields of p named in nilai.
+func terapkanNilai(p *Pegawai, nilai map[string]string) error {
+	b, err := json.Marshal(nilai)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, p)
+}
+
+// AturanPersetujuan is the rule of one profile field. Aktif makes changes
+// to it through UpdatePegawai wait for approval. Swalayan says whether an
+// employee may change it on their own profile: directly (langsung), after
+// approval (persetujuan), or not at all (empty). Approvals need a Pengguna
+// with Peran, or an admin.
+type AturanPersetujuan struct {
+	ID        int64     `json:"id"`
+	Field     string    `json:"field" gorm:"size:50;uniqueIndex"`
+	Aktif     bool      `json:"aktif"`
+	Swalayan  string    `json:"swalayan" gorm:"size:20"`
+	Peran     string    `json:"peran" gorm:"size:20"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (AturanPersetujuan) TableName() string {
+	return "aturan_persetujuan"
+}
+
+// aturanDefault is installed for fields that have no rule yet.
+var aturanDefault = []AturanPersetujuan{
+	{Field: "nik", Aktif: true, Peran: PeranPenyetuju},
+	{Field: "tanggal_lahir", Aktif: true, Peran: PeranPenyetuju},
+	{Field: "status_pegawai", Aktif: true, Peran: PeranPenyetuju},
+	{Field: "unit", Aktif: true, Peran: PeranPenyetuju},
+	{Field: "foto", Swalayan: SwalayanPersetujuan, Peran: PeranHR},
+	{Field: "email", Swalayan: SwalayanLangsung, Peran: PeranHR},
+	{Field: "no_hp", Swalayan: SwalayanLangsung, Peran: PeranHR},
+	{Field: "alamat", Swalayan: SwalayanLangsung, Peran: PeranHR},
+	{Field: fieldKeluarga, Swalayan: SwalayanPersetujuan, Peran: PeranHR},
+}
+
+func seedAturanPersetujuan(db *gorm.DB) error {
+	for _, a := range aturanDefault {
+		var aturan AturanPersetujuan
+		if err := db.Where(AturanPersetujuan{Field: a.Field}).Attrs(a).FirstOrCreate(&aturan).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// aturanSemua returns every rule keyed by field.
+func aturanSemua(db *gorm.DB) (map[string]*AturanPersetujuan, error) {
+	rows := make([]*AturanPersetujuan, 0)
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	aturan := make(map[string]*AturanPersetujuan, len(rows))
+	for _, r := range rows {
+		aturan[r.Field] = r
+	}
+	return aturan, nil
+}
+
+// NilaiPerubahan is the old and proposed value of one field.
+type NilaiPerubahan struct {
+	Lama string `json:"lama"`
+	Baru string `json:"baru"`
+}
+
+// PerubahanData is a pending change of profile fields of a Pegawai.
+type PerubahanData struct {
+	ID               int64                     `json:"id"`
+	PegawaiID        int64                     `json:"pegawai_id" gorm:"index"`
+	Perubahan        map[string]NilaiPerubahan `json:"perubahan" gorm:"type:text;serializer:encrypted"`
+	Status           string                    `json:"status" gorm:"size:20;index"`
+	DiajukanOleh     *int64                    `json:"diajukan_oleh"`
+	DiprosesOleh     *int64                    `json:"diproses_oleh"`
+	TanggalDiproses  *time.Time                `json:"tanggal_diproses"`
+	CatatanKeputusan string                    `json:"catatan_keputusan"`
+	CreatedAt        time.Time                 `json:"created_at"`
+	UpdatedAt        time.Time                 `json:"updated_at"`
+}
+
+func (PerubahanData) TableName() string {
+	return "perubahan_data"
+}
+
+// fields returns the changed fields in a stable order.
+func (p *PerubahanData) fields() []string {
+	fields := make([]string, 0, len(p.Perubahan))
+	for f := range p.Perubahan {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+type KomentarPerubahan struct {
+	ID          int64     `json:"id"`
+	PerubahanID int64     `json:"perubahan_id" gorm:"index"`
+	PenggunaID  int64     `json:"pengguna_id"`
+	Isi         string    `json:"isi"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (KomentarPerubahan) TableName() string {
+	return "komentar_perubahan"
+}
+
+// RiwayatPerubahan is one entry of the audit trail of a PerubahanData.
+type RiwayatPerubahan struct {
+	ID          int64     `json:"id"`
+	PerubahanID int64     `json:"perubahan_id" gorm:"index"`
+	Aksi        string    `json:"aksi" gorm:"size:20"`
+	PenggunaID  *int64    `json:"pengguna_id"`
+	Catatan     string    `json:"catatan"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (RiwayatPerubahan) TableName() string {
+	return "riwayat_perubahan"
+}
+
+type Notifikasi struct {
+	ID         int64     `json:"id"`
+	PenggunaID int64     `json:"pengguna_id" gorm:"index"`
+	Judul      string    `json:"judul"`
+	Pesan      string    `json:"pesan"`
+	Tautan     string    `json:"tautan"`
+	Dibaca     bool      `json:"dibaca"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (Notifikasi) TableName() string {
+	return "notifikasi"
+}
+
+// kirimNotifikasi notifies every Pengguna in penerima except pengirim.
+func kirimNotifikasi(tx *gorm.DB, penerima []int64, pengirim *int64, judul, pesan, tautan string) error {
+	notifikasi := make([]*Notifikasi, 0, len(penerima))
+	for _, id := range penerima {
+		if pengirim != nil && *pengirim == id {
+			continue
+		}
+		notifikasi = append(notifikasi, &Notifikasi{PenggunaID: id, Judul: judul, Pesan: pesan, Tautan: tautan})
+	}
+	if len(notifikasi) == 0 {
+		return nil
+	}
+	return tx.Create(&notifikasi).Error
+}
+
+// penyetujuUntuk returns the accounts allowed to approve every field of p.
+func penyetujuUntuk(tx *gorm.DB, p *PerubahanData) ([]int64, error) {
+	aturan, err := aturanSemua(tx)
+	if err != nil {
+		return nil, err
+	}
+	peran := []string{PeranAdmin}
+	for _, f := range p.fields() {
+		if a, ok := aturan[f]; ok && !slices.Contains(peran, a.Peran) {
+			peran = append(peran, a.Peran)
+		}
+	}
+	ids := make([]int64, 0)
+	if len(peran) > 2 {
+		// Fields need different roles, so only admins can approve them all.
+		peran = peran[:1]
+	}
+	err = tx.Model(&Pengguna{}).Where("peran IN ?", peran).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// ajukanPerubahan splits the update of existing into pegawai: sensitive
+// fields are reset to their current value on pegawai and returned as a
+// PerubahanData of pengaju for approval, or nil when no sensitive field
+// changed. Without pengaju nobody could be kept from approving their own
+// change, so sensitive fields are refused.
+func ajukanPerubahan(db *gorm.DB, existing, pegawai *Pegawai, pengaju *Pengguna) (*PerubahanData, error) {
+	aturan, err := aturanSemua(db)
+	if err != nil {
+		return nil, err
+	}
+	lama := nilaiPegawai(existing)
+	baru := nilaiPegawai(pegawai)
+	perubahan := make(map[string]NilaiPerubahan)
+	for f, a := range aturan {
+		if !a.Aktif || !slices.Contains(fieldPegawai, f) {
+			continue
+		}
+		if baru[f] != lama[f] {
+			perubahan[f] = NilaiPerubahan{Lama: lama[f], Baru: baru[f]}
+			baru[f] = lama[f]
+		}
+	}
+	if len(perubahan) == 0 {
+		return nil, nil
+	}
+	if pengaju == nil {
+		return nil, apperror.Unauthorized("Login required to change fields under an aturan persetujuan")
+	}
+	if err := terapkanNilai(pegawai, baru); err != nil {
+		return nil, err
+	}
+	return &PerubahanData{PegawaiID: existing.ID, Perubahan: perubahan, Status: StatusPerubahanMenunggu, DiajukanOleh: &pengaju.ID}, nil
+}
+
+// errPerubahanTertunda reports a field that already has a pending change.
+type errPerubahanTertunda struct {
+	Field       string
+	PerubahanID int64
+}
+
+func (e *errPerubahanTertunda) Error() string {
+	return fmt.Sprintf("Field %s already has a pending change (perubahan %d)", e.Field, e.PerubahanID)
+}
+
+// simpanPerubahan stores a new PerubahanData with its history entry and
+// notifies the approvers. It fails with errPerubahanTertunda when one of the
+// fields is already waiting for approval.
+func simpanPerubahan(tx *gorm.DB, p *PerubahanData) error {
+	tertunda := make([]*PerubahanData, 0)
+	if err := tx.Where("pegawai_id = ? AND status = ?", p.PegawaiID, StatusPerubahanMenunggu).Find(&tertunda).Error; err != nil {
+		return err
+	}
+	for _, t := range tertunda {
+		for _, f := range p.fields() {
+			if _, ok := t.Perubahan[f]; ok {
+				return &errPerubahanTertunda{Field: f, PerubahanID: t.ID}
+			}
+		}
+	}
+
+	if err := tx.Create(p).Error; err != nil {
+		return err
+	}
+	riwayat := &RiwayatPerubahan{PerubahanID: p.ID, Aksi: AksiDiajukan, PenggunaID: p.DiajukanOleh, Catatan: strings.Join(p.fields(), ", ")}
+	if err := tx.Create(riwayat).Error; err != nil {
+		return err
+	}
+	penyetuju, err := penyetujuUntuk(tx, p)
+	if err != nil {
+		return err
+	}
+	return kirimNotifikasi(tx, penyetuju, p.DiajukanOleh,
+		"Perubahan data menunggu persetujuan",
+		fmt.Sprintf("Perubahan %s untuk pegawai %d menunggu persetujuan", strings.Join(p.fields(), ", "), p.PegawaiID),
+		fmt.Sprintf("/perubahan/%d", p.ID))
+}
+
+type PerubahanHandler struct {
+	db *gorm.DB
+}
+
+func NewPerubahanHandler(db *gorm.DB) *PerubahanHandler {
+	return &PerubahanHandler{db: db}
+}
+
+type AturanPersetujuanRequest struct {
+	Field    string `json:"field"`
+	Aktif    bool   `json:"aktif"`
+	Swalayan string `json:"swalayan"`
+	Peran    string `json:"peran"`
+}
+
+type KeputusanPerubahanRequest struct {
+	ID      int64  `param:"id"`
+	Catatan string `json:"catatan"`
+}
+
+type KomentarPerubahanRequest struct {
+	ID  int64  `param:"id"`
+	Isi string `json:"isi"`
+}
+
+func (h *PerubahanHandler) GetAllAturanPersetujuan(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	aturan := make([]*AturanPersetujuan, 0)
+	if err := db.Order("field").Find(&aturan).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Get All Aturan Persetujuan")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get All Aturan Persetujuan", "data": aturan})
+}
+
+// SetAturanPersetujuan creates or replaces the rule of a field.
+func (h *PerubahanHandler) SetAturanPersetujuan(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	var input AturanPersetujuanRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+	// /api/v1 names the field in the path, the root route in the body
+	if field := ctx.Param("field"); field != "" {
+		input.Field = field
+	}
+	if !slices.Contains(fieldProfil, input.Field) {
+		return apperror.Validation(fmt.Sprintf("Invalid field, expected one of %s", strings.Join(fieldProfil, ", ")))
+	}
+	if input.Swalayan != "" && input.Swalayan != SwalayanLangsung && input.Swalayan != SwalayanPersetujuan {
+		return apperror.Validation("Invalid swalayan, expected langsung, persetujuan or empty")
+	}
+	if !slices.Contains(daftarPeran, input.Peran) {
+		return apperror.Validation(fmt.Sprintf("Invalid peran, expected one of %s", strings.Join(daftarPeran, ", ")))
+	}
+
+	var aturan AturanPersetujuan
+	if err := db.Where(AturanPersetujuan{Field: input.Field}).FirstOrInit(&aturan).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Set Aturan Persetujuan")
+	}
+	aturan.Aktif = input.Aktif
+	aturan.Swalayan = input.Swalayan
+	aturan.Peran = input.Peran
+	if err := db.Save(&aturan).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Set Aturan Persetujuan")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Set Aturan Persetujuan", "data": aturan})
+}
+
+func (h *PerubahanHandler) GetAllPerubahan(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	perubahan := make([]*PerubahanData, 0)
+	query := db.Model(&PerubahanData{})
+	if pegawaiID := ctx.QueryParam("pegawai_id"); pegawaiID != "" {
+		query = query.Where("pegawai_id = ?", pegawaiID)
+	}
+	if status := ctx.QueryParam("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Order("id DESC").Find(&perubahan).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Get All Perubahan")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get All Perubahan", "data": perubahan})
+}
+
+// GetPerubahanByID returns a change request with its comments and history.
+func (h *PerubahanHandler) GetPerubahanByID(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	id := ctx.Param("id")
+	var perubahan PerubahanData
+	if err := db.First(&perubahan, "id = ?", id).Error; err != nil {
+		return apperror.Lookup(err, "Perubahan not found")
+	}
+	komentar := make([]*KomentarPerubahan, 0)
+	riwayat := make([]*RiwayatPerubahan, 0)
+	if err := db.Where("perubahan_id = ?", perubahan.ID).Order("id").Find(&komentar).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Get Perubahan")
+	}
+	if err := db.Where("perubahan_id = ?", perubahan.ID).Order("id").Find(&riwayat).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Get Perubahan")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"message":  fmt.Sprintf("Successfully Get Perubahan By ID: %s", id),
+		"data":     perubahan,
+		"komentar": komentar,
+		"riwayat":  riwayat,
+	})
+}
+
+func (h *PerubahanHandler) CreateKomentar(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	var input KomentarPerubahanRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+	if strings.TrimSpace(input.Isi) == "" {
+		return apperror.Validation("Isi is required")
+	}
+	pengguna := penggunaDari(ctx)
+
+	var perubahan PerubahanData
+	if err := db.First(&perubahan, input.ID).Error; err != nil {
+		return apperror.Lookup(err, "Perubahan not found")
+	}
+
+	komentar := &KomentarPerubahan{PerubahanID: perubahan.ID, PenggunaID: pengguna.ID, Isi: input.Isi}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(komentar).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&RiwayatPerubahan{PerubahanID: perubahan.ID, Aksi: AksiDikomentari, PenggunaID: &pengguna.ID, Catatan: input.Isi}).Error; err != nil {
+			return err
+		}
+		penerima, err := penyetujuUntuk(tx, &perubahan)
+		if err != nil {
+			return err
+		}
+		if perubahan.DiajukanOleh != nil {
+			penerima = append(penerima, *perubahan.DiajukanOleh)
+		}
+		return kirimNotifikasi(tx, penerima, &pengguna.ID,
+			"Komentar baru pada perubahan data",
+			fmt.Sprintf("%s: %s", pengguna.Username, input.Isi),
+			fmt.Sprintf("/perubahan/%d", perubahan.ID))
+	})
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Create Komentar")
+	}
+	return ctx.JSON(http.StatusCreated, map[string]interface{}{"message": "Successfully Create a Komentar", "data": komentar})
+}
+
+// putuskan approves or rejects a pending change. The approver needs, for
+// every field, the role of its rule (admins may decide anything) and must
+// not be the one who proposed the change. A change without a maker, left
+// from before updates needed a login, is never decided, only cancelled.
+func (h *PerubahanHandler) putuskan(ctx echo.Context, setujui bool) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	var input KeputusanPerubahanRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+	pengguna := penggunaDari(ctx)
+
+	var perubahan PerubahanData
+	if err := db.First(&perubahan, input.ID).Error; err != nil {
+		return apperror.Lookup(err, "Perubahan not found")
+	}
+	if perubahan.Status != StatusPerubahanMenunggu {
+		return apperror.Conflict(fmt.Sprintf("Perubahan is already %s", perubahan.Status))
+	}
+	if perubahan.DiajukanOleh == nil {
+		return apperror.Conflict("Perubahan has no maker, cancel it and submit it again")
+	}
+	if *perubahan.DiajukanOleh == pengguna.ID {
+		return apperror.Forbidden("Perubahan cannot be decided by its maker")
+	}
+	if pengguna.Peran != PeranAdmin {
+		aturan, err := aturanSemua(db)
+		if err != nil {
+			return apperror.Wrap(err, "Failed to Process Perubahan")
+		}
+		for _, f := range perubahan.fields() {
+			// Fields without a rule are left to admins.
+			peran := PeranAdmin
+			if a, ok := aturan[f]; ok {
+				peran = a.Peran
+			}
+			if peran != pengguna.Peran {
+				return apperror.Forbidden(fmt.Sprintf("Field %s needs peran %s", f, peran))
+			}
+		}
+	}
+
+	now := time.Now()
+	perubahan.DiprosesOleh = &pengguna.ID
+	perubahan.TanggalDiproses = &now
+	perubahan.CatatanKeputusan = input.Catatan
+	perubahan.Status = StatusPerubahanDitolak
+	aksi := AksiDitolak
+	if setujui {
+		perubahan.Status = StatusPerubahanDisetujui
+		aksi = AksiDisetujui
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&PerubahanData{}).
+			Where("id = ? AND status = ?", perubahan.ID, StatusPerubahanMenunggu).
+			Updates(map[string]interface{}{
+				"status":            perubahan.Status,
+				"diproses_oleh":     perubahan.DiprosesOleh,
+				"tanggal_diproses":  perubahan.TanggalDiproses,
+				"catatan_keputusan": perubahan.CatatanKeputusan,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return &errKonflik{"Perubahan was processed concurrently"}
+		}
+
+		if setujui {
+			profil, err := muatProfil(tx, perubahan.PegawaiID)
+			if err != nil {
+				return err
+			}
+			sekarang := profil.nilai()
+			baru := make(map[string]string, len(perubahan.Perubahan))
+			for f, n := range perubahan.Perubahan {
+				if sekarang[f] != n.Lama {
+					return &errKonflik{fmt.Sprintf("Field %s changed since the Perubahan was made, reject it and submit again", f)}
+				}
+				baru[f] = n.Baru
+			}
+			if err := terapkanProfil(tx, perubahan.PegawaiID, baru); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Create(&RiwayatPerubahan{PerubahanID: perubahan.ID, Aksi: aksi, PenggunaID: &pengguna.ID, Catatan: input.Catatan}).Error; err != nil {
+			return err
+		}
+		return kirimNotifikasi(tx, []int64{*perubahan.DiajukanOleh}, &pengguna.ID,
+			"Perubahan data "+perubahan.Status,
+			fmt.Sprintf("Perubahan %s untuk pegawai %d %s oleh %s", strings.Join(perubahan.fields(), ", "), perubahan.PegawaiID, perubahan.Status, pengguna.Username),
+			fmt.Sprintf("/perubahan/%d", perubahan.ID))
+	})
+	var konflik *errKonflik
+	if errors.As(err, &konflik) {
+		return apperror.Conflict(konflik.pesan)
+	}
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Process Perubahan")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": fmt.Sprintf("Successfully set Perubahan to %s", perubahan.Status), "data": perubahan})
+}
+
+// errKonflik aborts a transaction with a 409 response.
+type errKonflik struct {
+	pesan string
+}
+
+func (e *errKonflik) Error() string {
+	return e.pesan
+}
+
+func (h *PerubahanHandler) ApprovePerubahan(ctx echo.Context) error {
+	return h.putuskan(ctx, true)
+}
+
+func (h *PerubahanHandler) RejectPerubahan(ctx echo.Context) error {
+	return h.putuskan(ctx, false)
+}
+
+// CancelPerubahan withdraws a pending change. Only its maker or an admin may
+// do so.
+func (h *PerubahanHandler) CancelPerubahan(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	id := ctx.Param("id")
+	pengguna := penggunaDari(ctx)
+
+	var perubahan PerubahanData
+	if err := db.First(&perubahan, "id = ?", id).Error; err != nil {
+		return apperror.Lookup(err, "Perubahan not found")
+	}
+	if perubahan.Status != StatusPerubahanMenunggu {
+		return apperror.Conflict(fmt.Sprintf("Perubahan is already %s", perubahan.Status))
+	}
+	if pengguna.Peran != PeranAdmin && (perubahan.DiajukanOleh == nil || *perubahan.DiajukanOleh != pengguna.ID) {
+		return apperror.Forbidden("Only the maker may cancel this Perubahan")
+	}
+
+	perubahan.Status = StatusPerubahanDibatalkan
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// The status guard keeps a cancel from overwriting a decision that
+		// committed since the read, whose values may already be applied.
+		result := tx.Model(&PerubahanData{}).
+			Where("id = ? AND status = ?", perubahan.ID, StatusPerubahanMenunggu).
+			Update("status", perubahan.Status)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return &errKonflik{"Perubahan was processed concurrently"}
+		}
+		return tx.Create(&RiwayatPerubahan{PerubahanID: perubahan.ID, Aksi: AksiDibatalkan, PenggunaID: &pengguna.ID}).Error
+	})
+	var konflik *errKonflik
+	if errors.As(err, &konflik) {
+		return apperror.Conflict(konflik.pesan)
+	}
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Cancel Perubahan")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Cancel Perubahan", "data": perubahan})
+}
+
+func (h *PerubahanHandler) GetAllNotifikasi(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	notifikasi := make([]*Notifikasi, 0)
+	query := db.Where("pengguna_id = ?", penggunaDari(ctx).ID)
+	if ctx.QueryParam("belum_dibaca") == "true" {
+		query = query.Where("dibaca = ?", false)
+	}
+	if err := query.Order("id DESC").Find(&notifikasi).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Get All Notifikasi")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get All Notifikasi", "data": notifikasi})
+}
+
+func (h *PerubahanHandler) ReadNotifikasi(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	id := ctx.Param("id")
+	result := db.Model(&Notifikasi{}).Where("id = ? AND pengguna_id = ?", id, penggunaDari(ctx).ID).Update("dibaca", true)
+	if result.Error != nil {
+		return apperror.Wrap(result.Error, "Failed to Read Notifikasi")
+	}
+	if result.RowsAffected == 0 {
+		return apperror.NotFound("Notifikasi not found")
+	}
+	return ctx.NoContent(http.StatusNoContent)
+}
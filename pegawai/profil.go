@@ -0,0 +1,349 @@
+package pegawai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"uas/apperror"
+)
+
+// Mode swalayan sebuah field pada aturan persetujuan.
+const (
+	SwalayanLangsung    = "langsung"
+	SwalayanPersetujuan = "persetujuan"
+)
+
+// fieldKontak are the KontakPegawai fields.
+var fieldKontak = []string{"email", "no_hp", "alamat"}
+
+// fieldKeluarga stands for the whole family list.
+const fieldKeluarga = "keluarga"
+
+// fieldProfil lists every field a rule can be set for.
+var fieldProfil = append(append(slices.Clone(fieldPegawai), fieldKontak...), fieldKeluarga)
+
+// KontakPegawai holds the contact data of a Pegawai.
+type KontakPegawai struct {
+	ID        int64     `json:"id"`
+	PegawaiID int64     `json:"pegawai_id" gorm:"uniqueIndex"`
+	Email     string    `json:"email"`
+	NoHP      string    `json:"no_hp" gorm:"column:no_hp"`
+	Alamat    string    `json:"alamat"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (KontakPegawai) TableName() string {
+	return "kontak_pegawai"
+}
+
+// AnggotaKeluarga is a family member of a Pegawai.
+type AnggotaKeluarga struct {
+	ID           int64     `json:"id"`
+	PegawaiID    int64     `json:"pegawai_id" gorm:"index"`
+	Nama         string    `json:"nama"`
+	Hubungan     string    `json:"hubungan"`
+	TanggalLahir string    `json:"tanggal_lahir"`
+	Pekerjaan    string    `json:"pekerjaan"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+func (AnggotaKeluarga) TableName() string {
+	return "keluarga_pegawai"
+}
+
+type AnggotaKeluargaRequest struct {
+	Nama         string `json:"nama"`
+	Hubungan     string `json:"hubungan"`
+	TanggalLahir string `json:"tanggal_lahir"`
+	Pekerjaan    string `json:"pekerjaan"`
+}
+
+type KontakRequest struct {
+	Email  string `json:"email"`
+	NoHP   string `json:"no_hp"`
+	Alamat string `json:"alamat"`
+}
+
+type FotoRequest struct {
+	Foto string `json:"foto"`
+}
+
+// Profil is a Pegawai with its contact and family data.
+type Profil struct {
+	Pegawai  *Pegawai           `json:"pegawai"`
+	Kontak   *KontakPegawai     `json:"kontak"`
+	Keluarga []*AnggotaKeluarga `json:"keluarga"`
+}
+
+func muatProfil(db *gorm.DB, pegawaiID int64) (*Profil, error) {
+	profil := &Profil{Pegawai: &Pegawai{}, Kontak: &KontakPegawai{PegawaiID: pegawaiID}, Keluarga: make([]*AnggotaKeluarga, 0)}
+	if err := db.First(profil.Pegawai, pegawaiID).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("pegawai_id = ?", pegawaiID).First(profil.Kontak).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if err := db.Where("pegawai_id = ?", pegawaiID).Order("id").Find(&profil.Keluarga).Error; err != nil {
+		return nil, err
+	}
+	return profil, nil
+}
+
+// keluargaJSON encodes family members without their ids and timestamps, so
+// two lists with the same content encode the same.
+func keluargaJSON(keluarga []*AnggotaKeluarga) string {
+	daftar := make([]AnggotaKeluargaRequest, 0, len(keluarga))
+	for _, k := range keluarga {
+		daftar = append(daftar, AnggotaKeluargaRequest{Nama: k.Nama, Hubungan: k.Hubungan, TanggalLahir: k.TanggalLahir, Pekerjaan: k.Pekerjaan})
+	}
+	b, _ := json.Marshal(daftar)
+	return string(b)
+}
+
+// nilai returns every field of fieldProfil keyed by name.
+func (p *Profil) nilai() map[string]string {
+	nilai := nilaiPegawai(p.Pegawai)
+	nilai["email"] = p.Kontak.Email
+	nilai["no_hp"] = p.Kontak.NoHP
+	nilai["alamat"] = p.Kontak.Alamat
+	nilai[fieldKeluarga] = keluargaJSON(p.Keluarga)
+	return nilai
+}
+
+// terapkanProfil writes the given fields of fieldProfil for a Pegawai.
+func terapkanProfil(tx *gorm.DB, pegawaiID int64, nilai map[string]string) error {
+	kolomPegawai := make(map[string]string)
+	kolomKontak := make(map[string]interface{})
+	for f, v := range nilai {
+		switch {
+		case slices.Contains(fieldPegawai, f):
+			kolomPegawai[f] = v
+		case slices.Contains(fieldKontak, f):
+			kolomKontak[f] = v
+		case f == fieldKeluarga:
+			daftar := make([]AnggotaKeluargaRequest, 0)
+			if err := json.Unmarshal([]byte(v), &daftar); err != nil {
+				return err
+			}
+			if err := tx.Where("pegawai_id = ?", pegawaiID).Delete(&AnggotaKeluarga{}).Error; err != nil {
+				return err
+			}
+			for _, k := range daftar {
+				anggota := &AnggotaKeluarga{PegawaiID: pegawaiID, Nama: k.Nama, Hubungan: k.Hubungan, TanggalLahir: k.TanggalLahir, Pekerjaan: k.Pekerjaan}
+				if err := tx.Create(anggota).Error; err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("unknown field %s", f)
+		}
+	}
+	if len(kolomPegawai) > 0 {
+		// through a Pegawai rather than the map, so the encrypted fields
+		// go through their serializer and BeforeSave updates nik_index
+		var p Pegawai
+		if err := terapkanNilai(&p, kolomPegawai); err != nil {
+			return err
+		}
+		kolom := urutKunci(kolomPegawai)
+		if _, ok := kolomPegawai["nik"]; ok {
+			kolom = append(kolom, "nik_index")
+		}
+		if err := tx.Model(&Pegawai{ID: pegawaiID}).Select(kolom).Updates(&p).Error; err != nil {
+			return err
+		}
+	}
+	if len(kolomKontak) > 0 {
+		var kontak KontakPegawai
+		if err := tx.Where(KontakPegawai{PegawaiID: pegawaiID}).FirstOrCreate(&kontak).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&kontak).Updates(kolomKontak).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type ProfilHandler struct {
+	db *gorm.DB
+}
+
+func NewProfilHandler(db *gorm.DB) *ProfilHandler {
+	return &ProfilHandler{db: db}
+}
+
+// pegawaiSaya returns the Pegawai linked to the logged in account. Routes
+// using it must be guarded by RequirePegawai.
+func pegawaiSaya(ctx echo.Context) int64 {
+	return *penggunaDari(ctx).PegawaiID
+}
+
+// GetProfil returns the profile of a Pegawai for HR.
+func (h *ProfilHandler) GetProfil(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	id := ctx.Param("id")
+	var pegawai Pegawai
+	if err := db.First(&pegawai, "id = ?", id).Error; err != nil {
+		return apperror.Lookup(err, "Pegawai not found")
+	}
+	profil, err := muatProfil(db, pegawai.ID)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Get Profil")
+	}
+	data, err := bentukPegawai.Apply(ctx, profil.Pegawai, nil)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Get Profil")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": fmt.Sprintf("Successfully Get Profil By Pegawai ID: %s", id), "data": map[string]interface{}{
+		"pegawai": data, "kontak": profil.Kontak, "keluarga": profil.Keluarga,
+	}})
+}
+
+// GetMe returns the profile of the logged in employee together with which
+// fields they may edit directly and which need approval.
+func (h *ProfilHandler) GetMe(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	pegawaiID := pegawaiSaya(ctx)
+	profil, err := muatProfil(db, pegawaiID)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Get Profil")
+	}
+	aturan, err := aturanSemua(db)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Get Profil")
+	}
+	swalayan := make(map[string]string)
+	for f, a := range aturan {
+		if a.Swalayan != "" {
+			swalayan[f] = a.Swalayan
+		}
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get Profil", "data": profil, "swalayan": swalayan})
+}
+
+// ubahProfilSaya applies changes proposed by an employee to their own
+// profile. Each field follows the Swalayan mode of its rule: langsung fields
+// are written right away, persetujuan fields become a PerubahanData, and
+// fields without a mode cannot be changed by the employee at all.
+func (h *ProfilHandler) ubahProfilSaya(ctx echo.Context, baru map[string]string) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	pegawaiID := pegawaiSaya(ctx)
+	pengguna := penggunaDari(ctx)
+
+	aturan, err := aturanSemua(db)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Update Profil")
+	}
+	profil, err := muatProfil(db, pegawaiID)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Update Profil")
+	}
+	lama := profil.nilai()
+
+	langsung := make(map[string]string)
+	perubahan := &PerubahanData{PegawaiID: pegawaiID, Perubahan: make(map[string]NilaiPerubahan), Status: StatusPerubahanMenunggu, DiajukanOleh: &pengguna.ID}
+	for f, v := range baru {
+		if v == lama[f] {
+			continue
+		}
+		a, ok := aturan[f]
+		switch {
+		case ok && a.Swalayan == SwalayanLangsung:
+			langsung[f] = v
+		case ok && a.Swalayan == SwalayanPersetujuan:
+			perubahan.Perubahan[f] = NilaiPerubahan{Lama: lama[f], Baru: v}
+		default:
+			return apperror.Forbidden(fmt.Sprintf("Field %s cannot be changed through self-service", f))
+		}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := terapkanProfil(tx, pegawaiID, langsung); err != nil {
+			return err
+		}
+		if len(perubahan.Perubahan) > 0 {
+			return simpanPerubahan(tx, perubahan)
+		}
+		return nil
+	})
+	var tertunda *errPerubahanTertunda
+	if errors.As(err, &tertunda) {
+		return apperror.Conflict(tertunda.Error())
+	}
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Update Profil")
+	}
+
+	profil, err = muatProfil(db, pegawaiID)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Get Profil")
+	}
+	if len(perubahan.Perubahan) > 0 {
+		return ctx.JSON(http.StatusAccepted, map[string]interface{}{
+			"message":   fmt.Sprintf("Successfully Update Profil, changes to %s are waiting for approval", strings.Join(perubahan.fields(), ", ")),
+			"data":      profil,
+			"perubahan": perubahan,
+		})
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Update Profil", "data": profil})
+}
+
+func (h *ProfilHandler) UpdateKontakSaya(ctx echo.Context) error {
+	var input KontakRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+	if input.Email != "" && !strings.Contains(input.Email, "@") {
+		return apperror.Validation("Invalid email")
+	}
+	return h.ubahProfilSaya(ctx, map[string]string{"email": input.Email, "no_hp": input.NoHP, "alamat": input.Alamat})
+}
+
+func (h *ProfilHandler) UpdateFotoSaya(ctx echo.Context) error {
+	var input FotoRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+	if input.Foto == "" {
+		return apperror.Validation("Foto is required")
+	}
+	return h.ubahProfilSaya(ctx, map[string]string{"foto": input.Foto})
+}
+
+// UpdateKeluargaSaya replaces the whole family list.
+func (h *ProfilHandler) UpdateKeluargaSaya(ctx echo.Context) error {
+	input := make([]AnggotaKeluargaRequest, 0)
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+	keluarga := make([]*AnggotaKeluarga, 0, len(input))
+	for _, k := range input {
+		if k.Nama == "" || k.Hubungan == "" {
+			return apperror.Validation("Nama and Hubungan are required for every anggota keluarga")
+		}
+		keluarga = append(keluarga, &AnggotaKeluarga{Nama: k.Nama, Hubungan: k.Hubungan, TanggalLahir: k.TanggalLahir, Pekerjaan: k.Pekerjaan})
+	}
+	return h.ubahProfilSaya(ctx, map[string]string{fieldKeluarga: keluargaJSON(keluarga)})
+}
+
+// GetPerubahanSaya lists the change requests of the logged in employee.
+func (h *ProfilHandler) GetPerubahanSaya(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	pegawaiID := pegawaiSaya(ctx)
+	perubahan := make([]*PerubahanData, 0)
+	if err := db.Where("pegawai_id = ?", pegawaiID).Order("id DESC").Find(&perubahan).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Get All Perubahan")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get All Perubahan", "data": perubahan})
+}
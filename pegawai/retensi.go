@@ -0,0 +1,345 @@
+package pegawai
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"uas/apperror"
+	"uas/cli"
+	"uas/outbox"
+	"uas/referensi"
+)
+
+// Aksi of an AturanRetensi.
+const (
+	RetensiHapus     = "hapus"
+	RetensiAnonimkan = "anonimkan"
+)
+
+// AuditRetensi is the Audit aksi of a row deleted by an AturanRetensi, the
+// ones it anonymizes are recorded as AuditAnonimisasi.
+const AuditRetensi = "hapus_retensi"
+
+// AturanRetensi says how long the rows of an entity are kept. Jenis narrows
+// the rule to one kind of row, see sasaranRetensi, empty means all of them.
+// Rows older than Hari days are purged with Aksi while Aktif is set.
+type AturanRetensi struct {
+	ID        int64     `json:"id"`
+	Entitas   string    `json:"entitas" gorm:"size:50;uniqueIndex:idx_aturan_retensi"`
+	Jenis     string    `json:"jenis" gorm:"size:50;uniqueIndex:idx_aturan_retensi"`
+	Aksi      string    `json:"aksi" gorm:"size:20"`
+	Hari      int       `json:"hari"`
+	Aktif     bool      `json:"aktif"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (AturanRetensi) TableName() string {
+	return "aturan_retensi"
+}
+
+// sasaran is what an AturanRetensi of one entity works on.
+type sasaran struct {
+	model interface{}
+	aksi  []string
+	// kandidat narrows db to the rows of jenis the rule may purge, last
+	// touched before batas.
+	kandidat func(db *gorm.DB, jenis string, batas time.Time) *gorm.DB
+}
+
+// sasaranRetensi are the entities an AturanRetensi may name.
+var sasaranRetensi = map[string]sasaran{
+	// inactive values are the deleted ones of the master data, jenis is
+	// the referensi jenis
+	"referensi": {model: &referensi.Referensi{}, aksi: []string{RetensiHapus},
+		kandidat: func(db *gorm.DB, jenis string, batas time.Time) *gorm.DB {
+			db = db.Where("aktif = ? AND updated_at < ?", false, batas)
+			if jenis != "" {
+				db = db.Where("jenis = ?", jenis)
+			}
+			return db
+		}},
+	// former employees not anonymized yet, jenis is the status_pegawai
+	"pegawai": {model: &Pegawai{}, aksi: []string{RetensiAnonimkan},
+		kandidat: func(db *gorm.DB, jenis string, batas time.Time) *gorm.DB {
+			db = db.Where("status_pegawai NOT IN ? AND updated_at < ?", statusMasihBekerja, batas).
+				Where("NOT EXISTS (SELECT 1 FROM audit_log WHERE audit_log.aksi = ? AND audit_log.entitas = ? AND audit_log.entitas_id = datadiri.id)",
+					AuditAnonimisasi, "pegawai")
+			if jenis != "" {
+				db = db.Where("status_pegawai = ?", jenis)
+			}
+			return db
+		}},
+	// notifikasi that were read
+	"notifikasi": {model: &Notifikasi{}, aksi: []string{RetensiHapus},
+		kandidat: func(db *gorm.DB, jenis string, batas time.Time) *gorm.DB {
+			return db.Where("dibaca = ? AND created_at < ?", true, batas)
+		}},
+	// outbox events every consumer of outbox.Dispatch has handled, jenis is
+	// the resource
+	"outbox": {model: &outbox.Event{}, aksi: []string{RetensiHapus},
+		kandidat: func(db *gorm.DB, jenis string, batas time.Time) *gorm.DB {
+			db = db.Where("created_at < ?", batas).
+				Where("NOT EXISTS (SELECT 1 FROM outbox_offset WHERE outbox_offset.position < outbox.id)")
+			if jenis != "" {
+				db = db.Where("resource = ?", jenis)
+			}
+			return db
+		}},
+	// webhook deliveries done with, sent or given up on, jenis is the
+	// status
+	"pengiriman_webhook": {model: &PengirimanWebhook{}, aksi: []string{RetensiHapus},
+		kandidat: func(db *gorm.DB, jenis string, batas time.Time) *gorm.DB {
+			db = db.Where("status IN ? AND created_at < ?", []string{StatusPengirimanTerkirim, StatusPengirimanGagal}, batas)
+			if jenis != "" {
+				db = db.Where("status = ?", jenis)
+			}
+			return db
+		}},
+}
+
+// aturanRetensiDefault is installed when the rule is missing. Anonymizing
+// employees cannot be undone, so that rule waits for an admin to turn it on.
+var aturanRetensiDefault = []AturanRetensi{
+	{Entitas: "referensi", Aksi: RetensiHapus, Hari: 90, Aktif: true},
+	{Entitas: "notifikasi", Aksi: RetensiHapus, Hari: 365, Aktif: true},
+	{Entitas: "pegawai", Aksi: RetensiAnonimkan, Hari: 3650},
+	{Entitas: "outbox", Aksi: RetensiHapus, Hari: 90, Aktif: true},
+	{Entitas: "pengiriman_webhook", Aksi: RetensiHapus, Hari: 90, Aktif: true},
+}
+
+func seedAturanRetensi(db *gorm.DB) error {
+	for _, a := range aturanRetensiDefault {
+		var aturan AturanRetensi
+		if err := db.Where(AturanRetensi{Entitas: a.Entitas, Jenis: a.Jenis}).Attrs(a).FirstOrCreate(&aturan).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HasilRetensi is what one AturanRetensi purged, or would purge on a dry
+// run.
+type HasilRetensi struct {
+	Aturan AturanRetensi `json:"aturan"`
+	Batas  time.Time     `json:"batas"`
+	ID     []int64       `json:"id"`
+	// Diproses counts the rows purged, zero on a dry run.
+	Diproses int `json:"diproses"`
+}
+
+// jalankanRetensi applies the active rules as of sekarang. Every row is
+// purged in its own transaction with its Audit entry, oleh is nil when the
+// scheduled job runs it. A dry run only reports the rows.
+func jalankanRetensi(db *gorm.DB, sekarang time.Time, dryRun bool, oleh *int64) ([]*HasilRetensi, error) {
+	var daftar []*AturanRetensi
+	if err := db.Where("aktif = ?", true).Order("id").Find(&daftar).Error; err != nil {
+		return nil, err
+	}
+	hasil := make([]*HasilRetensi, 0, len(daftar))
+	for _, a := range daftar {
+		t, ok := sasaranRetensi[a.Entitas]
+		if !ok {
+			slog.Warn("aturan retensi names an unknown entitas, skipped", "id", a.ID, "entitas", a.Entitas)
+			continue
+		}
+		h := &HasilRetensi{Aturan: *a, Batas: sekarang.AddDate(0, 0, -a.Hari), ID: make([]int64, 0)}
+		if err := t.kandidat(db.Model(t.model), a.Jenis, h.Batas).Order("id").Pluck("id", &h.ID).Error; err != nil {
+			return hasil, err
+		}
+		hasil = append(hasil, h)
+		if dryRun {
+			continue
+		}
+		keterangan := fmt.Sprintf("aturan retensi %d: %s %s after %d days", a.ID, a.Aksi, strings.TrimSpace(a.Entitas+" "+a.Jenis), a.Hari)
+		for _, id := range h.ID {
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if a.Aksi == RetensiAnonimkan {
+					_, err := anonimkan(tx, id, keterangan, oleh)
+					return err
+				}
+				if err := tx.Delete(t.model, id).Error; err != nil {
+					return err
+				}
+				return catatAudit(tx, AuditRetensi, a.Entitas, id, oleh, keterangan)
+			})
+			if err != nil {
+				return hasil, err
+			}
+			h.Diproses++
+		}
+	}
+	return hasil, nil
+}
+
+// purgeRetensi is the scheduled job of the retention rules.
+func purgeRetensi(ctx context.Context, db *gorm.DB) error {
+	hasil, err := jalankanRetensi(db.WithContext(ctx), time.Now(), false, nil)
+	for _, h := range hasil {
+		if h.Diproses > 0 {
+			slog.Info("retention purge", "entitas", h.Aturan.Entitas, "jenis", h.Aturan.Jenis, "aksi", h.Aturan.Aksi, "rows", h.Diproses)
+		}
+	}
+	return err
+}
+
+// retention applies the retention rules once, for a cron job instead of
+// RETENTION_INTERVAL, or reports what they would purge with -dry-run.
+func retention(ctx context.Context, db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("retention", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	dryRun := fs.Bool("dry-run", false, "only report what would be purged")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return fmt.Errorf("%w: retention [-dry-run]", cli.ErrUsage)
+	}
+	db = db.WithContext(ctx)
+	if err := migrate(db); err != nil {
+		return err
+	}
+	hasil, err := jalankanRetensi(db, time.Now(), *dryRun, nil)
+	for _, h := range hasil {
+		n := h.Diproses
+		if *dryRun {
+			n = len(h.ID)
+		}
+		fmt.Printf("%s: %s %d rows not touched since %s%s\n", strings.TrimSpace(h.Aturan.Entitas+" "+h.Aturan.Jenis),
+			h.Aturan.Aksi, n, h.Batas.Format(time.DateOnly), daftarID(h.ID, *dryRun))
+	}
+	return err
+}
+
+func daftarID(id []int64, tampilkan bool) string {
+	if !tampilkan || len(id) == 0 {
+		return ""
+	}
+	s := make([]string, len(id))
+	for i, v := range id {
+		s[i] = strconv.FormatInt(v, 10)
+	}
+	return " (id " + strings.Join(s, ", ") + ")"
+}
+
+type RetensiHandler struct {
+	db *gorm.DB
+}
+
+func NewRetensiHandler(db *gorm.DB) *RetensiHandler {
+	return &RetensiHandler{db: db}
+}
+
+type AturanRetensiRequest struct {
+	ID      int64  `param:"id"`
+	Entitas string `json:"entitas"`
+	Jenis   string `json:"jenis"`
+	Aksi    string `json:"aksi"`
+	Hari    int    `json:"hari"`
+	Aktif   bool   `json:"aktif"`
+}
+
+func (r AturanRetensiRequest) valid() error {
+	t, ok := sasaranRetensi[r.Entitas]
+	if !ok {
+		entitas := make([]string, 0, len(sasaranRetensi))
+		for e := range sasaranRetensi {
+			entitas = append(entitas, e)
+		}
+		sort.Strings(entitas)
+		return apperror.Validation(fmt.Sprintf("Invalid entitas, expected one of %s", strings.Join(entitas, ", ")))
+	}
+	if !slices.Contains(t.aksi, r.Aksi) {
+		return apperror.Validation(fmt.Sprintf("Invalid aksi for %s, expected one of %s", r.Entitas, strings.Join(t.aksi, ", ")))
+	}
+	if r.Hari < 1 {
+		return apperror.Validation("Hari must be at least 1")
+	}
+	return nil
+}
+
+func (h *RetensiHandler) GetAllAturanRetensi(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	aturan := make([]*AturanRetensi, 0)
+	if err := db.Order("entitas, jenis").Find(&aturan).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Get All Aturan Retensi")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get All Aturan Retensi", "data": aturan})
+}
+
+func (h *RetensiHandler) CreateAturanRetensi(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	var input AturanRetensiRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+	if err := input.valid(); err != nil {
+		return err
+	}
+	var n int64
+	if err := db.Model(&AturanRetensi{}).Where("entitas = ? AND jenis = ?", input.Entitas, input.Jenis).Count(&n).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Create Aturan Retensi")
+	}
+	if n > 0 {
+		return apperror.Conflict(fmt.Sprintf("Aturan retensi for %s already exists", strings.TrimSpace(input.Entitas+" "+input.Jenis)))
+	}
+	aturan := AturanRetensi{Entitas: input.Entitas, Jenis: input.Jenis, Aksi: input.Aksi, Hari: input.Hari, Aktif: input.Aktif}
+	if err := db.Create(&aturan).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Create Aturan Retensi")
+	}
+	return ctx.JSON(http.StatusCreated, map[string]interface{}{"message": "Successfully Create Aturan Retensi", "data": aturan})
+}
+
+// UpdateAturanRetensi changes the aksi, days and aktif of a rule, its
+// entitas and jenis stay.
+func (h *RetensiHandler) UpdateAturanRetensi(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	var input AturanRetensiRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+	var aturan AturanRetensi
+	if err := db.First(&aturan, input.ID).Error; err != nil {
+		return apperror.Lookup(err, "Aturan retensi not found")
+	}
+	input.Entitas, input.Jenis = aturan.Entitas, aturan.Jenis
+	if err := input.valid(); err != nil {
+		return err
+	}
+	aturan.Aksi = input.Aksi
+	aturan.Hari = input.Hari
+	aturan.Aktif = input.Aktif
+	if err := db.Save(&aturan).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Update Aturan Retensi")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Update Aturan Retensi", "data": aturan})
+}
+
+// GetLaporanRetensi is the dry run: what the active rules would purge now.
+func (h *RetensiHandler) GetLaporanRetensi(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	hasil, err := jalankanRetensi(db, time.Now(), true, nil)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Get Laporan Retensi")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get Laporan Retensi", "data": hasil})
+}
+
+// JalankanRetensi purges now what the scheduled job would purge next.
+func (h *RetensiHandler) JalankanRetensi(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	hasil, err := jalankanRetensi(db, time.Now(), false, idPengguna(ctx))
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Run Retensi")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Run Retensi", "data": hasil})
+}
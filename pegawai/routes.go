@@ -0,0 +1,367 @@
+package pegawai
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"uas/api"
+	"uas/openapi"
+	"uas/outbox"
+	"uas/referensi"
+)
+
+// rute is the route table of the service with the docs of every route.
+// v1 is served under /api/v1, lama is the root layout from before /api/v1
+// that keeps the routes v1 changed in their old shape.
+func rute(db *gorm.DB, referensiHandler *referensi.ReferensiHandler, streamHandler *StreamHandler) (v1, lama api.Routes) {
+	pegawaiHandler := NewPegawaiHandler(NewPegawaiService(db))
+	cutiHandler := NewCutiHandler(db)
+	absensiHandler := NewAbsensiHandler(db)
+	authHandler := NewAuthHandler(db)
+	perubahanHandler := NewPerubahanHandler(db)
+	profilHandler := NewProfilHandler(db)
+	duplikatHandler := NewDuplikatHandler(db)
+	dataPribadiHandler := NewDataPribadiHandler(db)
+	auditHandler := NewAuditHandler(db)
+	retensiHandler := NewRetensiHandler(db)
+	webhookHandler := NewWebhookHandler(db)
+	eventHandler := outbox.NewHandler(db)
+
+	get, post, put, del := http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete
+	pegawaiID := openapi.Param{Name: "pegawai_id", Type: int64(0)}
+	unit := openapi.Param{Name: "unit"}
+	bulan := openapi.Param{Name: "bulan", Description: "YYYY-MM, defaults to the current month"}
+	tahun := openapi.Param{Name: "tahun", Type: 0}
+	minSkor := openapi.Param{Name: "min_skor", Description: "Similarity between 0 and 1, defaults to 0.85", Type: 0.0}
+	hrd := []string{PeranAdmin, PeranHR}
+	pemeriksa := []string{PeranAdmin, PeranHR, PeranPenyetuju}
+	admin := []string{PeranAdmin}
+	masuk := []echo.MiddlewareFunc{RequirePeran()}
+	perlu := func(peran []string) []echo.MiddlewareFunc {
+		return []echo.MiddlewareFunc{RequirePeran(peran...)}
+	}
+	saya := []echo.MiddlewareFunc{RequirePegawai()}
+	diubah := "Changes to fields under an aturan persetujuan are not saved but answered with 202 and the PerubahanData waiting for approval."
+	fields := openapi.Param{Name: "fields", Description: "Comma separated fields to answer with, e.g. nama,unit. Defaults to all"}
+	arsip := &openapi.Schema{Type: "string", Format: "binary"}
+	isiArsip := "A zip of JSON files with the Pegawai, contact, family, accounts, notifikasi, leave, attendance, " +
+		"change requests, merges and audit entries, and the photo. Every export is recorded in the audit log."
+	disamarkan := "nik and tanggal_lahir are masked (3201********0001, 1990-**-**) unless the caller is admin, hr or the Pegawai themselves."
+
+	tag := "Pegawai"
+	v1 = api.Routes{
+		{Method: get, Path: "/pegawai", Handler: pegawaiHandler.GetAllPegawai,
+			Doc: openapi.Operation{Summary: "All Pegawai", Tag: tag, Description: disamarkan,
+				Query: []openapi.Param{fields}, Data: []Pegawai{}}},
+		{Method: get, Path: "/pegawai/duplikat", Handler: duplikatHandler.GetAllDuplikat, Middleware: perlu(hrd),
+			Doc: openapi.Operation{Summary: "Likely duplicate pairs among all Pegawai", Tag: tag,
+				Query: []openapi.Param{minSkor}, Data: []*KandidatDuplikat{}, Auth: true, Peran: hrd}},
+		{Method: get, Path: "/pegawai/:id", Handler: pegawaiHandler.GetPegawaiByID,
+			Doc: openapi.Operation{Summary: "Get a Pegawai", Tag: tag, Description: disamarkan,
+				Query: []openapi.Param{fields}, Data: Pegawai{}}},
+		{Method: post, Path: "/pegawai", Handler: pegawaiHandler.CreatePegawai, Middleware: perlu(hrd),
+			Doc: openapi.Operation{Summary: "Create a Pegawai", Tag: tag,
+				Description: "nik must be a valid 16 digit NIK that no other Pegawai has.",
+				Body:        PegawaiRequest{}, Status: http.StatusCreated, Data: Pegawai{}, Auth: true, Peran: hrd}},
+		{Method: put, Path: "/pegawai/:id", Handler: pegawaiHandler.UpdatePegawaiByID, Middleware: perlu(hrd),
+			Doc: openapi.Operation{Summary: "Update a Pegawai", Tag: tag, Description: diubah,
+				Body: PegawaiRequest{}, Data: Pegawai{}, Also: []int{http.StatusAccepted},
+				Extra: map[string]interface{}{"perubahan": &PerubahanData{}}, Auth: true, Peran: hrd}},
+		{Method: del, Path: "/pegawai/:id", Handler: pegawaiHandler.DeletePegawai, Middleware: perlu(hrd),
+			Doc: openapi.Operation{Summary: "Delete a Pegawai", Tag: tag, Status: http.StatusNoContent, Auth: true, Peran: hrd}},
+		{Method: get, Path: "/pegawai/:id/saldocuti", Handler: cutiHandler.GetSaldoCuti,
+			Doc: openapi.Operation{Summary: "Leave balance per jenis cuti", Tag: tag,
+				Query: []openapi.Param{tahun}, Data: []*SaldoCuti{}}},
+		{Method: get, Path: "/pegawai/:id/profil", Handler: profilHandler.GetProfil, Middleware: perlu(hrd),
+			Doc: openapi.Operation{Summary: "Pegawai with contact and family data", Tag: tag, Data: Profil{}, Auth: true, Peran: hrd}},
+		{Method: get, Path: "/pegawai/:id/datapribadi", Handler: dataPribadiHandler.ExportDataPribadi, Middleware: perlu(hrd),
+			Doc: openapi.Operation{Summary: "Everything held about a Pegawai, for a data subject request under UU PDP", Tag: tag,
+				Description: isiArsip, Response: arsip, ContentType: "application/zip", Auth: true, Peran: hrd}},
+		{Method: post, Path: "/pegawai/:id/anonimisasi", Handler: dataPribadiHandler.AnonimkanPegawai, Middleware: perlu(admin),
+			Doc: openapi.Operation{Summary: "Anonymize a former Pegawai", Tag: tag,
+				Description: "Scrubs name, NIK, birth place and photo, keeps only the year of birth, deletes contact and family data " +
+					"and blanks free text and change values. Unit, status and dates stay for the statistics. " +
+					"Answers 409 while the Pegawai is still employed.",
+				Body: AnonimisasiRequest{}, Data: Pegawai{}, Auth: true, Peran: admin}},
+		{Method: get, Path: "/audit", Handler: auditHandler.GetAllAudit, Middleware: perlu(admin),
+			Doc: openapi.Operation{Summary: "Audit log of exports and anonymizations", Tag: tag,
+				Query: []openapi.Param{{Name: "aksi"}, {Name: "entitas"}, {Name: "entitas_id", Type: int64(0)}},
+				Data:  []*Audit{}, Auth: true, Peran: admin}},
+		{Method: get, Path: "/aturanretensi", Handler: retensiHandler.GetAllAturanRetensi, Middleware: perlu(admin),
+			Doc: openapi.Operation{Summary: "How long rows are kept", Tag: tag,
+				Description: "entitas is referensi (inactive values, jenis is the referensi jenis, aksi hapus), " +
+					"pegawai (former employees, jenis is the status_pegawai, aksi anonimkan) or notifikasi (read ones, aksi hapus).",
+				Data: []*AturanRetensi{}, Auth: true, Peran: admin}},
+		{Method: post, Path: "/aturanretensi", Handler: retensiHandler.CreateAturanRetensi, Middleware: perlu(admin),
+			Doc: openapi.Operation{Summary: "Add a retention rule", Tag: tag,
+				Body: AturanRetensiRequest{}, Status: http.StatusCreated, Data: AturanRetensi{}, Auth: true, Peran: admin}},
+		{Method: put, Path: "/aturanretensi/:id", Handler: retensiHandler.UpdateAturanRetensi, Middleware: perlu(admin),
+			Doc: openapi.Operation{Summary: "Change a retention rule", Tag: tag, Description: "entitas and jenis in the body are ignored.",
+				Body: AturanRetensiRequest{}, Data: AturanRetensi{}, Auth: true, Peran: admin}},
+		{Method: get, Path: "/retensi", Handler: retensiHandler.GetLaporanRetensi, Middleware: perlu(admin),
+			Doc: openapi.Operation{Summary: "Dry run of the retention rules", Tag: tag,
+				Description: "The rows the active rules would purge now, nothing is changed.",
+				Data:        []*HasilRetensi{}, Auth: true, Peran: admin}},
+		{Method: post, Path: "/retensi", Handler: retensiHandler.JalankanRetensi, Middleware: perlu(admin),
+			Doc: openapi.Operation{Summary: "Apply the retention rules now", Tag: tag,
+				Description: "Every purged row gets an audit entry. The rules also run every RETENTION_INTERVAL.",
+				Data:        []*HasilRetensi{}, Auth: true, Peran: admin}},
+		{Method: get, Path: "/pegawai/:id/duplikat", Handler: duplikatHandler.GetDuplikatByID, Middleware: perlu(hrd),
+			Doc: openapi.Operation{Summary: "Likely duplicates of one Pegawai", Tag: tag,
+				Query: []openapi.Param{minSkor}, Data: []*KandidatDuplikat{}, Auth: true, Peran: hrd}},
+		{Method: get, Path: "/pegawai/:id/gabung", Handler: duplikatHandler.GetPenggabungan, Middleware: perlu(hrd),
+			Doc: openapi.Operation{Summary: "Merges into a Pegawai", Tag: tag,
+				Data: []*PenggabunganPegawai{}, Auth: true, Peran: hrd}},
+		{Method: post, Path: "/pegawai/:id/gabung", Handler: duplikatHandler.GabungPegawai, Middleware: perlu(hrd),
+			Doc: openapi.Operation{Summary: "Merge another Pegawai into this one", Tag: tag,
+				Description: "The source Pegawai is deleted, its references are moved to the target. " +
+					"Values taken over for fields under an aturan persetujuan are answered with 202 and the PerubahanData waiting for approval.",
+				Body: GabungPegawaiRequest{}, Data: Pegawai{}, Also: []int{http.StatusAccepted},
+				Extra: map[string]interface{}{"penggabungan": PenggabunganPegawai{}, "perubahan": &PerubahanData{}},
+				Auth:  true, Peran: hrd}},
+	}
+
+	v1 = append(v1, referensiHandler.Routes().GuardWrites(hrd, perlu(hrd)...)...)
+
+	tag = "Cuti"
+	kepala := "Only the kepala unit of the requester, logged in with the pengguna linked to them, and never for their own request."
+	v1 = append(v1, api.Routes{
+		{Method: get, Path: "/jeniscuti", Handler: cutiHandler.GetAllJenisCuti,
+			Doc: openapi.Operation{Summary: "All jenis cuti", Tag: tag, Data: []*JenisCuti{}}},
+		{Method: post, Path: "/jeniscuti", Handler: cutiHandler.CreateJenisCuti, Middleware: perlu(hrd),
+			Doc: openapi.Operation{Summary: "Create a jenis cuti", Tag: tag, Body: JenisCutiRequest{}, Status: http.StatusCreated, Data: JenisCuti{}, Auth: true, Peran: hrd}},
+		{Method: put, Path: "/jeniscuti/:id", Handler: cutiHandler.UpdateJenisCuti, Middleware: perlu(hrd),
+			Doc: openapi.Operation{Summary: "Update a jenis cuti", Tag: tag, Body: JenisCutiRequest{}, Data: JenisCuti{}, Auth: true, Peran: hrd}},
+		{Method: del, Path: "/jeniscuti/:id", Handler: cutiHandler.DeleteJenisCuti, Middleware: perlu(hrd),
+			Doc: openapi.Operation{Summary: "Delete a jenis cuti", Tag: tag, Status: http.StatusNoContent, Auth: true, Peran: hrd}},
+		{Method: get, Path: "/jatahcuti", Handler: cutiHandler.GetAllJatahCuti,
+			Doc: openapi.Operation{Summary: "All jatah cuti", Tag: tag,
+				Query: []openapi.Param{{Name: "jenis_pegawai"}, tahun}, Data: []*JatahCuti{}}},
+		{Method: post, Path: "/jatahcuti", Handler: cutiHandler.CreateJatahCuti, Middleware: perlu(hrd),
+			Doc: openapi.Operation{Summary: "Create a jatah cuti", Tag: tag, Body: JatahCutiRequest{}, Status: http.StatusCreated, Data: JatahCuti{}, Auth: true, Peran: hrd}},
+		{Method: put, Path: "/jatahcuti/:id", Handler: cutiHandler.UpdateJatahCuti, Middleware: perlu(hrd),
+			Doc: openapi.Operation{Summary: "Update a jatah cuti", Tag: tag, Body: JatahCutiRequest{}, Data: JatahCuti{}, Auth: true, Peran: hrd}},
+		{Method: del, Path: "/jatahcuti/:id", Handler: cutiHandler.DeleteJatahCuti, Middleware: perlu(hrd),
+			Doc: openapi.Operation{Summary: "Delete a jatah cuti", Tag: tag, Status: http.StatusNoContent, Auth: true, Peran: hrd}},
+		{Method: get, Path: "/kepalaunit", Handler: cutiHandler.GetAllKepalaUnit,
+			Doc: openapi.Operation{Summary: "All kepala unit", Tag: tag, Data: []*KepalaUnit{}}},
+		{Method: put, Path: "/kepalaunit/:unit", Handler: cutiHandler.SetKepalaUnit, Middleware: perlu(hrd),
+			Doc: openapi.Operation{Summary: "Set the kepala of a unit", Tag: tag,
+				Description: "Replaces the current kepala of the unit, who approves its leave requests. The unit in the body is ignored.",
+				Body:        KepalaUnitRequest{}, Data: KepalaUnit{}, Auth: true, Peran: hrd}},
+		{Method: del, Path: "/kepalaunit/:id", Handler: cutiHandler.DeleteKepalaUnit, Middleware: perlu(hrd),
+			Doc: openapi.Operation{Summary: "Delete a kepala unit", Tag: tag, Status: http.StatusNoContent, Auth: true, Peran: hrd}},
+		{Method: get, Path: "/cuti", Handler: cutiHandler.GetAllPengajuanCuti,
+			Doc: openapi.Operation{Summary: "All pengajuan cuti", Tag: tag,
+				Query: []openapi.Param{pegawaiID, {Name: "status"}, unit}, Data: []*PengajuanCuti{}}},
+		{Method: get, Path: "/cuti/kalender", Handler: cutiHandler.GetKalenderCuti,
+			Doc: openapi.Operation{Summary: "Who in a unit is on approved leave, per day", Tag: tag,
+				Query: []openapi.Param{unit, bulan}, Data: map[string][]KalenderCuti{},
+				Extra: map[string]interface{}{"unit": "", "bulan": ""}}},
+		{Method: get, Path: "/cuti/:id", Handler: cutiHandler.GetPengajuanCutiByID,
+			Doc: openapi.Operation{Summary: "Get a pengajuan cuti", Tag: tag, Data: PengajuanCuti{}}},
+		{Method: post, Path: "/cuti", Handler: cutiHandler.CreatePengajuanCuti, Middleware: saya,
+			Doc: openapi.Operation{Summary: "Request leave", Tag: tag,
+				Description: "For the Pegawai linked to your pengguna. Dates are YYYY-MM-DD. The working days are checked against the saldo cuti.",
+				Body:        PengajuanCutiRequest{}, Status: http.StatusCreated, Data: PengajuanCuti{}, Auth: true}},
+		{Method: put, Path: "/cuti/:id/setujui", Handler: cutiHandler.ApprovePengajuanCuti, Middleware: masuk,
+			Doc: openapi.Operation{Summary: "Approve a pengajuan cuti", Tag: tag, Description: kepala,
+				Body: PersetujuanCutiRequest{}, Data: PengajuanCuti{}, Auth: true}},
+		{Method: put, Path: "/cuti/:id/tolak", Handler: cutiHandler.RejectPengajuanCuti, Middleware: masuk,
+			Doc: openapi.Operation{Summary: "Reject a pengajuan cuti", Tag: tag, Description: kepala,
+				Body: PersetujuanCutiRequest{}, Data: PengajuanCuti{}, Auth: true}},
+		{Method: put, Path: "/cuti/:id/batal", Handler: cutiHandler.CancelPengajuanCuti, Middleware: masuk,
+			Doc: openapi.Operation{Summary: "Cancel a pengajuan cuti", Tag: tag,
+				Description: "Only the requester, or admin and hr. Approved leave only before it starts.",
+				Data:        PengajuanCuti{}, Auth: true}},
+	}...)
+
+	tag = "Absensi"
+	v1 = append(v1, api.Routes{
+		{Method: get, Path: "/harilibur", Handler: absensiHandler.GetAllHariLibur,
+			Doc: openapi.Operation{Summary: "All hari libur", Tag: tag, Query: []openapi.Param{tahun}, Data: []*HariLibur{}}},
+		{Method: post, Path: "/harilibur", Handler: absensiHandler.CreateHariLibur, Middleware: perlu(hrd),
+			Doc: openapi.Operation{Summary: "Create a hari libur", Tag: tag, Body: HariLiburRequest{}, Status: http.StatusCreated, Data: HariLibur{}, Auth: true, Peran: hrd}},
+		{Method: del, Path: "/harilibur/:id", Handler: absensiHandler.DeleteHariLibur, Middleware: perlu(hrd),
+			Doc: openapi.Operation{Summary: "Delete a hari libur", Tag: tag, Status: http.StatusNoContent, Auth: true, Peran: hrd}},
+		{Method: get, Path: "/jadwalkerja", Handler: absensiHandler.GetAllJadwalKerja,
+			Doc: openapi.Operation{Summary: "All jadwal kerja", Tag: tag,
+				Description: "default is the schedule of units without one of their own.",
+				Data:        []*JadwalKerja{}, Extra: map[string]interface{}{"default": JadwalKerja{}}}},
+		{Method: post, Path: "/jadwalkerja", Handler: absensiHandler.CreateJadwalKerja, Middleware: perlu(hrd),
+			Doc: openapi.Operation{Summary: "Create a jadwal kerja", Tag: tag, Body: JadwalKerjaRequest{}, Status: http.StatusCreated, Data: JadwalKerja{}, Auth: true, Peran: hrd}},
+		{Method: put, Path: "/jadwalkerja/:id", Handler: absensiHandler.UpdateJadwalKerja, Middleware: perlu(hrd),
+			Doc: openapi.Operation{Summary: "Update a jadwal kerja", Tag: tag, Body: JadwalKerjaRequest{}, Data: JadwalKerja{}, Auth: true, Peran: hrd}},
+		{Method: del, Path: "/jadwalkerja/:id", Handler: absensiHandler.DeleteJadwalKerja, Middleware: perlu(hrd),
+			Doc: openapi.Operation{Summary: "Delete a jadwal kerja", Tag: tag, Status: http.StatusNoContent, Auth: true, Peran: hrd}},
+		{Method: get, Path: "/absensi", Handler: absensiHandler.GetAllAbsensi,
+			Doc: openapi.Operation{Summary: "All absensi", Tag: tag,
+				Query: []openapi.Param{pegawaiID, {Name: "tanggal", Description: "YYYY-MM-DD"}}, Data: []*Absensi{}}},
+		{Method: get, Path: "/absensi/rekap", Handler: absensiHandler.GetRekapAbsensi, Middleware: masuk,
+			Doc: openapi.Operation{Summary: "Monthly attendance recap", Tag: tag,
+				Description: "With pegawai_id the recap of one Pegawai including the daily details, with unit a list with one recap per Pegawai. " +
+					"Only admin and hr see the recap of others.",
+				Query: []openapi.Param{pegawaiID, unit, bulan}, Data: RekapAbsensi{}, Auth: true}},
+		{Method: post, Path: "/absensi/masuk", Handler: absensiHandler.CheckIn, Middleware: saya,
+			Doc: openapi.Operation{Summary: "Check in", Tag: tag, Description: "For the Pegawai linked to your pengguna.",
+				Status: http.StatusCreated, Data: Absensi{}, Auth: true}},
+		{Method: post, Path: "/absensi/pulang", Handler: absensiHandler.CheckOut, Middleware: saya,
+			Doc: openapi.Operation{Summary: "Check out", Tag: tag, Description: "For the Pegawai linked to your pengguna.",
+				Data: Absensi{}, Auth: true}},
+		{Method: put, Path: "/absensi/:id", Handler: absensiHandler.UpdateAbsensi, Middleware: perlu(hrd),
+			Doc: openapi.Operation{Summary: "Correct an absensi", Tag: tag, Description: "Absent fields are left as they are.",
+				Body: AbsensiRequest{}, Data: Absensi{}, Auth: true, Peran: hrd}},
+	}...)
+
+	tag = "Auth"
+	v1 = append(v1, api.Routes{
+		{Method: post, Path: "/login", Handler: authHandler.Login,
+			Doc: openapi.Operation{Summary: "Log in", Tag: tag,
+				Description: "Send the token as Authorization: Bearer <token>.",
+				Body:        LoginRequest{}, Data: map[string]interface{}{"token": "", "expires_at": time.Time{}, "pengguna": Pengguna{}}}},
+		{Method: post, Path: "/logout", Handler: authHandler.Logout, Middleware: masuk,
+			Doc: openapi.Operation{Summary: "Log out", Tag: tag, Status: http.StatusNoContent, Auth: true}},
+		{Method: get, Path: "/pengguna", Handler: authHandler.GetAllPengguna, Middleware: perlu(admin),
+			Doc: openapi.Operation{Summary: "All pengguna", Tag: tag, Data: []*Pengguna{}, Auth: true, Peran: admin}},
+		{Method: post, Path: "/pengguna", Handler: authHandler.CreatePengguna, Middleware: perlu(admin),
+			Doc: openapi.Operation{Summary: "Create a pengguna", Tag: tag, Body: PenggunaRequest{}, Status: http.StatusCreated, Data: Pengguna{}, Auth: true, Peran: admin}},
+		{Method: put, Path: "/pengguna/:id", Handler: authHandler.UpdatePengguna, Middleware: perlu(admin),
+			Doc: openapi.Operation{Summary: "Update a pengguna", Tag: tag,
+				Description: "An empty password keeps the current one. A new peran or password logs the pengguna out everywhere.",
+				Body:        PenggunaRequest{}, Data: Pengguna{}, Auth: true, Peran: admin}},
+		{Method: del, Path: "/pengguna/:id", Handler: authHandler.DeletePengguna, Middleware: perlu(admin),
+			Doc: openapi.Operation{Summary: "Delete a pengguna", Tag: tag, Status: http.StatusNoContent, Auth: true, Peran: admin}},
+	}...)
+
+	tag = "Webhook"
+	v1 = append(v1, api.Routes{
+		{Method: get, Path: "/webhook", Handler: webhookHandler.GetAllWebhook, Middleware: perlu(admin),
+			Doc: openapi.Operation{Summary: "Subscriptions to Pegawai events", Tag: tag, Data: []*Webhook{}, Auth: true, Peran: admin}},
+		{Method: post, Path: "/webhook", Handler: webhookHandler.CreateWebhook, Middleware: perlu(admin),
+			Doc: openapi.Operation{Summary: "Subscribe a URL to Pegawai events", Tag: tag,
+				Description: "events are pegawai.created, pegawai.updated and pegawai.deleted, none means all. " +
+					"Events are POSTed as {event, created_at, data} with X-Webhook-Event, X-Webhook-Delivery and " +
+					"X-Webhook-Signature: t=<unix time>,v1=<hex HMAC-SHA256 of \"<t>.<body>\" with rahasia>. " +
+					"A delivery not answered with 2xx is retried 8 times with growing pauses. rahasia is only shown in this response.",
+				Body: WebhookRequest{}, Status: http.StatusCreated, Data: Webhook{}, Auth: true, Peran: admin}},
+		{Method: put, Path: "/webhook/:id", Handler: webhookHandler.UpdateWebhook, Middleware: perlu(admin),
+			Doc: openapi.Operation{Summary: "Change a subscription", Tag: tag, Body: WebhookRequest{}, Data: Webhook{}, Auth: true, Peran: admin}},
+		{Method: del, Path: "/webhook/:id", Handler: webhookHandler.DeleteWebhook, Middleware: perlu(admin),
+			Doc: openapi.Operation{Summary: "Remove a subscription and its deliveries", Tag: tag, Status: http.StatusNoContent, Auth: true, Peran: admin}},
+		{Method: get, Path: "/webhook/:id/pengiriman", Handler: webhookHandler.GetAllPengiriman, Middleware: perlu(admin),
+			Doc: openapi.Operation{Summary: "Delivery log of a subscription", Tag: tag,
+				Query: []openapi.Param{{Name: "status", Description: "menunggu, terkirim or gagal"}}, Data: []*PengirimanWebhook{}, Auth: true, Peran: admin}},
+		{Method: post, Path: "/webhook/:id/pengiriman/:pengiriman/ulang", Handler: webhookHandler.KirimUlang, Middleware: perlu(admin),
+			Doc: openapi.Operation{Summary: "Send a delivery again now", Tag: tag,
+				Description: "Whatever its status, with the same X-Webhook-Delivery. The attempt counts in percobaan, a delivery " +
+					"being sent already or of an inactive webhook is a 409. Answers with the outcome of the attempt.",
+				Data: PengirimanWebhook{}, Auth: true, Peran: admin}},
+		{Method: get, Path: "/events", Handler: eventHandler.GetEvents, Middleware: perlu(hrd),
+			Doc: openapi.Operation{Summary: "Changes of Pegawai and referensi since an event", Tag: tag,
+				Description: "For consumers that cannot receive webhooks. Every create, update and delete of a Pegawai or " +
+					"referensi value is an event, oldest first, data is the row after the change or before a delete. " +
+					"Send next of the last answer as after to resume.",
+				Query: []openapi.Param{
+					{Name: "after", Description: "Id of the last event seen, 0 for all", Type: int64(0)},
+					{Name: "limit", Description: "1 to 1000, defaults to 100", Type: 0},
+					{Name: "resource", Description: "Comma-separated, pegawai or referensi"},
+				},
+				Data: []outbox.Event{}, Extra: map[string]interface{}{"next": int64(0)}, Auth: true, Peran: hrd}},
+		{Method: get, Path: "/events/stream", Handler: streamHandler.StreamEvents, Middleware: masuk,
+			Doc: openapi.Operation{Summary: "Push changes of Pegawai and referensi as server-sent events", Tag: tag,
+				Description: "A text/event-stream for dashboards, in place of polling GET /pegawai. Every event has the outbox id as id, " +
+					"the event (pegawai.updated, referensi.created, ...) as event and a PesanStream JSON as data; " +
+					"fetch the row itself to show it. Reconnecting with Last-Event-ID first sends the events missed since. " +
+					"unit only narrows Pegawai events. A client that falls far behind is disconnected and should reconnect.",
+				Query: []openapi.Param{
+					{Name: "unit", Description: "Only Pegawai of this unit"},
+					{Name: "resource", Description: "Comma-separated, pegawai or referensi"},
+				},
+				Response: &openapi.Schema{Type: "string"}, ContentType: "text/event-stream", Auth: true}},
+	}...)
+
+	tag = "Perubahan"
+	v1 = append(v1, api.Routes{
+		{Method: get, Path: "/aturanpersetujuan", Handler: perubahanHandler.GetAllAturanPersetujuan,
+			Doc: openapi.Operation{Summary: "Which Pegawai fields need approval", Tag: tag, Data: []*AturanPersetujuan{}}},
+		{Method: put, Path: "/aturanpersetujuan/:field", Handler: perubahanHandler.SetAturanPersetujuan, Middleware: perlu(admin),
+			Doc: openapi.Operation{Summary: "Set the rule of one field", Tag: tag, Description: "The field in the body is ignored.",
+				Body: AturanPersetujuanRequest{}, Data: AturanPersetujuan{}, Auth: true, Peran: admin}},
+		{Method: get, Path: "/perubahan", Handler: perubahanHandler.GetAllPerubahan, Middleware: perlu(pemeriksa),
+			Doc: openapi.Operation{Summary: "All change requests", Tag: tag,
+				Query: []openapi.Param{pegawaiID, {Name: "status"}}, Data: []*PerubahanData{}, Auth: true, Peran: pemeriksa}},
+		{Method: get, Path: "/perubahan/:id", Handler: perubahanHandler.GetPerubahanByID, Middleware: perlu(pemeriksa),
+			Doc: openapi.Operation{Summary: "Get a change request with its comments and history", Tag: tag,
+				Data: PerubahanData{}, Extra: map[string]interface{}{"komentar": []*KomentarPerubahan{}, "riwayat": []*RiwayatPerubahan{}},
+				Auth: true, Peran: pemeriksa}},
+		{Method: post, Path: "/perubahan/:id/komentar", Handler: perubahanHandler.CreateKomentar, Middleware: perlu(pemeriksa),
+			Doc: openapi.Operation{Summary: "Comment on a change request", Tag: tag,
+				Body: KomentarPerubahanRequest{}, Status: http.StatusCreated, Data: KomentarPerubahan{}, Auth: true, Peran: pemeriksa}},
+		{Method: put, Path: "/perubahan/:id/setujui", Handler: perubahanHandler.ApprovePerubahan, Middleware: perlu(pemeriksa),
+			Doc: openapi.Operation{Summary: "Approve a change request", Tag: tag,
+				Description: "Admins decide any change request, other peran only those whose changed fields all name their peran " +
+					"in the aturan persetujuan. Nobody decides their own.",
+				Body: KeputusanPerubahanRequest{}, Data: PerubahanData{}, Auth: true, Peran: pemeriksa}},
+		{Method: put, Path: "/perubahan/:id/tolak", Handler: perubahanHandler.RejectPerubahan, Middleware: perlu(pemeriksa),
+			Doc: openapi.Operation{Summary: "Reject a change request", Tag: tag,
+				Body: KeputusanPerubahanRequest{}, Data: PerubahanData{}, Auth: true, Peran: pemeriksa}},
+		{Method: put, Path: "/perubahan/:id/batal", Handler: perubahanHandler.CancelPerubahan, Middleware: masuk,
+			Doc: openapi.Operation{Summary: "Withdraw your own change request", Tag: tag, Data: PerubahanData{}, Auth: true}},
+		{Method: get, Path: "/notifikasi", Handler: perubahanHandler.GetAllNotifikasi, Middleware: masuk,
+			Doc: openapi.Operation{Summary: "Your notifikasi", Tag: tag,
+				Query: []openapi.Param{{Name: "belum_dibaca", Description: "true lists only unread ones", Type: false}}, Data: []*Notifikasi{}, Auth: true}},
+		{Method: put, Path: "/notifikasi/:id/baca", Handler: perubahanHandler.ReadNotifikasi, Middleware: masuk,
+			Doc: openapi.Operation{Summary: "Mark a notifikasi as read", Tag: tag, Status: http.StatusNoContent, Auth: true}},
+	}...)
+
+	tag = "Profil saya"
+	swalayan := "Changes to fields under an aturan persetujuan are answered with 202 and the PerubahanData waiting for approval."
+	v1 = append(v1, api.Routes{
+		{Method: get, Path: "/me", Handler: profilHandler.GetMe, Middleware: saya,
+			Doc: openapi.Operation{Summary: "Your own profile", Tag: tag,
+				Description: "swalayan maps the fields you may change yourself to how they are handled.",
+				Data:        Profil{}, Extra: map[string]interface{}{"swalayan": map[string]string{}}, Auth: true}},
+		{Method: put, Path: "/me/kontak", Handler: profilHandler.UpdateKontakSaya, Middleware: saya,
+			Doc: openapi.Operation{Summary: "Change your contact data", Tag: tag, Description: swalayan,
+				Body: KontakRequest{}, Data: Profil{}, Also: []int{http.StatusAccepted}, Extra: map[string]interface{}{"perubahan": &PerubahanData{}}, Auth: true}},
+		{Method: put, Path: "/me/foto", Handler: profilHandler.UpdateFotoSaya, Middleware: saya,
+			Doc: openapi.Operation{Summary: "Change your photo", Tag: tag, Description: swalayan,
+				Body: FotoRequest{}, Data: Profil{}, Also: []int{http.StatusAccepted}, Extra: map[string]interface{}{"perubahan": &PerubahanData{}}, Auth: true}},
+		{Method: put, Path: "/me/keluarga", Handler: profilHandler.UpdateKeluargaSaya, Middleware: saya,
+			Doc: openapi.Operation{Summary: "Replace your family members", Tag: tag, Description: swalayan,
+				Body: []AnggotaKeluargaRequest{}, Data: Profil{}, Also: []int{http.StatusAccepted}, Extra: map[string]interface{}{"perubahan": &PerubahanData{}}, Auth: true}},
+		{Method: get, Path: "/me/datapribadi", Handler: dataPribadiHandler.ExportDataPribadiSaya, Middleware: saya,
+			Doc: openapi.Operation{Summary: "Everything held about you", Tag: tag,
+				Description: isiArsip, Response: arsip, ContentType: "application/zip", Auth: true}},
+		{Method: get, Path: "/me/perubahan", Handler: profilHandler.GetPerubahanSaya, Middleware: saya,
+			Doc: openapi.Operation{Summary: "Your change requests", Tag: tag, Data: []*PerubahanData{}, Auth: true}},
+	}...)
+
+	// The root layout names the record to update in the body where v1 has
+	// it in the path.
+	lama = v1.
+		Without(put, "/pegawai/:id").
+		Without(put, "/kepalaunit/:unit").
+		Without(put, "/aturanpersetujuan/:field").
+		With(
+			api.Route{Method: put, Path: "/pegawai", Handler: pegawaiHandler.UpdatePegawai, Middleware: perlu(hrd),
+				Successor: "/pegawai/:id",
+				Doc: openapi.Operation{Summary: "Update a Pegawai", Tag: "Pegawai",
+					Description: "The id is sent in the body. " + diubah,
+					Body:        PegawaiRequest{}, Data: Pegawai{}, Also: []int{http.StatusAccepted},
+					Extra: map[string]interface{}{"perubahan": &PerubahanData{}}, Auth: true, Peran: hrd}},
+			api.Route{Method: put, Path: "/kepalaunit", Handler: cutiHandler.SetKepalaUnit, Middleware: perlu(hrd),
+				Successor: "/kepalaunit/:unit",
+				Doc: openapi.Operation{Summary: "Set the kepala of a unit", Tag: "Cuti",
+					Description: "Replaces the current kepala of the unit, who approves its leave requests.",
+					Body:        KepalaUnitRequest{}, Data: KepalaUnit{}, Auth: true, Peran: hrd}},
+			api.Route{Method: put, Path: "/aturanpersetujuan", Handler: perubahanHandler.SetAturanPersetujuan, Middleware: perlu(admin),
+				Successor: "/aturanpersetujuan/:field",
+				Doc: openapi.Operation{Summary: "Set the rule of one field", Tag: "Perubahan",
+					Body: AturanPersetujuanRequest{}, Data: AturanPersetujuan{}, Auth: true, Peran: admin}},
+		)
+	return v1, lama
+}
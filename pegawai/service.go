@@ -0,0 +1,134 @@
+package pegawai
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"uas/apperror"
+	"uas/repository"
+)
+
+// PegawaiService holds the rules around Pegawai records: the NIK is
+// normalized, valid and unique, and sensitive fields only change through an
+// approved PerubahanData.
+type PegawaiService interface {
+	List(ctx context.Context) ([]Pegawai, error)
+	Get(ctx context.Context, id int64) (*Pegawai, error)
+	Create(ctx context.Context, pegawai *Pegawai) error
+	// Update saves pegawai. Changes to fields that need approval are kept
+	// back and returned as a pending PerubahanData instead.
+	Update(ctx context.Context, pegawai *Pegawai, pengaju *Pengguna) (*PerubahanData, error)
+	Delete(ctx context.Context, id int64) error
+	// Headcount counts the Pegawai per status_pegawai.
+	Headcount(ctx context.Context) (map[string]float64, error)
+}
+
+type pegawaiService struct {
+	db   *gorm.DB
+	repo repository.Repository[Pegawai]
+}
+
+func NewPegawaiService(db *gorm.DB) PegawaiService {
+	return &pegawaiService{db: db, repo: repository.NewGorm[Pegawai](db)}
+}
+
+func (s *pegawaiService) List(ctx context.Context) ([]Pegawai, error) {
+	return s.repo.List(ctx, repository.ListOptions{})
+}
+
+func (s *pegawaiService) Get(ctx context.Context, id int64) (*Pegawai, error) {
+	return s.repo.Get(ctx, id)
+}
+
+// cekNIK normalizes the NIK of pegawai and checks no other Pegawai uses it.
+func (s *pegawaiService) cekNIK(ctx context.Context, pegawai *Pegawai) error {
+	if !validNIK(pegawai.Nik) {
+		return apperror.Validation("Invalid nik, expected 16 digits")
+	}
+	terpakai, err := nikTerpakai(s.db.WithContext(ctx), pegawai.Nik, pegawai.ID)
+	if err != nil {
+		return err
+	}
+	if terpakai {
+		return apperror.Conflict("NIK is already used by another Pegawai")
+	}
+	return nil
+}
+
+func (s *pegawaiService) Create(ctx context.Context, pegawai *Pegawai) error {
+	pegawai.Nik = normalisasiNIK(pegawai.Nik)
+	if err := s.cekNIK(ctx, pegawai); err != nil {
+		return err
+	}
+	return s.repo.Create(ctx, pegawai)
+}
+
+func (s *pegawaiService) Update(ctx context.Context, pegawai *Pegawai, pengaju *Pengguna) (*PerubahanData, error) {
+	existing, err := s.repo.Get(ctx, pegawai.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// a caller that was answered the masked values sends them back as they
+	// were, they are not a change
+	if pegawai.Nik == samarkanNIK(existing.Nik) {
+		pegawai.Nik = existing.Nik
+	}
+	if pegawai.Tanggal_lahir == samarkanTanggal(existing.Tanggal_lahir) {
+		pegawai.Tanggal_lahir = existing.Tanggal_lahir
+	}
+	pegawai.Nik = normalisasiNIK(pegawai.Nik)
+	if pegawai.Nik != existing.Nik {
+		if err := s.cekNIK(ctx, pegawai); err != nil {
+			return nil, err
+		}
+	}
+	pegawai.CreatedAt = existing.CreatedAt
+
+	// Sensitive fields wait for approval, the others are applied right away
+	db := s.db.WithContext(ctx)
+	perubahan, err := ajukanPerubahan(db, existing, pegawai, pengaju)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(pegawai).Error; err != nil {
+			return err
+		}
+		if perubahan != nil {
+			return simpanPerubahan(tx, perubahan)
+		}
+		return nil
+	})
+	var tertunda *errPerubahanTertunda
+	if errors.As(err, &tertunda) {
+		return nil, apperror.Conflict(tertunda.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return perubahan, nil
+}
+
+func (s *pegawaiService) Delete(ctx context.Context, id int64) error {
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *pegawaiService) Headcount(ctx context.Context) (map[string]float64, error) {
+	var rows []struct {
+		StatusPegawai string
+		Jumlah        int64
+	}
+	err := s.db.WithContext(ctx).Model(&Pegawai{}).
+		Select("status_pegawai, COUNT(*) AS jumlah").Group("status_pegawai").Scan(&rows).Error
+	if err != nil {
+		return nil, apperror.Wrap(err, "Failed to Count Pegawai")
+	}
+	headcount := make(map[string]float64, len(rows))
+	for _, r := range rows {
+		headcount[r.StatusPegawai] = float64(r.Jumlah)
+	}
+	return headcount, nil
+}
@@ -0,0 +1,172 @@
+package pegawai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"uas/apperror"
+	"uas/outbox"
+)
+
+// sumberStream are the resources GET /events/stream can be narrowed to.
+var sumberStream = []string{sumberPegawai, "referensi"}
+
+// jedaPing is how often an idle stream gets a comment, so proxies do not
+// close it.
+var jedaPing = 15 * time.Second
+
+// PesanStream is the data of one server-sent event: what changed, not the
+// row itself, the dashboard reloads what it shows.
+type PesanStream struct {
+	ID         int64  `json:"id"`
+	Event      string `json:"event"`
+	Resource   string `json:"resource"`
+	ResourceID int64  `json:"resource_id"`
+	// Unit of the Pegawai, after the change or before a delete.
+	Unit string `json:"unit,omitempty"`
+}
+
+// filterStream is what a subscriber asked for, empty means everything.
+type filterStream struct {
+	unit     string
+	resource []string
+}
+
+// pesan returns the message of e, false when the filter leaves it out.
+// unit only narrows the Pegawai, the other resources belong to no unit.
+func (f filterStream) pesan(e outbox.Event) (PesanStream, bool) {
+	p := PesanStream{ID: e.ID, Event: e.Event, Resource: e.Resource, ResourceID: e.ResourceID}
+	if len(f.resource) > 0 && !slices.Contains(f.resource, e.Resource) {
+		return p, false
+	}
+	if e.Resource == sumberPegawai {
+		var data struct {
+			Unit string `json:"unit"`
+		}
+		if err := json.Unmarshal(e.Data, &data); err == nil {
+			p.Unit = data.Unit
+		}
+		if f.unit != "" && !strings.EqualFold(p.Unit, f.unit) {
+			return p, false
+		}
+	}
+	return p, true
+}
+
+type StreamHandler struct {
+	db     *gorm.DB
+	broker *outbox.Broker
+}
+
+func NewStreamHandler(db *gorm.DB, broker *outbox.Broker) *StreamHandler {
+	return &StreamHandler{db: db, broker: broker}
+}
+
+// StreamEvents pushes the changes of Pegawai and referensi as server-sent
+// events until the client goes away. The id of every event is its outbox
+// id, a client reconnecting with Last-Event-ID first gets what it missed.
+func (h *StreamHandler) StreamEvents(ctx echo.Context) error {
+	f := filterStream{unit: strings.TrimSpace(ctx.QueryParam("unit"))}
+	for _, r := range strings.Split(ctx.QueryParam("resource"), ",") {
+		if r = strings.TrimSpace(r); r == "" {
+			continue
+		}
+		if !slices.Contains(sumberStream, r) {
+			return apperror.Validation("Invalid resource " + r + ", expected some of " + strings.Join(sumberStream, ", "))
+		}
+		f.resource = append(f.resource, r)
+	}
+	var terakhir int64
+	if v := ctx.Request().Header.Get("Last-Event-ID"); v != "" {
+		var err error
+		if terakhir, err = strconv.ParseInt(v, 10, 64); err != nil || terakhir < 0 {
+			return apperror.Validation("Invalid Last-Event-ID, expected an event id")
+		}
+	}
+
+	// subscribed before catching up, so nothing falls between the two
+	sub, err := h.broker.Subscribe()
+	if errors.Is(err, outbox.ErrClosed) {
+		return apperror.Unavailable("Server is shutting down")
+	}
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Stream Events")
+	}
+	defer sub.Close()
+
+	res := ctx.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	kirim := func(e outbox.Event) error {
+		terakhir = e.ID
+		p, ok := f.pesan(e)
+		if !ok {
+			return nil
+		}
+		data, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(res, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Event, data); err != nil {
+			return err
+		}
+		res.Flush()
+		return nil
+	}
+
+	db := h.db.WithContext(ctx.Request().Context())
+	for terakhir > 0 {
+		events, err := outbox.After(db, terakhir, outbox.MaxLimit, f.resource...)
+		if err != nil {
+			// the status is already sent, the client reconnects and tries again
+			return nil
+		}
+		for _, e := range events {
+			if err := kirim(e); err != nil {
+				return nil
+			}
+		}
+		if len(events) < outbox.MaxLimit {
+			break
+		}
+	}
+
+	ping := time.NewTicker(jedaPing)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Request().Context().Done():
+			return nil
+		case <-ping.C:
+			if _, err := fmt.Fprint(res, ": ping\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		case e, ok := <-sub.C:
+			if !ok {
+				// dropped for falling behind or the server is stopping
+				return nil
+			}
+			// what catching up already sent comes again from the broker
+			if e.ID <= terakhir {
+				continue
+			}
+			if err := kirim(e); err != nil {
+				return nil
+			}
+		}
+	}
+}
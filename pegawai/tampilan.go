@@ -0,0 +1,54 @@
+package pegawai
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"uas/api"
+)
+
+// peranLihatData are the roles that see the NIK and birth date of every
+// Pegawai, everyone else only sees their own.
+var peranLihatData = []string{PeranAdmin, PeranHR}
+
+// bentukPegawai is how a Pegawai is answered: masked unless the caller may
+// see it, and limited to ?fields= where a handler supports it.
+var bentukPegawai = api.Shape{
+	Model:  Pegawai{},
+	Masks:  map[string]func(string) string{"nik": samarkanNIK, "tanggal_lahir": samarkanTanggal},
+	Reveal: bolehLihat,
+}
+
+// samarkanNIK keeps the first and last four digits of a NIK, the rest
+// becomes *: 3201********0001.
+func samarkanNIK(nik string) string {
+	if len(nik) <= 8 {
+		return strings.Repeat("*", len(nik))
+	}
+	return nik[:4] + strings.Repeat("*", len(nik)-8) + nik[len(nik)-4:]
+}
+
+// samarkanTanggal keeps the year of a YYYY-MM-DD date: 1990-**-**.
+func samarkanTanggal(tanggal string) string {
+	if len(tanggal) < 4 {
+		return strings.Repeat("*", len(tanggal))
+	}
+	return tanggal[:4] + "-**-**"
+}
+
+// bolehLihat reports whether the caller of ctx may see the Pegawai obj
+// unmasked: an admin or hr, or the Pegawai themselves.
+func bolehLihat(ctx echo.Context, obj map[string]interface{}) bool {
+	pengguna := penggunaDari(ctx)
+	if pengguna == nil {
+		return false
+	}
+	if slices.Contains(peranLihatData, pengguna.Peran) {
+		return true
+	}
+	return pengguna.PegawaiID != nil && fmt.Sprint(obj["id"]) == strconv.FormatInt(*pengguna.PegawaiID, 10)
+}
@@ -0,0 +1,434 @@
+package pegawai
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"uas/apperror"
+	"uas/outbox"
+)
+
+// sumberPegawai is the outbox resource of Pegawai.
+const sumberPegawai = "pegawai"
+
+func init() {
+	outbox.Track(&Pegawai{}, sumberPegawai)
+}
+
+// Events a Webhook can subscribe to, the outbox events of Pegawai.
+const (
+	EventPegawaiDibuat  = sumberPegawai + "." + outbox.Created
+	EventPegawaiDiubah  = sumberPegawai + "." + outbox.Updated
+	EventPegawaiDihapus = sumberPegawai + "." + outbox.Deleted
+)
+
+var daftarEvent = []string{EventPegawaiDibuat, EventPegawaiDiubah, EventPegawaiDihapus}
+
+// Status of a PengirimanWebhook.
+const (
+	StatusPengirimanMenunggu = "menunggu"
+	StatusPengirimanTerkirim = "terkirim"
+	StatusPengirimanGagal    = "gagal"
+)
+
+const (
+	// maxPercobaan is how often a delivery is tried before it is gagal.
+	maxPercobaan = 8
+	// jedaAwal is the wait after the first failure, it doubles after each
+	// further one: 30s, 1m, 2m, ... about an hour in all.
+	jedaAwal = 30 * time.Second
+	// masaKlaim keeps other replicas and KirimUlang off a delivery while it
+	// is being sent.
+	masaKlaim = time.Minute
+)
+
+// Webhook is a subscription of another system, like payroll, to the
+// lifecycle events of Pegawai. Events empty means every event. Rahasia
+// signs the payloads and is only shown when the Webhook is created.
+type Webhook struct {
+	ID        int64     `json:"id"`
+	URL       string    `json:"url" gorm:"size:500"`
+	Events    []string  `json:"events" gorm:"type:text;serializer:json"`
+	Rahasia   string    `json:"rahasia,omitempty" gorm:"size:255;serializer:encrypted"`
+	Aktif     bool      `json:"aktif"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (Webhook) TableName() string {
+	return "webhook"
+}
+
+func (w *Webhook) berlangganan(event string) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, event)
+}
+
+// PengirimanWebhook is one event to send to one Webhook, and the log of
+// the attempts so far.
+type PengirimanWebhook struct {
+	ID        int64 `json:"id"`
+	WebhookID int64 `json:"webhook_id" gorm:"index"`
+	// PegawaiID is the Pegawai of the event, anonimkan scrubs the Payload.
+	PegawaiID int64  `json:"pegawai_id" gorm:"index"`
+	Event     string `json:"event" gorm:"size:50"`
+	Payload   string `json:"payload" gorm:"type:text;serializer:encrypted"`
+	Status    string `json:"status" gorm:"size:20;index:idx_pengiriman_webhook_antre"`
+	Percobaan int    `json:"percobaan"`
+	// Berikutnya is when the next attempt is due.
+	Berikutnya    time.Time  `json:"berikutnya" gorm:"index:idx_pengiriman_webhook_antre"`
+	KodeRespons   int        `json:"kode_respons"`
+	Galat         string     `json:"galat"`
+	TerakhirKirim *time.Time `json:"terakhir_kirim"`
+	// DiklaimSampai is set while an attempt is under way, see klaim.
+	DiklaimSampai *time.Time `json:"-"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func (PengirimanWebhook) TableName() string {
+	return "pengiriman_webhook"
+}
+
+// antreWebhook queues the Pegawai events of the outbox for every active
+// Webhook subscribed to them. It runs in the transaction outbox.Dispatch
+// moves the offset of the webhook consumer in, so every event is queued
+// once.
+func antreWebhook(tx *gorm.DB, events []outbox.Event) error {
+	var webhooks []*Webhook
+	if err := tx.Where("aktif = ?", true).Find(&webhooks).Error; err != nil {
+		return err
+	}
+	for _, e := range events {
+		if e.Resource != sumberPegawai {
+			continue
+		}
+		var payload []byte
+		for _, w := range webhooks {
+			// a Webhook only hears of the changes made after it was added
+			if !w.berlangganan(e.Event) || e.CreatedAt.Before(w.CreatedAt) {
+				continue
+			}
+			if payload == nil {
+				var err error
+				payload, err = json.Marshal(map[string]interface{}{"event": e.Event, "created_at": e.CreatedAt.UTC(), "data": e.Data})
+				if err != nil {
+					return err
+				}
+			}
+			p := &PengirimanWebhook{WebhookID: w.ID, PegawaiID: e.ResourceID, Event: e.Event, Payload: string(payload), Status: StatusPengirimanMenunggu, Berikutnya: time.Now()}
+			if err := tx.Create(p).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// tandaTangan is the X-Webhook-Signature of body sent at t: the HMAC-SHA256
+// of "<unix t>.<body>" with the Rahasia of the Webhook.
+func tandaTangan(rahasia string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(rahasia))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// klienWebhook sends the deliveries, a test replaces it.
+var klienWebhook = &http.Client{Timeout: 10 * time.Second}
+
+// klaim takes p for one attempt, so another replica or a KirimUlang does
+// not send it at the same time. It fails when p changed since it was read
+// or another attempt holds it; a claim left by a crashed attempt lapses
+// after masaKlaim.
+func klaim(db *gorm.DB, p *PengirimanWebhook) (bool, error) {
+	sekarang := time.Now()
+	sampai := sekarang.Add(masaKlaim)
+	res := db.Model(p).Where("updated_at = ? AND (diklaim_sampai IS NULL OR diklaim_sampai <= ?)", p.UpdatedAt, sekarang).
+		UpdateColumn("diklaim_sampai", sampai)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return false, res.Error
+	}
+	p.DiklaimSampai = &sampai
+	return true, nil
+}
+
+// kirim makes one attempt at p, claimed with klaim, and records its outcome
+// and releases the claim. A 2xx answer is terkirim, anything else is
+// retried later until maxPercobaan.
+func kirim(ctx context.Context, db *gorm.DB, w *Webhook, p *PengirimanWebhook) error {
+	sekarang := time.Now()
+	body := []byte(p.Payload)
+	p.Percobaan++
+	p.TerakhirKirim = &sekarang
+	p.KodeRespons, p.Galat = 0, ""
+	p.DiklaimSampai = nil
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err == nil {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("X-Webhook-Event", p.Event)
+		req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(p.ID, 10))
+		req.Header.Set("X-Webhook-Signature", tandaTangan(w.Rahasia, sekarang, body))
+		var res *http.Response
+		res, err = klienWebhook.Do(req)
+		if err == nil {
+			io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+			res.Body.Close()
+			p.KodeRespons = res.StatusCode
+			if res.StatusCode < 200 || res.StatusCode > 299 {
+				err = fmt.Errorf("answered %s", res.Status)
+			}
+		}
+	}
+	switch {
+	case err == nil:
+		p.Status = StatusPengirimanTerkirim
+	case p.Percobaan >= maxPercobaan:
+		p.Status, p.Galat = StatusPengirimanGagal, err.Error()
+	default:
+		p.Status, p.Galat = StatusPengirimanMenunggu, err.Error()
+		p.Berikutnya = sekarang.Add(jedaAwal << (p.Percobaan - 1))
+	}
+	// the outcome is recorded even when ctx ended during the request; the
+	// Payload is left alone, anonimkan may have scrubbed it meanwhile
+	return db.WithContext(context.WithoutCancel(ctx)).Model(p).
+		Select("status", "percobaan", "berikutnya", "kode_respons", "galat", "terakhir_kirim", "diklaim_sampai").Updates(p).Error
+}
+
+// menyerah gives up on p, claimed with klaim, without sending it.
+func menyerah(db *gorm.DB, p *PengirimanWebhook, galat string) error {
+	p.Status, p.Galat, p.DiklaimSampai = StatusPengirimanGagal, galat, nil
+	return db.Model(p).Select("status", "galat", "diklaim_sampai").Updates(p).Error
+}
+
+// batasAntre is how many outbox events kirimWebhook queues per transaction.
+const batasAntre = 500
+
+// kirimWebhook is the job that queues the new Pegawai events of the outbox
+// and sends the deliveries that are due.
+func kirimWebhook(ctx context.Context, db *gorm.DB) error {
+	for {
+		n, err := outbox.Dispatch(ctx, db, "webhook", batasAntre, antreWebhook)
+		if err != nil {
+			return err
+		}
+		if n < batasAntre {
+			break
+		}
+	}
+	db = db.WithContext(ctx)
+	var antre []*PengirimanWebhook
+	sekarang := time.Now()
+	err := db.Where("status = ? AND berikutnya <= ?", StatusPengirimanMenunggu, sekarang).
+		Where("diklaim_sampai IS NULL OR diklaim_sampai <= ?", sekarang).
+		Order("berikutnya, id").Limit(100).Find(&antre).Error
+	if err != nil {
+		return err
+	}
+	webhooks := map[int64]*Webhook{}
+	for _, p := range antre {
+		ok, err := klaim(db, p)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		w, ok := webhooks[p.WebhookID]
+		if !ok {
+			w = &Webhook{}
+			if err := db.First(w, p.WebhookID).Error; err != nil {
+				return err
+			}
+			webhooks[p.WebhookID] = w
+		}
+		if !w.Aktif {
+			// the retries of a deactivated webhook are not sent, not even later
+			if err := menyerah(db, p, "webhook is inactive"); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := kirim(ctx, db, w, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type WebhookHandler struct {
+	db *gorm.DB
+}
+
+func NewWebhookHandler(db *gorm.DB) *WebhookHandler {
+	return &WebhookHandler{db: db}
+}
+
+type WebhookRequest struct {
+	ID     int64    `param:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Aktif  bool     `json:"aktif"`
+}
+
+func (r WebhookRequest) valid() error {
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return apperror.Validation("Invalid url, expected an http or https URL")
+	}
+	for _, e := range r.Events {
+		if !slices.Contains(daftarEvent, e) {
+			return apperror.Validation(fmt.Sprintf("Invalid event %s, expected some of %s", e, strings.Join(daftarEvent, ", ")))
+		}
+	}
+	return nil
+}
+
+func (h *WebhookHandler) GetAllWebhook(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	webhooks := make([]*Webhook, 0)
+	if err := db.Order("id").Find(&webhooks).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Get All Webhook")
+	}
+	for _, w := range webhooks {
+		w.Rahasia = ""
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get All Webhook", "data": webhooks})
+}
+
+// CreateWebhook answers with the Rahasia, the only time it is shown.
+func (h *WebhookHandler) CreateWebhook(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	var input WebhookRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+	if err := input.valid(); err != nil {
+		return err
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return apperror.Wrap(err, "Failed to Create Webhook")
+	}
+	webhook := Webhook{URL: input.URL, Events: input.Events, Rahasia: "whsec_" + hex.EncodeToString(buf), Aktif: input.Aktif}
+	if err := db.Create(&webhook).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Create Webhook")
+	}
+	return ctx.JSON(http.StatusCreated, map[string]interface{}{"message": "Successfully Create Webhook", "data": webhook})
+}
+
+func (h *WebhookHandler) UpdateWebhook(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	var input WebhookRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+	if err := input.valid(); err != nil {
+		return err
+	}
+	var webhook Webhook
+	if err := db.First(&webhook, input.ID).Error; err != nil {
+		return apperror.Lookup(err, "Webhook not found")
+	}
+	webhook.URL = input.URL
+	webhook.Events = input.Events
+	webhook.Aktif = input.Aktif
+	if err := db.Save(&webhook).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Update Webhook")
+	}
+	webhook.Rahasia = ""
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Update Webhook", "data": webhook})
+}
+
+// DeleteWebhook removes the Webhook with its delivery log.
+func (h *WebhookHandler) DeleteWebhook(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	// anything but a number cannot exist
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		return apperror.NotFound("Webhook not found")
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", id).Delete(&PengirimanWebhook{}).Error; err != nil {
+			return err
+		}
+		res := tx.Delete(&Webhook{}, id)
+		if res.Error == nil && res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return res.Error
+	})
+	if err != nil {
+		return apperror.Lookup(err, "Webhook not found")
+	}
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) GetAllPengiriman(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	pengiriman := make([]*PengirimanWebhook, 0)
+	query := db.Where("webhook_id = ?", ctx.Param("id"))
+	if status := ctx.QueryParam("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Order("id DESC").Find(&pengiriman).Error; err != nil {
+		return apperror.Wrap(err, "Failed to Get All Pengiriman")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get All Pengiriman", "data": pengiriman})
+}
+
+type KirimUlangRequest struct {
+	ID           int64 `param:"id"`
+	PengirimanID int64 `param:"pengiriman"`
+}
+
+// KirimUlang sends a delivery again right away, whatever its status, with
+// the same X-Webhook-Delivery so the receiver can tell it is a repeat. The
+// attempt counts in Percobaan like the scheduled ones, a delivery that is
+// being sent already is a conflict.
+func (h *WebhookHandler) KirimUlang(ctx echo.Context) error {
+	db := h.db.WithContext(ctx.Request().Context())
+	var input KirimUlangRequest
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+	var p PengirimanWebhook
+	if err := db.Where("webhook_id = ?", input.ID).First(&p, input.PengirimanID).Error; err != nil {
+		return apperror.Lookup(err, "Pengiriman not found")
+	}
+	var webhook Webhook
+	if err := db.First(&webhook, p.WebhookID).Error; err != nil {
+		return apperror.Lookup(err, "Webhook not found")
+	}
+	if !webhook.Aktif {
+		return apperror.Conflict("Webhook is inactive, activate it first")
+	}
+	ok, err := klaim(db, &p)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Send Pengiriman")
+	}
+	if !ok {
+		return apperror.Conflict("Pengiriman is being sent, try again later")
+	}
+	if err := kirim(ctx.Request().Context(), db, &webhook, &p); err != nil {
+		return apperror.Wrap(err, "Failed to Send Pengiriman")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Send Pengiriman", "data": p})
+}
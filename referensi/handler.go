@@ -0,0 +1,329 @@
+package referensi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"uas/api"
+	"uas/apperror"
+	"uas/openapi"
+	"uas/repository"
+)
+
+type ReferensiHandler struct {
+	svc Service
+}
+
+func NewReferensiHandler(svc Service) *ReferensiHandler {
+	return &ReferensiHandler{svc: svc}
+}
+
+// filter reads ?search=, ?semua=true and the language from ?lang= or the
+// first Accept-Language tag.
+func filter(ctx echo.Context) Filter {
+	f := Filter{Search: ctx.QueryParam("search"), Bahasa: ctx.QueryParam("lang")}
+	f.Semua, _ = strconv.ParseBool(ctx.QueryParam("semua"))
+	if f.Bahasa == "" {
+		tag := strings.Split(ctx.Request().Header.Get("Accept-Language"), ",")[0]
+		tag = strings.TrimSpace(strings.Split(tag, ";")[0])
+		f.Bahasa = strings.ToLower(strings.Split(tag, "-")[0])
+	}
+	return f
+}
+
+// referensiID parses the :id parameter, anything but a number cannot exist.
+func referensiID(ctx echo.Context, notFound string) (int64, error) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		return 0, apperror.NotFound(notFound)
+	}
+	return id, nil
+}
+
+// gagal maps a service error, ErrNotFound becomes a 404 with notFound.
+func gagal(err error, notFound, detail string) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return apperror.NotFound(notFound)
+	}
+	return apperror.Wrap(err, detail)
+}
+
+func (h *ReferensiHandler) GetSemua(ctx echo.Context) error {
+	semua, err := h.svc.Semua(ctx.Request().Context(), filter(ctx))
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Get All Referensi")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get All Referensi", "data": semua})
+}
+
+func (h *ReferensiHandler) GetJenis(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get All Jenis Referensi", "data": h.svc.Jenis()})
+}
+
+func (h *ReferensiHandler) GetAll(ctx echo.Context) error {
+	jenis := ctx.Param("jenis")
+	f := filter(ctx)
+	list, err := h.svc.List(ctx.Request().Context(), jenis, f)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Get All Referensi")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get All Referensi " + jenis, "data": list, "filter": f.Search})
+}
+
+func (h *ReferensiHandler) GetByID(ctx echo.Context) error {
+	jenis := ctx.Param("jenis")
+	id, err := referensiID(ctx, "Referensi not found")
+	if err != nil {
+		return err
+	}
+	r, err := h.svc.Get(ctx.Request().Context(), jenis, id)
+	if err != nil {
+		return gagal(err, "Referensi not found", "Failed to Get Referensi By ID")
+	}
+	if b := filter(ctx).Bahasa; b != "" {
+		*r = r.diterjemahkan(b)
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": fmt.Sprintf("Successfully Get Referensi %s By ID: %d", jenis, id), "data": r})
+}
+
+func (h *ReferensiHandler) Create(ctx echo.Context) error {
+	jenis := ctx.Param("jenis")
+	var input Input
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+	r, err := h.svc.Create(ctx.Request().Context(), jenis, input)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Create Referensi")
+	}
+	return ctx.JSON(http.StatusCreated, map[string]interface{}{"message": "Successfully Create a Referensi " + jenis, "data": r})
+}
+
+func (h *ReferensiHandler) Update(ctx echo.Context) error {
+	jenis := ctx.Param("jenis")
+	id, err := referensiID(ctx, "Referensi not found")
+	if err != nil {
+		return err
+	}
+	var input Input
+	if err := ctx.Bind(&input); err != nil {
+		return apperror.BadRequest("Failed to Bind Input")
+	}
+	r, err := h.svc.Update(ctx.Request().Context(), jenis, id, input)
+	if err != nil {
+		return gagal(err, "Referensi not found", "Failed to Update Referensi By ID")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": fmt.Sprintf("Successfully Update Referensi %s By ID: %d", jenis, id), "data": r})
+}
+
+func (h *ReferensiHandler) Delete(ctx echo.Context) error {
+	id, err := referensiID(ctx, "Referensi not found")
+	if err != nil {
+		return err
+	}
+	if err := h.svc.Delete(ctx.Request().Context(), ctx.Param("jenis"), id); err != nil {
+		return gagal(err, "Referensi not found", "Failed to Delete Referensi By ID")
+	}
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// legacyHandler serves one type on its old path, e.g. /agama, where the
+// value is called nama_agama instead of nama. Its lists include inactive
+// values like they always did.
+type legacyHandler struct {
+	svc   Service
+	jenis Jenis
+}
+
+func (h *legacyHandler) notFound() string {
+	return h.jenis.Nama + " not found"
+}
+
+// keluaran renders r with nama under the legacy field name.
+func (h *legacyHandler) keluaran(r Referensi) map[string]interface{} {
+	return map[string]interface{}{
+		"id":                r.ID,
+		h.jenis.LegacyField: r.Nama,
+		"kode":              r.Kode,
+		"urutan":            r.Urutan,
+		"aktif":             r.Aktif,
+		"created_at":        r.CreatedAt,
+		"updated_at":        r.UpdatedAt,
+	}
+}
+
+// masukan binds the body, taking nama from the legacy field name.
+func (h *legacyHandler) masukan(ctx echo.Context) (Input, error) {
+	var input Input
+	body := map[string]json.RawMessage{}
+	// the body only, path parameters cannot be bound into RawMessage
+	if err := (&echo.DefaultBinder{}).BindBody(ctx, &body); err != nil {
+		return input, apperror.BadRequest("Failed to Bind Input")
+	}
+	if nama, ok := body[h.jenis.LegacyField]; ok {
+		body["nama"] = nama
+	}
+	data, _ := json.Marshal(body)
+	if err := json.Unmarshal(data, &input); err != nil {
+		return input, apperror.BadRequest("Failed to Bind Input")
+	}
+	if input.Nama != nil && strings.TrimSpace(*input.Nama) == "" {
+		return input, apperror.Validation(h.jenis.LegacyField + " is required")
+	}
+	return input, nil
+}
+
+func (h *legacyHandler) GetAll(ctx echo.Context) error {
+	search := ctx.QueryParam("search")
+	list, err := h.svc.List(ctx.Request().Context(), h.jenis.Kode, Filter{Search: search, Semua: true})
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Get All "+h.jenis.Nama)
+	}
+	data := make([]map[string]interface{}, 0, len(list))
+	for _, r := range list {
+		data = append(data, h.keluaran(r))
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully Get All " + h.jenis.Nama, "data": data, "filter": search})
+}
+
+func (h *legacyHandler) GetByID(ctx echo.Context) error {
+	id, err := referensiID(ctx, h.notFound())
+	if err != nil {
+		return err
+	}
+	r, err := h.svc.Get(ctx.Request().Context(), h.jenis.Kode, id)
+	if err != nil {
+		return gagal(err, h.notFound(), "Failed to Get "+h.jenis.Nama+" By ID")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": fmt.Sprintf("Successfully Get %s By ID: %d", h.jenis.Nama, id), "data": h.keluaran(*r)})
+}
+
+func (h *legacyHandler) Create(ctx echo.Context) error {
+	input, err := h.masukan(ctx)
+	if err != nil {
+		return err
+	}
+	if input.Nama == nil {
+		return apperror.Validation(h.jenis.LegacyField + " is required")
+	}
+	r, err := h.svc.Create(ctx.Request().Context(), h.jenis.Kode, input)
+	if err != nil {
+		return apperror.Wrap(err, "Failed to Create "+h.jenis.Nama)
+	}
+	return ctx.JSON(http.StatusCreated, map[string]interface{}{"message": "Successfully Create a " + h.jenis.Nama, "data": h.keluaran(*r)})
+}
+
+func (h *legacyHandler) Update(ctx echo.Context) error {
+	id, err := referensiID(ctx, h.notFound())
+	if err != nil {
+		return err
+	}
+	input, err := h.masukan(ctx)
+	if err != nil {
+		return err
+	}
+	r, err := h.svc.Update(ctx.Request().Context(), h.jenis.Kode, id, input)
+	if err != nil {
+		return gagal(err, h.notFound(), "Failed to Update "+h.jenis.Nama+" By ID")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"message": fmt.Sprintf("Successfully Update %s By ID: %d", h.jenis.Nama, id), "data": h.keluaran(*r)})
+}
+
+func (h *legacyHandler) Delete(ctx echo.Context) error {
+	id, err := referensiID(ctx, h.notFound())
+	if err != nil {
+		return err
+	}
+	if err := h.svc.Delete(ctx.Request().Context(), h.jenis.Kode, id); err != nil {
+		return gagal(err, h.notFound(), "Failed to Delete "+h.jenis.Nama+" By ID")
+	}
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// Routes is the generic route table:
+//
+//	GET    /referensi                 every list at once, for form dropdowns
+//	GET    /referensi/jenis           the registered types
+//	GET    /referensi/:jenis          one list
+//	POST   /referensi/:jenis
+//	GET    /referensi/:jenis/:id
+//	PUT    /referensi/:jenis/:id
+//	DELETE /referensi/:jenis/:id
+func (h *ReferensiHandler) Routes() api.Routes {
+	const tag = "Referensi"
+	list := []openapi.Param{
+		{Name: "search", Description: "Part of nama or kode, case-insensitive"},
+		{Name: "semua", Description: "true includes inactive values", Type: false},
+		{Name: "lang", Description: "Translate nama, defaults to the first Accept-Language tag"},
+	}
+	return api.Routes{
+		{Method: http.MethodGet, Path: "/referensi", Handler: h.GetSemua, Doc: openapi.Operation{
+			Summary: "Every lookup list at once, keyed by jenis", Tag: tag,
+			Description: "Meant for form dropdowns. Only active values unless semua=true.",
+			Query:       list, Data: map[string][]Referensi{}}},
+		{Method: http.MethodGet, Path: "/referensi/jenis", Handler: h.GetJenis, Doc: openapi.Operation{
+			Summary: "Registered lookup types", Tag: tag, Data: []Jenis{}}},
+		{Method: http.MethodGet, Path: "/referensi/:jenis", Handler: h.GetAll, Doc: openapi.Operation{
+			Summary: "Values of one lookup type", Tag: tag,
+			Query: list, Data: []Referensi{}, Extra: map[string]interface{}{"filter": ""}}},
+		{Method: http.MethodPost, Path: "/referensi/:jenis", Handler: h.Create, Doc: openapi.Operation{
+			Summary: "Create a value", Tag: tag,
+			Description: "kode defaults to nama in UPPER_SNAKE case and must be unique within the jenis.",
+			Body:        Input{}, Status: http.StatusCreated, Data: Referensi{}}},
+		{Method: http.MethodGet, Path: "/referensi/:jenis/:id", Handler: h.GetByID, Doc: openapi.Operation{
+			Summary: "Get a value", Tag: tag, Query: list[2:], Data: Referensi{}}},
+		{Method: http.MethodPut, Path: "/referensi/:jenis/:id", Handler: h.Update, Doc: openapi.Operation{
+			Summary: "Update a value", Tag: tag,
+			Description: "Members left out keep their value, send aktif=false to retire a value.",
+			Body:        Input{}, Data: Referensi{}}},
+		{Method: http.MethodDelete, Path: "/referensi/:jenis/:id", Handler: h.Delete, Doc: openapi.Operation{
+			Summary: "Delete a value", Tag: tag, Status: http.StatusNoContent}},
+	}
+}
+
+// LegacyRoutes is the route table of the types with a LegacyPath, in the
+// shape the old per-type services used. Without kode every such type is
+// included.
+func (h *ReferensiHandler) LegacyRoutes(kode ...string) api.Routes {
+	pilih := map[string]bool{}
+	for _, k := range kode {
+		pilih[k] = true
+	}
+	var routes api.Routes
+	for _, j := range h.svc.Jenis() {
+		if j.LegacyPath != "" && (len(kode) == 0 || pilih[j.Kode]) {
+			routes = append(routes, (&legacyHandler{svc: h.svc, jenis: j}).routes()...)
+		}
+	}
+	return routes
+}
+
+func (h *legacyHandler) routes() api.Routes {
+	path, tag := h.jenis.LegacyPath, h.jenis.Nama
+	data := map[string]interface{}{
+		"id": int64(0), h.jenis.LegacyField: "", "kode": "", "urutan": 0, "aktif": false,
+		"created_at": time.Time{}, "updated_at": time.Time{},
+	}
+	body := map[string]interface{}{h.jenis.LegacyField: "", "kode": "", "urutan": 0, "aktif": false}
+	return api.Routes{
+		{Method: http.MethodGet, Path: path, Handler: h.GetAll, Doc: openapi.Operation{
+			Summary: "All " + tag + " values, inactive ones included", Tag: tag,
+			Query: []openapi.Param{{Name: "search", Description: "Part of " + h.jenis.LegacyField + " or kode, case-insensitive"}},
+			Data:  []map[string]interface{}{data}, Extra: map[string]interface{}{"filter": ""}}},
+		{Method: http.MethodGet, Path: path + "/:id", Handler: h.GetByID, Doc: openapi.Operation{
+			Summary: "Get a " + tag, Tag: tag, Data: data}},
+		{Method: http.MethodPost, Path: path, Handler: h.Create, Doc: openapi.Operation{
+			Summary: "Create a " + tag, Tag: tag, Body: body, Status: http.StatusCreated, Data: data}},
+		{Method: http.MethodPut, Path: path + "/:id", Handler: h.Update, Doc: openapi.Operation{
+			Summary: "Update a " + tag, Tag: tag, Description: "Members left out keep their value.", Body: body, Data: data}},
+		{Method: http.MethodDelete, Path: path + "/:id", Handler: h.Delete, Doc: openapi.Operation{
+			Summary: "Delete a " + tag, Tag: tag, Status: http.StatusNoContent}},
+	}
+}
@@ -0,0 +1,214 @@
+// Package referensi is the reference-data (lookup) subsystem. Every lookup
+// type, agama, golongan, bank and so on, is a Jenis in a Registry and its
+// values live in the single referensi table.
+package referensi
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+
+	"uas/outbox"
+)
+
+// Referensi is one value of a lookup type.
+type Referensi struct {
+	ID    int64  `json:"id"`
+	Jenis string `json:"jenis" gorm:"size:50;uniqueIndex:idx_referensi_kode"`
+	Kode  string `json:"kode" gorm:"size:50;uniqueIndex:idx_referensi_kode"`
+	Nama  string `json:"nama"`
+	// Urutan orders the values in dropdowns, ties are ordered by nama.
+	Urutan int  `json:"urutan"`
+	Aktif  bool `json:"aktif" gorm:"index"`
+	// Terjemahan maps a language code like "en" to the translated nama.
+	Terjemahan map[string]string `json:"terjemahan" gorm:"type:text;serializer:json"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+func (Referensi) TableName() string {
+	return "referensi"
+}
+
+func init() {
+	outbox.Track(&Referensi{}, "referensi")
+}
+
+// diterjemahkan returns r with nama in bahasa when a translation exists.
+func (r Referensi) diterjemahkan(bahasa string) Referensi {
+	if t, ok := r.Terjemahan[bahasa]; ok && t != "" {
+		r.Nama = t
+	}
+	return r
+}
+
+// Jenis declares a lookup type.
+type Jenis struct {
+	Kode string `json:"kode"`
+	Nama string `json:"nama"`
+	// LegacyPath and LegacyField keep the routes of the old per-type
+	// services working, e.g. /agama with the value in "nama_agama".
+	LegacyPath  string `json:"legacy_path,omitempty"`
+	LegacyField string `json:"legacy_field,omitempty"`
+	// LegacyTable is imported once into referensi by Migrate.
+	LegacyTable string `json:"legacy_table,omitempty"`
+}
+
+// Registry holds the known lookup types in declaration order.
+type Registry struct {
+	jenis  map[string]Jenis
+	urutan []string
+}
+
+func NewRegistry(jenis ...Jenis) *Registry {
+	r := &Registry{jenis: map[string]Jenis{}}
+	for _, j := range jenis {
+		if err := r.Register(j); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+// Register adds j, a kode can only be declared once.
+func (r *Registry) Register(j Jenis) error {
+	if j.Kode == "" || j.Nama == "" {
+		return fmt.Errorf("referensi: jenis needs a kode and a nama: %+v", j)
+	}
+	if _, ok := r.jenis[j.Kode]; ok {
+		return fmt.Errorf("referensi: jenis %q is already registered", j.Kode)
+	}
+	r.jenis[j.Kode] = j
+	r.urutan = append(r.urutan, j.Kode)
+	return nil
+}
+
+func (r *Registry) Cari(kode string) (Jenis, bool) {
+	j, ok := r.jenis[kode]
+	return j, ok
+}
+
+func (r *Registry) Daftar() []Jenis {
+	daftar := make([]Jenis, 0, len(r.urutan))
+	for _, kode := range r.urutan {
+		daftar = append(daftar, r.jenis[kode])
+	}
+	return daftar
+}
+
+// LoadFile registers the types declared in a JSON file holding a list of
+// Jenis. An empty path does nothing.
+func (r *Registry) LoadFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var daftar []Jenis
+	if err := json.Unmarshal(data, &daftar); err != nil {
+		return fmt.Errorf("referensi: %s: %w", path, err)
+	}
+	for _, j := range daftar {
+		if err := r.Register(j); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Bawaan returns a registry with the built-in lookup types plus the ones
+// declared in the file named by REFERENSI_CONFIG.
+func Bawaan() (*Registry, error) {
+	r := NewRegistry(
+		Jenis{Kode: "agama", Nama: "Agama", LegacyPath: "/agama", LegacyField: "nama_agama", LegacyTable: "agamas"},
+		Jenis{Kode: "jenis_kelamin", Nama: "Jenis Kelamin", LegacyPath: "/jeniskelamin", LegacyField: "jenis_kelamin"},
+		Jenis{Kode: "jenis_pegawai", Nama: "Jenis Pegawai", LegacyPath: "/jenispegawai", LegacyField: "jenis_pegawai"},
+		Jenis{Kode: "status_pegawai", Nama: "Status Pegawai", LegacyPath: "/statuspegawai", LegacyField: "status_pegawai"},
+		Jenis{Kode: "pendidikan", Nama: "Pendidikan", LegacyPath: "/pendidikan", LegacyField: "pendidikan"},
+		Jenis{Kode: "golongan", Nama: "Golongan"},
+		Jenis{Kode: "jabatan", Nama: "Jabatan"},
+		Jenis{Kode: "bank", Nama: "Bank"},
+		Jenis{Kode: "status_perkawinan", Nama: "Status Perkawinan"},
+	)
+	if err := r.LoadFile(os.Getenv("REFERENSI_CONFIG")); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// kodeDari derives a kode from nama: "Kristen Protestan" becomes
+// "KRISTEN_PROTESTAN".
+func kodeDari(nama string) string {
+	kode := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return ' '
+	}, nama)
+	return strings.Join(strings.Fields(kode), "_")
+}
+
+// Migrate creates the outbox and referensi tables and imports the rows of
+// every LegacyTable that has not been imported yet.
+func Migrate(db *gorm.DB, registry *Registry) error {
+	if err := outbox.Migrate(db); err != nil {
+		return err
+	}
+	if err := db.AutoMigrate(&Referensi{}); err != nil {
+		return err
+	}
+	for _, j := range registry.Daftar() {
+		if j.LegacyTable == "" || !db.Migrator().HasTable(j.LegacyTable) {
+			continue
+		}
+		var jumlah int64
+		if err := db.Model(&Referensi{}).Where("jenis = ?", j.Kode).Count(&jumlah).Error; err != nil {
+			return err
+		}
+		if jumlah > 0 {
+			continue
+		}
+		var lama []struct {
+			ID   int64
+			Nama string
+		}
+		err := db.Table(j.LegacyTable).Select("id, " + j.LegacyField + " AS nama").Order("id").Scan(&lama).Error
+		if err != nil {
+			return err
+		}
+		baru := make([]Referensi, 0, len(lama))
+		dipakai := map[string]bool{}
+		for i, l := range lama {
+			kode := kodeDari(l.Nama)
+			if kode == "" || dipakai[kode] {
+				kode = fmt.Sprintf("%s_%d", kode, l.ID)
+			}
+			dipakai[kode] = true
+			baru = append(baru, Referensi{Jenis: j.Kode, Kode: kode, Nama: l.Nama, Urutan: i + 1, Aktif: true})
+		}
+		if len(baru) > 0 {
+			if err := db.Create(&baru).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// urutkan orders values like the database does: by urutan, then nama.
+func urutkan(daftar []Referensi) {
+	sort.SliceStable(daftar, func(i, k int) bool {
+		if daftar[i].Urutan != daftar[k].Urutan {
+			return daftar[i].Urutan < daftar[k].Urutan
+		}
+		return daftar[i].Nama < daftar[k].Nama
+	})
+}
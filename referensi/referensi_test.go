@@ -0,0 +1,258 @@
+package referensi_test
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"gorm.io/gorm"
+
+	"uas/api"
+	"uas/apperror"
+	"uas/referensi"
+	"uas/testutil"
+)
+
+func newTestServer(t *testing.T) (*testutil.Server, *gorm.DB) {
+	registry, err := referensi.Bawaan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := testutil.OpenDB(t, func(db *gorm.DB) error { return referensi.Migrate(db, registry) })
+	testutil.LoadFixtures(t, db, "referensi.json", &[]referensi.Referensi{})
+
+	e := echo.New()
+	e.HTTPErrorHandler = apperror.HTTPErrorHandler
+	e.Use(middleware.RequestID())
+	h := referensi.NewReferensiHandler(referensi.NewGormService(db, registry))
+	routes := append(h.Routes(), h.LegacyRoutes()...)
+	a := api.New(e, nil)
+	a.Version("v1", routes, nil)
+	a.Unversioned(routes, api.RootDeprecation)
+	return testutil.NewServer(t, e), db
+}
+
+func namaDari(list []referensi.Referensi) []string {
+	nama := make([]string, 0, len(list))
+	for _, r := range list {
+		nama = append(nama, r.Nama)
+	}
+	return nama
+}
+
+func samaDengan(t *testing.T, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := referensi.NewRegistry(referensi.Jenis{Kode: "agama", Nama: "Agama"})
+	if err := r.Register(referensi.Jenis{Kode: "agama", Nama: "Agama lagi"}); err == nil {
+		t.Error("a kode can be registered twice")
+	}
+	if err := r.Register(referensi.Jenis{Kode: "tanpa_nama"}); err == nil {
+		t.Error("a jenis without nama was registered")
+	}
+	if err := r.LoadFile(filepath.Join("testdata", "jenis.json")); err != nil {
+		t.Fatal(err)
+	}
+	var kode []string
+	for _, j := range r.Daftar() {
+		kode = append(kode, j.Kode)
+	}
+	samaDengan(t, kode, []string{"agama", "suku", "hobi"})
+	if err := r.LoadFile(filepath.Join("testdata", "tidak_ada.json")); err == nil {
+		t.Error("loading a missing file succeeded")
+	}
+
+	t.Setenv("REFERENSI_CONFIG", filepath.Join("testdata", "jenis.json"))
+	bawaan, err := referensi.Bawaan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bawaan.Cari("suku"); !ok {
+		t.Error("Bawaan ignored REFERENSI_CONFIG")
+	}
+	if _, ok := bawaan.Cari("golongan"); !ok {
+		t.Error("Bawaan lost a built-in jenis")
+	}
+}
+
+func TestMigrateImportsLegacyTable(t *testing.T) {
+	registry := referensi.NewRegistry(referensi.Jenis{Kode: "agama", Nama: "Agama", LegacyField: "nama_agama", LegacyTable: "agamas"})
+	db := testutil.OpenDB(t, func(db *gorm.DB) error {
+		return db.Exec("CREATE TABLE agamas (id integer primary key, nama_agama text)").Error
+	})
+	db.Exec("INSERT INTO agamas (id, nama_agama) VALUES (1, 'Islam'), (2, 'Kristen Protestan'), (3, 'Islam')")
+
+	for i := 0; i < 2; i++ {
+		if err := referensi.Migrate(db, registry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var list []referensi.Referensi
+	db.Order("urutan").Find(&list)
+	var kode []string
+	for _, r := range list {
+		if r.Jenis != "agama" || !r.Aktif {
+			t.Errorf("imported %+v", r)
+		}
+		kode = append(kode, r.Kode)
+	}
+	samaDengan(t, kode, []string{"ISLAM", "KRISTEN_PROTESTAN", "ISLAM_3"})
+}
+
+func TestReferensiHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		header  map[string]string
+		body    interface{}
+		breakDB bool
+		code    int
+		check   func(t *testing.T, res *testutil.Response, db *gorm.DB)
+	}{
+		{name: "all lists", method: http.MethodGet, path: "/referensi", code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data map[string][]referensi.Referensi
+				res.Data(&data)
+				samaDengan(t, namaDari(data["agama"]), []string{"Islam", "Kristen"})
+				samaDengan(t, namaDari(data["bank"]), []string{"Bank Central Asia", "Bank Negara Indonesia"})
+				if list, ok := data["golongan"]; !ok || len(list) != 0 {
+					t.Errorf("golongan is %v, want an empty list", list)
+				}
+			}},
+		{name: "all lists translated", method: http.MethodGet, path: "/referensi?lang=en", code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data map[string][]referensi.Referensi
+				res.Data(&data)
+				samaDengan(t, namaDari(data["status_perkawinan"]), []string{"Married", "Single"})
+				samaDengan(t, namaDari(data["agama"]), []string{"Islam", "Protestant"})
+			}},
+		{name: "language from header", method: http.MethodGet, path: "/referensi/status_perkawinan",
+			header: map[string]string{"Accept-Language": "en-US,id;q=0.8"}, code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data []referensi.Referensi
+				res.Data(&data)
+				samaDengan(t, namaDari(data), []string{"Married", "Single"})
+			}},
+		{name: "all lists db failure", method: http.MethodGet, path: "/referensi", breakDB: true, code: http.StatusInternalServerError},
+		{name: "jenis", method: http.MethodGet, path: "/referensi/jenis", code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data []referensi.Jenis
+				res.Data(&data)
+				if len(data) != 9 || data[0].Kode != "agama" {
+					t.Errorf("got %+v", data)
+				}
+			}},
+
+		{name: "list orders by urutan then nama", method: http.MethodGet, path: "/referensi/status_perkawinan", code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data []referensi.Referensi
+				res.Data(&data)
+				samaDengan(t, namaDari(data), []string{"Belum Kawin", "Kawin"})
+			}},
+		{name: "list with inactive", method: http.MethodGet, path: "/referensi/agama?semua=true", code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data []referensi.Referensi
+				res.Data(&data)
+				samaDengan(t, namaDari(data), []string{"Islam", "Konghucu", "Kristen"})
+			}},
+		{name: "list searches kode", method: http.MethodGet, path: "/referensi/bank?search=bca", code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data []referensi.Referensi
+				res.Data(&data)
+				samaDengan(t, namaDari(data), []string{"Bank Central Asia"})
+			}},
+		{name: "list unknown jenis", method: http.MethodGet, path: "/referensi/planet", code: http.StatusNotFound},
+
+		{name: "get by id", method: http.MethodGet, path: "/referensi/agama/2?lang=en", code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data referensi.Referensi
+				res.Data(&data)
+				if data.Kode != "KRISTEN" || data.Nama != "Protestant" {
+					t.Errorf("got %+v", data)
+				}
+			}},
+		{name: "get by id of another jenis", method: http.MethodGet, path: "/referensi/bank/1", code: http.StatusNotFound},
+
+		{name: "create derives kode", method: http.MethodPost, path: "/referensi/golongan", body: map[string]interface{}{"nama": "III/a", "urutan": 5}, code: http.StatusCreated,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data referensi.Referensi
+				res.Data(&data)
+				if data.Jenis != "golongan" || data.Kode != "III_A" || data.Urutan != 5 || !data.Aktif {
+					t.Errorf("got %+v", data)
+				}
+			}},
+		{name: "create duplicate kode", method: http.MethodPost, path: "/referensi/agama", body: map[string]string{"kode": "islam", "nama": "Islam lain"}, code: http.StatusConflict},
+		{name: "create same kode in another jenis", method: http.MethodPost, path: "/referensi/bank", body: map[string]string{"kode": "ISLAM", "nama": "Bank Syariah"}, code: http.StatusCreated},
+		{name: "create without nama", method: http.MethodPost, path: "/referensi/bank", body: map[string]string{"kode": "BRI"}, code: http.StatusUnprocessableEntity},
+		{name: "create unknown jenis", method: http.MethodPost, path: "/referensi/planet", body: map[string]string{"nama": "Mars"}, code: http.StatusNotFound},
+		{name: "create bind failure", method: http.MethodPost, path: "/referensi/bank", body: `{"nama":`, code: http.StatusBadRequest},
+
+		{name: "update keeps unset fields", method: http.MethodPut, path: "/referensi/agama/3", body: map[string]bool{"aktif": true}, code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var saved referensi.Referensi
+				if err := db.First(&saved, 3).Error; err != nil || !saved.Aktif || saved.Nama != "Konghucu" || saved.Kode != "KONGHUCU" {
+					t.Errorf("saved %+v, err %v", saved, err)
+				}
+			}},
+		{name: "update deactivates", method: http.MethodPut, path: "/referensi/agama/1", body: map[string]bool{"aktif": false}, code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var saved referensi.Referensi
+				if err := db.First(&saved, 1).Error; err != nil || saved.Aktif {
+					t.Errorf("saved %+v, err %v", saved, err)
+				}
+			}},
+		{name: "update of another jenis", method: http.MethodPut, path: "/referensi/bank/1", body: map[string]bool{"aktif": false}, code: http.StatusNotFound},
+
+		{name: "delete", method: http.MethodDelete, path: "/referensi/agama/3", code: http.StatusNoContent},
+		{name: "delete of another jenis", method: http.MethodDelete, path: "/referensi/bank/1", code: http.StatusNotFound,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				if err := db.First(&referensi.Referensi{}, 1).Error; err != nil {
+					t.Errorf("row 1 is gone: %v", err)
+				}
+			}},
+
+		{name: "legacy list includes inactive", method: http.MethodGet, path: "/agama", code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var data []map[string]interface{}
+				res.Data(&data)
+				if len(data) != 3 || data[0]["nama_agama"] != "Islam" || data[0]["kode"] != "ISLAM" {
+					t.Errorf("got %v", data)
+				}
+			}},
+		{name: "legacy update by field name", method: http.MethodPut, path: "/agama/2", body: map[string]string{"nama_agama": "Kristen Protestan"}, code: http.StatusOK,
+			check: func(t *testing.T, res *testutil.Response, db *gorm.DB) {
+				var saved referensi.Referensi
+				if err := db.First(&saved, 2).Error; err != nil || saved.Nama != "Kristen Protestan" || saved.Kode != "KRISTEN" {
+					t.Errorf("saved %+v, err %v", saved, err)
+				}
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, db := newTestServer(t)
+			for k, v := range tt.header {
+				srv.Header.Set(k, v)
+			}
+			if tt.breakDB {
+				testutil.BreakDB(t, db)
+			}
+			res := srv.Do(tt.method, tt.path, tt.body).Expect(tt.code)
+			if tt.check != nil {
+				tt.check(t, res, db)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package referensi
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// nilaiBawaan are the values Seed loads into a fresh database.
+var nilaiBawaan = []Referensi{
+	// the six religions recognized by the state
+	{Jenis: "agama", Kode: "ISLAM", Nama: "Islam", Urutan: 1},
+	{Jenis: "agama", Kode: "KRISTEN", Nama: "Kristen", Urutan: 2},
+	{Jenis: "agama", Kode: "KATOLIK", Nama: "Katolik", Urutan: 3},
+	{Jenis: "agama", Kode: "HINDU", Nama: "Hindu", Urutan: 4},
+	{Jenis: "agama", Kode: "BUDDHA", Nama: "Buddha", Urutan: 5},
+	{Jenis: "agama", Kode: "KONGHUCU", Nama: "Konghucu", Urutan: 6},
+
+	{Jenis: "jenis_kelamin", Kode: "L", Nama: "Laki-laki", Urutan: 1},
+	{Jenis: "jenis_kelamin", Kode: "P", Nama: "Perempuan", Urutan: 2},
+
+	{Jenis: "pendidikan", Kode: "SD", Nama: "SD", Urutan: 1},
+	{Jenis: "pendidikan", Kode: "SMP", Nama: "SMP", Urutan: 2},
+	{Jenis: "pendidikan", Kode: "SMA", Nama: "SMA", Urutan: 3},
+	{Jenis: "pendidikan", Kode: "D1", Nama: "D1", Urutan: 4},
+	{Jenis: "pendidikan", Kode: "D2", Nama: "D2", Urutan: 5},
+	{Jenis: "pendidikan", Kode: "D3", Nama: "D3", Urutan: 6},
+	{Jenis: "pendidikan", Kode: "D4", Nama: "D4", Urutan: 7},
+	{Jenis: "pendidikan", Kode: "S1", Nama: "S1", Urutan: 8},
+	{Jenis: "pendidikan", Kode: "S2", Nama: "S2", Urutan: 9},
+	{Jenis: "pendidikan", Kode: "S3", Nama: "S3", Urutan: 10},
+
+	{Jenis: "jenis_pegawai", Kode: "PNS", Nama: "PNS", Urutan: 1},
+	{Jenis: "jenis_pegawai", Kode: "PPPK", Nama: "PPPK", Urutan: 2},
+	{Jenis: "jenis_pegawai", Kode: "HONORER", Nama: "Honorer", Urutan: 3},
+	{Jenis: "jenis_pegawai", Kode: "KONTRAK", Nama: "Kontrak", Urutan: 4},
+
+	{Jenis: "status_pegawai", Kode: "AKTIF", Nama: "Aktif", Urutan: 1},
+	{Jenis: "status_pegawai", Kode: "CUTI", Nama: "Cuti", Urutan: 2},
+	{Jenis: "status_pegawai", Kode: "TUGAS_BELAJAR", Nama: "Tugas Belajar", Urutan: 3},
+	{Jenis: "status_pegawai", Kode: "PENSIUN", Nama: "Pensiun", Urutan: 4},
+	{Jenis: "status_pegawai", Kode: "DIBERHENTIKAN", Nama: "Diberhentikan", Urutan: 5},
+	{Jenis: "status_pegawai", Kode: "MENINGGAL", Nama: "Meninggal", Urutan: 6},
+
+	// as printed on the KTP
+	{Jenis: "status_perkawinan", Kode: "BELUM_KAWIN", Nama: "Belum Kawin", Urutan: 1},
+	{Jenis: "status_perkawinan", Kode: "KAWIN", Nama: "Kawin", Urutan: 2},
+	{Jenis: "status_perkawinan", Kode: "CERAI_HIDUP", Nama: "Cerai Hidup", Urutan: 3},
+	{Jenis: "status_perkawinan", Kode: "CERAI_MATI", Nama: "Cerai Mati", Urutan: 4},
+
+	// golongan ruang of a PNS
+	{Jenis: "golongan", Kode: "I_A", Nama: "I/a", Urutan: 1},
+	{Jenis: "golongan", Kode: "I_B", Nama: "I/b", Urutan: 2},
+	{Jenis: "golongan", Kode: "I_C", Nama: "I/c", Urutan: 3},
+	{Jenis: "golongan", Kode: "I_D", Nama: "I/d", Urutan: 4},
+	{Jenis: "golongan", Kode: "II_A", Nama: "II/a", Urutan: 5},
+	{Jenis: "golongan", Kode: "II_B", Nama: "II/b", Urutan: 6},
+	{Jenis: "golongan", Kode: "II_C", Nama: "II/c", Urutan: 7},
+	{Jenis: "golongan", Kode: "II_D", Nama: "II/d", Urutan: 8},
+	{Jenis: "golongan", Kode: "III_A", Nama: "III/a", Urutan: 9},
+	{Jenis: "golongan", Kode: "III_B", Nama: "III/b", Urutan: 10},
+	{Jenis: "golongan", Kode: "III_C", Nama: "III/c", Urutan: 11},
+	{Jenis: "golongan", Kode: "III_D", Nama: "III/d", Urutan: 12},
+	{Jenis: "golongan", Kode: "IV_A", Nama: "IV/a", Urutan: 13},
+	{Jenis: "golongan", Kode: "IV_B", Nama: "IV/b", Urutan: 14},
+	{Jenis: "golongan", Kode: "IV_C", Nama: "IV/c", Urutan: 15},
+	{Jenis: "golongan", Kode: "IV_D", Nama: "IV/d", Urutan: 16},
+	{Jenis: "golongan", Kode: "IV_E", Nama: "IV/e", Urutan: 17},
+
+	{Jenis: "bank", Kode: "BRI", Nama: "Bank Rakyat Indonesia", Urutan: 1},
+	{Jenis: "bank", Kode: "BNI", Nama: "Bank Negara Indonesia", Urutan: 2},
+	{Jenis: "bank", Kode: "MANDIRI", Nama: "Bank Mandiri", Urutan: 3},
+	{Jenis: "bank", Kode: "BTN", Nama: "Bank Tabungan Negara", Urutan: 4},
+	{Jenis: "bank", Kode: "BSI", Nama: "Bank Syariah Indonesia", Urutan: 5},
+	{Jenis: "bank", Kode: "BCA", Nama: "Bank Central Asia", Urutan: 6},
+}
+
+// Seed adds the built-in values of the types in registry that are missing,
+// a value edited since keeps its changes. It returns how many it added.
+func Seed(db *gorm.DB, registry *Registry) (int, error) {
+	ditambah := 0
+	for _, nilai := range nilaiBawaan {
+		if _, ok := registry.Cari(nilai.Jenis); !ok {
+			continue
+		}
+		nilai.Aktif = true
+		res := db.Where(Referensi{Jenis: nilai.Jenis, Kode: nilai.Kode}).Attrs(nilai).FirstOrCreate(&Referensi{})
+		if res.Error != nil {
+			return ditambah, fmt.Errorf("referensi: seed %s %s: %w", nilai.Jenis, nilai.Kode, res.Error)
+		}
+		ditambah += int(res.RowsAffected)
+	}
+	return ditambah, nil
+}
@@ -0,0 +1,188 @@
+package referensi
+
+import (
+	"context"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"uas/apperror"
+	"uas/repository"
+)
+
+// Filter narrows a list of values.
+type Filter struct {
+	Search string
+	// Semua includes inactive values.
+	Semua bool
+	// Bahasa picks the translation of nama, empty keeps the original.
+	Bahasa string
+}
+
+// Input is the body of a create or update. Fields left nil keep their value
+// on update.
+type Input struct {
+	Kode       *string           `json:"kode"`
+	Nama       *string           `json:"nama"`
+	Urutan     *int              `json:"urutan"`
+	Aktif      *bool             `json:"aktif"`
+	Terjemahan map[string]string `json:"terjemahan"`
+}
+
+// Service is what the handlers depend on.
+type Service interface {
+	Jenis() []Jenis
+	CariJenis(kode string) (Jenis, error)
+	List(ctx context.Context, jenis string, filter Filter) ([]Referensi, error)
+	// Semua returns the values of every registered type keyed by its kode.
+	Semua(ctx context.Context, filter Filter) (map[string][]Referensi, error)
+	Get(ctx context.Context, jenis string, id int64) (*Referensi, error)
+	Create(ctx context.Context, jenis string, input Input) (*Referensi, error)
+	Update(ctx context.Context, jenis string, id int64, input Input) (*Referensi, error)
+	Delete(ctx context.Context, jenis string, id int64) error
+}
+
+type service struct {
+	registry *Registry
+	repo     repository.Repository[Referensi]
+}
+
+func NewService(registry *Registry, repo repository.Repository[Referensi]) Service {
+	return &service{registry: registry, repo: repo}
+}
+
+// NewGormService is NewService on the referensi table of db.
+func NewGormService(db *gorm.DB, registry *Registry) Service {
+	return NewService(registry, repository.NewGorm[Referensi](db, "nama", "kode"))
+}
+
+func (s *service) Jenis() []Jenis {
+	return s.registry.Daftar()
+}
+
+func (s *service) CariJenis(kode string) (Jenis, error) {
+	j, ok := s.registry.Cari(kode)
+	if !ok {
+		return Jenis{}, apperror.NotFound("Jenis referensi " + kode + " not found")
+	}
+	return j, nil
+}
+
+func (s *service) list(ctx context.Context, filters map[string]interface{}, filter Filter) ([]Referensi, error) {
+	if !filter.Semua {
+		filters["aktif"] = true
+	}
+	daftar, err := s.repo.List(ctx, repository.ListOptions{Search: filter.Search, Filters: filters, Order: "urutan, nama"})
+	if err != nil {
+		return nil, err
+	}
+	if filter.Bahasa != "" {
+		for i := range daftar {
+			daftar[i] = daftar[i].diterjemahkan(filter.Bahasa)
+		}
+		urutkan(daftar)
+	}
+	return daftar, nil
+}
+
+func (s *service) List(ctx context.Context, jenis string, filter Filter) ([]Referensi, error) {
+	if _, err := s.CariJenis(jenis); err != nil {
+		return nil, err
+	}
+	return s.list(ctx, map[string]interface{}{"jenis": jenis}, filter)
+}
+
+func (s *service) Semua(ctx context.Context, filter Filter) (map[string][]Referensi, error) {
+	daftar, err := s.list(ctx, map[string]interface{}{}, filter)
+	if err != nil {
+		return nil, err
+	}
+	hasil := map[string][]Referensi{}
+	for _, j := range s.registry.Daftar() {
+		hasil[j.Kode] = make([]Referensi, 0)
+	}
+	for _, r := range daftar {
+		if _, ok := hasil[r.Jenis]; ok {
+			hasil[r.Jenis] = append(hasil[r.Jenis], r)
+		}
+	}
+	return hasil, nil
+}
+
+func (s *service) Get(ctx context.Context, jenis string, id int64) (*Referensi, error) {
+	if _, err := s.CariJenis(jenis); err != nil {
+		return nil, err
+	}
+	r, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if r.Jenis != jenis {
+		return nil, repository.ErrNotFound
+	}
+	return r, nil
+}
+
+// terapkan copies the fields set in input to r and checks the result.
+func terapkan(r *Referensi, input Input) error {
+	if input.Nama != nil {
+		r.Nama = strings.TrimSpace(*input.Nama)
+	}
+	if input.Kode != nil {
+		r.Kode = strings.ToUpper(strings.TrimSpace(*input.Kode))
+	}
+	if input.Urutan != nil {
+		r.Urutan = *input.Urutan
+	}
+	if input.Aktif != nil {
+		r.Aktif = *input.Aktif
+	}
+	if input.Terjemahan != nil {
+		r.Terjemahan = input.Terjemahan
+	}
+	if r.Nama == "" {
+		return apperror.Validation("nama is required")
+	}
+	if r.Kode == "" {
+		r.Kode = kodeDari(r.Nama)
+	}
+	if len(r.Kode) > 50 {
+		return apperror.Validation("kode is longer than 50 characters")
+	}
+	return nil
+}
+
+func (s *service) Create(ctx context.Context, jenis string, input Input) (*Referensi, error) {
+	if _, err := s.CariJenis(jenis); err != nil {
+		return nil, err
+	}
+	r := &Referensi{Jenis: jenis, Aktif: true}
+	if err := terapkan(r, input); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(ctx, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *service) Update(ctx context.Context, jenis string, id int64, input Input) (*Referensi, error) {
+	r, err := s.Get(ctx, jenis, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := terapkan(r, input); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Save(ctx, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *service) Delete(ctx context.Context, jenis string, id int64) error {
+	if _, err := s.Get(ctx, jenis, id); err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, id)
+}
@@ -0,0 +1,131 @@
+// Package repository is the storage interface shared by the services. Every
+// entity is stored in its own table with an integer "id" primary key.
+//
+// It backs the entities whose handlers are plain CRUD: the referensi values
+// and Pegawai. The workflow handlers of the pegawai service (cuti, absensi,
+// perubahan, webhook, pengguna, ...) read and lock several tables inside one
+// transaction and keep using gorm directly.
+package repository
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"uas/database"
+)
+
+// ErrNotFound is returned by Get, Update and Delete for an unknown id. It is
+// gorm.ErrRecordNotFound so apperror maps it to 404 for every implementation.
+var ErrNotFound = gorm.ErrRecordNotFound
+
+// ListOptions narrows List. Filters and Order name columns and must never
+// come from user input, Search is matched against the repository's search
+// columns without regard to case.
+type ListOptions struct {
+	Search  string
+	Filters map[string]interface{}
+	Order   string
+	Limit   int
+	Offset  int
+}
+
+type Repository[T any] interface {
+	List(ctx context.Context, opts ListOptions) ([]T, error)
+	Get(ctx context.Context, id int64) (*T, error)
+	// Create ignores any id set on entity and fills in the new one.
+	Create(ctx context.Context, entity *T) error
+	// Update writes the non-zero fields of entity to row id and reloads
+	// entity from the database.
+	Update(ctx context.Context, id int64, entity *T) error
+	// Save writes every field of an entity loaded with Get, zero values
+	// included.
+	Save(ctx context.Context, entity *T) error
+	Delete(ctx context.Context, id int64) error
+}
+
+// Gorm implements Repository on a GORM connection.
+type Gorm[T any] struct {
+	db            *gorm.DB
+	searchColumns []string
+}
+
+// NewGorm returns a repository for T, List searches searchColumns.
+func NewGorm[T any](db *gorm.DB, searchColumns ...string) *Gorm[T] {
+	return &Gorm[T]{db: db, searchColumns: searchColumns}
+}
+
+func (r *Gorm[T]) List(ctx context.Context, opts ListOptions) ([]T, error) {
+	query := r.db.WithContext(ctx).Model(new(T))
+	if opts.Search != "" && len(r.searchColumns) > 0 {
+		cond := r.db.Session(&gorm.Session{NewDB: true})
+		for _, column := range r.searchColumns {
+			cond = cond.Or(database.Contains(r.db.Session(&gorm.Session{NewDB: true}), column, opts.Search))
+		}
+		query = query.Where(cond)
+	}
+	for column, value := range opts.Filters {
+		query = query.Where(map[string]interface{}{column: value})
+	}
+	order := opts.Order
+	if order == "" {
+		order = "id"
+	}
+	query = query.Order(order)
+	if opts.Limit > 0 {
+		query = query.Limit(opts.Limit)
+	}
+	if opts.Offset > 0 {
+		query = query.Offset(opts.Offset)
+	}
+	list := make([]T, 0)
+	if err := query.Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *Gorm[T]) Get(ctx context.Context, id int64) (*T, error) {
+	entity := new(T)
+	if err := r.db.WithContext(ctx).First(entity, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+func (r *Gorm[T]) Create(ctx context.Context, entity *T) error {
+	return r.db.WithContext(ctx).Omit("id").Create(entity).Error
+}
+
+func (r *Gorm[T]) Update(ctx context.Context, id int64, entity *T) error {
+	db := r.db.WithContext(ctx)
+	result := db.Model(new(T)).Where("id = ?", id).Omit("id", "created_at").Updates(entity)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	// a fresh value, GORM would also filter on an id the caller left in entity
+	saved := new(T)
+	if err := db.First(saved, "id = ?", id).Error; err != nil {
+		return err
+	}
+	*entity = *saved
+	return nil
+}
+
+func (r *Gorm[T]) Save(ctx context.Context, entity *T) error {
+	return r.db.WithContext(ctx).Save(entity).Error
+}
+
+func (r *Gorm[T]) Delete(ctx context.Context, id int64) error {
+	result := r.db.WithContext(ctx).Delete(new(T), "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"uas/repository"
+	"uas/testutil"
+)
+
+type barang struct {
+	ID       int64
+	Nama     string
+	Kategori string
+	Stok     int
+}
+
+func newRepo(t *testing.T) *repository.Gorm[barang] {
+	db := testutil.OpenDB(t, func(db *gorm.DB) error { return db.AutoMigrate(&barang{}) })
+	db.Create(&[]barang{
+		{Nama: "Pensil", Kategori: "ATK", Stok: 10},
+		{Nama: "Kertas A4", Kategori: "ATK", Stok: 0},
+		{Nama: "Printer", Kategori: "Elektronik", Stok: 2},
+	})
+	return repository.NewGorm[barang](db, "nama", "kategori")
+}
+
+func TestList(t *testing.T) {
+	repo := newRepo(t)
+	tests := []struct {
+		name string
+		opts repository.ListOptions
+		want []string
+	}{
+		{"all by id", repository.ListOptions{}, []string{"Pensil", "Kertas A4", "Printer"}},
+		{"search any column", repository.ListOptions{Search: "elektro"}, []string{"Printer"}},
+		{"search with filter", repository.ListOptions{Search: "atk", Filters: map[string]interface{}{"stok": 0}}, []string{"Kertas A4"}},
+		{"order and page", repository.ListOptions{Order: "nama", Limit: 2, Offset: 1}, []string{"Pensil", "Printer"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := repo.List(context.Background(), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, b := range list {
+				got = append(got, b.Nama)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateUpdateDelete(t *testing.T) {
+	repo := newRepo(t)
+	ctx := context.Background()
+
+	b := barang{ID: 1, Nama: "Spidol", Kategori: "ATK"}
+	if err := repo.Create(ctx, &b); err != nil {
+		t.Fatal(err)
+	}
+	if b.ID != 4 {
+		t.Errorf("created with id %d, the id from the caller must be ignored", b.ID)
+	}
+
+	ubah := barang{ID: 99, Stok: 5}
+	if err := repo.Update(ctx, 4, &ubah); err != nil {
+		t.Fatal(err)
+	}
+	if ubah.ID != 4 || ubah.Nama != "Spidol" || ubah.Stok != 5 {
+		t.Errorf("update returned %+v", ubah)
+	}
+	if err := repo.Update(ctx, 99, &barang{Stok: 1}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("update of a missing id: %v", err)
+	}
+
+	if err := repo.Delete(ctx, 4); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Get(ctx, 4); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get after delete: %v", err)
+	}
+	if err := repo.Delete(ctx, 4); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("second delete: %v", err)
+	}
+}
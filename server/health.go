@@ -0,0 +1,134 @@
+// Package server holds what every service needs around its routes: the
+// /healthz and /readyz probes and Run, which serves until SIGTERM and then
+// shuts down gracefully.
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"uas/api"
+	"uas/apperror"
+	"uas/openapi"
+)
+
+// ProbeTimeout bounds the database checks of one probe.
+const ProbeTimeout = 2 * time.Second
+
+// Check is the outcome of one check, Error is empty when it passed.
+type Check struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Status is the body of /healthz and /readyz.
+type Status struct {
+	Ready  bool             `json:"ready"`
+	Checks map[string]Check `json:"checks"`
+}
+
+type HealthHandler struct {
+	db     *gorm.DB
+	models []interface{}
+}
+
+// NewHealthHandler checks db and that the tables of models exist, i.e. that
+// the migrations of the service have run.
+func NewHealthHandler(db *gorm.DB, models ...interface{}) *HealthHandler {
+	return &HealthHandler{db: db, models: models}
+}
+
+// Status runs the checks.
+func (h *HealthHandler) Status(ctx context.Context) Status {
+	ctx, cancel := context.WithTimeout(ctx, ProbeTimeout)
+	defer cancel()
+
+	status := Status{Ready: true, Checks: map[string]Check{}}
+	catat := func(name string, err error) {
+		if err != nil {
+			status.Ready = false
+			status.Checks[name] = Check{Error: err.Error()}
+			return
+		}
+		status.Checks[name] = Check{OK: true}
+	}
+
+	err := h.ping(ctx)
+	catat("database", err)
+	if err != nil {
+		catat("migrations", fmt.Errorf("database unreachable"))
+		return status
+	}
+	catat("migrations", h.migrated(ctx))
+	return status
+}
+
+func (h *HealthHandler) ping(ctx context.Context) error {
+	sqlDB, err := h.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+func (h *HealthHandler) migrated(ctx context.Context) error {
+	db := h.db.WithContext(ctx)
+	var missing []string
+	for _, model := range h.models {
+		if db.Migrator().HasTable(model) {
+			continue
+		}
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		missing = append(missing, stmt.Table)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing tables: %s", strings.Join(missing, ", "))
+	}
+	return ctx.Err()
+}
+
+// GetHealthz is the liveness probe. The process answering is enough, the
+// checks are reported but never fail it so an outage of the database does
+// not get the service restarted.
+func (h *HealthHandler) GetHealthz(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Alive",
+		"data":    h.Status(ctx.Request().Context()),
+	})
+}
+
+// GetReadyz is the readiness probe, 503 while a check fails.
+func (h *HealthHandler) GetReadyz(ctx echo.Context) error {
+	status := h.Status(ctx.Request().Context())
+	if !status.Ready {
+		return apperror.Unavailable("Not ready").WithData(status)
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Ready",
+		"data":    status,
+	})
+}
+
+// Routes are mounted at the root with api.Root.
+func (h *HealthHandler) Routes() api.Routes {
+	tag := "Health"
+	return api.Routes{
+		{Method: http.MethodGet, Path: "/healthz", Handler: h.GetHealthz, Doc: openapi.Operation{
+			Summary: "Liveness probe", Tag: tag,
+			Description: "Always 200 while the process serves, data shows the database and migration checks.",
+			Data:        Status{}}},
+		{Method: http.MethodGet, Path: "/readyz", Handler: h.GetReadyz, Doc: openapi.Operation{
+			Summary: "Readiness probe", Tag: tag,
+			Description: "503 with the failing checks in data while the database is unreachable or its tables are missing.",
+			Data:        Status{}}},
+	}
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"uas/database"
+)
+
+// ShutdownTimeout is how long in-flight requests get to finish after SIGTERM.
+const ShutdownTimeout = 30 * time.Second
+
+// SignalContext is cancelled on SIGINT or SIGTERM. main uses it for the whole
+// life of the service, so a signal also stops the retries of
+// database.Connect during startup.
+func SignalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// Run serves e on addr until ctx is cancelled, then stops accepting
+// connections, waits up to ShutdownTimeout for the requests in flight and
+// closes the connection pool of db.
+func Run(ctx context.Context, e *echo.Echo, addr string, db *gorm.DB) error {
+	// the banner of Echo is not JSON, Run logs the start itself
+	e.HideBanner, e.HidePort = true, true
+	slog.Info("listening", "addr", addr)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- e.Start(addr)
+	}()
+
+	select {
+	case err := <-errc:
+		// the server never came up, e.g. the port is taken
+		return errors.Join(err, database.Close(db))
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down, draining requests", "timeout", ShutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	err := e.Shutdown(shutdownCtx)
+	if startErr := <-errc; !errors.Is(startErr, http.ErrServerClosed) {
+		err = errors.Join(err, startErr)
+	}
+	return errors.Join(err, database.Close(db))
+}
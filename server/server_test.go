@@ -0,0 +1,139 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"gorm.io/gorm"
+
+	"uas/api"
+	"uas/apperror"
+	"uas/server"
+	"uas/testutil"
+)
+
+type Catatan struct {
+	ID  int64
+	Isi string
+}
+
+type Lain struct {
+	ID int64
+}
+
+func TestHealthHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		models  []interface{}
+		breakDB bool
+		path    string
+		code    int
+		checks  map[string]bool
+	}{
+		{name: "ready", models: []interface{}{&Catatan{}}, path: "/readyz", code: http.StatusOK,
+			checks: map[string]bool{"database": true, "migrations": true}},
+		{name: "not migrated", models: []interface{}{&Catatan{}, &Lain{}}, path: "/readyz", code: http.StatusServiceUnavailable,
+			checks: map[string]bool{"database": true, "migrations": false}},
+		{name: "database down", models: []interface{}{&Catatan{}}, breakDB: true, path: "/readyz", code: http.StatusServiceUnavailable,
+			checks: map[string]bool{"database": false, "migrations": false}},
+		{name: "alive while the database is down", models: []interface{}{&Catatan{}}, breakDB: true, path: "/healthz", code: http.StatusOK,
+			checks: map[string]bool{"database": false, "migrations": false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.OpenDB(t, func(db *gorm.DB) error { return db.AutoMigrate(&Catatan{}) })
+			e := echo.New()
+			e.HTTPErrorHandler = apperror.HTTPErrorHandler
+			e.Use(middleware.RequestID())
+			api.New(e, nil).Root(server.NewHealthHandler(db, tt.models...).Routes())
+			if tt.breakDB {
+				testutil.BreakDB(t, db)
+			}
+
+			res := testutil.NewServer(t, e).Do(http.MethodGet, tt.path, nil).Expect(tt.code)
+			var status server.Status
+			if tt.code == http.StatusOK {
+				res.Data(&status)
+			} else {
+				var p struct{ Data server.Status }
+				res.Decode(&p)
+				status = p.Data
+			}
+			ready := true
+			for name, ok := range tt.checks {
+				ready = ready && ok
+				if got := status.Checks[name]; got.OK != ok || (got.Error == "") != ok {
+					t.Errorf("check %s = %+v, want ok %v", name, got, ok)
+				}
+			}
+			if status.Ready != ready {
+				t.Errorf("ready = %v, want %v", status.Ready, ready)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	db := testutil.OpenDB(t, nil)
+	masuk, lepas := make(chan struct{}), make(chan struct{})
+	e := echo.New()
+	e.HideBanner, e.HidePort = true, true
+	e.GET("/lambat", func(ctx echo.Context) error {
+		close(masuk)
+		<-lepas
+		return ctx.String(http.StatusOK, "selesai")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	selesai := make(chan error, 1)
+	go func() { selesai <- server.Run(ctx, e, "127.0.0.1:0", db) }()
+
+	var addr string
+	for i := 0; addr == "" && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+		if a := e.ListenerAddr(); a != nil {
+			addr = a.String()
+		}
+	}
+	if addr == "" {
+		t.Fatal("server did not start")
+	}
+
+	jawaban := make(chan int, 1)
+	go func() {
+		res, err := http.Get("http://" + addr + "/lambat")
+		if err != nil {
+			t.Error(err)
+			jawaban <- 0
+			return
+		}
+		res.Body.Close()
+		jawaban <- res.StatusCode
+	}()
+	<-masuk
+
+	// SIGTERM arrives while the request is in flight
+	cancel()
+	select {
+	case err := <-selesai:
+		t.Fatalf("Run returned %v before the request finished", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(lepas)
+
+	if code := <-jawaban; code != http.StatusOK {
+		t.Errorf("in-flight request got %d, want 200", code)
+	}
+	if err := <-selesai; err != nil {
+		t.Errorf("Run: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	if err := sqlDB.Ping(); err == nil {
+		t.Error("the connection pool is still open")
+	}
+}
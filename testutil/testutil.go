@@ -0,0 +1,224 @@
+// Package testutil is the harness that tests the handlers of every service
+// through httptest on an in-memory SQLite.
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"uas/apperror"
+	"uas/database"
+	"uas/encryption"
+	"uas/openapi"
+	"uas/outbox"
+)
+
+// Keyring is the fixed encryption key of the tests. init installs it, so the
+// encrypted columns of every test are stored as ciphertext like in
+// production.
+var Keyring = func() *encryption.Keyring {
+	k, err := encryption.NewKeyring("test", map[string][]byte{"test": bytes.Repeat([]byte{1}, encryption.KeySize)}, bytes.Repeat([]byte{2}, encryption.KeySize))
+	if err != nil {
+		panic(err)
+	}
+	return k
+}()
+
+func init() {
+	encryption.Use(Keyring)
+	// tests do not wait for the next outbox poll
+	outbox.Poll = 10 * time.Millisecond
+}
+
+// OpenDB opens a new in-memory SQLite database used only by t and runs
+// migrate on it. The connection is closed when the test ends.
+func OpenDB(t testing.TB, migrate func(*gorm.DB) error) *gorm.DB {
+	t.Helper()
+	db, err := database.Open(database.Config{Driver: database.SQLite, DSN: ":memory:", LogLevel: logger.Silent})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	// every :memory: connection is a database of its own, so the pool has one
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if migrate != nil {
+		if err := migrate(db); err != nil {
+			t.Fatalf("migrate: %v", err)
+		}
+	}
+	return db
+}
+
+// BreakDB closes the connection of db so the next query fails, to test the
+// database error paths of a handler.
+func BreakDB(t testing.TB, db *gorm.DB) {
+	t.Helper()
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("break database: %v", err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		t.Fatalf("break database: %v", err)
+	}
+}
+
+// LoadFixtures reads a JSON file of testdata into dest, a pointer to a slice
+// of models, and saves it to db.
+func LoadFixtures(t testing.TB, db *gorm.DB, name string, dest interface{}) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("read fixture %s: %v", name, err)
+	}
+	if err := json.Unmarshal(data, dest); err != nil {
+		t.Fatalf("decode fixture %s: %v", name, err)
+	}
+	if err := db.Create(dest).Error; err != nil {
+		t.Fatalf("insert fixture %s: %v", name, err)
+	}
+}
+
+// Server runs requests against Echo without opening a port.
+type Server struct {
+	t    testing.TB
+	Echo *echo.Echo
+	// Header is sent with every request, e.g. Authorization.
+	Header http.Header
+}
+
+func NewServer(t testing.TB, e *echo.Echo) *Server {
+	return &Server{t: t, Echo: e, Header: http.Header{}}
+}
+
+// Do sends a request. A string body is sent as it is, to test broken JSON,
+// anything else is encoded as JSON.
+func (s *Server) Do(method, path string, body interface{}) *Response {
+	s.t.Helper()
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			s.t.Fatalf("encode body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if reader != nil {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	for k, v := range s.Header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	s.Echo.ServeHTTP(rec, req)
+	return &Response{t: s.t, Code: rec.Code, Header: rec.Header(), Body: rec.Body.Bytes()}
+}
+
+type Response struct {
+	t      testing.TB
+	Code   int
+	Header http.Header
+	Body   []byte
+}
+
+// Decode reads the body into v and fails the test when it is not JSON.
+func (r *Response) Decode(v interface{}) {
+	r.t.Helper()
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		r.t.Fatalf("decode response %q: %v", r.Body, err)
+	}
+}
+
+// Message returns the "message" field of the body.
+func (r *Response) Message() string {
+	r.t.Helper()
+	var body struct {
+		Message string `json:"message"`
+	}
+	r.Decode(&body)
+	return body.Message
+}
+
+// Data reads the "data" field of the body into v.
+func (r *Response) Data(v interface{}) {
+	r.t.Helper()
+	var body struct {
+		Data json.RawMessage `json:"data"`
+	}
+	r.Decode(&body)
+	if err := json.Unmarshal(body.Data, v); err != nil {
+		r.t.Fatalf("decode data %q: %v", body.Data, err)
+	}
+}
+
+// Problem reads an RFC 7807 error body and checks that its content type is
+// application/problem+json.
+func (r *Response) Problem() apperror.Problem {
+	r.t.Helper()
+	if ct := r.Header.Get(echo.HeaderContentType); ct != apperror.ContentType {
+		r.t.Fatalf("content type = %q, want %q", ct, apperror.ContentType)
+	}
+	var p apperror.Problem
+	r.Decode(&p)
+	if p.Status != r.Code || p.Code == "" || p.RequestID == "" {
+		r.t.Fatalf("incomplete problem %s", r.Body)
+	}
+	return p
+}
+
+// Expect fails the test when the status is not code. An error status must
+// also come with a complete problem+json body.
+func (r *Response) Expect(code int) *Response {
+	r.t.Helper()
+	if r.Code != code {
+		r.t.Fatalf("status = %d, want %d, body %s", r.Code, code, r.Body)
+	}
+	if code >= http.StatusBadRequest {
+		r.Problem()
+	}
+	return r
+}
+
+// CheckOpenAPI fetches /openapi.json and /docs and fails the test for every
+// route that is served but not documented, or the other way around.
+func CheckOpenAPI(t testing.TB, s *Server) openapi.Document {
+	t.Helper()
+	var doc openapi.Document
+	s.Do(http.MethodGet, "/openapi.json", nil).Expect(http.StatusOK).Decode(&doc)
+	if doc.OpenAPI != openapi.Version || doc.Info.Title == "" {
+		t.Fatalf("incomplete document %+v", doc.Info)
+	}
+	for _, d := range openapi.Drift(doc, s.Echo.Routes()) {
+		t.Error(d)
+	}
+	for name, schema := range doc.Components.Schemas {
+		if schema.Type != "object" || len(schema.Properties) == 0 {
+			t.Errorf("schema %s has no properties", name)
+		}
+	}
+	res := s.Do(http.MethodGet, "/docs", nil).Expect(http.StatusOK)
+	if !strings.HasPrefix(res.Header.Get(echo.HeaderContentType), echo.MIMETextHTML) {
+		t.Errorf("/docs content type = %q", res.Header.Get(echo.HeaderContentType))
+	}
+	return doc
+}
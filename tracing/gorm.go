@@ -0,0 +1,98 @@
+package tracing
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const spanKey = "tracing:span"
+
+// Instrument adds a span to every query db runs, a child of the span in the
+// context the query runs with, db.WithContext(ctx.Request().Context()) in a
+// handler.
+func Instrument(db *gorm.DB) error {
+	return db.Use(&plugin{})
+}
+
+// registerer is what Before and After of a GORM callback processor return.
+type registerer interface {
+	Register(name string, fn func(*gorm.DB)) error
+}
+
+type plugin struct{}
+
+func (p *plugin) Name() string {
+	return "tracing"
+}
+
+func (p *plugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	register := func(operation string, before, after registerer) error {
+		if err := before.Register("tracing:before_"+operation, p.start(operation)); err != nil {
+			return err
+		}
+		return after.Register("tracing:after_"+operation, p.end)
+	}
+	return errors.Join(
+		register("create", cb.Create().Before("gorm:create"), cb.Create().After("gorm:create")),
+		register("query", cb.Query().Before("gorm:query"), cb.Query().After("gorm:query")),
+		register("update", cb.Update().Before("gorm:update"), cb.Update().After("gorm:update")),
+		register("delete", cb.Delete().Before("gorm:delete"), cb.Delete().After("gorm:delete")),
+		register("row", cb.Row().Before("gorm:row"), cb.Row().After("gorm:row")),
+		register("raw", cb.Raw().Before("gorm:raw"), cb.Raw().After("gorm:raw")),
+	)
+}
+
+func (p *plugin) start(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+			// a query outside a request, a migration or a gauge, starts no trace
+			return
+		}
+		_, span := tracer().Start(ctx, "gorm."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(system(db.Dialector.Name()), semconv.DBOperation(operation)),
+		)
+		db.InstanceSet(spanKey, span)
+	}
+}
+
+func (p *plugin) end(db *gorm.DB) {
+	v, ok := db.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span, ok := v.(trace.Span)
+	if !ok {
+		return
+	}
+	defer span.End()
+	// the statement with its placeholders, the values stay out of the trace
+	span.SetAttributes(
+		semconv.DBStatement(db.Statement.SQL.String()),
+		semconv.DBSQLTable(db.Statement.Table),
+		attribute.Int64("db.rows_affected", db.RowsAffected),
+	)
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, "query failed")
+	}
+}
+
+func system(dialect string) attribute.KeyValue {
+	switch dialect {
+	case "mysql":
+		return semconv.DBSystemMySQL
+	case "postgres":
+		return semconv.DBSystemPostgreSQL
+	case "sqlite":
+		return semconv.DBSystemSqlite
+	}
+	return semconv.DBSystemKey.String(dialect)
+}
@@ -0,0 +1,32 @@
+package tracing
+
+import (
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// JSONSerializer wraps s, the serializer of an Echo instance, with a span
+// for every body it encodes or decodes: what is left of a request span
+// after its queries and these is the handler itself.
+func JSONSerializer(s echo.JSONSerializer) echo.JSONSerializer {
+	return serializer{s}
+}
+
+type serializer struct {
+	next echo.JSONSerializer
+}
+
+func (s serializer) Serialize(c echo.Context, i interface{}, indent string) error {
+	_, span := tracer().Start(c.Request().Context(), "json.encode")
+	defer span.End()
+	before := c.Response().Size
+	err := s.next.Serialize(c, i, indent)
+	span.SetAttributes(attribute.Int64("http.response.body.size", c.Response().Size-before))
+	return err
+}
+
+func (s serializer) Deserialize(c echo.Context, i interface{}) error {
+	_, span := tracer().Start(c.Request().Context(), "json.decode")
+	defer span.End()
+	return s.next.Deserialize(c, i)
+}
@@ -0,0 +1,56 @@
+package tracing
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"uas/apperror"
+)
+
+// Middleware starts a server span for every request, as a child of the
+// trace context in its headers, and puts it into the request context, the
+// queries and the logs of the handler join it. It goes first, so the span
+// covers the other middleware too.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			req := ctx.Request()
+			parent := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+			route := ctx.Path()
+			spanCtx, span := tracer().Start(parent, req.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(req.Method),
+					semconv.HTTPRoute(route),
+					// the path only, a query string may carry a NIK
+					semconv.URLPath(req.URL.Path),
+					semconv.ClientAddress(ctx.RealIP()),
+					semconv.UserAgentOriginal(req.UserAgent()),
+				),
+			)
+			defer span.End()
+			ctx.SetRequest(req.WithContext(spanCtx))
+
+			err := next(ctx)
+
+			status := ctx.Response().Status
+			if err != nil && !ctx.Response().Committed {
+				status = apperror.From(err).Status
+			}
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+				if err != nil {
+					span.RecordError(err)
+				}
+			}
+			return err
+		}
+	}
+}
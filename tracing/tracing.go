@@ -0,0 +1,98 @@
+// Package tracing records OpenTelemetry spans of a service: one per request,
+// one per query GORM runs and one per JSON body encoded or decoded, so the
+// time of a slow request can be split between the database and the
+// serialization. The trace context of the caller is taken from the
+// traceparent header.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name is the instrumentation scope of the spans.
+const Name = "uas"
+
+// Exporters Setup knows, picked with OTEL_TRACES_EXPORTER.
+const (
+	OTLP   = "otlp"
+	Stdout = "stdout"
+	None   = "none"
+)
+
+// Setup makes a tracer provider the global one of OpenTelemetry and returns
+// the function that flushes and stops it, main calls it after the server
+// stopped. OTEL_TRACES_EXPORTER picks the exporter:
+//   - otlp sends the spans over OTLP/HTTP to OTEL_EXPORTER_OTLP_ENDPOINT
+//     (default http://localhost:4318), the default when that is set;
+//   - stdout writes them as JSON, for development;
+//   - none, the default otherwise, records nothing.
+//
+// The other OTEL_* variables of the SDK apply too, OTEL_SERVICE_NAME
+// overrides service and OTEL_TRACES_SAMPLER picks the sampler.
+func Setup(ctx context.Context, service string) (func(context.Context) error, error) {
+	return setup(ctx, service, os.Stdout)
+}
+
+func setup(ctx context.Context, service string, w io.Writer) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	exporter, err := newExporter(ctx, w)
+	if err != nil || exporter == nil {
+		return func(context.Context) error { return nil }, err
+	}
+	res, err := resource.New(ctx,
+		resource.WithSchemaURL(semconv.SchemaURL),
+		resource.WithAttributes(semconv.ServiceName(service)),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+func newExporter(ctx context.Context, w io.Writer) (sdktrace.SpanExporter, error) {
+	name := strings.ToLower(os.Getenv("OTEL_TRACES_EXPORTER"))
+	if name == "" {
+		name = None
+		if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" {
+			name = OTLP
+		}
+	}
+	switch name {
+	case OTLP:
+		// the endpoint, headers and timeout come from OTEL_EXPORTER_OTLP_*
+		return otlptracehttp.New(ctx)
+	case Stdout, "console":
+		return stdouttrace.New(stdouttrace.WithWriter(w))
+	case None:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown OTEL_TRACES_EXPORTER %q", name)
+	}
+}
+
+// tracer returns the tracer of the global provider at the time of the call,
+// a test can install its own provider after the server was built.
+func tracer() trace.Tracer {
+	return otel.Tracer(Name)
+}
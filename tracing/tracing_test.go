@@ -0,0 +1,214 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+	"gorm.io/gorm"
+
+	"uas/apperror"
+	"uas/testutil"
+	"uas/tracing"
+)
+
+type Catatan struct {
+	ID  int64  `json:"id"`
+	Isi string `json:"isi"`
+}
+
+// reset puts back a provider that records nothing.
+func reset() {
+	otel.SetTracerProvider(noop.NewTracerProvider())
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+}
+
+// record makes a provider recording into the returned recorder the global
+// one for t.
+func record(t *testing.T) *tracetest.SpanRecorder {
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(reset)
+	return rec
+}
+
+func attr(s sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range s.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracing(t *testing.T) {
+	db := testutil.OpenDB(t, func(db *gorm.DB) error { return db.AutoMigrate(&Catatan{}) })
+	if err := tracing.Instrument(db); err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.HTTPErrorHandler = apperror.HTTPErrorHandler
+	e.JSONSerializer = tracing.JSONSerializer(e.JSONSerializer)
+	e.Use(tracing.Middleware())
+	e.Use(middleware.RequestID())
+	e.POST("/catatan", func(ctx echo.Context) error {
+		var c Catatan
+		if err := ctx.Bind(&c); err != nil {
+			return apperror.BadRequest("Invalid body")
+		}
+		if err := db.WithContext(ctx.Request().Context()).Create(&c).Error; err != nil {
+			return apperror.Internal("Failed to Create", err)
+		}
+		return ctx.JSON(http.StatusCreated, c)
+	})
+	e.GET("/catatan", func(ctx echo.Context) error {
+		var rows []Catatan
+		if err := db.WithContext(ctx.Request().Context()).Table(ctx.QueryParam("tabel")).Find(&rows).Error; err != nil {
+			return apperror.Internal("Failed to Find", err)
+		}
+		return ctx.JSON(http.StatusOK, rows)
+	})
+	srv := testutil.NewServer(t, e)
+
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parent  = "00f067aa0ba902b7"
+	)
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		body      interface{}
+		header    string
+		status    int
+		wantSpans []string
+		wantSQL   string
+		failed    bool
+	}{
+		{
+			name: "create joins the trace of the caller", method: http.MethodPost, path: "/catatan",
+			body: Catatan{Isi: "rapat"}, header: "00-" + traceID + "-" + parent + "-01", status: http.StatusCreated,
+			wantSpans: []string{"json.decode", "gorm.create", "json.encode", "POST /catatan"},
+			wantSQL:   "INSERT INTO `catatans` (`isi`) VALUES (?) RETURNING `id`",
+		},
+		{
+			name: "list starts a new trace", method: http.MethodGet, path: "/catatan?tabel=catatans", status: http.StatusOK,
+			wantSpans: []string{"gorm.query", "json.encode", "GET /catatan"},
+			wantSQL:   "SELECT * FROM `catatans`",
+		},
+		{
+			name: "failed query", method: http.MethodGet, path: "/catatan?tabel=tidak_ada", status: http.StatusInternalServerError,
+			wantSpans: []string{"gorm.query", "GET /catatan"},
+			wantSQL:   "SELECT * FROM `tidak_ada`",
+			failed:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := record(t)
+			srv.Header = http.Header{}
+			if tt.header != "" {
+				srv.Header.Set("traceparent", tt.header)
+			}
+			srv.Do(tt.method, tt.path, tt.body).Expect(tt.status)
+
+			spans := rec.Ended()
+			if len(spans) != len(tt.wantSpans) {
+				t.Fatalf("got %d spans, want %v", len(spans), tt.wantSpans)
+			}
+			server := spans[len(spans)-1]
+			for i, s := range spans {
+				if s.Name() != tt.wantSpans[i] {
+					t.Errorf("span %d is %q, want %q", i, s.Name(), tt.wantSpans[i])
+				}
+				if s != server && s.Parent().SpanID() != server.SpanContext().SpanID() {
+					t.Errorf("span %q is not a child of the request", s.Name())
+				}
+			}
+			if tt.header != "" {
+				if got := server.SpanContext().TraceID().String(); got != traceID {
+					t.Errorf("trace id %s, want %s", got, traceID)
+				}
+				if got := server.Parent().SpanID().String(); got != parent {
+					t.Errorf("parent span %s, want %s", got, parent)
+				}
+			} else if server.Parent().IsValid() {
+				t.Errorf("request span has a parent %v", server.Parent())
+			}
+			if got := attr(server, "http.response.status_code").AsInt64(); got != int64(tt.status) {
+				t.Errorf("status code attribute %d, want %d", got, tt.status)
+			}
+			if got := attr(server, "http.route").AsString(); got != "/catatan" {
+				t.Errorf("route attribute %q", got)
+			}
+			if got := (server.Status().Code == codes.Error); got != tt.failed {
+				t.Errorf("request span failed %v, want %v", got, tt.failed)
+			}
+
+			query := spans[0]
+			if tt.method == http.MethodPost {
+				query = spans[1]
+			}
+			if got := attr(query, "db.statement").AsString(); got != tt.wantSQL {
+				t.Errorf("statement %q, want %q", got, tt.wantSQL)
+			}
+			if got := attr(query, "db.system").AsString(); got != "sqlite" {
+				t.Errorf("db.system %q", got)
+			}
+			if got := (query.Status().Code == codes.Error); got != tt.failed {
+				t.Errorf("query span failed %v, want %v", got, tt.failed)
+			}
+		})
+	}
+
+	t.Run("no span outside a request", func(t *testing.T) {
+		rec := record(t)
+		if err := db.Find(&[]Catatan{}).Error; err != nil {
+			t.Fatal(err)
+		}
+		if n := len(rec.Ended()); n != 0 {
+			t.Errorf("got %d spans", n)
+		}
+	})
+}
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		name     string
+		exporter string
+		endpoint string
+		wantErr  bool
+	}{
+		{name: "none by default"},
+		{name: "otlp when an endpoint is set", endpoint: "http://localhost:4318"},
+		{name: "stdout", exporter: "stdout"},
+		{name: "unknown exporter", exporter: "zipkin", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_TRACES_EXPORTER", tt.exporter)
+			t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", tt.endpoint)
+			t.Cleanup(reset)
+
+			shutdown, err := tracing.Setup(context.Background(), "test")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if err := shutdown(context.Background()); err != nil {
+					t.Errorf("shutdown: %v", err)
+				}
+			}
+		})
+	}
+}